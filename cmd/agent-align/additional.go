@@ -7,7 +7,7 @@ import (
 	"strings"
 
 	"agent-align/internal/config"
-	"github.com/tidwall/jsonc"
+	"agent-align/internal/jsoncdoc"
 )
 
 func buildAdditionalJSONContent(target config.AdditionalJSONTarget, servers map[string]interface{}) (string, error) {
@@ -103,38 +103,29 @@ func buildAdditionalJSONCContent(target config.AdditionalJSONTarget, servers map
 		return marshalJSON(servers)
 	}
 
-	root, err := loadJSONCFile(target.FilePath)
+	doc, err := loadJSONCDocument(target.FilePath)
 	if err != nil {
 		return "", err
 	}
 
-	mergeJSONValue(root, pathSegments, servers)
-	return marshalJSON(root)
+	// Replace only the value at the path so comments and formatting in the
+	// rest of the file are left alone.
+	data, err := doc.Set(pathSegments, servers)
+	if err != nil {
+		return "", fmt.Errorf("failed to update %s: %w", target.FilePath, err)
+	}
+	return string(data), nil
 }
 
-func loadJSONCFile(path string) (map[string]interface{}, error) {
+func loadJSONCDocument(path string) (*jsoncdoc.Document, error) {
 	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return make(map[string]interface{}), nil
-		}
+	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to read %s: %w", path, err)
 	}
 
-	trimmed := strings.TrimSpace(string(data))
-	if trimmed == "" {
-		return make(map[string]interface{}), nil
-	}
-
-	// Convert JSONC to JSON by stripping comments
-	normalized := jsonc.ToJSON(data)
-
-	var out map[string]interface{}
-	if err := json.Unmarshal(normalized, &out); err != nil {
+	doc, err := jsoncdoc.Parse(data)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse JSONC from %s: %w", path, err)
 	}
-	if out == nil {
-		out = make(map[string]interface{})
-	}
-	return out, nil
+	return doc, nil
 }
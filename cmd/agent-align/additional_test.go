@@ -5,9 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"agent-align/internal/config"
+	"github.com/tidwall/jsonc"
 )
 
 func TestJSONPathSegments(t *testing.T) {
@@ -120,8 +122,8 @@ func TestBuildAdditionalJSONCContent_MergesWithExisting(t *testing.T) {
 	}
 
 	var parsed map[string]interface{}
-	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
-		t.Fatalf("output is not valid JSON: %v", err)
+	if err := json.Unmarshal(jsonc.ToJSON([]byte(content)), &parsed); err != nil {
+		t.Fatalf("output is not valid JSONC: %v", err)
 	}
 	if _, ok := parsed["keep"]; !ok {
 		t.Fatal("expected existing keys to be preserved")
@@ -129,6 +131,9 @@ func TestBuildAdditionalJSONCContent_MergesWithExisting(t *testing.T) {
 	if _, ok := parsed["mcpServers"]; !ok {
 		t.Fatal("expected new node to be inserted")
 	}
+	if !strings.Contains(content, "// This is a comment") {
+		t.Fatalf("expected comments to be preserved:\n%s", content)
+	}
 }
 
 func TestBuildAdditionalJSONCContent_RootPath(t *testing.T) {
@@ -178,8 +183,8 @@ func TestBuildAdditionalJSONCContent_WithBlockComments(t *testing.T) {
 	}
 
 	var parsed map[string]interface{}
-	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
-		t.Fatalf("output is not valid JSON: %v", err)
+	if err := json.Unmarshal(jsonc.ToJSON([]byte(content)), &parsed); err != nil {
+		t.Fatalf("output is not valid JSONC: %v", err)
 	}
 	if _, ok := parsed["existing"]; !ok {
 		t.Fatal("expected existing keys to be preserved")
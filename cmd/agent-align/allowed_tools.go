@@ -13,20 +13,19 @@ import (
 	"agent-align/internal/config"
 )
 
-// generateCopilotWrapper creates wrapper scripts for each copilot agent at
-// their specified paths (or ~/.local/bin by default) that pre-approves
-// the configured allowed tools before invoking the real copilot CLI.
-func generateCopilotWrapper(cfg config.Config) error {
+// planCopilotWrapper renders the wrapper script for each copilot agent. No
+// wrappers are planned when copilot is not installed.
+func planCopilotWrapper(cfg config.Config) ([]plannedFile, error) {
 	if len(cfg.AllowedTools.AlwaysAllowedTools) == 0 {
 		// No allowed tools configured, skip wrapper generation
-		return nil
+		return nil, nil
 	}
 
 	// Find the real copilot binary
 	copilotPath, err := exec.LookPath("copilot")
 	if err != nil {
 		// Copilot not installed, skip silently
-		return nil
+		return nil, nil
 	}
 
 	// Build the wrapper script content once
@@ -35,11 +34,12 @@ func generateCopilotWrapper(cfg config.Config) error {
 	// Get home directory for default path
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
 	defaultBinDir := filepath.Join(homeDir, ".local", "bin")
 
-	// Generate wrapper for each configured copilot agent
+	// Plan a wrapper for each configured copilot agent
+	var files []plannedFile
 	for _, agent := range cfg.AllowedTools.Targets.Agents {
 		if agent.Name != "copilot" {
 			continue
@@ -51,19 +51,17 @@ func generateCopilotWrapper(cfg config.Config) error {
 			binDir = agent.Path
 		}
 
-		// Create bin directory if it doesn't exist
-		if err := os.MkdirAll(binDir, 0o755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", binDir, err)
-		}
-
-		// Write the wrapper script with agent name as filename
-		wrapperPath := filepath.Join(binDir, "acp")
-		if err := os.WriteFile(wrapperPath, []byte(script), 0o755); err != nil {
-			return fmt.Errorf("failed to write wrapper script to %s: %w", wrapperPath, err)
-		}
+		files = append(files, plannedFile{
+			Category: categoryAllowedTools,
+			Label:    "Allowed tools [copilot]",
+			Agent:    "copilot",
+			Path:     filepath.Join(binDir, "acp"),
+			Content:  []byte(script),
+			Mode:     0o755,
+		})
 	}
 
-	return nil
+	return files, nil
 }
 
 // convertToolToClaudePermission converts a tool string like "shell(git fetch)"
@@ -76,19 +74,20 @@ func convertToolToClaudePermission(tool string) string {
 	return tool
 }
 
-// generateClaudePermissions merges allowed tools into the Claude settings.json
-// by replacing the permissions.allow node while preserving other nodes.
-func generateClaudePermissions(cfg config.Config) error {
+// planClaudePermissions renders the updated settings.json for each Claude
+// agent.
+func planClaudePermissions(cfg config.Config) ([]plannedFile, error) {
 	if len(cfg.AllowedTools.AlwaysAllowedTools) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
 	defaultPath := filepath.Join(homeDir, ".claude", "settings.json")
 
+	var files []plannedFile
 	for _, agent := range cfg.AllowedTools.Targets.Agents {
 		if agent.Name != "claude" {
 			continue
@@ -127,18 +126,23 @@ func generateClaudePermissions(cfg config.Config) error {
 
 		data, err := json.MarshalIndent(existing, "", "  ")
 		if err != nil {
-			return fmt.Errorf("failed to marshal Claude settings: %w", err)
+			return nil, fmt.Errorf("failed to marshal Claude settings: %w", err)
 		}
 
-		if err := os.MkdirAll(filepath.Dir(settingsPath), 0o755); err != nil {
-			return fmt.Errorf("failed to create directory for %s: %w", settingsPath, err)
-		}
-		if err := os.WriteFile(settingsPath, append(data, '\n'), 0o644); err != nil {
-			return fmt.Errorf("failed to write Claude settings to %s: %w", settingsPath, err)
-		}
+		files = append(files, plannedFile{
+			Category:    categoryAllowedTools,
+			Label:       "Allowed tools [claude]",
+			Agent:       "claudecode",
+			Path:        settingsPath,
+			Content:     append(data, '\n'),
+			Mode:        0o644,
+			Merge:       true,
+			ManagedPath: []string{"permissions", "allow"},
+			Tools:       allowList,
+		})
 	}
 
-	return nil
+	return files, nil
 }
 
 // convertToolToCodexRule converts a tool string like "shell(git fetch)"
@@ -156,19 +160,19 @@ func convertToolToCodexRule(tool string) string {
 	return tool
 }
 
-// generateCodexRules overwrites a Codex rules file with prefix_rule entries
-// derived from the configured allowed tools.
-func generateCodexRules(cfg config.Config) error {
+// planCodexRules renders the rules file for each Codex agent.
+func planCodexRules(cfg config.Config) ([]plannedFile, error) {
 	if len(cfg.AllowedTools.AlwaysAllowedTools) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
 	defaultPath := filepath.Join(homeDir, ".codex", "instructions.md")
 
+	var files []plannedFile
 	for _, agent := range cfg.AllowedTools.Targets.Agents {
 		if agent.Name != "codex" {
 			continue
@@ -180,20 +184,26 @@ func generateCodexRules(cfg config.Config) error {
 		}
 
 		var sb strings.Builder
+		rules := make([]string, 0, len(cfg.AllowedTools.AlwaysAllowedTools))
 		for _, tool := range cfg.AllowedTools.AlwaysAllowedTools {
-			sb.WriteString(convertToolToCodexRule(tool))
+			rule := convertToolToCodexRule(tool)
+			rules = append(rules, rule)
+			sb.WriteString(rule)
 			sb.WriteByte('\n')
 		}
 
-		if err := os.MkdirAll(filepath.Dir(rulesPath), 0o755); err != nil {
-			return fmt.Errorf("failed to create directory for %s: %w", rulesPath, err)
-		}
-		if err := os.WriteFile(rulesPath, []byte(sb.String()), 0o644); err != nil {
-			return fmt.Errorf("failed to write Codex rules to %s: %w", rulesPath, err)
-		}
+		files = append(files, plannedFile{
+			Category: categoryAllowedTools,
+			Label:    "Allowed tools [codex]",
+			Agent:    "codex",
+			Path:     rulesPath,
+			Content:  []byte(sb.String()),
+			Mode:     0o644,
+			Tools:    rules,
+		})
 	}
 
-	return nil
+	return files, nil
 }
 
 // convertClaudePermissionToTool converts a Claude permission string like
@@ -302,6 +312,28 @@ func importCodexTools(rulesPath string) ([]string, error) {
 	return tools, nil
 }
 
+// exportAllowedTools prints the allowed tools collected from the targets in
+// the config at configPath. With -output json they are printed as a bare
+// array; failures are still reported in an allowed-tools document.
+func exportAllowedTools(out *output, configPath string) error {
+	doc := &allowedToolsDocument{outputHeader: outputHeader{Command: "export-allowed-tools"}, AllowedTools: []string{}}
+	data, err := config.Load(configPath)
+	if err != nil {
+		return out.finish(doc, categorize(errorConfig, fmt.Errorf("failed to load config %q: %w", configPath, err)))
+	}
+	tools, err := collectAllowedTools(data)
+	if err != nil {
+		return out.finish(doc, fmt.Errorf("failed to export allowed tools: %w", err))
+	}
+	if out.json() {
+		return out.writeList(append([]string{}, tools...))
+	}
+	for _, tool := range tools {
+		fmt.Fprintln(out.w, "- "+tool)
+	}
+	return nil
+}
+
 // collectAllowedTools reads the allowed-tools files referenced by each Claude
 // and Codex target in cfg, combines the results, deduplicates, and sorts them
 // alphabetically. Copilot targets are skipped.
@@ -57,21 +57,21 @@ func TestBuildWrapperScriptEscapesQuotes(t *testing.T) {
 	}
 }
 
-func TestGenerateCopilotWrapperWithNoTools(t *testing.T) {
+func TestPlanCopilotWrapperWithNoTools(t *testing.T) {
 	cfg := config.Config{
 		AllowedTools: config.AllowedToolsConfig{
 			AlwaysAllowedTools: []string{},
 		},
 	}
 
-	// Should return nil error when no tools are configured
-	err := generateCopilotWrapper(cfg)
-	if err != nil {
-		t.Errorf("should not error when no tools are configured, got: %v", err)
+	// Nothing is planned when no tools are configured
+	files, err := planCopilotWrapper(cfg)
+	if err != nil || len(files) != 0 {
+		t.Errorf("expected nothing to write when no tools are configured, got %v (err %v)", files, err)
 	}
 }
 
-func TestGenerateCopilotWrapperCopilotNotFound(t *testing.T) {
+func TestPlanCopilotWrapperCopilotNotFound(t *testing.T) {
 	cfg := config.Config{
 		AllowedTools: config.AllowedToolsConfig{
 			AlwaysAllowedTools: []string{"shell(git fetch)"},
@@ -81,7 +81,7 @@ func TestGenerateCopilotWrapperCopilotNotFound(t *testing.T) {
 	// When copilot is not found in PATH, should return nil silently
 	// This is tested implicitly by the fact that exec.LookPath returns an error
 	// and we handle it gracefully
-	err := generateCopilotWrapper(cfg)
+	_, err := planCopilotWrapper(cfg)
 	if err != nil {
 		// Should be nil since we skip silently when copilot is not found
 		t.Errorf("should skip silently when copilot is not found, got: %v", err)
@@ -128,20 +128,20 @@ func TestConvertToolToCodexRule(t *testing.T) {
 	}
 }
 
-func TestGenerateClaudePermissionsWithNoTools(t *testing.T) {
+func TestPlanClaudePermissionsWithNoTools(t *testing.T) {
 	cfg := config.Config{
 		AllowedTools: config.AllowedToolsConfig{
 			AlwaysAllowedTools: []string{},
 		},
 	}
 
-	err := generateClaudePermissions(cfg)
-	if err != nil {
-		t.Errorf("should not error when no tools are configured, got: %v", err)
+	files, err := planClaudePermissions(cfg)
+	if err != nil || len(files) != 0 {
+		t.Errorf("expected nothing to write when no tools are configured, got %v (err %v)", files, err)
 	}
 }
 
-func TestGenerateClaudePermissionsWritesFile(t *testing.T) {
+func TestPlanClaudePermissionsWritesFile(t *testing.T) {
 	dir := t.TempDir()
 	settingsPath := filepath.Join(dir, "settings.json")
 
@@ -156,10 +156,11 @@ func TestGenerateClaudePermissionsWritesFile(t *testing.T) {
 		},
 	}
 
-	err := generateClaudePermissions(cfg)
+	files, err := planClaudePermissions(cfg)
 	if err != nil {
-		t.Fatalf("generateClaudePermissions returned error: %v", err)
+		t.Fatalf("planClaudePermissions returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	data, err := os.ReadFile(settingsPath)
 	if err != nil {
@@ -192,7 +193,7 @@ func TestGenerateClaudePermissionsWritesFile(t *testing.T) {
 	}
 }
 
-func TestGenerateClaudePermissionsMergesExistingConfig(t *testing.T) {
+func TestPlanClaudePermissionsMergesExistingConfig(t *testing.T) {
 	dir := t.TempDir()
 	settingsPath := filepath.Join(dir, "settings.json")
 
@@ -219,10 +220,11 @@ func TestGenerateClaudePermissionsMergesExistingConfig(t *testing.T) {
 		},
 	}
 
-	err := generateClaudePermissions(cfg)
+	files, err := planClaudePermissions(cfg)
 	if err != nil {
-		t.Fatalf("generateClaudePermissions returned error: %v", err)
+		t.Fatalf("planClaudePermissions returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	data, err := os.ReadFile(settingsPath)
 	if err != nil {
@@ -254,20 +256,20 @@ func TestGenerateClaudePermissionsMergesExistingConfig(t *testing.T) {
 	}
 }
 
-func TestGenerateCodexRulesWithNoTools(t *testing.T) {
+func TestPlanCodexRulesWithNoTools(t *testing.T) {
 	cfg := config.Config{
 		AllowedTools: config.AllowedToolsConfig{
 			AlwaysAllowedTools: []string{},
 		},
 	}
 
-	err := generateCodexRules(cfg)
-	if err != nil {
-		t.Errorf("should not error when no tools are configured, got: %v", err)
+	files, err := planCodexRules(cfg)
+	if err != nil || len(files) != 0 {
+		t.Errorf("expected nothing to write when no tools are configured, got %v (err %v)", files, err)
 	}
 }
 
-func TestGenerateCodexRulesWritesFile(t *testing.T) {
+func TestPlanCodexRulesWritesFile(t *testing.T) {
 	dir := t.TempDir()
 	rulesPath := filepath.Join(dir, "agent-align.rules")
 
@@ -282,10 +284,11 @@ func TestGenerateCodexRulesWritesFile(t *testing.T) {
 		},
 	}
 
-	err := generateCodexRules(cfg)
+	files, err := planCodexRules(cfg)
 	if err != nil {
-		t.Fatalf("generateCodexRules returned error: %v", err)
+		t.Fatalf("planCodexRules returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	data, err := os.ReadFile(rulesPath)
 	if err != nil {
@@ -301,7 +304,7 @@ func TestGenerateCodexRulesWritesFile(t *testing.T) {
 	}
 }
 
-func TestGenerateCodexRulesOverwritesFile(t *testing.T) {
+func TestPlanCodexRulesOverwritesFile(t *testing.T) {
 	dir := t.TempDir()
 	rulesPath := filepath.Join(dir, "agent-align.rules")
 
@@ -321,10 +324,11 @@ func TestGenerateCodexRulesOverwritesFile(t *testing.T) {
 		},
 	}
 
-	err := generateCodexRules(cfg)
+	files, err := planCodexRules(cfg)
 	if err != nil {
-		t.Fatalf("generateCodexRules returned error: %v", err)
+		t.Fatalf("planCodexRules returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	data, err := os.ReadFile(rulesPath)
 	if err != nil {
@@ -790,7 +794,7 @@ func TestCollectAllowedToolsDefaultPathsUsedWhenNoPathSet(t *testing.T) {
 	}
 }
 
-func TestGenerateCopilotWrapperSkipsNonCopilotAgents(t *testing.T) {
+func TestPlanCopilotWrapperSkipsNonCopilotAgents(t *testing.T) {
 	dir := t.TempDir()
 	claudePath := filepath.Join(dir, "settings.json")
 	codexPath := filepath.Join(dir, "rules.txt")
@@ -807,18 +811,17 @@ func TestGenerateCopilotWrapperSkipsNonCopilotAgents(t *testing.T) {
 		},
 	}
 
-	// generateCopilotWrapper should skip claude and codex agents
-	err := generateCopilotWrapper(cfg)
+	// planCopilotWrapper should skip claude and codex agents
+	files, err := planCopilotWrapper(cfg)
 	if err != nil {
 		t.Errorf("should not error for non-copilot agents, got: %v", err)
 	}
 
-	// No files should be created for claude/codex by the copilot wrapper
-	if _, err := os.Stat(claudePath); err == nil {
-		t.Error("generateCopilotWrapper should not create files for claude agents")
-	}
-	if _, err := os.Stat(codexPath); err == nil {
-		t.Error("generateCopilotWrapper should not create files for codex agents")
+	// No files should be planned for claude/codex by the copilot wrapper
+	for _, file := range files {
+		if file.Path == claudePath || file.Path == codexPath {
+			t.Errorf("planCopilotWrapper should not plan %s", file.Path)
+		}
 	}
 }
 
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"agent-align/internal/backup"
+	"agent-align/internal/fileutil"
+)
+
+// Changes reported per file in the apply summary.
+const (
+	changeCreated   = "created"
+	changeUpdated   = "updated"
+	changeUnchanged = "unchanged"
+	changeRemoved   = "removed"
+)
+
+// applyResult is the outcome of applying a plan.
+type applyResult struct {
+	Written   []plannedFile // files created, updated, or removed
+	Unchanged []plannedFile // files whose content already matched
+	Errors    []string
+	counts    map[string]map[string]int // category -> change -> files
+	changes   map[string]string         // path -> change
+}
+
+func (r *applyResult) count(file plannedFile, change string) {
+	if r.counts == nil {
+		r.counts = make(map[string]map[string]int)
+		r.changes = make(map[string]string)
+	}
+	if r.counts[file.Category] == nil {
+		r.counts[file.Category] = make(map[string]int)
+	}
+	r.counts[file.Category][change]++
+	r.changes[file.Path] = change
+	if change == changeUnchanged {
+		r.Unchanged = append(r.Unchanged, file)
+	} else {
+		r.Written = append(r.Written, file)
+	}
+}
+
+func (r *applyResult) fail(redact *redactor, msg string) {
+	msg = redact.String(msg)
+	log.Print(msg)
+	r.Errors = append(r.Errors, msg)
+}
+
+// printSummary writes the updated, unchanged, and created counts for each
+// category that had files.
+func (r *applyResult) printSummary(w io.Writer) {
+	if len(r.counts) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nSummary:")
+	for _, category := range planCategories {
+		counts, ok := r.counts[category]
+		if !ok {
+			continue
+		}
+		line := fmt.Sprintf("%d updated, %d unchanged, %d created", counts[changeUpdated], counts[changeUnchanged], counts[changeCreated])
+		if counts[changeRemoved] > 0 {
+			line += fmt.Sprintf(", %d removed", counts[changeRemoved])
+		}
+		fmt.Fprintf(w, "  %-25s %s\n", categoryTitles[category], line)
+	}
+}
+
+// fileChange tells how applying file would change its destination.
+func fileChange(file plannedFile) (string, error) {
+	current, err := os.ReadFile(file.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if file.Delete {
+			return changeUnchanged, nil
+		}
+		return changeCreated, nil
+	case err != nil:
+		return "", fmt.Errorf("failed to read %s: %w", file.Path, err)
+	case file.Delete:
+		return changeRemoved, nil
+	case bytes.Equal(current, file.Content):
+		return changeUnchanged, nil
+	default:
+		return changeUpdated, nil
+	}
+}
+
+// applyFiles writes files one at a time, backing each up into run first.
+// Files whose content already matches the disk are left alone. A destination
+// that changed since the plan was rendered is rendered again with replan. A
+// file that fails is reported and skipped; the others are still written.
+func applyFiles(w io.Writer, files []plannedFile, run *backup.Run, redact *redactor, replan replanFunc) applyResult {
+	var result applyResult
+	for _, file := range files {
+		file, err := refreshIfChanged(w, file, replan)
+		if err != nil {
+			result.fail(redact, fmt.Sprintf("error writing %s: %v", file.Label, err))
+			continue
+		}
+		if file.Category == categoryArchives && !file.Delete && !file.Frozen {
+			// Rebuild archives at write time so they include files copied
+			// by extra targets earlier in this run.
+			content, err := renderZipArchive(file.Source)
+			if err != nil {
+				result.fail(redact, fmt.Sprintf("error archiving %s: %v", file.Source, err))
+				continue
+			}
+			file.Content = content
+		}
+		change, err := fileChange(file)
+		if err != nil {
+			result.fail(redact, fmt.Sprintf("error writing %s: %v", file.Label, err))
+			continue
+		}
+		if change == changeUnchanged {
+			result.count(file, change)
+			continue
+		}
+		if err := run.Save(file.Path); err != nil {
+			result.fail(redact, fmt.Sprintf("error backing up %s, not writing it: %v", file.Path, err))
+			continue
+		}
+		if err := writePlannedFile(file); err != nil {
+			result.fail(redact, fmt.Sprintf("error writing %s: %v", file.Label, err))
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %s\n", appliedVerb(file), file.Path)
+		result.count(file, change)
+	}
+	return result
+}
+
+// applyFilesAtomic writes files all or nothing. Every changed file is staged
+// next to its destination first, after rendering it again with replan if the
+// destination changed; nothing is replaced unless all of them staged. If a
+// destination changes again before it is replaced, or replacing one fails,
+// the files already replaced are restored from run.
+func applyFilesAtomic(w io.Writer, files []plannedFile, run *backup.Run, redact *redactor, replan replanFunc) applyResult {
+	abort := func(msg string) applyResult {
+		msg = redact.String(msg)
+		log.Print(msg)
+		return applyResult{Errors: []string{msg, "atomic apply aborted; no files were changed"}}
+	}
+
+	files = append([]plannedFile(nil), files...)
+	for i := range files {
+		file, err := refreshIfChanged(w, files[i], replan)
+		if err != nil {
+			return abort(fmt.Sprintf("error writing %s: %v", file.Label, err))
+		}
+		files[i] = file
+	}
+
+	// Render archives before anything is staged, overlaying the files this
+	// run is about to write so the archives match the committed result.
+	pending := make(map[string][]byte)
+	for _, file := range files {
+		if file.Category != categoryArchives && !file.Delete {
+			pending[filepath.Clean(file.Path)] = file.Content
+		}
+	}
+	for i, file := range files {
+		if file.Category != categoryArchives || file.Delete || file.Frozen {
+			continue
+		}
+		content, err := renderZipArchiveWith(file.Source, pending)
+		if err != nil {
+			return abort(fmt.Sprintf("error archiving %s: %v", file.Source, err))
+		}
+		files[i].Content = content
+	}
+
+	// Files that already match the disk take no part in the transaction.
+	var result applyResult
+	var changes []string
+	var changed []plannedFile
+	for _, file := range files {
+		change, err := fileChange(file)
+		if err != nil {
+			return abort(fmt.Sprintf("error writing %s: %v", file.Label, err))
+		}
+		if change == changeUnchanged {
+			result.count(file, change)
+			continue
+		}
+		changed = append(changed, file)
+		changes = append(changes, change)
+	}
+	files = changed
+
+	staged := make([]*fileutil.Staged, 0, len(files))
+	discard := func() {
+		for _, s := range staged {
+			if s != nil {
+				s.Discard()
+			}
+		}
+	}
+	for _, file := range files {
+		if err := run.Save(file.Path); err != nil {
+			discard()
+			return abort(fmt.Sprintf("error backing up %s, not writing it: %v", file.Path, err))
+		}
+		if file.Delete {
+			// Removals have nothing to stage and happen at commit time.
+			staged = append(staged, nil)
+			continue
+		}
+		s, err := stagePlannedFile(file)
+		if err != nil {
+			discard()
+			return abort(fmt.Sprintf("error writing %s: %v", file.Label, err))
+		}
+		staged = append(staged, s)
+	}
+
+	for i, s := range staged {
+		err := checkUnchanged(files[i])
+		if err == nil && s == nil {
+			err = removePlannedFile(files[i])
+		} else if err == nil {
+			err = s.Commit()
+		}
+		if err != nil {
+			discard()
+			msg := redact.String(fmt.Sprintf("error writing %s: %v", files[i].Label, err))
+			log.Print(msg)
+			return applyResult{Errors: append([]string{msg}, rollback(files[:i], run)...)}
+		}
+	}
+	for i, file := range files {
+		fmt.Fprintf(w, "  %s: %s\n", appliedVerb(file), file.Path)
+		result.count(file, changes[i])
+	}
+	return result
+}
+
+// rollback restores files from the copies saved in run, newest first, and
+// returns a message describing the outcome.
+func rollback(files []plannedFile, run *backup.Run) []string {
+	var errs []string
+	for i := len(files) - 1; i >= 0; i-- {
+		entry, ok := run.Entry(files[i].Path)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("error rolling back %s: no backup was saved", files[i].Path))
+			continue
+		}
+		if err := run.Restore(entry); err != nil {
+			errs = append(errs, fmt.Sprintf("error rolling back %s: %v", files[i].Path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return append(errs, fmt.Sprintf("atomic apply failed and could not be fully rolled back; see agent-align restore -run %s", run.ID))
+	}
+	return []string{fmt.Sprintf("atomic apply failed; rolled back %d files already written", len(files))}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyFilesAtomicWritesNothingWhenStagingFails(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	if err := os.WriteFile(good, []byte("before"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	// A regular file where a parent directory is expected makes staging fail.
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	plan := syncPlan{Files: []plannedFile{
+		{Category: categoryAgents, Label: "Good", Path: good, Content: []byte("after"), Mode: 0o644},
+		{Category: categoryExtra, Label: "Bad", Path: filepath.Join(blocker, "bad.json"), Content: []byte("x"), Mode: 0o644},
+	}}
+	markBaseHashes(&plan, nil)
+
+	var out bytes.Buffer
+	result := applyFilesAtomic(&out, plan.Files, backupStore().Begin("sync"), nil, nil)
+	if len(result.Written) != 0 || len(result.Errors) == 0 {
+		t.Fatalf("expected failure with nothing written, got %d written and %v", len(result.Written), result.Errors)
+	}
+	if !strings.Contains(result.Errors[len(result.Errors)-1], "no files were changed") {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	}
+	if data, _ := os.ReadFile(good); string(data) != "before" {
+		t.Fatalf("expected good.json untouched, got %q", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("expected staged files to be discarded, found %d entries", len(entries))
+	}
+}
+
+func TestApplyFilesAtomicArchivesIncludePendingFiles(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	source := filepath.Join(dir, "skills", "demo")
+	if err := os.MkdirAll(source, 0o755); err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "a.md"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	zipPath := filepath.Join(dir, "demo.zip")
+	files := []plannedFile{
+		{Category: categoryExtra, Label: "Copy", Path: filepath.Join(source, "b.md"), Content: []byte("b"), Mode: 0o644},
+		{Category: categoryArchives, Label: "Archive", Path: zipPath, Source: source, Mode: 0o644},
+	}
+
+	var out bytes.Buffer
+	result := applyFilesAtomic(&out, files, backupStore().Begin("sync"), nil, nil)
+	if len(result.Errors) != 0 || len(result.Written) != 2 {
+		t.Fatalf("expected both files written, got %d and %v", len(result.Written), result.Errors)
+	}
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer reader.Close()
+	var names []string
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+		if f.Name == "b.md" {
+			rc, _ := f.Open()
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(data) != "b" {
+				t.Fatalf("unexpected b.md content %q", data)
+			}
+		}
+	}
+	if strings.Join(names, ",") != "a.md,b.md" {
+		t.Fatalf("unexpected archive entries: %v", names)
+	}
+}
+
+func TestRollbackRestoresCommittedFiles(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.json")
+	created := filepath.Join(dir, "created.json")
+	if err := os.WriteFile(existing, []byte("before"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	run := backupStore().Begin("sync")
+	files := []plannedFile{{Path: existing}, {Path: created}}
+	for _, file := range files {
+		if err := run.Save(file.Path); err != nil {
+			t.Fatalf("Save returned error: %v", err)
+		}
+		if err := os.WriteFile(file.Path, []byte("after"), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	msgs := rollback(files, run)
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "rolled back 2 files") {
+		t.Fatalf("unexpected rollback messages: %v", msgs)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "before" {
+		t.Fatalf("expected existing.json restored, got %q", data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Fatalf("expected created.json removed, got %v", err)
+	}
+}
+
+func TestApplyFilesSkipsUnchangedFiles(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	same := filepath.Join(dir, "same.json")
+	changed := filepath.Join(dir, "changed.json")
+	for _, path := range []string{same, changed} {
+		if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(same, old, old); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+	plan := syncPlan{Files: []plannedFile{
+		{Category: categoryAgents, Label: "Same", Path: same, Content: []byte("old"), Mode: 0o644},
+		{Category: categoryAgents, Label: "Changed", Path: changed, Content: []byte("new"), Mode: 0o644},
+		{Category: categoryExtra, Label: "New", Path: filepath.Join(dir, "new.md"), Content: []byte("new"), Mode: 0o644},
+	}}
+	markBaseHashes(&plan, nil)
+	if !planHasChanges(plan) {
+		t.Fatal("expected plan to have changes")
+	}
+
+	var out bytes.Buffer
+	run := backupStore().Begin("sync")
+	result := applyFiles(&out, plan.Files, run, nil, nil)
+	if len(result.Errors) != 0 || len(result.Written) != 2 || len(result.Unchanged) != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if info, err := os.Stat(same); err != nil || !info.ModTime().Equal(old) {
+		t.Fatalf("expected unchanged file to keep its mtime, got %v (err %v)", info.ModTime(), err)
+	}
+	if _, ok := run.Entry(same); ok {
+		t.Fatal("expected unchanged file not to be backed up")
+	}
+
+	out.Reset()
+	result.printSummary(&out)
+	for _, want := range []string{"Agents:" + strings.Repeat(" ", 19) + "1 updated, 1 unchanged, 0 created", "Extra copy targets:" + strings.Repeat(" ", 7) + "0 updated, 0 unchanged, 1 created"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in summary:\n%s", want, out.String())
+		}
+	}
+
+	markBaseHashes(&plan, nil)
+	if planHasChanges(plan) {
+		t.Fatal("expected no changes after applying the plan")
+	}
+}
+
+// applyPlanned writes files through applyFiles, the path every command uses,
+// with backups kept in a temporary state directory. It fails the test on any
+// error and returns the files that were written.
+func applyPlanned(t *testing.T, files []plannedFile) []plannedFile {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	plan := syncPlan{Files: files}
+	markBaseHashes(&plan, nil)
+	result := applyFiles(io.Discard, plan.Files, backupStore().Begin("sync"), nil, nil)
+	if len(result.Errors) > 0 {
+		t.Fatalf("applyFiles returned errors: %v", result.Errors)
+	}
+	return result.Written
+}
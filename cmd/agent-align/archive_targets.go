@@ -2,65 +2,83 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"agent-align/internal/config"
 )
 
-// archiveSubdirectories creates a zip archive for each immediate subdirectory of
-// target.Source, placing the resulting zip files in target.Destination. Each zip
-// file is named after its source directory (e.g. "mydir" → "mydir.zip") and
-// contains the full recursive contents of that directory.
-func archiveSubdirectories(target config.ArchiveTarget) (int, error) {
+// planArchiveTarget renders the zip archive for each immediate subdirectory
+// of target.Source in memory.
+func planArchiveTarget(target config.ArchiveTarget) ([]plannedFile, error) {
 	sourceInfo, err := os.Stat(target.Source)
 	if err != nil {
-		return 0, fmt.Errorf("failed to inspect %s: %w", target.Source, err)
+		return nil, fmt.Errorf("failed to inspect %s: %w", target.Source, err)
 	}
 	if !sourceInfo.IsDir() {
-		return 0, fmt.Errorf("archive source %s is not a directory", target.Source)
+		return nil, fmt.Errorf("archive source %s is not a directory", target.Source)
 	}
 
 	entries, err := os.ReadDir(target.Source)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read directory %s: %w", target.Source, err)
+		return nil, fmt.Errorf("failed to read directory %s: %w", target.Source, err)
 	}
 
-	if err := os.MkdirAll(target.Destination, 0o755); err != nil {
-		return 0, fmt.Errorf("failed to create destination directory %s: %w", target.Destination, err)
-	}
-
-	var count int
+	var files []plannedFile
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
 		}
 		dirPath := filepath.Join(target.Source, entry.Name())
 		zipPath := filepath.Join(target.Destination, entry.Name()+".zip")
-		if err := createZipArchive(dirPath, zipPath); err != nil {
-			return count, fmt.Errorf("failed to archive %s to %s: %w", dirPath, zipPath, err)
+		content, err := renderZipArchive(dirPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to archive %s to %s: %w", dirPath, zipPath, err)
 		}
-		count++
+		files = append(files, plannedFile{
+			Category: categoryArchives,
+			Label:    "Archive",
+			Path:     zipPath,
+			Source:   dirPath,
+			Content:  content,
+			Mode:     0o644,
+		})
 	}
-	return count, nil
+	return files, nil
 }
 
-// createZipArchive writes the recursive contents of the directory at source into
-// a new zip file at zipPath. File paths inside the zip are relative to source.
-func createZipArchive(source, zipPath string) error {
-	out, err := os.Create(zipPath)
-	if err != nil {
-		return fmt.Errorf("failed to create zip file %s: %w", zipPath, err)
-	}
-	defer out.Close()
+// renderZipArchive builds a zip of the recursive contents of source. Entries
+// carry no timestamps, so unchanged directories produce identical bytes.
+func renderZipArchive(source string) ([]byte, error) {
+	return renderZipArchiveWith(source, nil)
+}
 
-	w := zip.NewWriter(out)
-	defer w.Close()
+// renderZipArchiveWith is renderZipArchive with pending, keyed by path,
+// standing in for files that are about to be written under source.
+func renderZipArchiveWith(source string, pending map[string][]byte) ([]byte, error) {
+	source = filepath.Clean(source)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	add := func(rel string, content io.Reader) error {
+		f, err := w.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return fmt.Errorf("failed to create zip entry %s: %w", rel, err)
+		}
+		if _, err := io.Copy(f, content); err != nil {
+			return fmt.Errorf("failed to write zip entry %s: %w", rel, err)
+		}
+		return nil
+	}
 
-	return filepath.WalkDir(source, func(path string, entry fs.DirEntry, walkErr error) error {
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
@@ -72,10 +90,9 @@ func createZipArchive(source, zipPath string) error {
 		if err != nil {
 			return err
 		}
-
-		f, err := w.Create(filepath.ToSlash(rel))
-		if err != nil {
-			return fmt.Errorf("failed to create zip entry %s: %w", rel, err)
+		if content, ok := pending[path]; ok {
+			seen[path] = true
+			return add(rel, bytes.NewReader(content))
 		}
 
 		in, err := os.Open(path)
@@ -83,10 +100,30 @@ func createZipArchive(source, zipPath string) error {
 			return fmt.Errorf("failed to open source file %s: %w", path, err)
 		}
 		defer in.Close()
+		return add(rel, in)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		if _, err := io.Copy(f, in); err != nil {
-			return fmt.Errorf("failed to write zip entry %s: %w", rel, err)
+	// Pending files that do not exist yet go after the ones on disk.
+	var added []string
+	for path := range pending {
+		rel, err := filepath.Rel(source, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || seen[path] {
+			continue
 		}
-		return nil
-	})
+		added = append(added, rel)
+	}
+	sort.Strings(added)
+	for _, rel := range added {
+		if err := add(rel, bytes.NewReader(pending[filepath.Join(source, rel)])); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish zip archive: %w", err)
+	}
+	return buf.Bytes(), nil
 }
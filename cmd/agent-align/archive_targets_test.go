@@ -2,6 +2,7 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,7 +11,7 @@ import (
 	"agent-align/internal/config"
 )
 
-func TestArchiveSubdirectoriesBasic(t *testing.T) {
+func TestPlanArchiveTargetBasic(t *testing.T) {
 	dir := t.TempDir()
 	source := filepath.Join(dir, "src")
 	dest := filepath.Join(dir, "dest")
@@ -30,11 +31,11 @@ func TestArchiveSubdirectoriesBasic(t *testing.T) {
 	}
 
 	target := config.ArchiveTarget{Source: source, Destination: dest}
-	count, err := archiveSubdirectories(target)
+	files, err := planArchiveTarget(target)
 	if err != nil {
-		t.Fatalf("archiveSubdirectories returned error: %v", err)
+		t.Fatalf("planArchiveTarget returned error: %v", err)
 	}
-	if count != 2 {
+	if count := len(applyPlanned(t, files)); count != 2 {
 		t.Fatalf("expected 2 zip files, got %d", count)
 	}
 
@@ -45,7 +46,7 @@ func TestArchiveSubdirectoriesBasic(t *testing.T) {
 	}
 }
 
-func TestArchiveSubdirectoriesSkipsFiles(t *testing.T) {
+func TestPlanArchiveTargetSkipsFiles(t *testing.T) {
 	dir := t.TempDir()
 	source := filepath.Join(dir, "src")
 	dest := filepath.Join(dir, "dest")
@@ -62,11 +63,11 @@ func TestArchiveSubdirectoriesSkipsFiles(t *testing.T) {
 	}
 
 	target := config.ArchiveTarget{Source: source, Destination: dest}
-	count, err := archiveSubdirectories(target)
+	files, err := planArchiveTarget(target)
 	if err != nil {
-		t.Fatalf("archiveSubdirectories returned error: %v", err)
+		t.Fatalf("planArchiveTarget returned error: %v", err)
 	}
-	if count != 1 {
+	if count := len(applyPlanned(t, files)); count != 1 {
 		t.Fatalf("expected 1 zip file, got %d", count)
 	}
 
@@ -80,7 +81,7 @@ func TestArchiveSubdirectoriesSkipsFiles(t *testing.T) {
 	}
 }
 
-func TestArchiveSubdirectoriesZipContents(t *testing.T) {
+func TestPlanArchiveTargetZipContents(t *testing.T) {
 	dir := t.TempDir()
 	source := filepath.Join(dir, "src")
 	dest := filepath.Join(dir, "dest")
@@ -96,9 +97,11 @@ func TestArchiveSubdirectoriesZipContents(t *testing.T) {
 	}
 
 	target := config.ArchiveTarget{Source: source, Destination: dest}
-	if _, err := archiveSubdirectories(target); err != nil {
-		t.Fatalf("archiveSubdirectories returned error: %v", err)
+	files, err := planArchiveTarget(target)
+	if err != nil {
+		t.Fatalf("planArchiveTarget returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	// Read the zip and verify its contents
 	zipPath := filepath.Join(dest, "mydir.zip")
@@ -120,7 +123,7 @@ func TestArchiveSubdirectoriesZipContents(t *testing.T) {
 	}
 }
 
-func TestArchiveSubdirectoriesSourceNotDirectory(t *testing.T) {
+func TestPlanArchiveTargetSourceNotDirectory(t *testing.T) {
 	dir := t.TempDir()
 	file := filepath.Join(dir, "file.txt")
 	if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
@@ -128,7 +131,7 @@ func TestArchiveSubdirectoriesSourceNotDirectory(t *testing.T) {
 	}
 
 	target := config.ArchiveTarget{Source: file, Destination: filepath.Join(dir, "dest")}
-	_, err := archiveSubdirectories(target)
+	_, err := planArchiveTarget(target)
 	if err == nil {
 		t.Fatal("expected error for non-directory source")
 	}
@@ -137,7 +140,7 @@ func TestArchiveSubdirectoriesSourceNotDirectory(t *testing.T) {
 	}
 }
 
-func TestArchiveSubdirectoriesCreatesDestination(t *testing.T) {
+func TestPlanArchiveTargetCreatesDestination(t *testing.T) {
 	dir := t.TempDir()
 	source := filepath.Join(dir, "src")
 	dest := filepath.Join(dir, "new", "nested", "dest")
@@ -147,27 +150,28 @@ func TestArchiveSubdirectoriesCreatesDestination(t *testing.T) {
 	}
 
 	target := config.ArchiveTarget{Source: source, Destination: dest}
-	_, err := archiveSubdirectories(target)
+	files, err := planArchiveTarget(target)
 	if err != nil {
-		t.Fatalf("archiveSubdirectories returned error: %v", err)
+		t.Fatalf("planArchiveTarget returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	if _, err := os.Stat(dest); err != nil {
 		t.Errorf("expected destination directory to be created: %v", err)
 	}
 }
 
-func TestCreateZipArchiveEmpty(t *testing.T) {
-	dir := t.TempDir()
-	source := filepath.Join(dir, "empty")
+func TestRenderZipArchiveEmpty(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "empty")
 	if err := os.MkdirAll(source, 0o755); err != nil {
 		t.Fatalf("failed to create dir: %v", err)
 	}
-	zipPath := filepath.Join(dir, "empty.zip")
-	if err := createZipArchive(source, zipPath); err != nil {
-		t.Fatalf("createZipArchive returned error: %v", err)
+	content, err := renderZipArchive(source)
+	if err != nil {
+		t.Fatalf("renderZipArchive returned error: %v", err)
 	}
-	if _, err := os.Stat(zipPath); err != nil {
-		t.Errorf("expected zip file to exist: %v", err)
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil || len(r.File) != 0 {
+		t.Fatalf("expected an empty zip, got %v (err %v)", r, err)
 	}
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Exit codes reported by the check command.
+const (
+	checkExitInSync = 0
+	checkExitError  = 1
+	checkExitDrift  = 2
+	checkExitUsage  = 64 // invalid flags, as for every command's usage errors
+)
+
+// File states reported by the check command.
+const (
+	statusInSync   = "in-sync"
+	statusModified = "modified"
+	statusMissing  = "missing"
+)
+
+// checkReport is the machine-readable result of the check command. Its exit
+// code is the one check exits with.
+type checkReport struct {
+	outputHeader
+	InSync bool         `json:"inSync"`
+	Files  []checkEntry `json:"files"`
+}
+
+type checkEntry struct {
+	Category string `json:"category"`
+	Path     string `json:"path"`
+	Status   string `json:"status"`
+}
+
+// runCheckCommand renders the same plan as a sync and compares it with the
+// files on disk without writing anything. It returns checkExitDrift when any
+// file differs and checkExitError when part of the plan could not be built.
+func runCheckCommand(args []string, stdout io.Writer) (int, error) {
+	checkFlags := flag.NewFlagSet("check", flag.ContinueOnError)
+	configPath := checkFlags.String("config", defaultConfigPath(), "path to YAML configuration file describing target agents and overrides")
+	mcpConfigPath := checkFlags.String("mcp-config", "", "path to YAML file that defines MCP servers (defaults to agent-align-mcp.yml next to the target config)")
+	agents := checkFlags.String("agents", "", "comma-separated list of agents to check (defaults to the agents in the config)")
+	profile := checkFlags.String("profile", "", "name of the profile in the MCP definitions file to apply")
+	strictEnv := checkFlags.Bool("strict-env", false, "fail when an MCP definition references an unset environment variable")
+	failOnLossy := checkFlags.Bool("fail-on-lossy", false, "fail the agents whose servers would lose configuration they cannot represent instead of only warning")
+	jsonOutput := checkFlags.Bool("json", false, "print the result as JSON (same as -output json)")
+	outputFormat := addOutputFlag(checkFlags)
+	if err := checkFlags.Parse(args); err != nil {
+		// The flag package already printed the error and usage.
+		if errors.Is(err, flag.ErrHelp) {
+			return checkExitInSync, nil
+		}
+		return checkExitUsage, nil
+	}
+	if *jsonOutput {
+		*outputFormat = outputJSON
+	}
+	out, err := newOutput(*outputFormat, stdout)
+	if err != nil {
+		log.Print(err)
+		return checkExitUsage, nil
+	}
+	report := checkReport{outputHeader: outputHeader{Command: "check"}, InSync: true, Files: []checkEntry{}}
+
+	rc, err := loadRun(runOptions{
+		ConfigPath:    *configPath,
+		MCPConfigPath: *mcpConfigPath,
+		Agents:        *agents,
+		Profile:       *profile,
+		StrictEnv:     *strictEnv,
+		FailOnLossy:   *failOnLossy,
+	})
+	if err != nil {
+		return checkExitError, out.finish(&report, categorize(errorConfig, err))
+	}
+	plan, err := rc.plan()
+	if err != nil {
+		return checkExitError, out.finish(&report, err)
+	}
+
+	for _, msg := range plan.Errors {
+		report.addError(errorTarget, msg)
+	}
+	for _, file := range plan.Files {
+		status, err := fileStatus(file)
+		if err != nil {
+			report.addError(errorInternal, err.Error())
+			continue
+		}
+		if status != statusInSync {
+			report.InSync = false
+		}
+		report.Files = append(report.Files, checkEntry{Category: file.Category, Path: file.Path, Status: status})
+	}
+
+	code := checkExitInSync
+	switch {
+	case len(report.Errors) > 0:
+		code = checkExitError
+	case !report.InSync:
+		code = checkExitDrift
+	}
+	if !out.json() {
+		printCheckReport(stdout, report)
+		return code, nil
+	}
+	report.ExitCode = code
+	if err := out.write(&report); err != nil {
+		return checkExitError, err
+	}
+	return code, nil
+}
+
+func printCheckReport(w io.Writer, report checkReport) {
+	drifted := 0
+	for _, entry := range report.Files {
+		if entry.Status == statusInSync {
+			continue
+		}
+		if drifted == 0 {
+			fmt.Fprintln(w, "Drifted files:")
+		}
+		drifted++
+		fmt.Fprintf(w, "  %s: %s (%s)\n", entry.Category, entry.Path, entry.Status)
+	}
+	if len(report.Errors) > 0 {
+		fmt.Fprintln(w, "Errors:")
+		for _, e := range report.Errors {
+			fmt.Fprintf(w, "  - %s\n", e.Message)
+		}
+	}
+	if drifted == 0 {
+		fmt.Fprintf(w, "All %d files are in sync.\n", len(report.Files))
+		return
+	}
+	fmt.Fprintf(w, "%d of %d files have drifted. Run agent-align to update them.\n", drifted, len(report.Files))
+}
+
+// fileStatus compares a planned file with the copy on disk.
+func fileStatus(file plannedFile) (string, error) {
+	current, err := os.ReadFile(file.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return statusMissing, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file.Path, err)
+	}
+	if !bytes.Equal(current, file.Content) {
+		return statusModified, nil
+	}
+	return statusInSync, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCheckFixture creates a config that syncs one server to a VS Code
+// target and an additional JSON file inside dir.
+func writeCheckFixture(t *testing.T, dir string) string {
+	t.Helper()
+	mcpPath := filepath.Join(dir, "mcp.yml")
+	if err := os.WriteFile(mcpPath, []byte("servers:\n  fs:\n    command: npx\n"), 0o644); err != nil {
+		t.Fatalf("failed to write MCP config: %v", err)
+	}
+	configPath := filepath.Join(dir, "agent-align.yml")
+	content := `mcpServers:
+  configPath: ` + mcpPath + `
+  targets:
+    agents:
+      - name: vscode
+        path: ` + filepath.Join(dir, "vscode.json") + `
+    additionalTargets:
+      json:
+        - filePath: ` + filepath.Join(dir, "extra.json") + `
+          jsonPath: .mcpServers
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return configPath
+}
+
+func TestRunCheckCommandReportsDrift(t *testing.T) {
+	dir := t.TempDir()
+	configPath := writeCheckFixture(t, dir)
+
+	var out bytes.Buffer
+	code, err := runCheckCommand([]string{"-config", configPath}, &out)
+	if err != nil {
+		t.Fatalf("runCheckCommand returned error: %v", err)
+	}
+	if code != checkExitDrift {
+		t.Fatalf("expected drift exit code for missing files, got %d:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "vscode.json (missing)") {
+		t.Fatalf("expected missing file in output:\n%s", out.String())
+	}
+
+	// Apply the plan, then the check should pass.
+	rc, err := loadRun(runOptions{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("loadRun returned error: %v", err)
+	}
+	plan, err := rc.plan()
+	if err != nil {
+		t.Fatalf("plan returned error: %v", err)
+	}
+	for _, file := range plan.Files {
+		if err := writePlannedFile(file); err != nil {
+			t.Fatalf("writePlannedFile returned error: %v", err)
+		}
+	}
+	out.Reset()
+	code, err = runCheckCommand([]string{"-config", configPath}, &out)
+	if err != nil || code != checkExitInSync {
+		t.Fatalf("expected files to be in sync, got code %d err %v:\n%s", code, err, out.String())
+	}
+	if !strings.Contains(out.String(), "All 2 files are in sync.") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	// A hand edit shows up as a modified file in the JSON report.
+	if err := os.WriteFile(filepath.Join(dir, "extra.json"), []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("failed to edit file: %v", err)
+	}
+	out.Reset()
+	code, err = runCheckCommand([]string{"-config", configPath, "-json"}, &out)
+	if err != nil || code != checkExitDrift {
+		t.Fatalf("expected drift, got code %d err %v", code, err)
+	}
+	var report checkReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out.String())
+	}
+	if report.InSync || len(report.Files) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Files[1].Status != statusModified || report.Files[1].Category != categoryAdditional {
+		t.Fatalf("expected additional target to be modified, got %+v", report.Files[1])
+	}
+	if report.Files[0].Status != statusInSync {
+		t.Fatalf("expected agent file to stay in sync, got %+v", report.Files[0])
+	}
+}
+
+func TestRunCheckCommandPlanErrors(t *testing.T) {
+	dir := t.TempDir()
+	configPath := writeCheckFixture(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "extra.json"), []byte("{broken"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	var out bytes.Buffer
+	code, err := runCheckCommand([]string{"-config", configPath}, &out)
+	if err != nil {
+		t.Fatalf("runCheckCommand returned error: %v", err)
+	}
+	if code != checkExitError {
+		t.Fatalf("expected error exit code, got %d", code)
+	}
+	if !strings.Contains(out.String(), "error preparing additional JSON") {
+		t.Fatalf("expected plan error in output:\n%s", out.String())
+	}
+}
+
+func TestRunCheckCommandUsageErrorsDoNotLookLikeDrift(t *testing.T) {
+	for _, args := range [][]string{{"-no-such-flag"}, {"-output", "xml"}} {
+		code, err := runCheckCommand(args, &bytes.Buffer{})
+		if err != nil || code != checkExitUsage || code == checkExitDrift {
+			t.Fatalf("%v: expected usage exit code %d, got %d (%v)", args, checkExitUsage, code, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"agent-align/internal/state"
+	"agent-align/internal/syncer"
+	"github.com/tidwall/jsonc"
+)
+
+// maxRemerges is how often a file that changed on disk after it was rendered
+// is rendered again before agent-align gives up on it.
+const maxRemerges = 3
+
+// replanFunc renders the plan again from the files currently on disk.
+type replanFunc func() (syncPlan, error)
+
+// markBaseHashes records the hash of each destination as it was when the plan
+// was rendered, and flags destinations edited since agent-align last wrote
+// them according to st. Merged files count as edited only when the content
+// agent-align manages in them changed.
+func markBaseHashes(plan *syncPlan, st *state.State) {
+	for i, file := range plan.Files {
+		current, err := os.ReadFile(file.Path)
+		if err != nil {
+			continue
+		}
+		plan.Files[i].BaseHash = state.Hash(current)
+		if st == nil || file.Delete || bytes.Equal(current, file.Content) {
+			continue
+		}
+		if record, ok := st.Lookup(file.Path); ok {
+			plan.Files[i].Edited = editedSince(file, record, current)
+		}
+	}
+}
+
+// editedSince reports whether current, the destination of file, differs
+// from what agent-align recorded writing there.
+func editedSince(file plannedFile, record state.File, current []byte) bool {
+	if !file.Merge || (record.ManagedHash == "" && file.Category != categoryAgents) {
+		return record.Hash != "" && record.Hash != state.Hash(current)
+	}
+	if record.ManagedHash == "" {
+		return false
+	}
+	hash, err := managedHash(file, record.Servers, current)
+	return err == nil && hash != record.ManagedHash
+}
+
+// managedHash hashes the content agent-align manages in data, the content of
+// the merged file: the servers named in managed for an agent file, or the
+// node at the file's ManagedPath for other JSON files. Agents reformat their
+// files and write their own settings into them, so only this content is
+// compared.
+func managedHash(file plannedFile, managed []string, data []byte) (string, error) {
+	var owned interface{}
+	if file.Category == categoryAgents {
+		cfg := syncer.AgentConfig{Name: file.Agent, FilePath: file.Path, NodeName: file.Node, Format: file.Format}
+		servers, err := syncer.ParseServers(cfg, data)
+		if err != nil {
+			return "", err
+		}
+		named := make(map[string]interface{}, len(managed))
+		for _, name := range managed {
+			if server, ok := servers[name]; ok {
+				named[name] = server
+			}
+		}
+		owned = named
+	} else {
+		if err := json.Unmarshal(jsonc.ToJSON(data), &owned); err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", file.Path, err)
+		}
+		for _, key := range file.ManagedPath {
+			node, _ := owned.(map[string]interface{})
+			owned = node[key]
+		}
+	}
+	encoded, err := json.Marshal(owned)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash managed servers of %s: %w", file.Path, err)
+	}
+	return state.Hash(encoded), nil
+}
+
+// skipsEdited reports whether file is left alone without -force.
+func skipsEdited(file plannedFile) bool {
+	return file.Edited
+}
+
+// editedWarning describes a destination edited since the last run. It returns
+// "" when there is nothing to report.
+func editedWarning(file plannedFile, force bool) string {
+	switch {
+	case !file.Edited:
+		return ""
+	case force:
+		return fmt.Sprintf("%s was edited since the last agent-align run; overwriting it because of -force", file.Path)
+	}
+	return fmt.Sprintf("%s was edited since the last agent-align run; skipping it (use -force to overwrite)", file.Path)
+}
+
+// skipEdited splits off the files edited since the last run so they are not
+// overwritten without -force.
+func skipEdited(files []plannedFile) (keep []plannedFile, skipped []string) {
+	for _, file := range files {
+		if skipsEdited(file) {
+			skipped = append(skipped, editedSkipMessage(file))
+			continue
+		}
+		keep = append(keep, file)
+	}
+	return keep, skipped
+}
+
+func editedSkipMessage(file plannedFile) string {
+	return fmt.Sprintf("skipped %s: edited since the last agent-align run (use -force to overwrite)", file.Path)
+}
+
+// forceReplan wraps replan so files it renders again are written even when
+// they were edited since the last run, as -force asks.
+func forceReplan(replan replanFunc) replanFunc {
+	return func() (syncPlan, error) {
+		plan, err := replan()
+		for i := range plan.Files {
+			plan.Files[i].Edited = false
+		}
+		return plan, err
+	}
+}
+
+// currentHash returns the hash of the file at path, or "" when it is missing.
+func currentHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return state.Hash(data), nil
+}
+
+// refreshIfChanged re-reads the destination of file right before it is
+// written. When it no longer matches what the plan was rendered from, the
+// file is rendered again with replan so the new edits are merged instead of
+// overwritten. A re-rendered file that skipEdited would skip is not written.
+func refreshIfChanged(w io.Writer, file plannedFile, replan replanFunc) (plannedFile, error) {
+	for attempt := 0; ; attempt++ {
+		err := checkUnchanged(file)
+		if err == nil || replan == nil || attempt == maxRemerges {
+			return file, err
+		}
+		plan, err := replan()
+		if err != nil {
+			return file, fmt.Errorf("failed to merge changes to %s: %w", file.Path, err)
+		}
+		fresh, ok := findPlannedFile(plan, file.Path)
+		if !ok {
+			return file, fmt.Errorf("%s changed on disk and is no longer part of the plan", file.Path)
+		}
+		if skipsEdited(fresh) {
+			return file, errors.New(editedSkipMessage(fresh))
+		}
+		fmt.Fprintf(w, "  Re-merged: %s (changed on disk)\n", file.Path)
+		file = fresh
+	}
+}
+
+// checkUnchanged reports an error when the destination of file no longer
+// matches what the plan was rendered from.
+func checkUnchanged(file plannedFile) error {
+	current, err := currentHash(file.Path)
+	if err != nil {
+		return err
+	}
+	if current != file.BaseHash {
+		return fmt.Errorf("%s changed on disk after it was rendered; run agent-align again to merge the changes", file.Path)
+	}
+	return nil
+}
+
+func findPlannedFile(plan syncPlan, path string) (plannedFile, bool) {
+	for _, file := range plan.Files {
+		if file.Path == path {
+			return file, true
+		}
+	}
+	return plannedFile{}, false
+}
+
+// planHasChanges reports whether applying plan would change any file.
+// Archives are compared as rendered at plan time.
+func planHasChanges(plan syncPlan) bool {
+	for _, file := range plan.Files {
+		if change, err := fileChange(file); err != nil || change != changeUnchanged {
+			return true
+		}
+	}
+	return false
+}
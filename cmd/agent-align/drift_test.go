@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent-align/internal/backup"
+	"agent-align/internal/state"
+)
+
+func TestMarkBaseHashesFlagsFilesEditedSinceLastRun(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	edited := filepath.Join(dir, "edited.json")
+	untouched := filepath.Join(dir, "untouched.json")
+	for _, path := range []string{edited, untouched} {
+		if err := os.WriteFile(path, []byte("written"), 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	st, _ := state.Load(statePath())
+	st.Record(stateRun("sync", &backup.Run{ID: "1"}, []plannedFile{
+		{Category: categoryExtra, Path: edited, Content: []byte("written")},
+		{Category: categoryExtra, Path: untouched, Content: []byte("written")},
+	}))
+	if err := os.WriteFile(edited, []byte("by hand"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	plan := syncPlan{Files: []plannedFile{
+		{Category: categoryExtra, Path: edited, Content: []byte("new")},
+		{Category: categoryExtra, Path: untouched, Content: []byte("new")},
+		{Category: categoryExtra, Path: filepath.Join(dir, "missing.json"), Content: []byte("new")},
+	}}
+	markBaseHashes(&plan, st)
+	if !plan.Files[0].Edited || plan.Files[1].Edited || plan.Files[2].Edited {
+		t.Fatalf("expected only the hand-edited file to be flagged, got %+v", plan.Files)
+	}
+	if plan.Files[0].BaseHash != state.Hash([]byte("by hand")) || plan.Files[2].BaseHash != "" {
+		t.Fatalf("unexpected base hashes %+v", plan.Files)
+	}
+
+	keep, skipped := skipEdited(plan.Files)
+	if len(keep) != 2 || len(skipped) != 1 || !strings.Contains(skipped[0], "-force") {
+		t.Fatalf("expected the edited file to be skipped, got %d kept and %v", len(keep), skipped)
+	}
+}
+
+func TestMarkBaseHashesComparesOnlyManagedServersOfAgentFiles(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "claude.json")
+	written := `{"mcpServers": {"fs": {"command": "npx"}}, "theme": "dark"}`
+	if err := os.WriteFile(path, []byte(written), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	st, _ := state.Load(statePath())
+	st.Record(stateRun("sync", &backup.Run{ID: "1"}, []plannedFile{
+		{Category: categoryAgents, Agent: "claudecode", Format: "json", Node: "mcpServers", Path: path, Content: []byte(written), Servers: []string{"fs"}, Merge: true},
+	}))
+	planned := plannedFile{Category: categoryAgents, Agent: "claudecode", Format: "json", Node: "mcpServers", Path: path, Content: []byte("new"), Servers: []string{"fs"}, Merge: true}
+
+	// Claude rewrites the file with its own settings and key order.
+	rewritten := `{
+  "numStartups": 12,
+  "mcpServers": {"fs": {"command": "npx"}, "mine": {"command": "other"}},
+  "theme": "light"
+}`
+	if err := os.WriteFile(path, []byte(rewritten), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	plan := syncPlan{Files: []plannedFile{planned}}
+	markBaseHashes(&plan, st)
+	if plan.Files[0].Edited {
+		t.Fatal("expected edits outside the managed servers not to count")
+	}
+
+	edited := `{"mcpServers": {"fs": {"command": "uvx"}}}`
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	plan = syncPlan{Files: []plannedFile{planned}}
+	markBaseHashes(&plan, st)
+	if !plan.Files[0].Edited {
+		t.Fatal("expected an edited managed server to be flagged")
+	}
+	keep, skipped := skipEdited(plan.Files)
+	if len(keep) != 0 || len(skipped) != 1 || !strings.Contains(skipped[0], "-force") {
+		t.Fatalf("expected the edited agent file to be skipped, got %d kept and %v", len(keep), skipped)
+	}
+}
+
+func TestMarkBaseHashesComparesOnlyManagedNodeOfMergedJSON(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "settings.json")
+	written := `{"model": "opus", "permissions": {"allow": ["Read"]}}`
+	if err := os.WriteFile(path, []byte(written), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	planned := plannedFile{Category: categoryAllowedTools, Agent: "claudecode", Path: path, Content: []byte(written), Merge: true, ManagedPath: []string{"permissions", "allow"}}
+	st, _ := state.Load(statePath())
+	st.Record(stateRun("sync", &backup.Run{ID: "1"}, []plannedFile{planned}))
+	planned.Content = []byte("new")
+
+	if err := os.WriteFile(path, []byte(`{"model": "sonnet", "permissions": {"allow": ["Read"], "deny": ["Write"]}}`), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	plan := syncPlan{Files: []plannedFile{planned}}
+	markBaseHashes(&plan, st)
+	if plan.Files[0].Edited {
+		t.Fatal("expected edits outside the managed node not to count")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"model": "opus", "permissions": {"allow": ["Read", "Bash"]}}`), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	plan = syncPlan{Files: []plannedFile{planned}}
+	markBaseHashes(&plan, st)
+	if keep, skipped := skipEdited(plan.Files); len(keep) != 0 || len(skipped) != 1 {
+		t.Fatalf("expected the edited permissions to be skipped, got %d kept and %v", len(keep), skipped)
+	}
+}
+
+func TestApplyFilesRemergesFilesChangedBeforeWrite(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, []byte("rendered from"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	plan := syncPlan{Files: []plannedFile{{Category: categoryExtra, Label: "Extra file", Path: path, Content: []byte("stale"), Mode: 0o644}}}
+	markBaseHashes(&plan, nil)
+
+	// Another program writes the file between rendering and writing.
+	if err := os.WriteFile(path, []byte("changed meanwhile"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	replans := 0
+	replan := func() (syncPlan, error) {
+		replans++
+		fresh := syncPlan{Files: []plannedFile{{Category: categoryExtra, Label: "Extra file", Path: path, Content: []byte("merged"), Mode: 0o644}}}
+		markBaseHashes(&fresh, nil)
+		return fresh, nil
+	}
+
+	var out bytes.Buffer
+	result := applyFiles(&out, plan.Files, backupStore().Begin("sync"), nil, replan)
+	if len(result.Errors) != 0 || len(result.Written) != 1 || replans != 1 {
+		t.Fatalf("expected one re-merge and a write, got %d replans, %d written, %v", replans, len(result.Written), result.Errors)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "merged" {
+		t.Fatalf("expected re-merged content, got %q", data)
+	}
+	if !strings.Contains(out.String(), "Re-merged: "+path) {
+		t.Fatalf("expected re-merge note:\n%s", out.String())
+	}
+
+	// Without replan a changed file is left alone.
+	if err := os.WriteFile(path, []byte("changed again"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	result = applyFiles(&out, plan.Files, backupStore().Begin("sync"), nil, nil)
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "changed on disk") {
+		t.Fatalf("expected changed-on-disk error, got %v", result.Errors)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "changed again" {
+		t.Fatalf("expected the file to be left alone, got %q", data)
+	}
+}
+
+func TestRefreshIfChangedSkipsFilesEditedBeforeRemerge(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(path, []byte("rendered from"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	file := plannedFile{Category: categoryExtra, Label: "Extra file", Path: path, Content: []byte("new"), Mode: 0o644}
+	plan := syncPlan{Files: []plannedFile{file}}
+	markBaseHashes(&plan, nil)
+	if err := os.WriteFile(path, []byte("by hand"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	replan := func() (syncPlan, error) {
+		fresh := file
+		fresh.BaseHash = state.Hash([]byte("by hand"))
+		fresh.Edited = true
+		return syncPlan{Files: []plannedFile{fresh}}, nil
+	}
+
+	var out bytes.Buffer
+	if _, err := refreshIfChanged(&out, plan.Files[0], replan); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Fatalf("expected the edited file to be skipped, got %v", err)
+	}
+	if refreshed, err := refreshIfChanged(&out, plan.Files[0], forceReplan(replan)); err != nil || refreshed.Edited {
+		t.Fatalf("expected -force to re-merge the edited file, got %+v, %v", refreshed, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
@@ -69,44 +70,58 @@ func matchGlob(pattern, path string) bool {
 	return matched
 }
 
-func copyExtraFileTarget(target config.ExtraFileTarget, configDir string, mcpServers map[string]interface{}) error {
+// planExtraFileTarget renders the content of every destination of an extra
+// file target without writing anything.
+func planExtraFileTarget(target config.ExtraFileTarget, configDir string, mcpServers map[string]interface{}) ([]plannedFile, error) {
 	info, err := os.Stat(target.Source)
 	if err != nil {
-		return fmt.Errorf("failed to inspect %s: %w", target.Source, err)
+		return nil, fmt.Errorf("failed to inspect %s: %w", target.Source, err)
 	}
 	if info.IsDir() {
-		return fmt.Errorf("extra file target %s is a directory; use directories instead", target.Source)
+		return nil, fmt.Errorf("extra file target %s is a directory; use directories instead", target.Source)
 	}
+	var files []plannedFile
 	for _, dest := range target.Destinations {
-		if err := copyFileContentsWithSkillsAndFrontmatter(target.Source, dest, info.Mode(), configDir, mcpServers); err != nil {
-			return fmt.Errorf("failed to copy %s to %s: %w", target.Source, dest.Path, err)
+		content, err := renderExtraFile(target.Source, dest, configDir, mcpServers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s to %s: %w", target.Source, dest.Path, err)
 		}
-	}
-	return nil
+		files = append(files, plannedFile{
+			Category: categoryExtra,
+			Label:    "Extra file",
+			Path:     dest.Path,
+			Source:   target.Source,
+			Content:  content,
+			Mode:     info.Mode().Perm(),
+		})
+	}
+	return files, nil
 }
 
-func copyExtraDirectoryTarget(target config.ExtraDirectoryTarget) (int, error) {
+// planExtraDirectoryTarget lists every file an extra directory target would
+// copy along with its content.
+func planExtraDirectoryTarget(target config.ExtraDirectoryTarget) ([]plannedFile, error) {
 	sourceInfo, err := os.Stat(target.Source)
 	if err != nil {
-		return 0, fmt.Errorf("failed to inspect %s: %w", target.Source, err)
+		return nil, fmt.Errorf("failed to inspect %s: %w", target.Source, err)
 	}
 	if !sourceInfo.IsDir() {
-		return 0, fmt.Errorf("extra directory target %s is not a directory", target.Source)
+		return nil, fmt.Errorf("extra directory target %s is not a directory", target.Source)
 	}
 
-	var total int
+	var files []plannedFile
 	for _, dest := range target.Destinations {
-		count, err := copyDirectory(target.Source, dest.Path, dest.Flatten, dest.ExcludeGlobs, dest.AppendToFilename)
+		copies, err := planDirectoryCopy(target.Source, dest.Path, dest.Flatten, dest.ExcludeGlobs, dest.AppendToFilename)
 		if err != nil {
-			return total, fmt.Errorf("failed to copy directory %s to %s: %w", target.Source, dest.Path, err)
+			return nil, fmt.Errorf("failed to copy directory %s to %s: %w", target.Source, dest.Path, err)
 		}
-		total += count
+		files = append(files, copies...)
 	}
-	return total, nil
+	return files, nil
 }
 
-func copyDirectory(source, destination string, flatten bool, excludeGlobs []string, appendToFilename string) (int, error) {
-	var copied int
+func planDirectoryCopy(source, destination string, flatten bool, excludeGlobs []string, appendToFilename string) ([]plannedFile, error) {
+	var files []plannedFile
 	walkErr := filepath.WalkDir(source, func(path string, entry fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
@@ -145,89 +160,68 @@ func copyDirectory(source, destination string, flatten bool, excludeGlobs []stri
 		if err != nil {
 			return err
 		}
-		if err := copyFileContents(path, destPath, info.Mode()); err != nil {
+		content, err := os.ReadFile(path)
+		if err != nil {
 			return err
 		}
-		copied++
+		files = append(files, plannedFile{
+			Category: categoryExtra,
+			Label:    "Extra directory",
+			Path:     destPath,
+			Source:   path,
+			Content:  content,
+			Mode:     info.Mode().Perm(),
+		})
 		return nil
 	})
 	if walkErr != nil {
-		return copied, walkErr
+		return nil, walkErr
 	}
-	return copied, nil
+	return files, nil
 }
 
-func copyFileContentsWithSkillsAndFrontmatter(source string, dest config.ExtraFileCopyRoute, mode os.FileMode, configDir string, mcpServers map[string]interface{}) error {
+// renderExtraFile builds the content written to a single extra file
+// destination: the source file, optionally wrapped in a frontmatter template
+// or followed by the skills listing.
+func renderExtraFile(source string, dest config.ExtraFileCopyRoute, configDir string, mcpServers map[string]interface{}) ([]byte, error) {
 	// Read source file content
 	sourceData, err := os.ReadFile(source)
 	if err != nil {
-		return err
-	}
-
-	if err := os.MkdirAll(filepath.Dir(dest.Path), 0o755); err != nil {
-		return fmt.Errorf("failed to create directory for %s: %w", dest.Path, err)
+		return nil, err
 	}
 
-	out, err := os.OpenFile(dest.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
-	if err != nil {
-		return fmt.Errorf("failed to open %s: %w", dest.Path, err)
-	}
-	defer out.Close()
+	var out bytes.Buffer
 
 	// If FrontmatterPath is specified, use frontmatter template processing
 	if dest.FrontmatterPath != "" {
-		if err := processFrontmatterTemplate(out, dest.FrontmatterPath, string(sourceData), mcpServers); err != nil {
-			return fmt.Errorf("failed to process frontmatter template: %w", err)
-		}
-	} else {
-		// Otherwise, copy source content directly
-		if _, err := out.Write(sourceData); err != nil {
-			return fmt.Errorf("failed to copy %s to %s: %w", source, dest.Path, err)
-		}
-
-		// If PathToSkills is specified (deprecated), append skills content
-		if dest.PathToSkills != "" {
-			if err := appendSkillsContent(out, dest.PathToSkills, configDir, nil); err != nil {
-				return fmt.Errorf("failed to append skills content: %w", err)
-			}
-		}
-
-		// If AppendSkills is specified (new format), append skills content with filtering
-		for _, appendSkill := range dest.AppendSkills {
-			if err := appendSkillsContent(out, appendSkill.Path, configDir, appendSkill.IgnoredSkills); err != nil {
-				return fmt.Errorf("failed to append skills content from %s: %w", appendSkill.Path, err)
-			}
+		if err := processFrontmatterTemplate(&out, dest.FrontmatterPath, string(sourceData), mcpServers); err != nil {
+			return nil, fmt.Errorf("failed to process frontmatter template: %w", err)
 		}
+		return out.Bytes(), nil
 	}
 
-	return nil
-}
+	// Otherwise, copy source content directly
+	out.Write(sourceData)
 
-func copyFileContents(source, dest string, mode os.FileMode) error {
-	in, err := os.Open(source)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-
-	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-		return fmt.Errorf("failed to create directory for %s: %w", dest, err)
+	// If PathToSkills is specified (deprecated), append skills content
+	if dest.PathToSkills != "" {
+		if err := appendSkillsContent(&out, dest.PathToSkills, configDir, nil); err != nil {
+			return nil, fmt.Errorf("failed to append skills content: %w", err)
+		}
 	}
 
-	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
-	if err != nil {
-		return fmt.Errorf("failed to open %s: %w", dest, err)
+	// If AppendSkills is specified (new format), append skills content with filtering
+	for _, appendSkill := range dest.AppendSkills {
+		if err := appendSkillsContent(&out, appendSkill.Path, configDir, appendSkill.IgnoredSkills); err != nil {
+			return nil, fmt.Errorf("failed to append skills content from %s: %w", appendSkill.Path, err)
+		}
 	}
-	defer out.Close()
 
-	if _, err := io.Copy(out, in); err != nil {
-		return fmt.Errorf("failed to copy %s to %s: %w", source, dest, err)
-	}
-	return nil
+	return out.Bytes(), nil
 }
 
 // processFrontmatterTemplate processes a frontmatter template file, replacing [CONTENT] and [MCP] placeholders
-func processFrontmatterTemplate(out *os.File, frontmatterPath, sourceContent string, mcpServers map[string]interface{}) error {
+func processFrontmatterTemplate(out io.Writer, frontmatterPath, sourceContent string, mcpServers map[string]interface{}) error {
 	// Read the frontmatter template
 	templateData, err := os.ReadFile(frontmatterPath)
 	if err != nil {
@@ -253,7 +247,7 @@ func processFrontmatterTemplate(out *os.File, frontmatterPath, sourceContent str
 	template = strings.ReplaceAll(template, "[MCP]", mcpReplacement)
 
 	// Write the processed template to the output file
-	if _, err := out.WriteString(template); err != nil {
+	if _, err := io.WriteString(out, template); err != nil {
 		return fmt.Errorf("failed to write processed template: %w", err)
 	}
 
@@ -261,7 +255,7 @@ func processFrontmatterTemplate(out *os.File, frontmatterPath, sourceContent str
 }
 
 // appendSkillsContent reads skills.md from configDir and appends it along with discovered SKILL.md files
-func appendSkillsContent(out *os.File, pathToSkills, configDir string, ignoredSkills []string) error {
+func appendSkillsContent(out io.Writer, pathToSkills, configDir string, ignoredSkills []string) error {
 	// First, try to read and append the skills.md template from configDir. If it
 	// doesn't exist, fall back to the embedded default so the binary can be
 	// distributed standalone.
@@ -276,7 +270,7 @@ func appendSkillsContent(out *os.File, pathToSkills, configDir string, ignoredSk
 	}
 
 	// Write a newline before appending to ensure separation
-	if _, err := out.WriteString("\n"); err != nil {
+	if _, err := io.WriteString(out, "\n"); err != nil {
 		return err
 	}
 
@@ -292,7 +286,7 @@ func appendSkillsContent(out *os.File, pathToSkills, configDir string, ignoredSk
 
 	for _, skill := range skills {
 		skillSection := fmt.Sprintf("\n### **Skill: %s**\n**Description / Use when:**  \n%s\n", skill.Name, skill.Description)
-		if _, err := out.WriteString(skillSection); err != nil {
+		if _, err := io.WriteString(out, skillSection); err != nil {
 			return fmt.Errorf("failed to write skill %s: %w", skill.Name, err)
 		}
 	}
@@ -26,9 +26,11 @@ func TestCopyExtraFileTarget(t *testing.T) {
 		},
 	}
 	mcpServers := map[string]interface{}{}
-	if err := copyExtraFileTarget(target, dir, mcpServers); err != nil {
-		t.Fatalf("copyExtraFileTarget returned error: %v", err)
+	files, err := planExtraFileTarget(target, dir, mcpServers)
+	if err != nil {
+		t.Fatalf("planExtraFileTarget returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	for _, dest := range []string{dest1, dest2} {
 		data, err := os.ReadFile(dest)
@@ -61,11 +63,11 @@ func TestCopyExtraDirectoryTarget(t *testing.T) {
 			{Path: dest},
 		},
 	}
-	count, err := copyExtraDirectoryTarget(target)
+	files, err := planExtraDirectoryTarget(target)
 	if err != nil {
-		t.Fatalf("copyExtraDirectoryTarget returned error: %v", err)
+		t.Fatalf("planExtraDirectoryTarget returned error: %v", err)
 	}
-	if count != 2 {
+	if count := len(applyPlanned(t, files)); count != 2 {
 		t.Fatalf("expected 2 files copied, got %d", count)
 	}
 
@@ -99,11 +101,11 @@ func TestCopyExtraDirectoryTargetMultipleDestinations(t *testing.T) {
 			{Path: dest2},
 		},
 	}
-	count, err := copyExtraDirectoryTarget(target)
+	files, err := planExtraDirectoryTarget(target)
 	if err != nil {
-		t.Fatalf("copyExtraDirectoryTarget returned error: %v", err)
+		t.Fatalf("planExtraDirectoryTarget returned error: %v", err)
 	}
-	if count != 2 {
+	if count := len(applyPlanned(t, files)); count != 2 {
 		t.Fatalf("expected total copies to be 2, got %d", count)
 	}
 
@@ -131,11 +133,11 @@ func TestCopyExtraDirectoryTargetFlatten(t *testing.T) {
 			{Path: dest, Flatten: true},
 		},
 	}
-	count, err := copyExtraDirectoryTarget(target)
+	files, err := planExtraDirectoryTarget(target)
 	if err != nil {
-		t.Fatalf("copyExtraDirectoryTarget returned error: %v", err)
+		t.Fatalf("planExtraDirectoryTarget returned error: %v", err)
 	}
-	if count != 1 {
+	if count := len(applyPlanned(t, files)); count != 1 {
 		t.Fatalf("expected 1 file copied, got %d", count)
 	}
 
@@ -180,11 +182,11 @@ func TestCopyExtraDirectoryTargetExcludeGlobs(t *testing.T) {
 			},
 		},
 	}
-	count, err := copyExtraDirectoryTarget(target)
+	files, err := planExtraDirectoryTarget(target)
 	if err != nil {
-		t.Fatalf("copyExtraDirectoryTarget returned error: %v", err)
+		t.Fatalf("planExtraDirectoryTarget returned error: %v", err)
 	}
-	if count != 2 {
+	if count := len(applyPlanned(t, files)); count != 2 {
 		t.Fatalf("expected 2 files copied (excluding troubleshoot/**), got %d", count)
 	}
 
@@ -250,11 +252,11 @@ func TestCopyExtraDirectoryTargetMultipleExcludeGlobs(t *testing.T) {
 			},
 		},
 	}
-	count, err := copyExtraDirectoryTarget(target)
+	files, err := planExtraDirectoryTarget(target)
 	if err != nil {
-		t.Fatalf("copyExtraDirectoryTarget returned error: %v", err)
+		t.Fatalf("planExtraDirectoryTarget returned error: %v", err)
 	}
-	if count != 2 {
+	if count := len(applyPlanned(t, files)); count != 2 {
 		t.Fatalf("expected 2 files copied (excluding logs/**, temp/**, *.tmp), got %d", count)
 	}
 
@@ -298,11 +300,11 @@ func TestCopyExtraDirectoryAppendToFilename(t *testing.T) {
 			{Path: dest, AppendToFilename: ".prompt"},
 		},
 	}
-	count, err := copyExtraDirectoryTarget(target)
+	files, err := planExtraDirectoryTarget(target)
 	if err != nil {
-		t.Fatalf("copyExtraDirectoryTarget returned error: %v", err)
+		t.Fatalf("planExtraDirectoryTarget returned error: %v", err)
 	}
-	if count != 2 {
+	if count := len(applyPlanned(t, files)); count != 2 {
 		t.Fatalf("expected 2 files copied, got %d", count)
 	}
 
@@ -378,9 +380,11 @@ description: Use when reviewing code for best practices and common issues
 	}
 
 	mcpServers := map[string]interface{}{}
-	if err := copyExtraFileTarget(target, dir, mcpServers); err != nil {
-		t.Fatalf("copyExtraFileTarget returned error: %v", err)
+	files, err := planExtraFileTarget(target, dir, mcpServers)
+	if err != nil {
+		t.Fatalf("planExtraFileTarget returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	// Verify the output contains original content and skills
 	data, err := os.ReadFile(dest)
@@ -438,9 +442,11 @@ func TestCopyExtraFileTargetMixedDestinations(t *testing.T) {
 	}
 
 	mcpServers := map[string]interface{}{}
-	if err := copyExtraFileTarget(target, dir, mcpServers); err != nil {
-		t.Fatalf("copyExtraFileTarget returned error: %v", err)
+	files, err := planExtraFileTarget(target, dir, mcpServers)
+	if err != nil {
+		t.Fatalf("planExtraFileTarget returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	// dest1 should have skills appended
 	data1, err := os.ReadFile(dest1)
@@ -571,9 +577,11 @@ tools: ['edit', 'view', [MCP]]
 		"qdrant":  map[string]interface{}{"command": "uvx"},
 	}
 
-	if err := copyExtraFileTarget(target, dir, mcpServers); err != nil {
-		t.Fatalf("copyExtraFileTarget returned error: %v", err)
+	files, err := planExtraFileTarget(target, dir, mcpServers)
+	if err != nil {
+		t.Fatalf("planExtraFileTarget returned error: %v", err)
 	}
+	applyPlanned(t, files)
 
 	// Verify the output
 	data, err := os.ReadFile(dest)
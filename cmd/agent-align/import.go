@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"agent-align/internal/config"
+	"agent-align/internal/fileutil"
+	"agent-align/internal/syncer"
+)
+
+// defaultImportAgents are the agents read by the import command when neither
+// -from nor the config lists any.
+var defaultImportAgents = []string{"codex", "claudecode", "opencode"}
+
+// importDocument is the JSON result of the import command.
+type importDocument struct {
+	outputHeader
+	DryRun      bool                   `json:"dryRun"`
+	Sources     []importSource         `json:"sources"`
+	Conflicts   []importConflict       `json:"conflicts,omitempty"`
+	Servers     map[string]interface{} `json:"servers,omitempty"` // secrets masked
+	Destination string                 `json:"destination,omitempty"`
+	BackupRun   string                 `json:"backupRun,omitempty"`
+}
+
+type importSource struct {
+	Agent   string   `json:"agent"`
+	Path    string   `json:"path"`
+	Servers []string `json:"servers"`
+}
+
+type importConflict struct {
+	Server string `json:"server"`
+	Field  string `json:"field"`
+	Kept   string `json:"kept"`
+	Other  string `json:"other"`
+}
+
+// runImportCommand reads existing agent configs, converts their MCP servers
+// back to the neutral format, and writes them to the MCP config file.
+func runImportCommand(args []string, stdout io.Writer) error {
+	importFlags := flag.NewFlagSet("import", flag.ExitOnError)
+	from := importFlags.String("from", "", fmt.Sprintf("comma-separated list of agents to import from (defaults to the agents in the config, or %s)", strings.Join(defaultImportAgents, ",")))
+	configPath := importFlags.String("config", defaultConfigPath(), "path to YAML configuration file used for agent paths and custom agents")
+	outPath := importFlags.String("out", "", "path of the MCP config file to write (defaults to agent-align-mcp.yml next to the target config)")
+	dryRun := importFlags.Bool("dry-run", false, "print the imported servers without writing them")
+	showSecrets := importFlags.Bool("show-secrets", false, "print secret values in the dry-run output instead of masking them")
+	confirm := importFlags.Bool("confirm", false, "overwrite an existing MCP config file without prompting")
+	outputFormat := addOutputFlag(importFlags)
+	if err := importFlags.Parse(args); err != nil {
+		return err
+	}
+	out, err := newOutput(*outputFormat, stdout)
+	if err != nil {
+		return err
+	}
+	w := out.text()
+	doc := &importDocument{outputHeader: outputHeader{Command: "import"}, DryRun: *dryRun, Sources: []importSource{}}
+	if err := out.requireConfirmation(*confirm || *dryRun); err != nil {
+		return out.finish(doc, err)
+	}
+
+	var cfg config.Config
+	var registry syncer.Registry
+	if _, err := os.Stat(*configPath); err == nil {
+		loaded, err := config.Load(*configPath)
+		if err != nil {
+			return out.finish(doc, categorize(errorConfig, fmt.Errorf("failed to load config %q: %w", *configPath, err)))
+		}
+		if registry, err = agentRegistry(loaded.AgentDefinitions); err != nil {
+			return out.finish(doc, categorize(errorConfig, fmt.Errorf("invalid agent definitions in %q: %w", *configPath, err)))
+		}
+		cfg = loaded
+	}
+
+	agents, err := importTargets(*from, cfg)
+	if err != nil {
+		return out.finish(doc, categorize(errorUsage, err))
+	}
+
+	result, err := syncer.Import(agents, registry)
+	if err != nil {
+		return out.finish(doc, categorize(errorTarget, err))
+	}
+	printImportReport(w, result)
+	for _, source := range result.Sources {
+		doc.Sources = append(doc.Sources, importSource{Agent: source.Config.Name, Path: source.Config.FilePath, Servers: source.Servers})
+	}
+	for _, conflict := range result.Conflicts {
+		doc.Conflicts = append(doc.Conflicts, importConflict(conflict))
+	}
+	if len(result.Servers) == 0 {
+		return out.finish(doc, categorize(errorTarget, errors.New("no MCP servers found to import")))
+	}
+	doc.Servers = newRedactor(nil, *showSecrets).Servers(result.Servers)
+
+	data, err := marshalServers(result.Servers)
+	if err != nil {
+		return out.finish(doc, fmt.Errorf("failed to marshal servers: %w", err))
+	}
+
+	if *dryRun {
+		preview, err := marshalServers(doc.Servers)
+		if err != nil {
+			return out.finish(doc, fmt.Errorf("failed to marshal servers: %w", err))
+		}
+		fmt.Fprintln(w)
+		fmt.Fprint(w, string(preview))
+		return out.finish(doc, nil)
+	}
+
+	destination := strings.TrimSpace(*outPath)
+	if destination == "" {
+		destination = cfg.MCP.ConfigPath
+	}
+	if destination == "" {
+		destination = defaultMCPConfigPath(*configPath)
+	}
+	if _, err := os.Stat(destination); err == nil && !*confirm {
+		if !promptUser(fmt.Sprintf("%s already exists. Overwrite? [y/N]: ", destination), false) {
+			fmt.Fprintln(stdout, "Import cancelled.")
+			return nil
+		}
+	}
+
+	doc.Destination = destination
+	if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+		return out.finish(doc, categorize(errorWrite, fmt.Errorf("failed to create directory for %s: %w", destination, err)))
+	}
+	backups := backupStore()
+	backupRun := backups.Begin("import")
+	if err := backupRun.Save(destination); err != nil {
+		return out.finish(doc, categorize(errorWrite, err))
+	}
+	if err := fileutil.WriteFile(destination, data, 0o644); err != nil {
+		return out.finish(doc, categorize(errorWrite, fmt.Errorf("failed to write %s: %w", destination, err)))
+	}
+	fmt.Fprintf(w, "Wrote %d servers to %s\n", len(result.Servers), destination)
+	err = finishBackupRun(w, backups, backupRun, cfg.Backups.Retain)
+	if len(backupRun.Entries) > 0 {
+		doc.BackupRun = backupRun.ID
+	}
+	return out.finish(doc, categorize(errorWrite, err))
+}
+
+// marshalServers renders servers as an MCP definitions file, indented by two
+// spaces like the examples in the docs.
+func marshalServers(servers map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{"servers": servers}); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// importTargets resolves the agents to read. Paths configured for an agent in
+// the target config are honored so imports read the same files a sync writes.
+func importTargets(from string, cfg config.Config) ([]syncer.AgentTarget, error) {
+	overrides := make(map[string]string, len(cfg.MCP.Targets.Agents))
+	for _, agent := range cfg.MCP.Targets.Agents {
+		overrides[strings.ToLower(strings.TrimSpace(agent.Name))] = agent.Path
+	}
+
+	var names []string
+	if strings.TrimSpace(from) != "" {
+		names = parseAgents(from)
+		if len(names) == 0 {
+			return nil, errors.New("the -from flag must list at least one agent")
+		}
+	} else if len(cfg.MCP.Targets.Agents) > 0 {
+		for _, agent := range cfg.MCP.Targets.Agents {
+			names = append(names, agent.Name)
+		}
+	} else {
+		names = defaultImportAgents
+	}
+
+	targets := make([]syncer.AgentTarget, 0, len(names))
+	for _, name := range names {
+		normalized := strings.ToLower(strings.TrimSpace(name))
+		targets = append(targets, syncer.AgentTarget{Name: normalized, PathOverride: overrides[normalized]})
+	}
+	return targets, nil
+}
+
+func printImportReport(w io.Writer, result syncer.ImportResult) {
+	if len(result.Sources) == 0 {
+		fmt.Fprintln(w, "No agent config files found.")
+	}
+	for _, source := range result.Sources {
+		fmt.Fprintf(w, "Read %d servers from %s (%s)\n", len(source.Servers), source.Config.Name, source.Config.FilePath)
+	}
+	if len(result.Conflicts) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Conflicting definitions:")
+	for _, conflict := range result.Conflicts {
+		fmt.Fprintf(w, "  - %s.%s differs between %s and %s; keeping %s\n", conflict.Server, conflict.Field, conflict.Kept, conflict.Other, conflict.Kept)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent-align/internal/mcpconfig"
+)
+
+func TestRunImportCommandWritesMCPConfig(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	claudePath := filepath.Join(dir, "claude.json")
+	claude := `{"theme": "dark", "mcpServers": {"fs": {"command": "npx", "args": ["fs"]}, "web": {"type": "http", "url": "https://a.example.com"}}}`
+	if err := os.WriteFile(claudePath, []byte(claude), 0o644); err != nil {
+		t.Fatalf("failed to write claude config: %v", err)
+	}
+	opencodePath := filepath.Join(dir, "opencode.jsonc")
+	opencode := `{"mcp": {"web": {"type": "remote", "url": "https://b.example.com"}}}`
+	if err := os.WriteFile(opencodePath, []byte(opencode), 0o644); err != nil {
+		t.Fatalf("failed to write opencode config: %v", err)
+	}
+
+	configPath := filepath.Join(dir, "agent-align.yml")
+	content := `mcpServers:
+  targets:
+    agents:
+      - name: claudecode
+        path: ` + claudePath + `
+      - name: opencode
+        path: ` + opencodePath + `
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runImportCommand([]string{"-config", configPath, "-from", "claudecode,opencode"}, &out); err != nil {
+		t.Fatalf("runImportCommand returned error: %v", err)
+	}
+	for _, want := range []string{
+		"Read 2 servers from claudecode (" + claudePath + ")",
+		"Read 1 servers from opencode (" + opencodePath + ")",
+		"web.url differs between claudecode and opencode; keeping claudecode",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+
+	written, err := os.ReadFile(filepath.Join(dir, "agent-align-mcp.yml"))
+	if err != nil {
+		t.Fatalf("failed to read imported MCP config: %v", err)
+	}
+	if !strings.Contains(string(written), "servers:\n  fs:\n    args:\n      - fs\n") {
+		t.Fatalf("expected two-space indented YAML:\n%s", written)
+	}
+	servers, err := mcpconfig.Load(filepath.Join(dir, "agent-align-mcp.yml"))
+	if err != nil {
+		t.Fatalf("failed to load imported MCP config: %v", err)
+	}
+	fs := servers["fs"].(map[string]interface{})
+	if fs["command"] != "npx" {
+		t.Fatalf("unexpected fs server: %v", fs)
+	}
+	web := servers["web"].(map[string]interface{})
+	if web["url"] != "https://a.example.com" {
+		t.Fatalf("expected first agent's url to win, got %v", web)
+	}
+}
+
+func TestRunImportCommandDryRunDoesNotWrite(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	if err := os.WriteFile(filepath.Join(dir, ".claude.json"), []byte(`{"mcpServers": {"fs": {"command": "npx"}}}`), 0o644); err != nil {
+		t.Fatalf("failed to write claude config: %v", err)
+	}
+	outPath := filepath.Join(dir, "out.yml")
+
+	var out bytes.Buffer
+	args := []string{"-config", filepath.Join(dir, "missing.yml"), "-from", "claudecode", "-out", outPath, "-dry-run"}
+	if err := runImportCommand(args, &out); err != nil {
+		t.Fatalf("runImportCommand returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "servers:\n  fs:\n    command: npx\n") {
+		t.Fatalf("expected YAML in output:\n%s", out.String())
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Fatalf("dry run should not write %s", outPath)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -20,8 +19,10 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"agent-align/internal/config"
-	"agent-align/internal/mcpconfig"
+	"agent-align/internal/fileutil"
+	"agent-align/internal/mcpserver"
 	"agent-align/internal/syncer"
+	"agent-align/internal/transforms"
 )
 
 // version is set at build time via -ldflags.
@@ -42,6 +43,31 @@ func main() {
 		}
 		return
 	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		code, err := runCheckCommand(os.Args[2:], os.Stdout)
+		exitOnError("check", err)
+		os.Exit(code)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		exitOnError("import", runImportCommand(os.Args[2:], os.Stdout))
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		exitOnError("restore", runRestoreCommand(os.Args[2:], os.Stdout))
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "uninstall" {
+		exitOnError("uninstall", runUninstallCommand(os.Args[2:], os.Stdout))
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "plan" {
+		exitOnError("plan", runPlanCommand(os.Args[2:], os.Stdout))
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apply" {
+		exitOnError("apply", runApplyCommand(os.Args[2:], os.Stdout))
+		return
+	}
 	if err := validateCommand(os.Args); err != nil {
 		log.Fatal(err)
 	}
@@ -50,16 +76,30 @@ func main() {
 	agents := flag.String("agents", "", fmt.Sprintf("comma-separated list of agents to keep in sync (defaults to %s)", defaultAgents))
 	configPath := flag.String("config", defaultConfigPath(), "path to YAML configuration file describing target agents and overrides")
 	mcpConfigPath := flag.String("mcp-config", "", "path to YAML file that defines MCP servers (defaults to agent-align-mcp.yml next to the target config)")
+	profile := flag.String("profile", "", "name of the profile in the MCP definitions file to apply (agents with their own profile keep it)")
+	strictEnv := flag.Bool("strict-env", false, "fail before writing anything when an MCP definition references an unset environment variable")
+	failOnLossy := flag.Bool("fail-on-lossy", false, "fail the agents whose servers would lose configuration they cannot represent instead of only warning")
+	showSecrets := flag.Bool("show-secrets", false, "print secret values in previews and debug output instead of masking them")
 	dryRun := flag.Bool("dry-run", false, "only show what would be changed without applying changes")
 	debug := flag.Bool("debug", false, "print shell commands to test each MCP server and exit")
 	confirm := flag.Bool("confirm", false, "skip user confirmation prompt (useful for cron jobs)")
+	force := flag.Bool("force", false, "overwrite destinations that were edited since the last agent-align run")
+	atomic := flag.Bool("atomic", false, "stage every output first and write none of them unless all succeed, rolling back on failure")
 	showVersion := flag.Bool("version", false, "print version and exit")
 	exportAllowedToolsFlag := flag.Bool("export-allowed-tools", false, "read allowed tools from the configured target files and print a combined, sorted, deduplicated list")
 	updateAllowedToolsFlag := flag.Bool("update-allowed-tools", false, "read allowed tools from the configured target files and merge them into the allowedTools list in the config file")
+	outputFormat := addOutputFlag(flag.CommandLine)
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "agent-align version %s\n\n", version)
-		fmt.Fprintf(os.Stderr, "Usage: agent-align [OPTIONS]\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: agent-align [OPTIONS]\n")
+		fmt.Fprintf(os.Stderr, "       agent-align init [-config PATH]\n")
+		fmt.Fprintf(os.Stderr, "       agent-align check [-config PATH] [-mcp-config PATH] [-agents LIST] [-profile NAME] [-strict-env] [-fail-on-lossy] [-output json]\n")
+		fmt.Fprintf(os.Stderr, "       agent-align import [-from LIST] [-config PATH] [-out PATH] [-dry-run] [-confirm]\n")
+		fmt.Fprintf(os.Stderr, "       agent-align restore [-run ID] [-list] [-confirm] [PATH...]\n")
+		fmt.Fprintf(os.Stderr, "       agent-align uninstall [-agents LIST] [-servers LIST] [-extra] [-archives] [-dry-run] [-confirm]\n")
+		fmt.Fprintf(os.Stderr, "       agent-align plan [-agents LIST] [-profile NAME] [-force] [-out FILE]\n")
+		fmt.Fprintf(os.Stderr, "       agent-align apply [-atomic] FILE\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nDefault config file location: %s\n", defaultConfigPath())
@@ -76,47 +116,47 @@ func main() {
 		return
 	}
 
+	out, err := newOutput(*outputFormat, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := out.text()
+
 	resolvedConfigPath := *configPath
-	resolvedMCPPath := strings.TrimSpace(*mcpConfigPath)
 	agentsFlagValue := strings.TrimSpace(*agents)
 
 	// Handle -export-allowed-tools independently of the normal sync flow.
 	if *exportAllowedToolsFlag {
-		data, err := config.Load(resolvedConfigPath)
-		if err != nil {
-			log.Fatalf("failed to load config %q: %v", resolvedConfigPath, err)
-		}
-		tools, err := collectAllowedTools(data)
-		if err != nil {
-			log.Fatalf("failed to export allowed tools: %v", err)
-		}
-		for _, tool := range tools {
-			fmt.Println("- " + tool)
-		}
+		exitOnError("export-allowed-tools", exportAllowedTools(out, resolvedConfigPath))
 		return
 	}
 
 	// Handle -update-allowed-tools: collect tools and merge with the config.
 	if *updateAllowedToolsFlag {
+		doc := &allowedToolsDocument{outputHeader: outputHeader{Command: "update-allowed-tools"}, ConfigPath: resolvedConfigPath, AllowedTools: []string{}}
+		if err := out.requireConfirmation(*confirm); err != nil {
+			fatal(out, doc, err)
+		}
 		data, err := config.Load(resolvedConfigPath)
 		if err != nil {
-			log.Fatalf("failed to load config %q: %v", resolvedConfigPath, err)
+			fatal(out, doc, categorize(errorConfig, fmt.Errorf("failed to load config %q: %w", resolvedConfigPath, err)))
 		}
 		tools, err := collectAllowedTools(data)
 		if err != nil {
-			log.Fatalf("failed to collect allowed tools: %v", err)
+			fatal(out, doc, fmt.Errorf("failed to collect allowed tools: %w", err))
 		}
 		// Merge collected tools with the existing alwaysAllowedTools from the config.
 		tools = mergeAllowedTools(tools, data.AllowedTools.AlwaysAllowedTools)
-		fmt.Printf("The following allowed tools will be written to %s:\n", resolvedConfigPath)
+		doc.AllowedTools = append(doc.AllowedTools, tools...)
+		fmt.Fprintf(w, "The following allowed tools will be written to %s:\n", resolvedConfigPath)
 		if len(tools) == 0 {
-			fmt.Println("  (none)")
+			fmt.Fprintln(w, "  (none)")
 		} else {
 			for _, tool := range tools {
-				fmt.Println("  - " + tool)
+				fmt.Fprintln(w, "  - "+tool)
 			}
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 		if !*confirm {
 			if !promptUser("Apply these changes? [y/N]: ", false) {
 				fmt.Println("Changes cancelled.")
@@ -124,262 +164,74 @@ func main() {
 			}
 		}
 		if err := config.UpdateAllowedTools(resolvedConfigPath, tools); err != nil {
-			log.Fatalf("failed to update allowed tools in config: %v", err)
+			fatal(out, doc, categorize(errorWrite, fmt.Errorf("failed to update allowed tools in config: %w", err)))
 		}
-		fmt.Printf("Updated allowedTools in %s\n", resolvedConfigPath)
+		doc.Updated = true
+		fmt.Fprintf(w, "Updated allowedTools in %s\n", resolvedConfigPath)
+		exitOnError("update-allowed-tools", out.finish(doc, nil))
 		return
 	}
 
-	var cfg config.Config
-	var haveConfig bool
-	var additionalTargets []config.AdditionalJSONTarget
-	var additionalJSONCTargets []config.AdditionalJSONTarget
-	var extraTargets config.ExtraTargetsConfig
-	var archiveTargets []config.ArchiveTarget
-	var targetAgents []syncer.AgentTarget
-
-	if agentsFlagValue == "" {
-		if err := ensureConfigFile(resolvedConfigPath); err != nil {
-			log.Fatalf("configuration unavailable: %v", err)
-		}
-		data, err := config.Load(resolvedConfigPath)
-		if err != nil {
-			log.Fatalf("failed to load config %q: %v", resolvedConfigPath, err)
-		}
-		cfg = data
-		haveConfig = true
-	} else if _, err := os.Stat(resolvedConfigPath); err == nil {
-		data, err := config.Load(resolvedConfigPath)
-		if err != nil {
-			log.Fatalf("failed to load config %q: %v", resolvedConfigPath, err)
-		}
-		cfg = data
-		haveConfig = true
-	}
-
-	if haveConfig {
-		additionalTargets = cfg.MCP.Targets.Additional.JSON
-		additionalJSONCTargets = cfg.MCP.Targets.Additional.JSONC
-		extraTargets = cfg.ExtraTargets
-		archiveTargets = cfg.ArchiveTargets
-		targetAgents = configTargetsToSyncer(cfg.MCP.Targets.Agents)
-		if resolvedMCPPath == "" {
-			resolvedMCPPath = cfg.MCP.ConfigPath
-		}
-	}
-
-	if resolvedMCPPath == "" {
-		resolvedMCPPath = defaultMCPConfigPath(resolvedConfigPath)
-	}
-
-	if agentsFlagValue != "" {
-		names := parseAgents(agentsFlagValue)
-		if len(names) == 0 {
-			log.Fatal("the -agents flag must list at least one agent")
-		}
-		overrideLookup := make(map[string]string, len(cfg.MCP.Targets.Agents))
-		for _, agent := range cfg.MCP.Targets.Agents {
-			overrideLookup[agent.Name] = agent.Path
-		}
-		targetAgents = nil
-		for _, name := range names {
-			normalized := strings.ToLower(strings.TrimSpace(name))
-			targetAgents = append(targetAgents, syncer.AgentTarget{
-				Name:         normalized,
-				PathOverride: overrideLookup[normalized],
-			})
-		}
-	}
-
-	if len(targetAgents) == 0 && len(additionalTargets) == 0 && len(additionalJSONCTargets) == 0 && extraTargets.IsZero() && len(archiveTargets) == 0 {
-		log.Fatal("no target agents, additional destinations, or extra copy targets configured; provide agents via config/flags or add extra targets")
-	}
-
-	servers, err := mcpconfig.Load(resolvedMCPPath)
+	doc := newSyncDocument("sync", *dryRun)
+	if *debug {
+		doc.Command = "debug"
+	} else if err := out.requireConfirmation(*confirm || *dryRun); err != nil {
+		fatal(out, doc, err)
+	}
+
+	rc, err := loadRun(runOptions{
+		ConfigPath:      resolvedConfigPath,
+		MCPConfigPath:   *mcpConfigPath,
+		Agents:          agentsFlagValue,
+		Profile:         *profile,
+		StrictEnv:       *strictEnv,
+		FailOnLossy:     *failOnLossy,
+		PromptForConfig: !out.json(),
+	})
 	if err != nil {
-		log.Fatalf("failed to load MCP configuration %q: %v", resolvedMCPPath, err)
+		fatal(out, doc, categorize(errorConfig, err))
 	}
+	doc.Profile = rc.Profile
+
+	redact := newRedactor(rc.Resolver.SecretValues(), *showSecrets)
 
 	// If debug flag is provided, print a shell-ready command for each server and exit.
 	if *debug {
+		servers := redact.Servers(rc.Servers)
+		if out.json() {
+			debugDoc := &debugDocument{outputHeader: outputHeader{Command: "debug"}, Servers: serverLaunches(servers)}
+			exitOnError("debug", out.finish(debugDoc, nil))
+			return
+		}
 		printDebugCommands(servers)
 		return
 	}
 
-	s := syncer.New(targetAgents)
-
-	syncResult, err := s.Sync(servers)
+	plan, err := rc.plan()
 	if err != nil {
-		log.Fatalf("sync failed: %v", err)
-	}
-
-	// Display the dry run results
-	fmt.Println("\n=== Dry Run Results ===")
-	fmt.Println("The following configuration changes will be made:")
-	fmt.Println()
-
-	var agentNames []string
-	for name := range syncResult.Agents {
-		agentNames = append(agentNames, name)
-	}
-	sort.Strings(agentNames)
-
-	for _, agent := range agentNames {
-		outputs := syncResult.Agents[agent]
-		for _, output := range outputs {
-			fmt.Printf("Agent: %s\n", agent)
-			fmt.Printf("  File: %s\n", output.Config.FilePath)
-			fmt.Printf("  Format: %s\n", output.Config.Format)
-			fmt.Printf("  Content:\n")
-			// Indent the content for readability
-			lines := strings.Split(output.Content, "\n")
-			for _, line := range lines {
-				fmt.Printf("    %s\n", line)
-			}
-			fmt.Println()
-		}
-	}
-
-	if len(additionalTargets) > 0 {
-		fmt.Println("Additional destinations:")
-		for _, target := range additionalTargets {
-			fmt.Printf("Additional JSON: %s\n", target.FilePath)
-			fmt.Printf("  JSON Path: %s\n", displayJSONPath(target.JSONPath))
-			content, err := buildAdditionalJSONContent(target, syncResult.Servers)
-			if err != nil {
-				fmt.Printf("  (error preparing content: %v)\n\n", err)
-				continue
-			}
-			content = strings.TrimRight(content, "\n")
-			if content == "" {
-				fmt.Println("  Content: <empty>")
-				fmt.Println()
-				continue
-			}
-			fmt.Println("  Content:")
-			lines := strings.Split(content, "\n")
-			for _, line := range lines {
-				fmt.Printf("    %s\n", line)
-			}
-			fmt.Println()
-		}
+		fatal(out, doc, err)
 	}
+	doc.describePlan(plan, redact, *force)
 
-	if len(additionalJSONCTargets) > 0 {
-		if len(additionalTargets) == 0 {
-			fmt.Println("Additional destinations:")
-		}
-		for _, target := range additionalJSONCTargets {
-			fmt.Printf("Additional JSONC: %s\n", target.FilePath)
-			fmt.Printf("  JSON Path: %s\n", displayJSONPath(target.JSONPath))
-			content, err := buildAdditionalJSONCContent(target, syncResult.Servers)
-			if err != nil {
-				fmt.Printf("  (error preparing content: %v)\n\n", err)
-				continue
-			}
-			content = strings.TrimRight(content, "\n")
-			if content == "" {
-				fmt.Println("  Content: <empty>")
-				fmt.Println()
-				continue
-			}
-			fmt.Println("  Content:")
-			lines := strings.Split(content, "\n")
-			for _, line := range lines {
-				fmt.Printf("    %s\n", line)
-			}
-			fmt.Println()
-		}
-	}
-
-	if !extraTargets.IsZero() {
-		fmt.Println("Extra copy targets:")
-		for _, target := range extraTargets.Files {
-			fmt.Printf("File Source: %s\n", target.Source)
-			for _, dest := range target.Destinations {
-				fmt.Printf("  -> %s\n", dest)
-			}
-			fmt.Println()
-		}
-		for _, target := range extraTargets.Directories {
-			fmt.Printf("Directory Source: %s\n", target.Source)
-			fmt.Println("  Destinations:")
-			for _, dest := range target.Destinations {
-				label := dest.Path
-				if dest.Flatten {
-					label = fmt.Sprintf("%s (flatten)", label)
-				}
-				fmt.Printf("    - %s\n", label)
-			}
-			fmt.Println()
-		}
-	}
-
-	// Display archive targets if configured
-	if len(archiveTargets) > 0 {
-		fmt.Println("Archive targets:")
-		for _, target := range archiveTargets {
-			fmt.Printf("  Source: %s\n", target.Source)
-			fmt.Printf("  Destination: %s\n", target.Destination)
-			fmt.Println()
-		}
-	}
-
-	// Display allowed tools if configured
-	if len(cfg.AllowedTools.AlwaysAllowedTools) > 0 {
-		fmt.Println("Allowed tools:")
-		homeDir, _ := os.UserHomeDir()
-
-		for _, agent := range cfg.AllowedTools.Targets.Agents {
-			switch agent.Name {
-			case "copilot":
-				defaultBinDir := filepath.Join(homeDir, ".local", "bin")
-				binDir := defaultBinDir
-				if agent.Path != "" {
-					binDir = agent.Path
-				}
-				wrapperPath := filepath.Join(binDir, "acp")
-				copilotPath, _ := exec.LookPath("copilot")
-				if copilotPath == "" {
-					copilotPath = "copilot"
-				}
-				script := buildWrapperScript(copilotPath, cfg.AllowedTools.AlwaysAllowedTools)
-				fmt.Printf("  [copilot] File: %s\n", wrapperPath)
-				fmt.Println("  Content:")
-				for _, line := range strings.Split(script, "\n") {
-					if line != "" {
-						fmt.Printf("    %s\n", line)
-					}
-				}
-			case "claude":
-				settingsPath := filepath.Join(homeDir, ".claude", "settings.json")
-				if agent.Path != "" {
-					settingsPath = agent.Path
-				}
-				fmt.Printf("  [claude] File: %s\n", settingsPath)
-				fmt.Println("  Content (permissions.allow):")
-				for _, tool := range cfg.AllowedTools.AlwaysAllowedTools {
-					fmt.Printf("    %s\n", convertToolToClaudePermission(tool))
-				}
-			case "codex":
-				defaultCodexPath := filepath.Join(homeDir, ".codex", "instructions.md")
-				rulesPath := defaultCodexPath
-				if agent.Path != "" {
-					rulesPath = agent.Path
-				}
-				fmt.Printf("  [codex] File: %s\n", rulesPath)
-				fmt.Println("  Content:")
-				for _, tool := range cfg.AllowedTools.AlwaysAllowedTools {
-					fmt.Printf("    %s\n", convertToolToCodexRule(tool))
-				}
-			}
-		}
-		fmt.Println()
+	// Display the dry run results as a diff against the files on disk
+	fmt.Fprintln(w, "\n=== Dry Run Results ===")
+	if rc.Profile != "" {
+		fmt.Fprintf(w, "Active MCP profile: %s\n", rc.Profile)
 	}
+	fmt.Fprintln(w, "The following configuration changes will be made:")
+	fmt.Fprintln(w)
+	printPreview(w, plan, out.color(), *force, redact)
 
 	// If dry-run mode, exit without making changes
 	if *dryRun {
-		fmt.Println("Dry run complete. No changes were made.")
+		fmt.Fprintln(w, "Dry run complete. No changes were made.")
+		exitOnError("sync", out.finish(doc, nil))
+		return
+	}
+
+	if len(plan.Errors) == 0 && !planHasChanges(plan) {
+		fmt.Fprintln(w, "Everything is up to date. No changes were made.")
+		exitOnError("sync", out.finish(doc, nil))
 		return
 	}
 
@@ -392,123 +244,95 @@ func main() {
 	}
 
 	// Apply the changes
-	fmt.Println("\nApplying changes...")
-	var applyErrors []string
-	for _, agent := range agentNames {
-		outputs := syncResult.Agents[agent]
-		for _, output := range outputs {
-			if err := writeAgentConfig(output.Config.FilePath, output.Content); err != nil {
-				msg := fmt.Sprintf("error writing config for %s: %v", agent, err)
-				log.Print(msg)
-				applyErrors = append(applyErrors, msg)
-				continue
-			}
-			fmt.Printf("  Updated: %s\n", output.Config.FilePath)
-		}
-	}
-
-	for _, target := range additionalTargets {
-		content, err := buildAdditionalJSONContent(target, syncResult.Servers)
-		if err != nil {
-			msg := fmt.Sprintf("error preparing additional JSON %s: %v", target.FilePath, err)
+	fmt.Fprintln(w, "\nApplying changes...")
+	applyErrors := append([]string(nil), plan.Errors...)
+	backups := backupStore()
+	backupRun := backups.Begin("sync")
+	files := plan.Files
+	if !*force {
+		var skipped []string
+		files, skipped = skipEdited(files)
+		for _, msg := range skipped {
 			log.Print(msg)
-			applyErrors = append(applyErrors, msg)
-			continue
-		}
-		if err := writeAgentConfig(target.FilePath, content); err != nil {
-			msg := fmt.Sprintf("error writing additional JSON %s: %v", target.FilePath, err)
-			log.Print(msg)
-			applyErrors = append(applyErrors, msg)
-			continue
-		}
-		fmt.Printf("  Updated additional JSON: %s\n", target.FilePath)
-		if target.JSONPath != "" {
-			fmt.Printf("    JSON Path: %s\n", target.JSONPath)
+			doc.addError(errorConflict, msg)
 		}
+		applyErrors = append(applyErrors, skipped...)
 	}
-
-	for _, target := range additionalJSONCTargets {
-		content, err := buildAdditionalJSONCContent(target, syncResult.Servers)
-		if err != nil {
-			msg := fmt.Sprintf("error preparing additional JSONC %s: %v", target.FilePath, err)
-			log.Print(msg)
-			applyErrors = append(applyErrors, msg)
-			continue
-		}
-		if err := writeAgentConfig(target.FilePath, content); err != nil {
-			msg := fmt.Sprintf("error writing additional JSONC %s: %v", target.FilePath, err)
-			log.Print(msg)
-			applyErrors = append(applyErrors, msg)
-			continue
-		}
-		fmt.Printf("  Updated additional JSONC: %s\n", target.FilePath)
-		if target.JSONPath != "" {
-			fmt.Printf("    JSON Path: %s\n", target.JSONPath)
-		}
+	replan := rc.plan
+	if *force {
+		replan = forceReplan(replan)
 	}
-
-	configDir := filepath.Dir(resolvedConfigPath)
-	for _, target := range extraTargets.Files {
-		if err := copyExtraFileTarget(target, configDir, servers); err != nil {
-			msg := fmt.Sprintf("error copying extra file %s: %v", target.Source, err)
-			log.Print(msg)
-			applyErrors = append(applyErrors, msg)
-			continue
-		}
-		fmt.Printf("  Copied extra file: %s -> %d destinations\n", target.Source, len(target.Destinations))
+	var result applyResult
+	switch {
+	case *atomic && len(applyErrors) > 0:
+		result.Errors = []string{"atomic apply aborted because some files could not be planned or were skipped; no files were changed"}
+	case *atomic:
+		result = applyFilesAtomic(w, files, backupRun, redact, replan)
+	default:
+		result = applyFiles(w, files, backupRun, redact, replan)
 	}
-	for _, target := range extraTargets.Directories {
-		count, err := copyExtraDirectoryTarget(target)
-		if err != nil {
-			msg := fmt.Sprintf("error copying extra directory %s: %v", target.Source, err)
-			log.Print(msg)
-			applyErrors = append(applyErrors, msg)
-			continue
-		}
-		fmt.Printf("  Copied extra directory: %s -> %d destination(s) (%d files)\n", target.Source, len(target.Destinations), count)
-		var flattened bool
-		for _, dest := range target.Destinations {
-			if dest.Flatten {
-				flattened = true
-				break
-			}
-		}
-		if flattened {
-			fmt.Println("    Applied flatten to some destinations")
-		}
+	doc.markApplied(files, result)
+	for _, msg := range result.Errors {
+		doc.addError(errorWrite, redact.String(msg))
 	}
-	for _, target := range archiveTargets {
-		count, err := archiveSubdirectories(target)
-		if err != nil {
-			msg := fmt.Sprintf("error archiving %s: %v", target.Source, err)
-			log.Print(msg)
-			applyErrors = append(applyErrors, msg)
-			continue
+	applyErrors = append(applyErrors, result.Errors...)
+	if len(result.Written) > 0 {
+		// Unchanged files are recorded too so their servers stay owned.
+		rc.State.Record(stateRun("sync", backupRun, append(result.Written, result.Unchanged...)))
+		if err := rc.State.Save(); err != nil {
+			log.Print(err)
+			doc.addError(errorWrite, err.Error())
+			applyErrors = append(applyErrors, err.Error())
 		}
-		fmt.Printf("  Archived: %s -> %s (%d zip files)\n", target.Source, target.Destination, count)
 	}
-	fmt.Println("\nConfiguration sync complete.")
-
-	// Generate allowed tools outputs if configured
-	if err := generateCopilotWrapper(cfg); err != nil {
-		log.Printf("Warning: failed to generate copilot wrapper: %v", err)
+	if err := finishBackupRun(w, backups, backupRun, rc.Config.Backups.Retain); err != nil {
+		log.Print(err)
+		doc.addError(errorWrite, err.Error())
+		applyErrors = append(applyErrors, err.Error())
 	}
-	if err := generateClaudePermissions(cfg); err != nil {
-		log.Printf("Warning: failed to generate Claude permissions: %v", err)
+	if len(backupRun.Entries) > 0 {
+		doc.BackupRun = backupRun.ID
 	}
-	if err := generateCodexRules(cfg); err != nil {
-		log.Printf("Warning: failed to generate Codex rules: %v", err)
+	if out.json() {
+		exitOnError("sync", out.finish(doc, nil))
+		return
 	}
-	
+	result.printSummary(os.Stdout)
+	fmt.Println("\nConfiguration sync complete.")
+
 	if len(applyErrors) > 0 {
 		fmt.Println("Encountered errors while applying changes:")
 		for _, msg := range applyErrors {
-			fmt.Printf("  - %s\n", msg)
+			fmt.Printf("  - %s\n", redact.String(msg))
 		}
 		os.Exit(1)
 	}
 }
 
+// fatal ends the process for err. In JSON mode err is reported in doc and
+// the exit code follows its category; in text mode it is logged.
+func fatal(out *output, doc document, err error) {
+	err = out.finish(doc, err)
+	var reported *reportedError
+	if errors.As(err, &reported) {
+		os.Exit(reported.code)
+	}
+	log.Fatal(err)
+}
+
+// exitOnError ends the process when command failed. Errors already printed
+// in a JSON document only set the exit code.
+func exitOnError(command string, err error) {
+	if err == nil {
+		return
+	}
+	var reported *reportedError
+	if errors.As(err, &reported) {
+		os.Exit(reported.code)
+	}
+	log.Fatalf("%s failed: %v", command, err)
+}
+
 func parseAgents(agents string) []string {
 	segments := strings.Split(agents, ",")
 	var out []string
@@ -529,11 +353,37 @@ func configTargetsToSyncer(targets []config.AgentTarget) []syncer.AgentTarget {
 			Name:               target.Name,
 			PathOverride:       target.Path,
 			DisabledMcpServers: target.DisabledMcpServers,
+			MergeStrategy:      target.MergeStrategy,
+			IncludeTags:        target.IncludeTags,
+			ExcludeTags:        target.ExcludeTags,
+			Profile:            target.Profile,
+			Secrets:            target.Secrets,
 		})
 	}
 	return out
 }
 
+// agentRegistry returns the built-in agents plus the custom agents defined in
+// the config.
+func agentRegistry(defs []config.AgentDefinition) (syncer.Registry, error) {
+	custom := make([]syncer.CustomAgent, 0, len(defs))
+	for _, def := range defs {
+		custom = append(custom, syncer.CustomAgent{
+			Name:     def.Name,
+			Path:     def.Path,
+			Format:   def.Format,
+			NodeName: def.RootNode,
+			Rules: transforms.FieldRules{
+				Rename:   def.Rules.Rename,
+				Drop:     def.Rules.Drop,
+				Defaults: def.Rules.Defaults,
+				TypeMap:  def.Rules.TypeMap,
+			},
+		})
+	}
+	return syncer.NewRegistry(custom)
+}
+
 func defaultConfigPath() string {
 	switch runtime.GOOS {
 	case "darwin":
@@ -568,7 +418,7 @@ func ensureConfigFile(path string) error {
 		return fmt.Errorf("configuration file %s is required", path)
 	}
 
-	cfg, err := collectConfig()
+	cfg, err := collectConfig(syncer.SupportedAgents())
 	if err != nil {
 		return fmt.Errorf("failed to collect configuration: %w", err)
 	}
@@ -587,19 +437,32 @@ func runInitCommand(args []string) error {
 	}
 
 	path := *configPath
+	var definitions []config.AgentDefinition
+	agents := syncer.SupportedAgents()
 	if _, err := os.Stat(path); err == nil {
 		if !promptUser(fmt.Sprintf("Configuration already exists at %s. Overwrite? [y/N]: ", path), false) {
 			fmt.Println("Init cancelled.")
 			return nil
 		}
+		// Keep custom agent definitions from the existing config so they can
+		// be selected in the wizard and survive the rewrite.
+		if existing, err := config.Load(path); err == nil {
+			definitions = existing.AgentDefinitions
+			registry, err := agentRegistry(definitions)
+			if err != nil {
+				return fmt.Errorf("invalid agent definitions in %q: %w", path, err)
+			}
+			agents = registry.Agents()
+		}
 	} else if !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("failed to inspect %q: %w", path, err)
 	}
 
-	cfg, err := collectConfig()
+	cfg, err := collectConfig(agents)
 	if err != nil {
 		return fmt.Errorf("failed to collect configuration: %w", err)
 	}
+	cfg.AgentDefinitions = definitions
 	if err := writeConfigFile(path, cfg); err != nil {
 		return err
 	}
@@ -632,10 +495,11 @@ func askYes(prompt string, defaultYes bool) bool {
 	}
 }
 
-func promptForConfig() (config.Config, error) {
+// promptForConfig asks for a configuration, offering agents as targets.
+func promptForConfig(agents []string) (config.Config, error) {
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("\nLet's create your agent-align configuration.")
-	targets, err := promptTargetAgents(reader)
+	targets, err := promptTargetAgents(reader, agents)
 	if err != nil {
 		return config.Config{}, err
 	}
@@ -664,8 +528,8 @@ func configPromptSuffix(path string) string {
 	return ""
 }
 
-func promptTargetAgents(reader *bufio.Reader) ([]config.AgentTarget, error) {
-	options := syncer.SupportedAgents()
+func promptTargetAgents(reader *bufio.Reader, agents []string) ([]config.AgentTarget, error) {
+	options := append([]string(nil), agents...)
 
 	sort.Strings(options)
 	fmt.Println("\nSelect target agents (enter comma-separated numbers, e.g. 1,3):")
@@ -816,7 +680,7 @@ func writeConfigFile(path string, cfg config.Config) error {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return fmt.Errorf("failed to ensure directory %q: %w", dir, err)
 	}
-	if err := os.WriteFile(path, data, 0o644); err != nil {
+	if err := fileutil.WriteFile(path, data, 0o644); err != nil {
 		printManualConfigInstructions(path, data)
 		return fmt.Errorf("failed to write config %q: %w", path, err)
 	}
@@ -827,23 +691,12 @@ func printManualConfigInstructions(path string, contents []byte) {
 	fmt.Fprintf(os.Stderr, "\nUnable to write the config file automatically. Please create %s with the following contents:\n\n%s\n", path, contents)
 }
 
-func writeAgentConfig(path, content string) error {
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("failed to ensure directory %q: %w", dir, err)
-	}
-	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
-		return fmt.Errorf("failed to write config %q: %w", path, err)
-	}
-	return nil
-}
-
 func validateCommand(args []string) error {
 	if len(args) <= 1 {
 		return nil
 	}
 	arg := args[1]
-	if arg == "" || arg == "init" || strings.HasPrefix(arg, "-") {
+	if arg == "" || arg == "init" || arg == "check" || arg == "import" || arg == "restore" || arg == "uninstall" || arg == "plan" || arg == "apply" || strings.HasPrefix(arg, "-") {
 		return nil
 	}
 	return fmt.Errorf("unknown command %q. Use -h for usage or run \"init\" to create a config.", arg)
@@ -877,54 +730,26 @@ func printDebugCommands(servers map[string]interface{}) {
 // It concatenates environment assignments (KEY=VALUE) before the command and
 // properly quotes arguments.
 func formatServerCommand(m map[string]interface{}) string {
-	// command
-	cmdVal, ok := m["command"]
-	if !ok {
-		return ""
-	}
-	cmdStr, ok := cmdVal.(string)
-	if !ok || strings.TrimSpace(cmdStr) == "" {
+	server := mcpserver.Parse("", m)
+	if strings.TrimSpace(server.Command) == "" {
 		return ""
 	}
 
-	// args may be an array
-	var args []string
-	if rawArgs, ok := m["args"]; ok {
-		switch v := rawArgs.(type) {
-		case []interface{}:
-			for _, ai := range v {
-				if s, ok := ai.(string); ok {
-					args = append(args, s)
-				}
-			}
-		case []string:
-			args = append(args, v...)
-		case string:
-			// single string argument
-			args = append(args, v)
-		}
+	// args may also be a single string argument
+	args := server.Args
+	if arg, ok := server.Extra[mcpserver.FieldArgs].(string); ok {
+		args = []string{arg}
 	}
 
-	// env may be a map
+	// env in key order
 	var envParts []string
-	if rawEnv, ok := m["env"]; ok {
-		if envMap, ok := rawEnv.(map[string]interface{}); ok {
-			// preserve insertion order by sorting keys
-			var keys []string
-			for k := range envMap {
-				keys = append(keys, k)
-			}
-			sort.Strings(keys)
-			for _, k := range keys {
-				v := envMap[k]
-				sval := fmt.Sprintf("%v", v)
-				// if value looks like ${VAR} or starts with $ keep as-is
-				if (strings.HasPrefix(sval, "${") && strings.HasSuffix(sval, "}")) || strings.HasPrefix(sval, "$") {
-					envParts = append(envParts, fmt.Sprintf("%s=%s", k, sval))
-				} else {
-					envParts = append(envParts, fmt.Sprintf("%s=%s", k, shellQuote(sval)))
-				}
-			}
+	for _, k := range mcpserver.SortedKeys(server.Env) {
+		sval := server.Env[k]
+		// if value looks like ${VAR} or starts with $ keep as-is
+		if (strings.HasPrefix(sval, "${") && strings.HasSuffix(sval, "}")) || strings.HasPrefix(sval, "$") {
+			envParts = append(envParts, fmt.Sprintf("%s=%s", k, sval))
+		} else {
+			envParts = append(envParts, fmt.Sprintf("%s=%s", k, shellQuote(sval)))
 		}
 	}
 
@@ -934,7 +759,7 @@ func formatServerCommand(m map[string]interface{}) string {
 		parts = append(parts, strings.Join(envParts, " "))
 	}
 	// quote the command itself if needed
-	parts = append(parts, shellQuote(cmdStr))
+	parts = append(parts, shellQuote(server.Command))
 	for _, a := range args {
 		parts = append(parts, shellQuote(a))
 	}
@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"agent-align/internal/config"
+	"agent-align/internal/syncer"
 )
 
 func TestParseAgents(t *testing.T) {
@@ -73,6 +74,22 @@ func TestValidateCommand(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
+	if err := validateCommand([]string{"agent-align", "check"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := validateCommand([]string{"agent-align", "import"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := validateCommand([]string{"agent-align", "restore"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := validateCommand([]string{"agent-align", "uninstall"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
 	if err := validateCommand([]string{"agent-align", "-config"}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -115,7 +132,7 @@ func TestEnsureConfigFileCreatesFile(t *testing.T) {
 	}()
 
 	promptUser = func(string, bool) bool { return true }
-	collectConfig = func() (config.Config, error) {
+	collectConfig = func([]string) (config.Config, error) {
 		return config.Config{
 			MCP: config.MCPConfig{
 				Targets: config.TargetsConfig{
@@ -144,7 +161,7 @@ func TestEnsureConfigFileCreatesFile(t *testing.T) {
 
 func TestPromptTargetAgents(t *testing.T) {
 	reader := bufio.NewReader(strings.NewReader("0\n1,3\n"))
-	targets, err := promptTargetAgents(reader)
+	targets, err := promptTargetAgents(reader, syncer.SupportedAgents())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
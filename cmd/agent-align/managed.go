@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-align/internal/backup"
+	"agent-align/internal/state"
+)
+
+// stateDir returns the directory agent-align keeps run state in, following
+// the XDG base directory spec.
+func stateDir() string {
+	if base := os.Getenv("XDG_STATE_HOME"); base != "" {
+		return filepath.Join(base, "agent-align")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "agent-align")
+	}
+	return filepath.Join(home, ".local", "state", "agent-align")
+}
+
+// statePath is the file recording what each run wrote, including which
+// server IDs agent-align owns in each agent file so managed-only targets can
+// leave foreign servers alone.
+func statePath() string {
+	return filepath.Join(stateDir(), "state.json")
+}
+
+// stateRun describes the files a command wrote or removed for the state file.
+func stateRun(command string, backupRun *backup.Run, written []plannedFile) state.Run {
+	run := state.Run{ID: backupRun.ID, Time: time.Now().UTC(), Command: command}
+	if len(backupRun.Entries) > 0 {
+		run.Backup = backupRun.ID
+	}
+	for _, file := range written {
+		if file.Delete {
+			run.Removed = append(run.Removed, file.Path)
+			continue
+		}
+		record := state.File{
+			Path:     file.Path,
+			Category: file.Category,
+			Agent:    file.Agent,
+			Source:   file.Source,
+			Hash:     state.Hash(file.Content),
+			Servers:  append([]string(nil), file.Servers...),
+			Tools:    append([]string(nil), file.Tools...),
+		}
+		if file.Merge {
+			record.ManagedHash, _ = managedHash(file, file.Servers, file.Content)
+		}
+		run.Files = append(run.Files, record)
+	}
+	return run
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"agent-align/internal/backup"
+	"agent-align/internal/state"
+)
+
+func TestStateRecordsWrittenFiles(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := statePath()
+	if filepath.Base(filepath.Dir(path)) != "agent-align" {
+		t.Fatalf("expected state to live in an agent-align directory, got %s", path)
+	}
+
+	st, err := state.Load(path)
+	if err != nil || len(st.ManagedServers()) != 0 {
+		t.Fatalf("expected empty state for missing file, got %v (err %v)", st, err)
+	}
+
+	written := []plannedFile{
+		{Category: categoryAgents, Agent: "claudecode", Path: "/home/me/.claude.json", Content: []byte("{}"), Servers: []string{"web", "fs"}},
+		{Category: categoryAllowedTools, Agent: "copilot", Path: "/home/me/.local/bin/acp", Content: []byte("#!/bin/sh")},
+		{Category: categoryArchives, Path: "/home/me/skills/demo.zip", Source: "/home/me/skills/demo", Content: []byte("zip")},
+	}
+	st.Record(stateRun("sync", &backup.Run{ID: "20260101-120000"}, written))
+	if err := st.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	loaded, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	want := map[string][]string{"/home/me/.claude.json": {"fs", "web"}}
+	if got := loaded.ManagedServers(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got := loaded.Wrappers(); !reflect.DeepEqual(got, []string{"/home/me/.local/bin/acp"}) {
+		t.Fatalf("unexpected wrappers %v", got)
+	}
+	if got := loaded.Archives(); !reflect.DeepEqual(got, []string{"/home/me/skills/demo.zip"}) {
+		t.Fatalf("unexpected archives %v", got)
+	}
+	file, ok := loaded.Lookup("/home/me/.claude.json")
+	if !ok || file.Hash != state.Hash([]byte("{}")) {
+		t.Fatalf("unexpected record %+v", file)
+	}
+	if len(loaded.Runs) != 1 || loaded.Runs[0].Command != "sync" || loaded.Runs[0].Backup != "" {
+		t.Fatalf("unexpected runs %+v", loaded.Runs)
+	}
+}
+
+func TestStateReadsLegacyManagedServers(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	legacy := filepath.Join(stateDir(), "managed-servers.json")
+	if err := os.MkdirAll(filepath.Dir(legacy), 0o755); err != nil {
+		t.Fatalf("failed to create state dir: %v", err)
+	}
+	if err := os.WriteFile(legacy, []byte(`{"/home/me/.claude.json": ["fs"]}`), 0o644); err != nil {
+		t.Fatalf("failed to write legacy file: %v", err)
+	}
+
+	st, err := state.Load(statePath())
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	want := map[string][]string{"/home/me/.claude.json": {"fs"}}
+	if got := st.ManagedServers(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if err := st.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("expected legacy file to be removed, got %v", err)
+	}
+}
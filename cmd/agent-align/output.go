@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"agent-align/internal/mcpserver"
+)
+
+// Output formats selected with -output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputSchemaVersion is the version of the documents printed with -output
+// json. It only changes when a field is removed or changes meaning; new
+// fields can be added without a new version.
+const outputSchemaVersion = 1
+
+// Error categories reported in JSON documents.
+const (
+	errorInternal = "internal" // unexpected failure
+	errorUsage    = "usage"    // invalid flags or arguments
+	errorConfig   = "config"   // the config or MCP definitions could not be loaded
+	errorConflict = "conflict" // a target changed underneath agent-align
+	errorTarget   = "target"   // a target's content could not be prepared
+	errorWrite    = "write"    // a file could not be written or removed
+)
+
+// errorExitCodes is the exit code of each error category in JSON mode. Usage
+// errors exit with 64, EX_USAGE from sysexits.h, so they are never mistaken
+// for the drift code of check.
+var errorExitCodes = map[string]int{
+	errorInternal: 1,
+	errorUsage:    checkExitUsage,
+	errorConfig:   3,
+	errorConflict: 4,
+	errorTarget:   5,
+	errorWrite:    6,
+}
+
+// categorizedError is an error with the category it is reported under.
+type categorizedError struct {
+	category string
+	err      error
+}
+
+func (e *categorizedError) Error() string { return e.err.Error() }
+func (e *categorizedError) Unwrap() error { return e.err }
+
+// categorize tags err with category unless it already has one.
+func categorize(category string, err error) error {
+	var c *categorizedError
+	if err == nil || errors.As(err, &c) {
+		return err
+	}
+	return &categorizedError{category: category, err: err}
+}
+
+// errorCategory returns the category err was tagged with, or errorInternal.
+func errorCategory(err error) string {
+	var c *categorizedError
+	if errors.As(err, &c) {
+		return c.category
+	}
+	return errorInternal
+}
+
+// reportedError is a failure that was already printed in a JSON document, so
+// main only exits with its code.
+type reportedError struct {
+	code int
+}
+
+func (e *reportedError) Error() string {
+	return fmt.Sprintf("command failed with exit code %d", e.code)
+}
+
+// outputError is an error in a JSON document.
+type outputError struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// outputHeader starts every JSON document.
+type outputHeader struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Command       string        `json:"command"`
+	ExitCode      int           `json:"exitCode"`
+	Errors        []outputError `json:"errors"`
+}
+
+func (h *outputHeader) header() *outputHeader { return h }
+
+// addError records msg under category. A document exits with the code of its
+// first error.
+func (h *outputHeader) addError(category, msg string) {
+	code := errorExitCodes[category]
+	h.Errors = append(h.Errors, outputError{Category: category, Message: msg, ExitCode: code})
+	if h.ExitCode == 0 {
+		h.ExitCode = code
+	}
+}
+
+// document is a JSON document printed by a command.
+type document interface {
+	header() *outputHeader
+}
+
+// output sends a command's results to stdout as text or as one JSON document.
+type output struct {
+	format string
+	w      io.Writer
+}
+
+// addOutputFlag registers -output on fs.
+func addOutputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", outputText, "output format: text or json (a versioned document for scripts)")
+}
+
+func newOutput(format string, w io.Writer) (*output, error) {
+	switch format {
+	case outputText, outputJSON:
+		return &output{format: format, w: w}, nil
+	}
+	return nil, categorize(errorUsage, fmt.Errorf("unknown output format %q (expected text or json)", format))
+}
+
+func (o *output) json() bool {
+	return o.format == outputJSON
+}
+
+// text is where human-readable output goes. It is discarded in JSON mode so
+// stdout only holds the document.
+func (o *output) text() io.Writer {
+	if o.json() {
+		return io.Discard
+	}
+	return o.w
+}
+
+// color reports whether text output should be colored.
+func (o *output) color() bool {
+	f, ok := o.w.(*os.File)
+	return ok && !o.json() && colorEnabled(f)
+}
+
+// finish ends a command. In text mode err is returned unchanged. In JSON mode
+// doc is printed with err added to its errors, and a reportedError carrying
+// the document's exit code is returned when it has any errors.
+func (o *output) finish(doc document, err error) error {
+	if !o.json() {
+		return err
+	}
+	h := doc.header()
+	if err != nil {
+		h.addError(errorCategory(err), err.Error())
+	}
+	if err := o.write(doc); err != nil {
+		return err
+	}
+	if h.ExitCode != 0 {
+		return &reportedError{code: h.ExitCode}
+	}
+	return nil
+}
+
+// write prints doc as JSON with the current schema version.
+func (o *output) write(doc document) error {
+	h := doc.header()
+	h.SchemaVersion = outputSchemaVersion
+	if h.Errors == nil {
+		h.Errors = []outputError{}
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	fmt.Fprintln(o.w, string(data))
+	return nil
+}
+
+// writeList prints values as a bare JSON array, for commands whose result is
+// a plain list.
+func (o *output) writeList(values []string) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	fmt.Fprintln(o.w, string(data))
+	return nil
+}
+
+// requireConfirmation rejects JSON runs that would stop at a prompt.
+func (o *output) requireConfirmation(confirm bool) error {
+	if o.json() && !confirm {
+		return categorize(errorUsage, errors.New("-output json cannot prompt; pass -confirm or -dry-run"))
+	}
+	return nil
+}
+
+// targetStatus is one planned file in a JSON document. Status is the change
+// the file would get in a dry run or plan and the change it got once applied:
+// created, updated, unchanged, or removed. Files left alone because they were
+// edited are skipped, and files that could not be read or written are failed.
+type targetStatus struct {
+	Category string   `json:"category"`
+	Label    string   `json:"label"`
+	Path     string   `json:"path"`
+	Format   string   `json:"format"`
+	Agent    string   `json:"agent,omitempty"`
+	Servers  []string `json:"servers,omitempty"`
+	Status   string   `json:"status"`
+	Diff     string   `json:"diff,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Target states besides the changes an apply makes.
+const (
+	statusSkipped = "skipped"
+	statusFailed  = "failed"
+)
+
+// syncDocument is the JSON result of the commands that write planned files:
+// sync, uninstall, plan, and apply.
+type syncDocument struct {
+	outputHeader
+	DryRun    bool           `json:"dryRun"`
+	Profile   string         `json:"profile,omitempty"`
+	PlanFile  string         `json:"planFile,omitempty"`
+	BackupRun string         `json:"backupRun,omitempty"`
+	Targets   []targetStatus `json:"targets"`
+	// Diagnostics are the problems found in the servers of each agent.
+	Diagnostics []diagnostic `json:"diagnostics,omitempty"`
+}
+
+// diagnostic is a problem with one server for one agent.
+type diagnostic struct {
+	Severity string `json:"severity"`
+	Kind     string `json:"kind,omitempty"`
+	Agent    string `json:"agent"`
+	Server   string `json:"server,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+func newSyncDocument(command string, dryRun bool) *syncDocument {
+	return &syncDocument{outputHeader: outputHeader{Command: command}, DryRun: dryRun, Targets: []targetStatus{}}
+}
+
+// describeTargets reports the change each file would get, with its diff and
+// preview warnings. It must run before anything is applied.
+func (d *syncDocument) describeTargets(files []plannedFile, redact *redactor, force bool) {
+	for _, file := range files {
+		target := targetStatus{
+			Category: file.Category,
+			Label:    file.Label,
+			Path:     file.Path,
+			Format:   fileFormat(file),
+			Agent:    file.Agent,
+			Servers:  file.Servers,
+		}
+		change, err := fileChange(file)
+		if err == nil {
+			target.Status = change
+			target.Diff, err = diffPlannedFile(file, redact)
+		}
+		if err != nil {
+			target.Status = statusFailed
+			target.Error = redact.String(err.Error())
+		}
+		for _, warning := range []string{permissionWarning(file), editedWarning(file, force)} {
+			if warning != "" {
+				target.Warnings = append(target.Warnings, warning)
+			}
+		}
+		d.Targets = append(d.Targets, target)
+	}
+}
+
+// describePlan reports the files of plan like describeTargets, followed by
+// the agent targets that could not be rendered, and adds the plan's errors
+// and diagnostics.
+func (d *syncDocument) describePlan(plan syncPlan, redact *redactor, force bool) {
+	d.describeTargets(plan.Files, redact, force)
+	for _, failed := range plan.Failed {
+		d.Targets = append(d.Targets, targetStatus{
+			Category: categoryAgents,
+			Label:    "Agent " + failed.Agent,
+			Path:     failed.Path,
+			Format:   fileFormat(plannedFile{Path: failed.Path}),
+			Agent:    failed.Agent,
+			Status:   statusFailed,
+			Error:    redact.String(failed.Err.Error()),
+		})
+	}
+	for _, msg := range plan.Errors {
+		d.addError(errorTarget, redact.String(msg))
+	}
+	for _, diag := range plan.Diagnostics {
+		d.Diagnostics = append(d.Diagnostics, diagnostic{
+			Severity: diag.Severity,
+			Kind:     diag.Kind,
+			Agent:    diag.Agent,
+			Server:   diag.Server,
+			Field:    diag.Field,
+			Message:  redact.String(diag.Message),
+		})
+	}
+}
+
+// markApplied updates the targets after applied was handed to an apply that
+// returned result. Planned files left out of applied were skipped, and those
+// the apply did not get to were failed. Targets that already failed keep
+// their error.
+func (d *syncDocument) markApplied(applied []plannedFile, result applyResult) {
+	attempted := make(map[string]bool, len(applied))
+	for _, file := range applied {
+		attempted[file.Path] = true
+	}
+	for i, target := range d.Targets {
+		switch change, ok := result.changes[target.Path]; {
+		case ok:
+			d.Targets[i].Status = change
+		case target.Error != "":
+			d.Targets[i].Status = statusFailed
+		case !attempted[target.Path]:
+			d.Targets[i].Status = statusSkipped
+		default:
+			d.Targets[i].Status = statusFailed
+		}
+	}
+}
+
+// fileFormat names the format of a planned file, falling back to its
+// extension.
+func fileFormat(file plannedFile) string {
+	if file.Format != "" {
+		return file.Format
+	}
+	switch ext := strings.ToLower(filepath.Ext(file.Path)); ext {
+	case ".json", ".jsonc", ".toml", ".zip":
+		return ext[1:]
+	case ".yml", ".yaml":
+		return "yaml"
+	}
+	return "text"
+}
+
+// serverLaunch is how an MCP server is started, for -debug.
+type serverLaunch struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Shell is the same one-line command printed in text mode.
+	Shell string `json:"shell,omitempty"`
+}
+
+type debugDocument struct {
+	outputHeader
+	Servers []serverLaunch `json:"servers"`
+}
+
+// serverLaunches describes each server in name order. Servers that are not
+// mappings are left out, as they are in text mode.
+func serverLaunches(servers map[string]interface{}) []serverLaunch {
+	var names []string
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	launches := []serverLaunch{}
+	for _, name := range names {
+		m, ok := servers[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		server := mcpserver.Parse(name, m)
+		launch := serverLaunch{
+			Name:    name,
+			Type:    server.Type,
+			Command: server.Command,
+			Args:    server.Args,
+			URL:     server.URL,
+			Shell:   formatServerCommand(m),
+		}
+		if arg, ok := server.Extra[mcpserver.FieldArgs].(string); ok {
+			launch.Args = []string{arg}
+		}
+		if len(server.Env) > 0 {
+			launch.Env = server.Env
+		}
+		if len(server.Headers) > 0 {
+			launch.Headers = server.Headers
+		}
+		launches = append(launches, launch)
+	}
+	return launches
+}
+
+type allowedToolsDocument struct {
+	outputHeader
+	ConfigPath   string   `json:"configPath,omitempty"`
+	Updated      bool     `json:"updated,omitempty"`
+	AllowedTools []string `json:"allowedTools"`
+}
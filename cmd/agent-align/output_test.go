@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOutputFinishReportsCategorizedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	out, err := newOutput(outputJSON, &buf)
+	if err != nil {
+		t.Fatalf("newOutput returned error: %v", err)
+	}
+	doc := newSyncDocument("sync", false)
+	doc.addError(errorConflict, "skipped a.json")
+	err = out.finish(doc, categorize(errorWrite, errors.New("disk full")))
+
+	var reported *reportedError
+	if !errors.As(err, &reported) || reported.code != errorExitCodes[errorConflict] {
+		t.Fatalf("expected the first error's exit code, got %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if got["schemaVersion"] != float64(outputSchemaVersion) || got["command"] != "sync" || got["exitCode"] != float64(4) {
+		t.Fatalf("unexpected header: %v", got)
+	}
+	errs := got["errors"].([]interface{})
+	last := errs[1].(map[string]interface{})
+	if len(errs) != 2 || last["category"] != errorWrite || last["message"] != "disk full" || last["exitCode"] != float64(6) {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
+func TestExportAllowedToolsJSONPrintsArray(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.md")
+	if err := os.WriteFile(rules, []byte(`prefix_rule(pattern=["git", "fetch"], decision="allow")`+"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	configPath := filepath.Join(dir, "agent-align.yml")
+	config := "mcpServers:\n  targets:\n    agents: [codex]\nallowedTools:\n  targets:\n    agents:\n      - name: codex\n        path: " + rules + "\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	var buf bytes.Buffer
+	out, _ := newOutput(outputJSON, &buf)
+	if err := exportAllowedTools(out, configPath); err != nil {
+		t.Fatalf("exportAllowedTools returned error: %v", err)
+	}
+	var tools []string
+	if err := json.Unmarshal(buf.Bytes(), &tools); err != nil {
+		t.Fatalf("expected a JSON array: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(tools, []string{"shell(git fetch)"}) {
+		t.Fatalf("unexpected tools %v", tools)
+	}
+
+	buf.Reset()
+	err := exportAllowedTools(out, filepath.Join(dir, "missing.yml"))
+	var reported *reportedError
+	if !errors.As(err, &reported) || reported.code != errorExitCodes[errorConfig] || !bytes.Contains(buf.Bytes(), []byte(`"errors"`)) {
+		t.Fatalf("expected a config error document, got %v\n%s", err, buf.String())
+	}
+}
+
+func TestOutputRejectsUnknownFormat(t *testing.T) {
+	_, err := newOutput("xml", os.Stdout)
+	if err == nil || errorCategory(err) != errorUsage {
+		t.Fatalf("expected usage error, got %v", err)
+	}
+}
+
+func TestOutputJSONRequiresConfirmation(t *testing.T) {
+	out, _ := newOutput(outputJSON, &bytes.Buffer{})
+	if err := out.requireConfirmation(false); errorCategory(err) != errorUsage {
+		t.Fatalf("expected usage error, got %v", err)
+	}
+	if err := out.requireConfirmation(true); err != nil {
+		t.Fatalf("expected no error with confirmation, got %v", err)
+	}
+	text, _ := newOutput(outputText, &bytes.Buffer{})
+	if err := text.requireConfirmation(false); err != nil {
+		t.Fatalf("expected text mode to allow prompts, got %v", err)
+	}
+}
+
+func TestPlanCommandJSONListsTargets(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	configPath := writeCheckFixture(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "extra.json"), []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runPlanCommand([]string{"-config", configPath, "-output", "json"}, &out); err != nil {
+		t.Fatalf("plan returned error: %v\n%s", err, out.String())
+	}
+	var doc syncDocument
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not a single JSON document: %v\n%s", err, out.String())
+	}
+	if doc.SchemaVersion != outputSchemaVersion || doc.Command != "plan" || !doc.DryRun || len(doc.Errors) != 0 {
+		t.Fatalf("unexpected header: %+v", doc.outputHeader)
+	}
+	if len(doc.Targets) != 2 {
+		t.Fatalf("expected 2 targets, got %+v", doc.Targets)
+	}
+	agent, extra := doc.Targets[0], doc.Targets[1]
+	if agent.Status != changeCreated || agent.Format != "json" || agent.Agent != "vscode" || !reflect.DeepEqual(agent.Servers, []string{"fs"}) {
+		t.Fatalf("unexpected agent target: %+v", agent)
+	}
+	if extra.Status != changeUpdated || extra.Category != categoryAdditional || extra.Diff == "" {
+		t.Fatalf("unexpected additional target: %+v", extra)
+	}
+}
+
+func TestUninstallCommandJSONRequiresConfirmation(t *testing.T) {
+	_, configPath := writeUninstallFixture(t)
+
+	var out bytes.Buffer
+	err := runUninstallCommand([]string{"-config", configPath, "-output", "json"}, &out)
+	var reported *reportedError
+	if !errors.As(err, &reported) || reported.code != errorExitCodes[errorUsage] {
+		t.Fatalf("expected usage exit code, got %v", err)
+	}
+	var doc syncDocument
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out.String())
+	}
+	if len(doc.Errors) != 1 || doc.Errors[0].Category != errorUsage {
+		t.Fatalf("expected one usage error, got %+v", doc.Errors)
+	}
+}
+
+func TestServerLaunchesDescribeEachServer(t *testing.T) {
+	launches := serverLaunches(map[string]interface{}{
+		"web": map[string]interface{}{"type": "http", "url": "https://example.com/mcp", "headers": map[string]interface{}{"Authorization": "***"}},
+		"fs":  map[string]interface{}{"command": "npx", "args": []interface{}{"-y", "fs"}, "env": map[string]interface{}{"ROOT": "/tmp"}},
+		"bad": "not a server",
+	})
+	if len(launches) != 2 || launches[0].Name != "fs" || launches[1].Name != "web" {
+		t.Fatalf("unexpected launches: %+v", launches)
+	}
+	fs := launches[0]
+	if fs.Command != "npx" || !reflect.DeepEqual(fs.Args, []string{"-y", "fs"}) || fs.Env["ROOT"] != "/tmp" || fs.Shell != "ROOT=/tmp npx -y fs" {
+		t.Fatalf("unexpected stdio launch: %+v", fs)
+	}
+	web := launches[1]
+	if web.Type != "http" || web.URL != "https://example.com/mcp" || web.Headers["Authorization"] != "***" {
+		t.Fatalf("unexpected http launch: %+v", web)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// secretFileMode is the mode for new files that will hold secrets.
+const secretFileMode os.FileMode = 0o600
+
+// markSecretFiles flags the planned files whose content includes secrets,
+// using the same rules as the preview redaction.
+func markSecretFiles(plan *syncPlan, values []string) {
+	redact := newRedactor(values, false)
+	for i, file := range plan.Files {
+		if file.Category == categoryArchives || isBinary(file.Content) {
+			continue
+		}
+		content := string(file.Content)
+		plan.Files[i].Secret = redact.String(content) != content
+	}
+}
+
+// fileMode returns the mode file should be written with: the mode of the
+// existing file when there is one, otherwise 0600 for files holding secrets
+// and the planned mode for the rest.
+func fileMode(file plannedFile) (os.FileMode, error) {
+	info, err := os.Stat(file.Path)
+	switch {
+	case err == nil:
+		return info.Mode().Perm(), nil
+	case errors.Is(err, os.ErrNotExist):
+		if file.Secret {
+			return secretFileMode, nil
+		}
+		return file.Mode, nil
+	default:
+		return 0, fmt.Errorf("failed to inspect %q: %w", file.Path, err)
+	}
+}
+
+// permissionWarning describes an existing destination that is readable by
+// group or others and would receive secrets. It returns "" when there is
+// nothing to report.
+func permissionWarning(file plannedFile) string {
+	if !file.Secret || runtime.GOOS == "windows" {
+		return ""
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil || info.Mode().Perm()&0o044 == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s will contain secrets but is readable by group or others (mode %04o); run chmod 600 %s", file.Path, info.Mode().Perm(), file.Path)
+}
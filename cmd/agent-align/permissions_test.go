@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWritePlannedFileModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.json")
+	if err := os.WriteFile(existing, []byte("{}\n"), 0o640); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Chmod(existing, 0o640); err != nil {
+		t.Fatalf("failed to chmod file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		file plannedFile
+		want os.FileMode
+	}{
+		{name: "new secret file", file: plannedFile{Path: filepath.Join(dir, "secret.json"), Mode: 0o644, Secret: true}, want: 0o600},
+		{name: "existing file", file: plannedFile{Path: existing, Mode: 0o644, Secret: true}, want: 0o640},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.file.Content = []byte("{}\n")
+			if err := writePlannedFile(tt.file); err != nil {
+				t.Fatalf("writePlannedFile returned error: %v", err)
+			}
+			info, err := os.Stat(tt.file.Path)
+			if err != nil {
+				t.Fatalf("failed to stat file: %v", err)
+			}
+			if got := info.Mode().Perm(); got != tt.want {
+				t.Fatalf("expected mode %04o, got %04o", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMarkSecretFilesAndPermissionWarning(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+	path := filepath.Join(t.TempDir(), "claude.json")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatalf("failed to chmod file: %v", err)
+	}
+
+	plan := syncPlan{Files: []plannedFile{
+		{Category: categoryAgents, Path: path, Content: []byte(`{"env": {"GITHUB_TOKEN": "ghp_x"}}`)},
+		{Category: categoryAgents, Path: path, Content: []byte(`{"env": {"GITHUB_TOKEN": "${GITHUB_TOKEN}"}}`)},
+		{Category: categoryExtra, Path: path, Content: []byte("uses the value resolved-secret\n")},
+	}}
+	markSecretFiles(&plan, []string{"resolved-secret"})
+	for i, want := range []bool{true, false, true} {
+		if plan.Files[i].Secret != want {
+			t.Fatalf("file %d: expected Secret=%v", i, want)
+		}
+	}
+
+	if warning := permissionWarning(plan.Files[0]); !strings.Contains(warning, "readable by group or others (mode 0644)") {
+		t.Fatalf("expected permission warning, got %q", warning)
+	}
+	if warning := permissionWarning(plan.Files[1]); warning != "" {
+		t.Fatalf("expected no warning for a file without secrets, got %q", warning)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"agent-align/internal/config"
+	"agent-align/internal/fileutil"
+	"agent-align/internal/state"
+	"agent-align/internal/syncer"
+	"agent-align/internal/transforms"
+)
+
+// Categories group planned files in previews and summaries.
+const (
+	categoryAgents       = state.CategoryAgents
+	categoryAdditional   = state.CategoryAdditional
+	categoryExtra        = state.CategoryExtra
+	categoryArchives     = state.CategoryArchives
+	categoryAllowedTools = state.CategoryAllowedTools
+)
+
+// planCategories lists the categories in the order they are applied.
+var planCategories = []string{categoryAgents, categoryAdditional, categoryExtra, categoryArchives, categoryAllowedTools}
+
+// plannedFile is a file a run would write, rendered in memory so it can be
+// previewed or compared with the copy on disk before anything is written.
+type plannedFile struct {
+	Category string
+	Label    string // short description shown next to the path
+	Path     string
+	Source   string // source file or directory for copies and archives
+	Agent    string // agent an agent file or allowed-tools output belongs to
+	Format   string // file format when it is not clear from the extension
+	Node     string // node holding the servers in an agent file
+	Content  []byte
+	Mode     os.FileMode
+	Servers  []string // server IDs rendered into an agent file
+	Tools    []string // entries rendered into an allowed-tools output
+	Secret   bool     // content includes secret values
+	Delete   bool     // remove the file instead of writing Content
+	BaseHash string   // hash of the destination when rendered; "" if missing
+	Edited   bool     // destination changed since agent-align last wrote it
+	Merge    bool     // content is merged into the destination's other settings
+	// ManagedPath is the JSON path of the node agent-align writes in a merged
+	// JSON file other than an agent config; empty means the whole document.
+	ManagedPath []string
+	Frozen      bool // content comes from a saved plan and is written as is
+}
+
+// syncPlan is every file a run would write plus the targets whose content
+// could not be prepared.
+type syncPlan struct {
+	Files  []plannedFile
+	Errors []string
+	// Failed are the agent targets that could not be rendered; their errors
+	// are in Errors too.
+	Failed []failedTarget
+	// Diagnostics are the typed problems found in the servers of each agent,
+	// warnings included.
+	Diagnostics []transforms.Diagnostic
+}
+
+// failedTarget is an agent target that is left alone because its content
+// could not be rendered.
+type failedTarget struct {
+	Agent string
+	Path  string
+	Err   error
+}
+
+// planInputs is everything needed to render the outputs of a run.
+type planInputs struct {
+	Result          syncer.SyncResult
+	Servers         map[string]interface{} // MCP servers as loaded, for extra file templates
+	Profiles        map[string]string      // agent file path -> MCP profile it was rendered with
+	AdditionalJSON  []config.AdditionalJSONTarget
+	AdditionalJSONC []config.AdditionalJSONTarget
+	Extra           config.ExtraTargetsConfig
+	Archives        []config.ArchiveTarget
+	Config          config.Config
+	ConfigDir       string
+}
+
+func agentLabel(agent, format, profile string) string {
+	if profile != "" {
+		return fmt.Sprintf("Agent %s (%s, profile %s)", agent, format, profile)
+	}
+	return fmt.Sprintf("Agent %s (%s)", agent, format)
+}
+
+// buildPlan renders the content of every output in the order it is applied:
+// agents, additional destinations, extra copies, archives, and allowed tools.
+func buildPlan(in planInputs) syncPlan {
+	var plan syncPlan
+
+	var agentNames []string
+	for name := range in.Result.Agents {
+		agentNames = append(agentNames, name)
+	}
+	sort.Strings(agentNames)
+	for _, target := range in.Result.Targets {
+		plan.Diagnostics = append(plan.Diagnostics, target.Diagnostics...)
+		if target.Err == nil {
+			continue
+		}
+		plan.Failed = append(plan.Failed, failedTarget{Agent: target.Agent, Path: target.Path, Err: target.Err})
+		if target.Path == "" {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error rendering agent %s: %v", target.Agent, target.Err))
+		} else {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error rendering agent %s (%s): %v", target.Agent, target.Path, target.Err))
+		}
+	}
+	for _, agent := range agentNames {
+		for _, output := range in.Result.Agents[agent] {
+			plan.Files = append(plan.Files, plannedFile{
+				Category: categoryAgents,
+				Label:    agentLabel(agent, output.Config.Format, in.Profiles[output.Config.FilePath]),
+				Agent:    agent,
+				Format:   output.Config.Format,
+				Node:     output.Config.NodeName,
+				Path:     output.Config.FilePath,
+				Content:  []byte(output.Content),
+				Mode:     0o644,
+				Servers:  output.Managed,
+				Merge:    true,
+			})
+		}
+	}
+
+	for _, target := range in.AdditionalJSON {
+		content, err := buildAdditionalJSONContent(target, in.Result.Servers)
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error preparing additional JSON %s: %v", target.FilePath, err))
+			continue
+		}
+		plan.Files = append(plan.Files, plannedFile{
+			Category:    categoryAdditional,
+			Label:       fmt.Sprintf("Additional JSON (%s)", displayJSONPath(target.JSONPath)),
+			Format:      "json",
+			Path:        target.FilePath,
+			Content:     []byte(content),
+			Mode:        0o644,
+			Merge:       true,
+			ManagedPath: jsonPathSegments(target.JSONPath),
+		})
+	}
+	for _, target := range in.AdditionalJSONC {
+		content, err := buildAdditionalJSONCContent(target, in.Result.Servers)
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error preparing additional JSONC %s: %v", target.FilePath, err))
+			continue
+		}
+		plan.Files = append(plan.Files, plannedFile{
+			Category:    categoryAdditional,
+			Label:       fmt.Sprintf("Additional JSONC (%s)", displayJSONPath(target.JSONPath)),
+			Format:      "jsonc",
+			Path:        target.FilePath,
+			Content:     []byte(content),
+			Mode:        0o644,
+			Merge:       true,
+			ManagedPath: jsonPathSegments(target.JSONPath),
+		})
+	}
+
+	for _, target := range in.Extra.Files {
+		files, err := planExtraFileTarget(target, in.ConfigDir, in.Servers)
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error copying extra file %s: %v", target.Source, err))
+			continue
+		}
+		plan.Files = append(plan.Files, files...)
+	}
+	for _, target := range in.Extra.Directories {
+		files, err := planExtraDirectoryTarget(target)
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error copying extra directory %s: %v", target.Source, err))
+			continue
+		}
+		plan.Files = append(plan.Files, files...)
+	}
+
+	for _, target := range in.Archives {
+		files, err := planArchiveTarget(target)
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error archiving %s: %v", target.Source, err))
+			continue
+		}
+		plan.Files = append(plan.Files, files...)
+	}
+
+	// Allowed tools have always been best effort, so failures are warnings.
+	allowed := []struct {
+		name string
+		plan func(config.Config) ([]plannedFile, error)
+	}{
+		{"copilot wrapper", planCopilotWrapper},
+		{"Claude permissions", planClaudePermissions},
+		{"Codex rules", planCodexRules},
+	}
+	for _, a := range allowed {
+		files, err := a.plan(in.Config)
+		if err != nil {
+			log.Printf("Warning: failed to generate %s: %v", a.name, err)
+			continue
+		}
+		plan.Files = append(plan.Files, files...)
+	}
+
+	return plan
+}
+
+// writePlannedFile writes file to disk, creating parent directories as needed.
+// The write is atomic and existing files keep their mode and owner; new files
+// get the mode chosen by fileMode.
+func writePlannedFile(file plannedFile) error {
+	if file.Delete {
+		return removePlannedFile(file)
+	}
+	// Leave files that already match alone so their mtime is kept and
+	// agents watching them do not reload.
+	if current, err := os.ReadFile(file.Path); err == nil && bytes.Equal(current, file.Content) {
+		return nil
+	}
+	staged, err := stagePlannedFile(file)
+	if err != nil {
+		return err
+	}
+	if err := staged.Commit(); err != nil {
+		staged.Discard()
+		return err
+	}
+	return nil
+}
+
+// stagePlannedFile writes file to a temporary file next to its destination
+// without replacing the destination yet.
+func stagePlannedFile(file plannedFile) (*fileutil.Staged, error) {
+	dir := filepath.Dir(file.Path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to ensure directory %q: %w", dir, err)
+	}
+	mode, err := fileMode(file)
+	if err != nil {
+		return nil, err
+	}
+	staged, err := fileutil.Stage(file.Path, file.Content, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %q: %w", file.Path, err)
+	}
+	return staged, nil
+}
+
+// removePlannedFile deletes a file planned for removal. A file that is
+// already gone is not an error.
+func removePlannedFile(file plannedFile) error {
+	if err := os.Remove(file.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %q: %w", file.Path, err)
+	}
+	return nil
+}
+
+// appliedVerb describes what applying file did, for progress output.
+func appliedVerb(file plannedFile) string {
+	if file.Delete {
+		return "Removed"
+	}
+	return "Updated"
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent-align/internal/config"
+	"agent-align/internal/syncer"
+)
+
+func TestBuildPlanOrdersOutputsAndCollectsErrors(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "AGENTS.md")
+	if err := os.WriteFile(source, []byte("rules\n"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{not json"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	servers := map[string]interface{}{"fs": map[string]interface{}{"command": "npx"}}
+	plan := buildPlan(planInputs{
+		Result: syncer.SyncResult{
+			Agents: map[string][]syncer.AgentResult{
+				"vscode":  {{Config: syncer.AgentConfig{Name: "vscode", FilePath: filepath.Join(dir, "vscode.json"), Format: "json"}, Content: "{}"}},
+				"copilot": {{Config: syncer.AgentConfig{Name: "copilot", FilePath: filepath.Join(dir, "copilot.json"), Format: "json"}, Content: "{}"}},
+			},
+			Servers: servers,
+		},
+		Servers: servers,
+		AdditionalJSON: []config.AdditionalJSONTarget{
+			{FilePath: filepath.Join(dir, "extra.json"), JSONPath: ".mcpServers"},
+			{FilePath: invalid, JSONPath: ".mcpServers"},
+		},
+		Extra: config.ExtraTargetsConfig{
+			Files: []config.ExtraFileTarget{{
+				Source:       source,
+				Destinations: []config.ExtraFileCopyRoute{{Path: filepath.Join(dir, "out", "AGENTS.md")}},
+			}},
+		},
+		Archives: []config.ArchiveTarget{{Source: filepath.Join(dir, "missing"), Destination: dir}},
+	})
+
+	var paths []string
+	for _, file := range plan.Files {
+		paths = append(paths, filepath.Base(file.Path))
+	}
+	if got := strings.Join(paths, ","); got != "copilot.json,vscode.json,extra.json,AGENTS.md" {
+		t.Fatalf("unexpected plan order: %s", got)
+	}
+	if mode := plan.Files[3].Mode; mode != 0o600 {
+		t.Fatalf("expected extra file to keep source mode, got %v", mode)
+	}
+	if len(plan.Errors) != 2 {
+		t.Fatalf("expected errors for the invalid JSON and missing archive source, got %v", plan.Errors)
+	}
+	for _, file := range plan.Files {
+		if _, err := os.Stat(file.Path); err == nil {
+			t.Fatalf("planning should not write %s", file.Path)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"agent-align/internal/fileutil"
+	"agent-align/internal/state"
+)
+
+// planFileVersion is the format version of saved plans.
+const planFileVersion = 1
+
+// planFile is a saved plan: every write a sync would make, with the content
+// to write and the hash of each destination when the plan was made.
+type planFile struct {
+	Version    int             `json:"version"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	ConfigPath string          `json:"configPath"`
+	Profile    string          `json:"profile,omitempty"`
+	Files      []planFileEntry `json:"files"`
+}
+
+// planFileEntry is one write in a saved plan. Content is base64 encoded.
+type planFileEntry struct {
+	Path      string   `json:"path"`
+	Operation string   `json:"operation"` // created, updated, or removed
+	Category  string   `json:"category"`
+	Label     string   `json:"label"`
+	Format    string   `json:"format,omitempty"`
+	Node      string   `json:"node,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Agent     string   `json:"agent,omitempty"`
+	Servers   []string `json:"servers,omitempty"`
+	Tools     []string `json:"tools,omitempty"`
+	Merge     bool     `json:"merge,omitempty"`
+	// ManagedPath is the JSON path of the node agent-align writes in a
+	// merged JSON file.
+	ManagedPath []string `json:"managedPath,omitempty"`
+	BaseHash    string   `json:"baseHash,omitempty"`
+	Hash        string   `json:"hash,omitempty"`
+	Content     []byte   `json:"content,omitempty"`
+	Mode        uint32   `json:"mode,omitempty"`
+	Secret      bool     `json:"secret,omitempty"`
+}
+
+// newPlanFile keeps the files of plan that would change. source names where
+// the content of files without a source of their own comes from.
+func newPlanFile(rc *runContext, files []plannedFile) (planFile, error) {
+	pf := planFile{Version: planFileVersion, CreatedAt: time.Now().UTC(), ConfigPath: rc.ConfigPath, Profile: rc.Profile, Files: []planFileEntry{}}
+	for _, file := range files {
+		change, err := fileChange(file)
+		if err != nil {
+			return planFile{}, err
+		}
+		if change == changeUnchanged {
+			continue
+		}
+		entry := planFileEntry{
+			Path:        file.Path,
+			Operation:   change,
+			Category:    file.Category,
+			Label:       file.Label,
+			Format:      file.Format,
+			Node:        file.Node,
+			Source:      planSource(rc, file),
+			Agent:       file.Agent,
+			Servers:     file.Servers,
+			Tools:       file.Tools,
+			Merge:       file.Merge,
+			ManagedPath: file.ManagedPath,
+			BaseHash:    file.BaseHash,
+			Mode:        uint32(file.Mode),
+			Secret:      file.Secret,
+		}
+		if !file.Delete {
+			entry.Hash = state.Hash(file.Content)
+			entry.Content = file.Content
+		}
+		pf.Files = append(pf.Files, entry)
+	}
+	return pf, nil
+}
+
+// planSource names what a planned file was rendered from.
+func planSource(rc *runContext, file plannedFile) string {
+	switch {
+	case file.Source != "":
+		return file.Source
+	case file.Category == categoryAgents || file.Category == categoryAdditional:
+		return rc.MCPConfigPath
+	default:
+		return rc.ConfigPath
+	}
+}
+
+// plannedFiles turns the entries back into files to apply as they are.
+func (pf planFile) plannedFiles() []plannedFile {
+	files := make([]plannedFile, 0, len(pf.Files))
+	for _, entry := range pf.Files {
+		files = append(files, plannedFile{
+			Category:    entry.Category,
+			Label:       entry.Label,
+			Format:      entry.Format,
+			Node:        entry.Node,
+			Path:        entry.Path,
+			Source:      entry.Source,
+			Agent:       entry.Agent,
+			Content:     entry.Content,
+			Mode:        os.FileMode(entry.Mode),
+			Servers:     entry.Servers,
+			Tools:       entry.Tools,
+			Merge:       entry.Merge,
+			ManagedPath: entry.ManagedPath,
+			Secret:      entry.Secret,
+			Delete:      entry.Operation == changeRemoved,
+			BaseHash:    entry.BaseHash,
+			Frozen:      true,
+		})
+	}
+	return files
+}
+
+// readPlanFile loads a plan saved by the plan command and checks that its
+// content matches the recorded hashes.
+func readPlanFile(path string) (planFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return planFile{}, fmt.Errorf("failed to read plan %s: %w", path, err)
+	}
+	var pf planFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return planFile{}, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if pf.Version != planFileVersion {
+		return planFile{}, fmt.Errorf("plan %s has version %d; this agent-align reads version %d", path, pf.Version, planFileVersion)
+	}
+	for _, entry := range pf.Files {
+		switch entry.Operation {
+		case changeCreated, changeUpdated:
+			if state.Hash(entry.Content) != entry.Hash {
+				return planFile{}, fmt.Errorf("plan %s is corrupt: content of %s does not match its hash", path, entry.Path)
+			}
+		case changeRemoved:
+		default:
+			return planFile{}, fmt.Errorf("plan %s has unknown operation %q for %s", path, entry.Operation, entry.Path)
+		}
+	}
+	return pf, nil
+}
+
+// stalePlanEntries lists the targets that changed since the plan was made.
+func stalePlanEntries(pf planFile) ([]string, error) {
+	var stale []string
+	for _, entry := range pf.Files {
+		current, err := currentHash(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		if current != entry.BaseHash {
+			stale = append(stale, entry.Path)
+		}
+	}
+	return stale, nil
+}
+
+// runPlanCommand renders the same plan as a sync, prints the preview, and
+// with -out saves every write so apply can make exactly those changes.
+func runPlanCommand(args []string, stdout io.Writer) error {
+	planFlags := flag.NewFlagSet("plan", flag.ExitOnError)
+	configPath := planFlags.String("config", defaultConfigPath(), "path to YAML configuration file describing target agents and overrides")
+	mcpConfigPath := planFlags.String("mcp-config", "", "path to YAML file that defines MCP servers (defaults to agent-align-mcp.yml next to the target config)")
+	agents := planFlags.String("agents", "", "comma-separated list of agents to plan (defaults to the agents in the config)")
+	profile := planFlags.String("profile", "", "name of the profile in the MCP definitions file to apply")
+	strictEnv := planFlags.Bool("strict-env", false, "fail when an MCP definition references an unset environment variable")
+	failOnLossy := planFlags.Bool("fail-on-lossy", false, "fail the agents whose servers would lose configuration they cannot represent instead of only warning")
+	showSecrets := planFlags.Bool("show-secrets", false, "print secret values in the preview instead of masking them")
+	force := planFlags.Bool("force", false, "include destinations that were edited since the last agent-align run")
+	planOut := planFlags.String("out", "", "path to save the plan to, for agent-align apply")
+	outputFormat := addOutputFlag(planFlags)
+	if err := planFlags.Parse(args); err != nil {
+		return err
+	}
+	out, err := newOutput(*outputFormat, stdout)
+	if err != nil {
+		return err
+	}
+	w := out.text()
+	doc := newSyncDocument("plan", true)
+
+	rc, err := loadRun(runOptions{
+		ConfigPath:    *configPath,
+		MCPConfigPath: *mcpConfigPath,
+		Agents:        *agents,
+		Profile:       *profile,
+		StrictEnv:     *strictEnv,
+		FailOnLossy:   *failOnLossy,
+	})
+	if err != nil {
+		return out.finish(doc, categorize(errorConfig, err))
+	}
+	doc.Profile = rc.Profile
+	plan, err := rc.plan()
+	if err != nil {
+		return out.finish(doc, err)
+	}
+	redact := newRedactor(rc.Resolver.SecretValues(), *showSecrets)
+	doc.describePlan(plan, redact, *force)
+
+	if rc.Profile != "" {
+		fmt.Fprintf(w, "Active MCP profile: %s\n", rc.Profile)
+	}
+	printPreview(w, plan, out.color(), *force, redact)
+	if len(plan.Errors) > 0 {
+		return out.finish(doc, categorize(errorTarget, errors.New("the plan has errors; fix them before saving it")))
+	}
+
+	files := plan.Files
+	if !*force {
+		var skipped []string
+		files, skipped = skipEdited(files)
+		for _, msg := range skipped {
+			log.Print(msg)
+		}
+	}
+	pf, err := newPlanFile(rc, files)
+	if err != nil {
+		return out.finish(doc, err)
+	}
+	if *planOut == "" {
+		fmt.Fprintf(w, "%d files would change. Use -out to save the plan for agent-align apply.\n", len(pf.Files))
+		return out.finish(doc, nil)
+	}
+	data, err := json.MarshalIndent(pf, "", "  ")
+	if err != nil {
+		return out.finish(doc, fmt.Errorf("failed to marshal plan: %w", err))
+	}
+	// Plans hold the rendered content, secrets included.
+	if err := fileutil.WriteFile(*planOut, append(data, '\n'), secretFileMode); err != nil {
+		return out.finish(doc, categorize(errorWrite, fmt.Errorf("failed to write plan %s: %w", *planOut, err)))
+	}
+	doc.PlanFile = *planOut
+	fmt.Fprintf(w, "Saved a plan with %d changes to %s. Run agent-align apply %s to make them.\n", len(pf.Files), *planOut, *planOut)
+	return out.finish(doc, nil)
+}
+
+// runApplyCommand makes exactly the changes in a saved plan. It refuses to
+// write anything when a target changed since the plan was made.
+func runApplyCommand(args []string, stdout io.Writer) error {
+	applyFlags := flag.NewFlagSet("apply", flag.ExitOnError)
+	atomic := applyFlags.Bool("atomic", false, "write every file or none of them, rolling back on failure")
+	showSecrets := applyFlags.Bool("show-secrets", false, "print secret values in error messages instead of masking them")
+	outputFormat := addOutputFlag(applyFlags)
+	if err := applyFlags.Parse(args); err != nil {
+		return err
+	}
+	out, err := newOutput(*outputFormat, stdout)
+	if err != nil {
+		return err
+	}
+	w := out.text()
+	doc := newSyncDocument("apply", false)
+	if applyFlags.NArg() != 1 {
+		return out.finish(doc, categorize(errorUsage, errors.New("usage: agent-align apply [-atomic] FILE")))
+	}
+	path := applyFlags.Arg(0)
+	doc.PlanFile = path
+
+	pf, err := readPlanFile(path)
+	if err != nil {
+		return out.finish(doc, categorize(errorUsage, err))
+	}
+	doc.Profile = pf.Profile
+	files := pf.plannedFiles()
+	redact := newRedactor(nil, *showSecrets)
+	doc.describeTargets(files, redact, true)
+
+	stale, err := stalePlanEntries(pf)
+	if err != nil {
+		return out.finish(doc, err)
+	}
+	if len(stale) > 0 {
+		fmt.Fprintln(w, "These targets changed since the plan was made:")
+		for _, p := range stale {
+			fmt.Fprintf(w, "  %s\n", p)
+			doc.addError(errorConflict, fmt.Sprintf("%s changed since the plan was made", p))
+		}
+		return out.finish(doc, categorize(errorConflict, fmt.Errorf("plan %s is stale; run agent-align plan again", path)))
+	}
+	if len(pf.Files) == 0 {
+		fmt.Fprintln(w, "The plan has no changes.")
+		return out.finish(doc, nil)
+	}
+
+	st, err := state.Load(statePath())
+	if err != nil {
+		return out.finish(doc, err)
+	}
+	fmt.Fprintf(w, "Applying plan %s...\n", path)
+	backups := backupStore()
+	backupRun := backups.Begin("apply")
+	var result applyResult
+	if *atomic {
+		result = applyFilesAtomic(w, files, backupRun, redact, nil)
+	} else {
+		result = applyFiles(w, files, backupRun, redact, nil)
+	}
+	doc.markApplied(files, result)
+	for _, msg := range result.Errors {
+		doc.addError(errorWrite, redact.String(msg))
+	}
+	applyErrors := result.Errors
+	if len(result.Written) > 0 {
+		st.Record(stateRun("apply", backupRun, append(result.Written, result.Unchanged...)))
+		if err := st.Save(); err != nil {
+			doc.addError(errorWrite, err.Error())
+			applyErrors = append(applyErrors, err.Error())
+		}
+	}
+	if err := finishBackupRun(w, backups, backupRun, backupRetention(pf.ConfigPath)); err != nil {
+		doc.addError(errorWrite, err.Error())
+		applyErrors = append(applyErrors, err.Error())
+	}
+	if len(backupRun.Entries) > 0 {
+		doc.BackupRun = backupRun.ID
+	}
+	if out.json() {
+		return out.finish(doc, nil)
+	}
+	result.printSummary(stdout)
+	if len(applyErrors) > 0 {
+		fmt.Fprintln(stdout, "Encountered errors while applying the plan:")
+		for _, msg := range applyErrors {
+			fmt.Fprintf(stdout, "  - %s\n", redact.String(msg))
+		}
+		return fmt.Errorf("%d of the changes could not be applied", len(applyErrors))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanAndApplyWriteExactlyThePlannedContent(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	configPath := writeCheckFixture(t, dir)
+	planPath := filepath.Join(dir, "plan.json")
+
+	var out bytes.Buffer
+	if err := runPlanCommand([]string{"-config", configPath, "-out", planPath}, &out); err != nil {
+		t.Fatalf("plan returned error: %v\n%s", err, out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vscode.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected plan to write nothing, got %v", err)
+	}
+	info, err := os.Stat(planPath)
+	if err != nil {
+		t.Fatalf("expected plan file: %v", err)
+	}
+	if info.Mode().Perm() != secretFileMode {
+		t.Fatalf("expected plan file mode %v, got %v", secretFileMode, info.Mode().Perm())
+	}
+	pf, err := readPlanFile(planPath)
+	if err != nil {
+		t.Fatalf("readPlanFile returned error: %v", err)
+	}
+	if len(pf.Files) != 2 {
+		t.Fatalf("expected 2 planned files, got %+v", pf.Files)
+	}
+	for _, entry := range pf.Files {
+		if entry.Operation != changeCreated || entry.BaseHash != "" || entry.Source != filepath.Join(dir, "mcp.yml") {
+			t.Fatalf("unexpected entry %+v", entry)
+		}
+	}
+
+	// Changing the servers after planning must not change what apply writes.
+	if err := os.WriteFile(filepath.Join(dir, "mcp.yml"), []byte("servers:\n  web:\n    command: web\n"), 0o644); err != nil {
+		t.Fatalf("failed to rewrite MCP config: %v", err)
+	}
+	out.Reset()
+	if err := runApplyCommand([]string{planPath}, &out); err != nil {
+		t.Fatalf("apply returned error: %v\n%s", err, out.String())
+	}
+	for _, entry := range pf.Files {
+		data, err := os.ReadFile(entry.Path)
+		if err != nil {
+			t.Fatalf("expected %s to be written: %v", entry.Path, err)
+		}
+		if !bytes.Equal(data, entry.Content) {
+			t.Fatalf("expected %s to hold the planned content, got %s", entry.Path, data)
+		}
+	}
+}
+
+func TestApplyRefusesWhenATargetChanged(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	configPath := writeCheckFixture(t, dir)
+	planPath := filepath.Join(dir, "plan.json")
+
+	var out bytes.Buffer
+	if err := runPlanCommand([]string{"-config", configPath, "-out", planPath}, &out); err != nil {
+		t.Fatalf("plan returned error: %v\n%s", err, out.String())
+	}
+	edited := filepath.Join(dir, "extra.json")
+	if err := os.WriteFile(edited, []byte(`{"mine": true}`), 0o644); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+
+	out.Reset()
+	err := runApplyCommand([]string{planPath}, &out)
+	if err == nil || !strings.Contains(err.Error(), "run agent-align plan again") {
+		t.Fatalf("expected stale plan error, got %v", err)
+	}
+	if !strings.Contains(out.String(), edited) {
+		t.Fatalf("expected changed target to be listed:\n%s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vscode.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be written, got %v", err)
+	}
+}
+
+func TestReadPlanFileRejectsTamperedContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plan.json")
+	content := `{"version": 1, "files": [{"path": "x", "operation": "created", "hash": "sha256:00", "content": "e30K"}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write plan: %v", err)
+	}
+	if _, err := readPlanFile(path); err == nil || !strings.Contains(err.Error(), "does not match its hash") {
+		t.Fatalf("expected hash mismatch error, got %v", err)
+	}
+}
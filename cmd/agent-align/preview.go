@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"agent-align/internal/textdiff"
+	"agent-align/internal/transforms"
+)
+
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[31m"
+	ansiGreen = "\033[32m"
+	ansiCyan  = "\033[36m"
+)
+
+var categoryTitles = map[string]string{
+	categoryAgents:       "Agents:",
+	categoryAdditional:   "Additional destinations:",
+	categoryExtra:        "Extra copy targets:",
+	categoryArchives:     "Archive targets:",
+	categoryAllowedTools: "Allowed tools:",
+}
+
+// printPreview writes a unified diff between each planned file and the copy
+// currently on disk. Files that would not change get a single line. Secrets
+// are masked by redact. force says whether files edited since the last run
+// will be overwritten.
+func printPreview(w io.Writer, plan syncPlan, color, force bool, redact *redactor) {
+	category := ""
+	for _, file := range plan.Files {
+		if file.Category != category {
+			if category != "" {
+				fmt.Fprintln(w)
+			}
+			category = file.Category
+			fmt.Fprintln(w, categoryTitles[category])
+		}
+
+		diff, err := diffPlannedFile(file, redact)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "%s: %s (error reading current file: %v)\n", file.Label, file.Path, err)
+		case diff == "":
+			fmt.Fprintf(w, "%s: %s (no changes)\n", file.Label, file.Path)
+		default:
+			fmt.Fprintf(w, "%s: %s\n", file.Label, file.Path)
+			writeDiff(w, diff, color)
+		}
+		if warning := permissionWarning(file); warning != "" {
+			fmt.Fprintf(w, "warning: %s\n", warning)
+		}
+		if warning := editedWarning(file, force); warning != "" {
+			fmt.Fprintf(w, "warning: %s\n", warning)
+		}
+	}
+	if len(plan.Files) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	var warnings []string
+	for _, d := range plan.Diagnostics {
+		switch {
+		case d.Severity != transforms.SeverityWarning:
+		case d.Kind == transforms.KindLossy:
+			warnings = append(warnings, "lossy conversion: "+d.Error())
+		default:
+			warnings = append(warnings, d.Error())
+		}
+	}
+	if len(warnings) > 0 {
+		fmt.Fprintln(w, "Warnings:")
+		for _, msg := range warnings {
+			fmt.Fprintf(w, "  - %s\n", redact.String(msg))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(plan.Errors) > 0 {
+		fmt.Fprintln(w, "Errors preparing content:")
+		for _, msg := range plan.Errors {
+			fmt.Fprintf(w, "  - %s\n", redact.String(msg))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// diffPlannedFile returns the unified diff from the file on disk to the
+// planned content, or "" when they match. Archives are compared by their
+// entry listing and other binary files are only reported as different. Text
+// is redacted before diffing so secrets never appear in the diff.
+func diffPlannedFile(file plannedFile, redact *redactor) (string, error) {
+	current, err := os.ReadFile(file.Path)
+	oldName := file.Path
+	if errors.Is(err, os.ErrNotExist) {
+		current, err = nil, nil
+		oldName = "/dev/null"
+	}
+	if err != nil {
+		return "", err
+	}
+	newName := file.Path + " (planned)"
+	if file.Delete {
+		if current == nil {
+			return "", nil
+		}
+		newName = "/dev/null"
+	} else if bytes.Equal(current, file.Content) {
+		return "", nil
+	}
+
+	if file.Category == categoryArchives {
+		oldListing := ""
+		if current != nil {
+			oldListing = zipListing(current)
+		}
+		newListing := ""
+		if !file.Delete {
+			newListing = zipListing(file.Content)
+		}
+		return textdiff.Unified(oldName, newName, oldListing, newListing, textdiff.DefaultContext), nil
+	}
+	if isBinary(current) || isBinary(file.Content) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName), nil
+	}
+	diff := textdiff.Unified(oldName, newName, redact.String(string(current)), redact.String(string(file.Content)), textdiff.DefaultContext)
+	if diff == "" && redact.enabled() {
+		return "Only redacted values differ (use -show-secrets to see them)\n", nil
+	}
+	return diff, nil
+}
+
+// zipListing describes each archive entry on its own line so archives can be
+// diffed as text.
+func zipListing(data []byte) string {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "<not a zip archive>\n"
+	}
+	var sb strings.Builder
+	for _, f := range r.File {
+		fmt.Fprintf(&sb, "%s (%d bytes, crc32 %08x)\n", f.Name, f.UncompressedSize64, f.CRC32)
+	}
+	return sb.String()
+}
+
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+func writeDiff(w io.Writer, diff string, color bool) {
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\n")
+		if !color {
+			fmt.Fprintln(w, line)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++"):
+			fmt.Fprintln(w, ansiBold+line+ansiReset)
+		case strings.HasPrefix(line, "@@"):
+			fmt.Fprintln(w, ansiCyan+line+ansiReset)
+		case strings.HasPrefix(line, "+"):
+			fmt.Fprintln(w, ansiGreen+line+ansiReset)
+		case strings.HasPrefix(line, "-"):
+			fmt.Fprintln(w, ansiRed+line+ansiReset)
+		default:
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// colorEnabled reports whether output written to f should be colored. Color
+// is used for terminals unless NO_COLOR is set.
+func colorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent-align/internal/config"
+	"agent-align/internal/transforms"
+)
+
+func TestPrintPreviewShowsDiffsAndUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	same := filepath.Join(dir, "same.json")
+	changed := filepath.Join(dir, "changed.json")
+	created := filepath.Join(dir, "new.json")
+	if err := os.WriteFile(same, []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(changed, []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	plan := syncPlan{
+		Files: []plannedFile{
+			{Category: categoryAgents, Label: "Agent one (json)", Path: same, Content: []byte("{}\n")},
+			{Category: categoryAgents, Label: "Agent two (json)", Path: changed, Content: []byte("a\nB\nc\n")},
+			{Category: categoryAdditional, Label: "Additional JSON (<root>)", Path: created, Content: []byte("x\n")},
+		},
+		Errors: []string{"error preparing additional JSON broken.json: boom"},
+	}
+
+	var out bytes.Buffer
+	printPreview(&out, plan, false, false, nil)
+	got := out.String()
+
+	for _, want := range []string{
+		"Agents:\n",
+		"Agent one (json): " + same + " (no changes)\n",
+		"Agent two (json): " + changed + "\n--- " + changed + "\n+++ " + changed + " (planned)\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		"Additional destinations:\n",
+		"--- /dev/null\n+++ " + created + " (planned)\n@@ -0,0 +1 @@\n+x\n",
+		"Errors preparing content:\n  - error preparing additional JSON broken.json: boom\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in preview:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "\033[") {
+		t.Fatalf("expected no color codes when color is disabled:\n%s", got)
+	}
+
+	out.Reset()
+	printPreview(&out, plan, true, false, nil)
+	if !strings.Contains(out.String(), ansiGreen+"+B"+ansiReset) || !strings.Contains(out.String(), ansiRed+"-b"+ansiReset) {
+		t.Fatalf("expected colored diff lines:\n%s", out.String())
+	}
+}
+
+func TestDiffPlannedFileArchiveListsEntries(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(source, "skill"), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "skill", "SKILL.md"), []byte("one"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	target := config.ArchiveTarget{Source: source, Destination: filepath.Join(dir, "zips")}
+	files, err := planArchiveTarget(target)
+	if err != nil {
+		t.Fatalf("planArchiveTarget returned error: %v", err)
+	}
+	applyPlanned(t, files)
+	if diff, err := diffPlannedFile(files[0], nil); err != nil || diff != "" {
+		t.Fatalf("expected unchanged archive, got diff %q (err %v)", diff, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(source, "skill", "extra.md"), []byte("two"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	files, err = planArchiveTarget(target)
+	if err != nil {
+		t.Fatalf("planArchiveTarget returned error: %v", err)
+	}
+	diff, err := diffPlannedFile(files[0], nil)
+	if err != nil {
+		t.Fatalf("diffPlannedFile returned error: %v", err)
+	}
+	if !strings.Contains(diff, "+extra.md (3 bytes") || strings.Contains(diff, "-SKILL.md") {
+		t.Fatalf("expected archive listing diff, got:\n%s", diff)
+	}
+}
+
+func TestDiffPlannedFileBinary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.png")
+	if err := os.WriteFile(path, []byte{0x89, 0x00, 0x01}, 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	diff, err := diffPlannedFile(plannedFile{Category: categoryExtra, Path: path, Content: []byte{0x89, 0x00, 0x02}}, nil)
+	if err != nil {
+		t.Fatalf("diffPlannedFile returned error: %v", err)
+	}
+	if !strings.HasPrefix(diff, "Binary files ") {
+		t.Fatalf("expected binary marker, got %q", diff)
+	}
+}
+
+func TestPreviewShowsLossyConversions(t *testing.T) {
+	plan := syncPlan{Diagnostics: []transforms.Diagnostic{{
+		Severity: transforms.SeverityWarning,
+		Kind:     transforms.KindLossy,
+		Agent:    "gemini",
+		Server:   "fs",
+		Field:    "disabled",
+		Message:  "dropped; gemini cannot disable a server, so it will be started",
+	}}}
+	var out bytes.Buffer
+	printPreview(&out, plan, false, false, nil)
+	if !strings.Contains(out.String(), `lossy conversion: gemini: server "fs" field "disabled": dropped;`) {
+		t.Fatalf("expected the lossy conversion in the preview:\n%s", out.String())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"agent-align/internal/mcpconfig"
+)
+
+// redactedValue replaces secrets in output.
+const redactedValue = "********"
+
+var (
+	// quotedKeyValue matches "key": "value" (JSON) and key = "value" (TOML).
+	quotedKeyValue = regexp.MustCompile(`"?([A-Za-z_][A-Za-z0-9_.-]*)"?(\s*[:=]\s*)"((?:[^"\\\n]|\\.)*)"`)
+	// plainKeyValue matches unquoted YAML values such as key: value.
+	plainKeyValue = regexp.MustCompile(`(?m)^([ \t+-]*(?:- )?)([A-Za-z_][A-Za-z0-9_.-]*)(:[ \t]+)([^"'\s#{\[][^\n]*)$`)
+)
+
+// redactor masks secrets in previews, diffs, and log lines: values the
+// resolver read from providers or sensitive environment variables, and the
+// values of sensitive keys such as Authorization or *_TOKEN. A nil redactor
+// or one created with show set leaves output unchanged.
+type redactor struct {
+	values []string // longest first so overlapping secrets are fully masked
+	show   bool
+}
+
+func newRedactor(values []string, show bool) *redactor {
+	return &redactor{values: values, show: show}
+}
+
+func (r *redactor) enabled() bool {
+	return r != nil && !r.show
+}
+
+// String masks the secrets in s.
+func (r *redactor) String(s string) string {
+	if !r.enabled() {
+		return s
+	}
+	for _, value := range r.values {
+		s = strings.ReplaceAll(s, value, redactedValue)
+	}
+	s = replaceSubmatches(quotedKeyValue, s, 1, 3)
+	return replaceSubmatches(plainKeyValue, s, 2, 4)
+}
+
+// replaceSubmatches masks submatch valueGroup of every match of re whose
+// submatch keyGroup is a sensitive name.
+func replaceSubmatches(re *regexp.Regexp, s string, keyGroup, valueGroup int) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		key := s[m[2*keyGroup]:m[2*keyGroup+1]]
+		start, end := m[2*valueGroup], m[2*valueGroup+1]
+		if !mcpconfig.IsSensitiveName(key) {
+			continue
+		}
+		sb.WriteString(s[last:start])
+		sb.WriteString(maskValue(s[start:end]))
+		last = end
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// Servers returns a copy of servers with secrets masked, for output that is
+// built from server definitions rather than rendered files.
+func (r *redactor) Servers(servers map[string]interface{}) map[string]interface{} {
+	if !r.enabled() {
+		return servers
+	}
+	out := make(map[string]interface{}, len(servers))
+	for name, server := range servers {
+		out[name] = r.value(server, false)
+	}
+	return out
+}
+
+func (r *redactor) value(value interface{}, sensitive bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if sensitive {
+			return maskValue(v)
+		}
+		return r.String(v)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = r.value(item, mcpconfig.IsSensitiveName(key))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = r.value(item, sensitive)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// maskValue hides value while keeping an authorization scheme and leaving
+// unexpanded references, which are not secret, as written.
+func maskValue(value string) string {
+	if value == "" || value == redactedValue || strings.Contains(value, "${") || strings.Contains(value, "{env:") {
+		return value
+	}
+	for _, scheme := range []string{"Bearer ", "Basic ", "Token "} {
+		if len(value) > len(scheme) && strings.EqualFold(value[:len(scheme)], scheme) {
+			return value[:len(scheme)] + redactedValue
+		}
+	}
+	return redactedValue
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactorMasksSensitiveKeysAndKnownValues(t *testing.T) {
+	redact := newRedactor([]string{"ghp_secret123"}, false)
+	input := `{
+  "mcpServers": {
+    "github": {
+      "args": ["--token=ghp_secret123"],
+      "headers": {"Authorization": "Bearer abc.def"},
+      "env": {"API_KEY": "k-123", "DB_PASSWORD": "hunter2", "LOG_LEVEL": "info", "GH_TOKEN": "${GH_TOKEN}"}
+    }
+  }
+}
+[mcp_servers.github.env]
+OPENAI_API_KEY = "sk-live"
+servers:
+  db:
+    env:
+      DB_PASSWORD: plain-yaml
+`
+	got := redact.String(input)
+	for _, want := range []string{
+		`"--token=********"`,
+		`"Authorization": "Bearer ********"`,
+		`"API_KEY": "********"`,
+		`"DB_PASSWORD": "********"`,
+		`"LOG_LEVEL": "info"`,
+		`"GH_TOKEN": "${GH_TOKEN}"`,
+		`OPENAI_API_KEY = "********"`,
+		`DB_PASSWORD: ********`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in redacted output:\n%s", want, got)
+		}
+	}
+	for _, secret := range []string{"ghp_secret123", "abc.def", "k-123", "hunter2", "sk-live", "plain-yaml"} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("secret %q leaked:\n%s", secret, got)
+		}
+	}
+
+	if shown := newRedactor([]string{"ghp_secret123"}, true).String(input); shown != input {
+		t.Fatalf("expected -show-secrets to leave output unchanged:\n%s", shown)
+	}
+}
+
+func TestRedactorServersMasksSensitiveFields(t *testing.T) {
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{
+			"command": "gh-mcp",
+			"env":     map[string]interface{}{"GITHUB_TOKEN": "ghp_x", "HOST": "api.github.com"},
+		},
+	}
+	got := newRedactor(nil, false).Servers(servers)
+	want := map[string]interface{}{
+		"github": map[string]interface{}{
+			"command": "gh-mcp",
+			"env":     map[string]interface{}{"GITHUB_TOKEN": "********", "HOST": "api.github.com"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if servers["github"].(map[string]interface{})["env"].(map[string]interface{})["GITHUB_TOKEN"] != "ghp_x" {
+		t.Fatal("Servers should not modify its input")
+	}
+}
+
+func TestDiffPlannedFileRedactsSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claude.json")
+	if err := os.WriteFile(path, []byte("{\"Authorization\": \"Bearer old-token\"}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	file := plannedFile{Category: categoryAgents, Path: path, Content: []byte("{\"Authorization\": \"Bearer new-token\"}\n")}
+
+	diff, err := diffPlannedFile(file, newRedactor(nil, false))
+	if err != nil {
+		t.Fatalf("diffPlannedFile returned error: %v", err)
+	}
+	if strings.Contains(diff, "token") || !strings.Contains(diff, "Only redacted values differ") {
+		t.Fatalf("expected a redacted notice, got:\n%s", diff)
+	}
+
+	diff, err = diffPlannedFile(file, newRedactor(nil, true))
+	if err != nil {
+		t.Fatalf("diffPlannedFile returned error: %v", err)
+	}
+	if !strings.Contains(diff, "+{\"Authorization\": \"Bearer new-token\"}") {
+		t.Fatalf("expected full diff with -show-secrets, got:\n%s", diff)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"agent-align/internal/backup"
+	"agent-align/internal/config"
+)
+
+// backupStore is where previous versions of overwritten files are kept.
+func backupStore() backup.Store {
+	return backup.Store{Dir: filepath.Join(stateDir(), "backups")}
+}
+
+// finishBackupRun records run and prunes the store down to retain runs.
+func finishBackupRun(w io.Writer, store backup.Store, run *backup.Run, retain int) error {
+	if err := run.Finish(); err != nil {
+		return err
+	}
+	if len(run.Entries) > 0 {
+		fmt.Fprintf(w, "Previous versions saved as backup run %s (undo with: agent-align restore -run %s)\n", run.ID, run.ID)
+	}
+	return store.Prune(retain)
+}
+
+// restoreDocument is the JSON result of the restore command.
+type restoreDocument struct {
+	outputHeader
+	Runs     []backup.Run   `json:"runs,omitempty"`     // with -list
+	Run      string         `json:"run,omitempty"`      // the run restored
+	Restored []backup.Entry `json:"restored,omitempty"` // entries put back
+	UndoRun  string         `json:"undoRun,omitempty"`  // run that can undo the restore
+}
+
+// runRestoreCommand rolls files back to the copies saved before a run wrote
+// them. Without -run the newest run is used; without paths every file of the
+// run is restored.
+func runRestoreCommand(args []string, stdout io.Writer) error {
+	restoreFlags := flag.NewFlagSet("restore", flag.ExitOnError)
+	runID := restoreFlags.String("run", "", "ID of the backup run to restore (defaults to the newest run)")
+	list := restoreFlags.Bool("list", false, "list the available backup runs and exit")
+	configPath := restoreFlags.String("config", defaultConfigPath(), "path to YAML configuration file, read for backups.retain")
+	confirm := restoreFlags.Bool("confirm", false, "restore without prompting")
+	outputFormat := addOutputFlag(restoreFlags)
+	if err := restoreFlags.Parse(args); err != nil {
+		return err
+	}
+	out, err := newOutput(*outputFormat, stdout)
+	if err != nil {
+		return err
+	}
+	w := out.text()
+	doc := &restoreDocument{outputHeader: outputHeader{Command: "restore"}}
+
+	store := backupStore()
+	runs, err := store.Runs()
+	if err != nil {
+		return out.finish(doc, err)
+	}
+	if *list {
+		doc.Runs = append([]backup.Run{}, runs...)
+		if len(runs) == 0 {
+			fmt.Fprintln(w, "No backup runs found.")
+			return out.finish(doc, nil)
+		}
+		for _, run := range runs {
+			fmt.Fprintf(w, "%s  %s  %-7s %d files\n", run.ID, run.Time.Local().Format("2006-01-02 15:04:05"), run.Command, len(run.Entries))
+		}
+		return out.finish(doc, nil)
+	}
+	if err := out.requireConfirmation(*confirm); err != nil {
+		return out.finish(doc, err)
+	}
+
+	var run backup.Run
+	switch {
+	case *runID != "":
+		if !backup.ValidID(*runID) {
+			return out.finish(doc, categorize(errorUsage, fmt.Errorf("invalid backup run ID %q (see agent-align restore -list)", *runID)))
+		}
+		run, err = store.Load(*runID)
+		if errors.Is(err, os.ErrNotExist) {
+			return out.finish(doc, categorize(errorUsage, fmt.Errorf("backup run %q not found (see agent-align restore -list)", *runID)))
+		}
+		if err != nil {
+			return out.finish(doc, err)
+		}
+	case len(runs) == 0:
+		return out.finish(doc, categorize(errorUsage, errors.New("no backup runs found")))
+	default:
+		run = runs[0]
+	}
+	doc.Run = run.ID
+
+	entries, err := selectRestoreEntries(run, restoreFlags.Args())
+	if err != nil {
+		return out.finish(doc, categorize(errorUsage, err))
+	}
+
+	fmt.Fprintf(w, "Restoring backup run %s (%s, %s):\n", run.ID, run.Command, run.Time.Local().Format("2006-01-02 15:04:05"))
+	for _, entry := range entries {
+		if entry.Existed() {
+			fmt.Fprintf(w, "  restore %s\n", entry.Path)
+		} else {
+			fmt.Fprintf(w, "  remove  %s (created by the run)\n", entry.Path)
+		}
+	}
+	if !*confirm && !promptUser("Restore these files? [y/N]: ", false) {
+		fmt.Fprintln(stdout, "Restore cancelled.")
+		return nil
+	}
+
+	// Back up the current files too, so the restore itself can be undone.
+	undo := store.Begin("restore")
+	var restoreErrors []error
+	for _, entry := range entries {
+		if err := undo.Save(entry.Path); err != nil {
+			restoreErrors = append(restoreErrors, err)
+			continue
+		}
+		if err := run.Restore(entry); err != nil {
+			restoreErrors = append(restoreErrors, err)
+			continue
+		}
+		doc.Restored = append(doc.Restored, entry)
+		fmt.Fprintf(w, "  Restored: %s\n", entry.Path)
+	}
+	if err := finishBackupRun(w, store, undo, backupRetention(*configPath)); err != nil {
+		restoreErrors = append(restoreErrors, err)
+	}
+	if len(undo.Entries) > 0 {
+		doc.UndoRun = undo.ID
+	}
+	return out.finish(doc, categorize(errorWrite, errors.Join(restoreErrors...)))
+}
+
+// selectRestoreEntries returns the entries of run for paths, or all of them
+// when no paths are given.
+func selectRestoreEntries(run backup.Run, paths []string) ([]backup.Entry, error) {
+	if len(paths) == 0 {
+		return run.Entries, nil
+	}
+	byPath := make(map[string]backup.Entry, len(run.Entries))
+	for _, entry := range run.Entries {
+		byPath[entry.Path] = entry
+	}
+	var entries []backup.Entry
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		entry, ok := byPath[abs]
+		if !ok {
+			return nil, fmt.Errorf("backup run %s has no copy of %s", run.ID, abs)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// backupRetention reads backups.retain from the config at path. A missing or
+// invalid config uses the default.
+func backupRetention(path string) int {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return backup.DefaultRetention
+	}
+	return cfg.Backups.Retain
+}
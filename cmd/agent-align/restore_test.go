@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunRestoreCommandRestoresNewestRun(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "claude.json")
+	if err := os.WriteFile(path, []byte("before"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	store := backupStore()
+	run := store.Begin("sync")
+	if err := run.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := finishBackupRun(&out, store, run, 0); err != nil {
+		t.Fatalf("finishBackupRun returned error: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("after"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	out.Reset()
+	if err := runRestoreCommand([]string{"-list"}, &out); err != nil {
+		t.Fatalf("restore -list returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), run.ID) || !strings.Contains(out.String(), "1 files") {
+		t.Fatalf("expected run in listing:\n%s", out.String())
+	}
+
+	out.Reset()
+	args := []string{"-confirm", "-config", filepath.Join(dir, "missing.yml"), path}
+	if err := runRestoreCommand(args, &out); err != nil {
+		t.Fatalf("restore returned error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "before" {
+		t.Fatalf("expected restored content, got %q", data)
+	}
+	if !strings.Contains(out.String(), "Restored: "+path) {
+		t.Fatalf("expected restore report:\n%s", out.String())
+	}
+
+	// The restore saved the replaced version, so it can be undone.
+	runs, err := store.Runs()
+	if err != nil {
+		t.Fatalf("Runs returned error: %v", err)
+	}
+	if len(runs) != 2 || runs[0].Command != "restore" {
+		t.Fatalf("expected an undo run, got %+v", runs)
+	}
+}
+
+func TestRunRestoreCommandRejectsUnknownPath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "claude.json")
+	store := backupStore()
+	run := store.Begin("sync")
+	if err := run.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if err := run.Finish(); err != nil {
+		t.Fatalf("Finish returned error: %v", err)
+	}
+
+	err := runRestoreCommand([]string{"-confirm", "-run", run.ID, filepath.Join(dir, "other.json")}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "has no copy of") {
+		t.Fatalf("expected unknown path error, got %v", err)
+	}
+	if err := runRestoreCommand([]string{"-confirm", "-run", "20000101-000000"}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected unknown run error, got %v", err)
+	}
+	if err := runRestoreCommand([]string{"-confirm", "-run", "../../x"}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "invalid backup run ID") {
+		t.Fatalf("expected invalid run ID error, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"agent-align/internal/config"
+	"agent-align/internal/mcpconfig"
+	"agent-align/internal/mcpserver"
+	"agent-align/internal/state"
+	"agent-align/internal/syncer"
+)
+
+// runOptions selects the config files and agents for a sync or check.
+type runOptions struct {
+	ConfigPath    string
+	MCPConfigPath string
+	Agents        string // value of the -agents flag
+	Profile       string // value of the -profile flag
+	StrictEnv     bool   // value of the -strict-env flag
+	FailOnLossy   bool   // value of the -fail-on-lossy flag
+	// PromptForConfig offers to create the config file when it is missing.
+	PromptForConfig bool
+}
+
+// runContext is the configuration and MCP servers loaded for a run.
+type runContext struct {
+	Config          config.Config
+	ConfigPath      string
+	MCPConfigPath   string
+	Agents          []syncer.AgentTarget
+	AdditionalJSON  []config.AdditionalJSONTarget
+	AdditionalJSONC []config.AdditionalJSONTarget
+	Extra           config.ExtraTargetsConfig
+	Archives        []config.ArchiveTarget
+	// Definitions is the MCP file as loaded, before any profile is applied.
+	Definitions mcpconfig.Definitions
+	// Profile is the profile applied to Servers and to agents without their
+	// own profile. Empty means the base servers.
+	Profile   string
+	Servers   map[string]interface{} // with environment references expanded
+	Targeting map[string]mcpconfig.Targeting
+	// RawServers are the same servers with only provider references
+	// resolved, for agents that keep environment references as written.
+	RawServers map[string]interface{}
+	// Resolver expands server values and caches provider lookups for the run.
+	Resolver *mcpconfig.Resolver
+	// State is what earlier runs wrote.
+	State *state.State
+	// Owned is the server IDs earlier runs wrote, keyed by agent file path.
+	Owned map[string][]string
+	// FailOnLossy fails agent targets that would lose configuration.
+	FailOnLossy bool
+	// Registry holds the built-in agents and the config's custom agents.
+	Registry syncer.Registry
+}
+
+// loadRun reads the target config and MCP definitions the same way for every
+// command that renders outputs.
+func loadRun(opts runOptions) (*runContext, error) {
+	rc := &runContext{
+		ConfigPath:    opts.ConfigPath,
+		MCPConfigPath: strings.TrimSpace(opts.MCPConfigPath),
+		Profile:       strings.TrimSpace(opts.Profile),
+		Resolver:      mcpconfig.NewResolver(),
+		FailOnLossy:   opts.FailOnLossy,
+	}
+	agentsFlagValue := strings.TrimSpace(opts.Agents)
+
+	haveConfig := false
+	if agentsFlagValue == "" {
+		if opts.PromptForConfig {
+			if err := ensureConfigFile(rc.ConfigPath); err != nil {
+				return nil, fmt.Errorf("configuration unavailable: %w", err)
+			}
+		}
+		data, err := config.Load(rc.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config %q: %w", rc.ConfigPath, err)
+		}
+		rc.Config = data
+		haveConfig = true
+	} else if _, err := os.Stat(rc.ConfigPath); err == nil {
+		data, err := config.Load(rc.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config %q: %w", rc.ConfigPath, err)
+		}
+		rc.Config = data
+		haveConfig = true
+	}
+
+	if haveConfig {
+		cfg := rc.Config
+		registry, err := agentRegistry(cfg.AgentDefinitions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent definitions in %q: %w", rc.ConfigPath, err)
+		}
+		rc.Registry = registry
+		rc.AdditionalJSON = cfg.MCP.Targets.Additional.JSON
+		rc.AdditionalJSONC = cfg.MCP.Targets.Additional.JSONC
+		rc.Extra = cfg.ExtraTargets
+		rc.Archives = cfg.ArchiveTargets
+		rc.Agents = configTargetsToSyncer(cfg.MCP.Targets.Agents)
+		if rc.MCPConfigPath == "" {
+			rc.MCPConfigPath = cfg.MCP.ConfigPath
+		}
+	}
+
+	if rc.MCPConfigPath == "" {
+		rc.MCPConfigPath = defaultMCPConfigPath(rc.ConfigPath)
+	}
+
+	if agentsFlagValue != "" {
+		names := parseAgents(agentsFlagValue)
+		if len(names) == 0 {
+			return nil, errors.New("the -agents flag must list at least one agent")
+		}
+		overrideLookup := make(map[string]config.AgentTarget, len(rc.Config.MCP.Targets.Agents))
+		for _, agent := range rc.Config.MCP.Targets.Agents {
+			overrideLookup[agent.Name] = agent
+		}
+		rc.Agents = nil
+		for _, name := range names {
+			normalized := strings.ToLower(strings.TrimSpace(name))
+			rc.Agents = append(rc.Agents, syncer.AgentTarget{
+				Name:          normalized,
+				PathOverride:  overrideLookup[normalized].Path,
+				MergeStrategy: overrideLookup[normalized].MergeStrategy,
+				IncludeTags:   overrideLookup[normalized].IncludeTags,
+				ExcludeTags:   overrideLookup[normalized].ExcludeTags,
+				Profile:       overrideLookup[normalized].Profile,
+				Secrets:       overrideLookup[normalized].Secrets,
+			})
+		}
+	}
+
+	if len(rc.Agents) == 0 && len(rc.AdditionalJSON) == 0 && len(rc.AdditionalJSONC) == 0 && rc.Extra.IsZero() && len(rc.Archives) == 0 {
+		return nil, errors.New("no target agents, additional destinations, or extra copy targets configured; provide agents via config/flags or add extra targets")
+	}
+
+	rc.Resolver.Strict = opts.StrictEnv || rc.Config.MCP.StrictEnv
+	defs, err := mcpconfig.LoadDefinitions(rc.MCPConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load MCP configuration %q: %w", rc.MCPConfigPath, err)
+	}
+	rc.Definitions = defs
+	applied, err := defs.Apply(rc.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MCP profile in %q: %w", rc.MCPConfigPath, err)
+	}
+	for _, problem := range mcpserver.ValidateServers(applied.Servers) {
+		log.Printf("warning: %s: %v", rc.MCPConfigPath, problem)
+	}
+	if rc.Servers, rc.RawServers, err = rc.resolve(applied.Servers); err != nil {
+		return nil, err
+	}
+	rc.Targeting = applied.Targeting
+	for _, agent := range rc.Agents {
+		if _, err := defs.Apply(agent.Profile); err != nil {
+			return nil, fmt.Errorf("invalid MCP profile for agent %q in %q: %w", agent.Name, rc.MCPConfigPath, err)
+		}
+	}
+
+	if rc.State, err = state.Load(statePath()); err != nil {
+		return nil, err
+	}
+	rc.Owned = rc.State.ManagedServers()
+	return rc, nil
+}
+
+// resolve returns servers with every reference expanded and with only
+// provider references resolved.
+func (rc *runContext) resolve(servers map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	expanded, err := rc.Resolver.ExpandServers(servers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve MCP configuration %q: %w", rc.MCPConfigPath, err)
+	}
+	raw, err := rc.Resolver.ResolveProviders(servers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve MCP configuration %q: %w", rc.MCPConfigPath, err)
+	}
+	return expanded, raw, nil
+}
+
+// plan syncs the MCP servers to every agent and renders all other outputs.
+// Agents are synced in groups that share a profile so each group receives the
+// servers of its own profile.
+func (rc *runContext) plan() (syncPlan, error) {
+	syncResult := syncer.SyncResult{Agents: make(map[string][]syncer.AgentResult), Servers: rc.Servers}
+	profiles := make(map[string]string)
+	for _, group := range rc.profileGroups() {
+		servers, raw, targeting := rc.Servers, rc.RawServers, rc.Targeting
+		if group.profile != rc.Profile {
+			applied, err := rc.Definitions.Apply(group.profile)
+			if err != nil {
+				return syncPlan{}, fmt.Errorf("sync failed: %w", err)
+			}
+			if servers, raw, err = rc.resolve(applied.Servers); err != nil {
+				return syncPlan{}, err
+			}
+			targeting = applied.Targeting
+		}
+
+		s := syncer.New(group.agents)
+		s.Owned = rc.Owned
+		s.Targeting = targeting
+		s.Unexpanded = raw
+		s.FailOnLossy = rc.FailOnLossy
+		s.Registry = rc.Registry
+		result, err := s.Sync(servers)
+		if err != nil {
+			return syncPlan{}, fmt.Errorf("sync failed: %w", err)
+		}
+		syncResult.Targets = append(syncResult.Targets, result.Targets...)
+		for name, outputs := range result.Agents {
+			syncResult.Agents[name] = append(syncResult.Agents[name], outputs...)
+			for _, output := range outputs {
+				if group.profile != "" {
+					profiles[output.Config.FilePath] = group.profile
+				}
+			}
+		}
+	}
+
+	plan := buildPlan(planInputs{
+		Result:          syncResult,
+		Servers:         rc.Servers,
+		Profiles:        profiles,
+		AdditionalJSON:  rc.AdditionalJSON,
+		AdditionalJSONC: rc.AdditionalJSONC,
+		Extra:           rc.Extra,
+		Archives:        rc.Archives,
+		Config:          rc.Config,
+		ConfigDir:       filepath.Dir(rc.ConfigPath),
+	})
+	markSecretFiles(&plan, rc.Resolver.SecretValues())
+	markBaseHashes(&plan, rc.State)
+	return plan, nil
+}
+
+type profileGroup struct {
+	profile string
+	agents  []syncer.AgentTarget
+}
+
+// profileGroups splits the agents by the profile they are rendered with,
+// keeping the order in which each profile first appears.
+func (rc *runContext) profileGroups() []profileGroup {
+	var groups []profileGroup
+	index := make(map[string]int)
+	for _, agent := range rc.Agents {
+		profile := strings.TrimSpace(agent.Profile)
+		if profile == "" {
+			profile = rc.Profile
+		}
+		i, ok := index[profile]
+		if !ok {
+			i = len(groups)
+			index[profile] = i
+			groups = append(groups, profileGroup{profile: profile})
+		}
+		groups[i].agents = append(groups[i].agents, agent)
+	}
+	return groups
+}
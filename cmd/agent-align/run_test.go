@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agent-align/internal/transforms"
+)
+
+func TestPlanAppliesProfilesPerAgent(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	mcpPath := filepath.Join(dir, "mcp.yml")
+	mcp := `servers:
+  fs:
+    command: npx
+profiles:
+  work:
+    servers:
+      jira:
+        command: jira-mcp
+  personal:
+    servers:
+      notes:
+        command: notes-mcp
+`
+	if err := os.WriteFile(mcpPath, []byte(mcp), 0o644); err != nil {
+		t.Fatalf("failed to write MCP config: %v", err)
+	}
+	configPath := filepath.Join(dir, "agent-align.yml")
+	content := `mcpServers:
+  configPath: ` + mcpPath + `
+  targets:
+    agents:
+      - name: vscode
+        path: ` + filepath.Join(dir, "vscode.json") + `
+      - name: claudecode
+        path: ` + filepath.Join(dir, "claude.json") + `
+        profile: personal
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	rc, err := loadRun(runOptions{ConfigPath: configPath, Profile: "work"})
+	if err != nil {
+		t.Fatalf("loadRun returned error: %v", err)
+	}
+	plan, err := rc.plan()
+	if err != nil {
+		t.Fatalf("plan returned error: %v", err)
+	}
+
+	contents := make(map[string]string)
+	for _, file := range plan.Files {
+		contents[file.Label] = string(file.Content)
+	}
+	vscode := contents["Agent vscode (json, profile work)"]
+	if !strings.Contains(vscode, "jira-mcp") || strings.Contains(vscode, "notes-mcp") {
+		t.Fatalf("expected vscode to use the work profile, got labels %v:\n%s", plan.Files, vscode)
+	}
+	claude := contents["Agent claudecode (json, profile personal)"]
+	if !strings.Contains(claude, "notes-mcp") || strings.Contains(claude, "jira-mcp") {
+		t.Fatalf("expected claudecode to keep its own profile:\n%s", claude)
+	}
+
+	if _, err := loadRun(runOptions{ConfigPath: configPath, Profile: "client"}); err == nil || !strings.Contains(err.Error(), `unknown profile "client"`) {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+}
+
+func TestLoadRunStrictEnvReportsUnsetVariables(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	mcpPath := filepath.Join(dir, "mcp.yml")
+	mcp := `servers:
+  github:
+    url: https://api.example.com/mcp/
+    headers:
+      Authorization: "Bearer ${AGENT_ALIGN_TEST_UNSET_TOKEN}"
+`
+	if err := os.WriteFile(mcpPath, []byte(mcp), 0o644); err != nil {
+		t.Fatalf("failed to write MCP config: %v", err)
+	}
+	configPath := filepath.Join(dir, "agent-align.yml")
+	content := `mcpServers:
+  configPath: ` + mcpPath + `
+  targets:
+    agents:
+      - name: claudecode
+        path: ` + filepath.Join(dir, "claude.json") + `
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if _, err := loadRun(runOptions{ConfigPath: configPath}); err != nil {
+		t.Fatalf("expected unset variables to be allowed by default, got %v", err)
+	}
+	_, err := loadRun(runOptions{ConfigPath: configPath, StrictEnv: true})
+	if err == nil || !strings.Contains(err.Error(), `server "github" field "headers.Authorization": ${AGENT_ALIGN_TEST_UNSET_TOKEN}`) {
+		t.Fatalf("expected unresolved reference error, got %v", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(content+"  strictEnv: true\n"), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := loadRun(runOptions{ConfigPath: configPath}); err == nil {
+		t.Fatal("expected strictEnv in the config to fail the run")
+	}
+}
+
+func TestPlanKeepsValidTargetsWhenOneFails(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	mcpPath := filepath.Join(dir, "mcp.yml")
+	mcp := "servers:\n  fs:\n    command: npx\n  remote:\n    type: http\n"
+	if err := os.WriteFile(mcpPath, []byte(mcp), 0o644); err != nil {
+		t.Fatalf("failed to write MCP config: %v", err)
+	}
+	configPath := filepath.Join(dir, "agent-align.yml")
+	content := `mcpServers:
+  configPath: ` + mcpPath + `
+  targets:
+    agents:
+      - name: copilot
+        path: ` + filepath.Join(dir, "copilot.json") + `
+      - name: vscode
+        path: ` + filepath.Join(dir, "vscode.json") + `
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	rc, err := loadRun(runOptions{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("loadRun returned error: %v", err)
+	}
+	plan, err := rc.plan()
+	if err != nil {
+		t.Fatalf("plan returned error: %v", err)
+	}
+	if len(plan.Files) != 1 || plan.Files[0].Agent != "vscode" {
+		t.Fatalf("expected only vscode to be planned, got %+v", plan.Files)
+	}
+	if len(plan.Failed) != 1 || plan.Failed[0].Agent != "copilot" || plan.Failed[0].Path != filepath.Join(dir, "copilot.json") {
+		t.Fatalf("expected copilot to fail, got %+v", plan.Failed)
+	}
+	if len(plan.Errors) != 1 || !strings.Contains(plan.Errors[0], `server "remote" field "url"`) {
+		t.Fatalf("expected a typed error for the remote server, got %v", plan.Errors)
+	}
+	if len(plan.Diagnostics) != 1 || plan.Diagnostics[0].Server != "remote" || plan.Diagnostics[0].Field != "url" {
+		t.Fatalf("unexpected diagnostics: %+v", plan.Diagnostics)
+	}
+
+	doc := newSyncDocument("sync", true)
+	doc.describePlan(plan, newRedactor(nil, false), false)
+	if len(doc.Targets) != 2 || doc.Targets[1].Status != statusFailed || doc.Targets[1].Agent != "copilot" {
+		t.Fatalf("expected the failed target in the document, got %+v", doc.Targets)
+	}
+	if len(doc.Errors) != 1 || doc.Errors[0].Category != errorTarget || len(doc.Diagnostics) != 1 || doc.Diagnostics[0].Kind != transforms.KindInvalid {
+		t.Fatalf("unexpected errors %+v and diagnostics %+v", doc.Errors, doc.Diagnostics)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"agent-align/internal/config"
+	"agent-align/internal/jsoncdoc"
+	"agent-align/internal/state"
+	"agent-align/internal/syncer"
+)
+
+// uninstallOptions selects what the uninstall command removes.
+type uninstallOptions struct {
+	Agents   []string // agents to uninstall from; empty means all
+	Servers  []string // server IDs to remove; empty means every managed one
+	Extra    bool     // also delete copied extra files
+	Archives bool     // also delete generated archives
+	// Registry resolves agent names, including the config's custom agents.
+	Registry syncer.Registry
+}
+
+// runUninstallCommand removes what earlier syncs recorded in the state file:
+// the managed servers in each agent file, the copilot wrapper, and the
+// managed Claude permissions and Codex rules. Extra copies and archives are
+// only deleted when asked for.
+func runUninstallCommand(args []string, stdout io.Writer) error {
+	uninstallFlags := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	configPath := uninstallFlags.String("config", defaultConfigPath(), "path to YAML configuration file, read for custom agents and allowed tools")
+	agents := uninstallFlags.String("agents", "", "comma-separated list of agents to uninstall from (defaults to every agent agent-align wrote to)")
+	servers := uninstallFlags.String("servers", "", "comma-separated list of server IDs to remove; only agent files are changed when set")
+	extra := uninstallFlags.Bool("extra", false, "also delete the files copied by extra targets")
+	archives := uninstallFlags.Bool("archives", false, "also delete the archives created by archive targets")
+	dryRun := uninstallFlags.Bool("dry-run", false, "only show what would be removed")
+	confirm := uninstallFlags.Bool("confirm", false, "remove without prompting")
+	showSecrets := uninstallFlags.Bool("show-secrets", false, "print secret values in the preview instead of masking them")
+	outputFormat := addOutputFlag(uninstallFlags)
+	if err := uninstallFlags.Parse(args); err != nil {
+		return err
+	}
+	out, err := newOutput(*outputFormat, stdout)
+	if err != nil {
+		return err
+	}
+	w := out.text()
+	doc := newSyncDocument("uninstall", *dryRun)
+	if err := out.requireConfirmation(*confirm || *dryRun); err != nil {
+		return out.finish(doc, err)
+	}
+
+	var cfg config.Config
+	var registry syncer.Registry
+	if _, err := os.Stat(*configPath); err == nil {
+		loaded, err := config.Load(*configPath)
+		if err != nil {
+			return out.finish(doc, categorize(errorConfig, fmt.Errorf("failed to load config %q: %w", *configPath, err)))
+		}
+		if registry, err = agentRegistry(loaded.AgentDefinitions); err != nil {
+			return out.finish(doc, categorize(errorConfig, fmt.Errorf("invalid agent definitions in %q: %w", *configPath, err)))
+		}
+		cfg = loaded
+	}
+
+	st, err := state.Load(statePath())
+	if err != nil {
+		return out.finish(doc, err)
+	}
+	opts := uninstallOptions{
+		Agents:   parseAgents(strings.ToLower(*agents)),
+		Servers:  parseAgents(*servers),
+		Extra:    *extra,
+		Archives: *archives,
+		Registry: registry,
+	}
+	plan := planUninstall(st, cfg, opts)
+	redact := newRedactor(nil, *showSecrets)
+	doc.describeTargets(plan.Files, redact, false)
+	for _, msg := range plan.Errors {
+		doc.addError(errorTarget, redact.String(msg))
+	}
+
+	if len(plan.Files) == 0 && len(plan.Errors) == 0 {
+		fmt.Fprintln(w, "Nothing to uninstall.")
+		return out.finish(doc, nil)
+	}
+	fmt.Fprintln(w, "The following changes will be made:")
+	fmt.Fprintln(w)
+	printPreview(w, plan, out.color(), false, redact)
+	if *dryRun {
+		fmt.Fprintln(w, "Dry run complete. No changes were made.")
+		return out.finish(doc, nil)
+	}
+	if len(plan.Files) == 0 {
+		return out.finish(doc, categorize(errorTarget, errors.New("nothing could be uninstalled")))
+	}
+	if !*confirm && !promptUser("Apply these changes? [y/N]: ", false) {
+		fmt.Fprintln(stdout, "Changes cancelled.")
+		return nil
+	}
+
+	fmt.Fprintln(w, "\nApplying changes...")
+	applyErrors := append([]string(nil), plan.Errors...)
+	backups := backupStore()
+	backupRun := backups.Begin("uninstall")
+	replan := func() (syncPlan, error) { return planUninstall(st, cfg, opts), nil }
+	result := applyFiles(w, plan.Files, backupRun, redact, replan)
+	doc.markApplied(plan.Files, result)
+	for _, msg := range result.Errors {
+		doc.addError(errorWrite, redact.String(msg))
+	}
+	applyErrors = append(applyErrors, result.Errors...)
+	if len(result.Written) > 0 {
+		st.Record(stateRun("uninstall", backupRun, append(result.Written, result.Unchanged...)))
+		if err := st.Save(); err != nil {
+			doc.addError(errorWrite, err.Error())
+			applyErrors = append(applyErrors, err.Error())
+		}
+	}
+	if err := finishBackupRun(w, backups, backupRun, cfg.Backups.Retain); err != nil {
+		doc.addError(errorWrite, err.Error())
+		applyErrors = append(applyErrors, err.Error())
+	}
+	if len(backupRun.Entries) > 0 {
+		doc.BackupRun = backupRun.ID
+	}
+	if out.json() {
+		return out.finish(doc, nil)
+	}
+	if len(applyErrors) > 0 {
+		fmt.Fprintln(stdout, "Encountered errors while uninstalling:")
+		for _, msg := range applyErrors {
+			fmt.Fprintf(stdout, "  - %s\n", redact.String(msg))
+		}
+		return fmt.Errorf("%d of the changes could not be applied", len(applyErrors))
+	}
+	return nil
+}
+
+// planUninstall renders the files that undo what st records, in the same
+// category order as a sync.
+func planUninstall(st *state.State, cfg config.Config, opts uninstallOptions) syncPlan {
+	var plan syncPlan
+	selected := func(agent string) bool {
+		return len(opts.Agents) == 0 || containsString(opts.Agents, agent)
+	}
+
+	for _, record := range st.FilesIn(categoryAgents) {
+		agent := record.Agent
+		if agent == "" {
+			agent = agentForPath(record.Path, cfg, opts.Registry)
+		}
+		if agent == "" {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("cannot tell which agent wrote %s; remove its servers by hand", record.Path))
+			continue
+		}
+		if !selected(agent) {
+			continue
+		}
+		ids := record.Servers
+		if len(opts.Servers) > 0 {
+			ids = intersectStrings(ids, opts.Servers)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		agentCfg, err := opts.Registry.AgentConfig(agent, record.Path)
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error preparing %s: %v", record.Path, err))
+			continue
+		}
+		content, removed, err := syncer.RemoveServers(agentCfg, ids)
+		if os.IsNotExist(err) || (err == nil && len(removed) == 0) {
+			continue
+		}
+		if err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("error preparing %s: %v", record.Path, err))
+			continue
+		}
+		plan.Files = append(plan.Files, plannedFile{
+			Category: categoryAgents,
+			Label:    agentLabel(agent, agentCfg.Format, ""),
+			Agent:    agent,
+			Format:   agentCfg.Format,
+			Node:     agentCfg.NodeName,
+			Path:     record.Path,
+			Content:  []byte(content),
+			Mode:     0o644,
+			Servers:  subtractStrings(record.Servers, removed),
+			Merge:    true,
+		})
+	}
+	if len(opts.Servers) == 0 {
+		files, errs := planUninstallOther(st, opts, selected)
+		plan.Files = append(plan.Files, files...)
+		plan.Errors = append(plan.Errors, errs...)
+	}
+	markBaseHashes(&plan, nil)
+	return plan
+}
+
+// planUninstallOther plans removing extra copies and archives when asked
+// for, and the allowed-tools outputs of the selected agents. Only the
+// permissions and rules recorded in the state are removed.
+func planUninstallOther(st *state.State, opts uninstallOptions, selected func(string) bool) ([]plannedFile, []string) {
+	var files []plannedFile
+	var errs []string
+	if opts.Extra {
+		files = append(files, plannedRemovals(st.FilesIn(categoryExtra), "Extra file")...)
+	}
+	if opts.Archives {
+		files = append(files, plannedRemovals(st.FilesIn(categoryArchives), "Archive")...)
+	}
+
+	for _, record := range st.FilesIn(categoryAllowedTools) {
+		if !selected(record.Agent) || !fileExists(record.Path) {
+			continue
+		}
+		var file plannedFile
+		var err error
+		switch record.Agent {
+		case "copilot":
+			file = plannedFile{Label: "Allowed tools [copilot]", Delete: true}
+		case "claudecode", "codex":
+			if len(record.Tools) == 0 {
+				log.Printf("warning: no allowed tools recorded for %s; leaving it as it is", record.Path)
+				continue
+			}
+			if record.Agent == "claudecode" {
+				file, err = planClaudePermissionsRemoval(record.Path, record.Tools)
+			} else {
+				file, err = planCodexRulesRemoval(record.Path, record.Tools)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if file.Label == "" {
+			continue
+		}
+		file.Category = categoryAllowedTools
+		file.Agent = record.Agent
+		file.Path = record.Path
+		file.Mode = 0o644
+		files = append(files, file)
+	}
+	return files, errs
+}
+
+// plannedRemovals plans deleting each recorded file that still exists.
+func plannedRemovals(records []state.File, label string) []plannedFile {
+	var files []plannedFile
+	for _, record := range records {
+		if !fileExists(record.Path) {
+			continue
+		}
+		files = append(files, plannedFile{Category: record.Category, Label: label, Path: record.Path, Source: record.Source, Delete: true})
+	}
+	return files
+}
+
+// planClaudePermissionsRemoval removes the managed entries from
+// permissions.allow in the Claude settings at path. Every other entry and
+// setting is kept, along with the file's layout. It returns a zero
+// plannedFile when there is nothing to remove.
+func planClaudePermissionsRemoval(path string, managed []string) (plannedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return plannedFile{}, fmt.Errorf("failed to read Claude settings %s: %w", path, err)
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return plannedFile{}, fmt.Errorf("failed to parse Claude settings %s: %w", path, err)
+	}
+	permissions, _ := settings["permissions"].(map[string]interface{})
+	allow, _ := permissions["allow"].([]interface{})
+	remove := make(map[string]bool, len(managed))
+	for _, entry := range managed {
+		remove[entry] = true
+	}
+	kept := make([]interface{}, 0, len(allow))
+	for _, entry := range allow {
+		if s, ok := entry.(string); ok && remove[s] {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	if len(kept) == len(allow) {
+		return plannedFile{}, nil
+	}
+
+	doc, err := jsoncdoc.Parse(data)
+	if err != nil {
+		return plannedFile{}, fmt.Errorf("failed to parse Claude settings %s: %w", path, err)
+	}
+	var out []byte
+	switch {
+	case len(kept) > 0:
+		out, err = doc.Set([]string{"permissions", "allow"}, kept)
+	case len(permissions) > 1:
+		out, err = doc.Delete([]string{"permissions", "allow"})
+	default:
+		out, err = doc.Delete([]string{"permissions"})
+	}
+	if err != nil {
+		return plannedFile{}, fmt.Errorf("failed to update Claude settings %s: %w", path, err)
+	}
+	return plannedFile{Label: "Allowed tools [claude]", Content: out}, nil
+}
+
+// planCodexRulesRemoval removes the managed rules from the Codex rules file
+// at path, deleting the file when no other lines remain. It returns a zero
+// plannedFile when there is nothing to remove.
+func planCodexRulesRemoval(path string, managed []string) (plannedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return plannedFile{}, fmt.Errorf("failed to read Codex rules %s: %w", path, err)
+	}
+	remove := make(map[string]bool, len(managed))
+	for _, rule := range managed {
+		remove[rule] = true
+	}
+	var kept []string
+	removed := false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if remove[strings.TrimSpace(line)] {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !removed {
+		return plannedFile{}, nil
+	}
+	content := strings.Join(kept, "")
+	if strings.TrimSpace(content) == "" {
+		return plannedFile{Label: "Allowed tools [codex]", Delete: true}, nil
+	}
+	return plannedFile{Label: "Allowed tools [codex]", Content: []byte(content)}, nil
+}
+
+// agentForPath finds the agent whose config file is path, for records written
+// before the state file stored agent names.
+func agentForPath(path string, cfg config.Config, registry syncer.Registry) string {
+	for _, target := range cfg.MCP.Targets.Agents {
+		if agentCfg, err := registry.AgentConfig(target.Name, target.Path); err == nil && agentCfg.FilePath == path {
+			return agentCfg.Name
+		}
+	}
+	for _, name := range registry.Agents() {
+		if agentCfg, err := registry.AgentConfig(name, ""); err == nil && agentCfg.FilePath == path {
+			return agentCfg.Name
+		}
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// intersectStrings returns the values that are also in other.
+func intersectStrings(values, other []string) []string {
+	var out []string
+	for _, value := range values {
+		if containsString(other, value) {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+// subtractStrings returns the values that are not in other.
+func subtractStrings(values, other []string) []string {
+	var out []string
+	for _, value := range values {
+		if !containsString(other, value) {
+			out = append(out, value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"agent-align/internal/backup"
+	"agent-align/internal/config"
+	"agent-align/internal/state"
+)
+
+const claudeSettingsFixture = `{
+    "permissions": {
+        "deny": ["Bash(rm:*)"],
+        "allow": [
+            "Bash(git status:*)",
+            "Read"
+        ]
+    },
+    "model": "opus"
+}
+`
+
+// writeUninstallFixture records a sync that wrote a Claude agent file with a
+// foreign server, a copilot wrapper, Claude permissions, and an extra copy.
+// The config has changed since, so only the state says which permissions
+// agent-align wrote.
+func writeUninstallFixture(t *testing.T) (dir string, configPath string) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir = t.TempDir()
+	files := map[string]string{
+		"claude.json":   `{"theme": "dark", "mcpServers": {"fs": {"command": "npx"}, "web": {"command": "web"}, "manual": {"command": "mine"}}}`,
+		"acp":           "#!/bin/sh\n",
+		"settings.json": claudeSettingsFixture,
+		"notes.md":      "notes\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	configPath = filepath.Join(dir, "agent-align.yml")
+	config := "mcpServers:\n  targets:\n    agents: [claudecode]\nallowedTools:\n  alwaysAllowedTools:\n    - shell(git log)\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	st, err := state.Load(statePath())
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	st.Record(stateRun("sync", &backup.Run{ID: "1"}, []plannedFile{
+		{Category: categoryAgents, Agent: "claudecode", Path: filepath.Join(dir, "claude.json"), Servers: []string{"fs", "web"}},
+		{Category: categoryExtra, Path: filepath.Join(dir, "notes.md")},
+		{Category: categoryAllowedTools, Agent: "copilot", Path: filepath.Join(dir, "acp")},
+		{Category: categoryAllowedTools, Agent: "claudecode", Path: filepath.Join(dir, "settings.json"), Tools: []string{"Bash(git status:*)"}},
+	}))
+	if err := st.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	return dir, configPath
+}
+
+func TestRunUninstallCommandRemovesManagedContent(t *testing.T) {
+	dir, configPath := writeUninstallFixture(t)
+
+	var out bytes.Buffer
+	if err := runUninstallCommand([]string{"-config", configPath, "-confirm"}, &out); err != nil {
+		t.Fatalf("uninstall returned error: %v\n%s", err, out.String())
+	}
+
+	var claude map[string]interface{}
+	data, _ := os.ReadFile(filepath.Join(dir, "claude.json"))
+	if err := json.Unmarshal(data, &claude); err != nil {
+		t.Fatalf("failed to parse claude.json: %v", err)
+	}
+	if servers := claude["mcpServers"].(map[string]interface{}); len(servers) != 1 || servers["manual"] == nil || claude["theme"] != "dark" {
+		t.Fatalf("expected only foreign content to remain, got %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "acp")); !os.IsNotExist(err) {
+		t.Fatalf("expected wrapper to be removed, got %v", err)
+	}
+	settings, _ := os.ReadFile(filepath.Join(dir, "settings.json"))
+	want := strings.Replace(claudeSettingsFixture, `"allow": [
+            "Bash(git status:*)",
+            "Read"
+        ]`, `"allow": [
+            "Read"
+        ]`, 1)
+	if string(settings) != want {
+		t.Fatalf("expected only the managed permission to be removed in place:\n%s", settings)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.md")); err != nil {
+		t.Fatalf("expected extra copy to be kept without -extra: %v", err)
+	}
+
+	st, err := state.Load(statePath())
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(st.Wrappers()) != 0 || len(st.ManagedServers()[filepath.Join(dir, "claude.json")]) != 0 {
+		t.Fatalf("expected state to drop removed content, got %+v", st.Files)
+	}
+	if !strings.Contains(out.String(), "undo with: agent-align restore") {
+		t.Fatalf("expected backup note in output:\n%s", out.String())
+	}
+}
+
+func TestPlanUninstallServersOnlyTouchesAgentFiles(t *testing.T) {
+	_, configPath := writeUninstallFixture(t)
+	st, err := state.Load(statePath())
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load returned error: %v", err)
+	}
+
+	plan := planUninstall(st, cfg, uninstallOptions{Servers: []string{"web"}, Extra: true})
+	if len(plan.Errors) != 0 || len(plan.Files) != 1 {
+		t.Fatalf("expected a single agent file, got %+v (errors %v)", plan.Files, plan.Errors)
+	}
+	file := plan.Files[0]
+	if !reflect.DeepEqual(file.Servers, []string{"fs"}) || !strings.Contains(string(file.Content), `"fs"`) || strings.Contains(string(file.Content), `"web"`) {
+		t.Fatalf("unexpected planned file %+v\n%s", file, file.Content)
+	}
+
+	plan = planUninstall(st, cfg, uninstallOptions{Agents: []string{"copilot"}, Extra: true})
+	var paths []string
+	for _, file := range plan.Files {
+		paths = append(paths, filepath.Base(file.Path))
+		if !file.Delete {
+			t.Fatalf("expected only removals, got %+v", file)
+		}
+	}
+	if !reflect.DeepEqual(paths, []string{"notes.md", "acp"}) {
+		t.Fatalf("unexpected planned files %v", paths)
+	}
+}
+
+func TestPlanCodexRulesRemovalDeletesEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.md")
+	rules := convertToolToCodexRule("shell(git status)") + "\n"
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	file, err := planCodexRulesRemoval(path, []string{strings.TrimSpace(rules)})
+	if err != nil || !file.Delete {
+		t.Fatalf("expected file to be deleted, got %+v (err %v)", file, err)
+	}
+
+	if err := os.WriteFile(path, []byte(rules+"# mine\n"), 0o644); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	file, err = planCodexRulesRemoval(path, []string{strings.TrimSpace(rules)})
+	if err != nil || file.Delete || string(file.Content) != "# mine\n" {
+		t.Fatalf("expected other lines to be kept, got %+v (err %v)", file, err)
+	}
+}
+
+func TestPlanClaudePermissionsRemovalDropsEmptyPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	src := "{\n  \"model\": \"opus\",\n  \"permissions\": {\n    \"allow\": [\"Bash(git status:*)\"]\n  }\n}\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatalf("failed to write settings: %v", err)
+	}
+	file, err := planClaudePermissionsRemoval(path, []string{"Bash(git status:*)"})
+	if err != nil {
+		t.Fatalf("planClaudePermissionsRemoval returned error: %v", err)
+	}
+	want := "{\n  \"model\": \"opus\"\n}\n"
+	if string(file.Content) != want {
+		t.Fatalf("unexpected settings:\n%s\nwant:\n%s", file.Content, want)
+	}
+}
@@ -0,0 +1,295 @@
+// Package backup keeps the previous version of every file agent-align
+// overwrites, grouped by the run that replaced it, so a run can be rolled back.
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"agent-align/internal/fileutil"
+)
+
+// DefaultRetention is the number of runs kept when none is configured.
+const DefaultRetention = 10
+
+const manifestName = "manifest.json"
+
+// idPattern matches the IDs Begin generates: a UTC timestamp, with a counter
+// added when several runs start in the same second.
+var idPattern = regexp.MustCompile(`^\d{8}-\d{6}(-\d+)?$`)
+
+// ValidID reports whether id has the form of a run ID. Only such IDs are
+// loaded, so an ID can never name a path outside the store.
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// Entry is one file saved by a run.
+type Entry struct {
+	Path string `json:"path"`
+	// Backup is the name of the saved copy inside the run directory. It is
+	// empty when the file did not exist before the run.
+	Backup string      `json:"backup,omitempty"`
+	Mode   os.FileMode `json:"mode,omitempty"`
+}
+
+// Existed reports whether the file existed before the run wrote it.
+func (e Entry) Existed() bool {
+	return e.Backup != ""
+}
+
+// Run is the set of files saved by one command.
+type Run struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Entries []Entry   `json:"entries"`
+
+	dir     string
+	created bool
+}
+
+// Store is a directory of runs, one subdirectory per run.
+type Store struct {
+	Dir string
+}
+
+// Begin starts a run for command. Nothing is written until the first Save.
+func (s Store) Begin(command string) *Run {
+	now := time.Now().UTC()
+	return &Run{ID: now.Format("20060102-150405"), Time: now, Command: command, dir: s.Dir}
+}
+
+// Save copies the current content of path into the run before it is
+// overwritten. A missing file is recorded so restoring removes it again.
+// Saving the same path twice keeps the first copy.
+func (r *Run) Save(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	for _, entry := range r.Entries {
+		if entry.Path == abs {
+			return nil
+		}
+	}
+	if err := r.ensureDir(); err != nil {
+		return err
+	}
+
+	entry := Entry{Path: abs}
+	info, err := os.Stat(abs)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		r.Entries = append(r.Entries, entry)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to inspect %s: %w", abs, err)
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return fmt.Errorf("failed to read %s for backup: %w", abs, err)
+	}
+	entry.Backup = strconv.Itoa(len(r.Entries)) + "-" + filepath.Base(abs)
+	entry.Mode = info.Mode().Perm()
+	// Backups can hold secrets, so they are only readable by the owner.
+	if err := os.WriteFile(filepath.Join(r.path(), entry.Backup), data, 0o600); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", abs, err)
+	}
+	r.Entries = append(r.Entries, entry)
+	return nil
+}
+
+// Entry returns the entry saved for path.
+func (r *Run) Entry(path string) (Entry, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Entry{}, false
+	}
+	for _, entry := range r.Entries {
+		if entry.Path == abs {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Finish records the run's manifest. Runs that saved nothing leave no trace.
+func (r *Run) Finish() error {
+	if len(r.Entries) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	if err := fileutil.WriteFile(filepath.Join(r.path(), manifestName), append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+	return nil
+}
+
+func (r *Run) path() string {
+	return filepath.Join(r.dir, r.ID)
+}
+
+// ensureDir creates the run directory, adding a suffix to the ID when a run
+// with the same timestamp already exists.
+func (r *Run) ensureDir() error {
+	if r.created {
+		return nil
+	}
+	if err := os.MkdirAll(r.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create backup directory %s: %w", r.dir, err)
+	}
+	base := r.ID
+	for i := 2; ; i++ {
+		err := os.Mkdir(r.path(), 0o700)
+		if err == nil {
+			r.created = true
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to create backup directory %s: %w", r.path(), err)
+		}
+		r.ID = base + "-" + strconv.Itoa(i)
+	}
+}
+
+// Runs returns the recorded runs, newest first.
+func (s Store) Runs() ([]Run, error) {
+	ids, err := s.runIDs()
+	if err != nil {
+		return nil, err
+	}
+	var runs []Run
+	for _, id := range ids {
+		run, err := s.Load(id)
+		if errors.Is(err, os.ErrNotExist) {
+			// A run that was interrupted before its manifest was written.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Time.After(runs[j].Time)
+	})
+	return runs, nil
+}
+
+// runIDs returns the IDs of every run directory, including runs interrupted
+// before their manifest was written, newest first.
+func (s Store) runIDs() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory %s: %w", s.Dir, err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() && ValidID(entry.Name()) {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return newerID(ids[i], ids[j])
+	})
+	return ids, nil
+}
+
+// newerID reports whether run ID a was generated after b: by timestamp, then
+// by the counter added when several runs start in the same second.
+func newerID(a, b string) bool {
+	stampA, counterA := splitID(a)
+	stampB, counterB := splitID(b)
+	if stampA != stampB {
+		return stampA > stampB
+	}
+	return counterA > counterB
+}
+
+// splitID separates a valid run ID into its timestamp and counter. The first
+// run of a second has counter 1.
+func splitID(id string) (string, int) {
+	const stampLen = len("20060102-150405")
+	if len(id) == stampLen {
+		return id, 1
+	}
+	counter, _ := strconv.Atoi(id[stampLen+1:])
+	return id[:stampLen], counter
+}
+
+// Load reads the run with the given ID.
+func (s Store) Load(id string) (Run, error) {
+	if !ValidID(id) {
+		return Run{}, fmt.Errorf("invalid backup run ID %q", id)
+	}
+	run := Run{dir: s.Dir}
+	data, err := os.ReadFile(filepath.Join(s.Dir, id, manifestName))
+	if err != nil {
+		return Run{}, err
+	}
+	if err := json.Unmarshal(data, &run); err != nil {
+		return Run{}, fmt.Errorf("failed to parse backup manifest for run %s: %w", id, err)
+	}
+	run.ID = id
+	return run, nil
+}
+
+// Restore puts entry back the way it was before run: the saved copy is
+// written back, or the file is removed when the run created it.
+func (r Run) Restore(entry Entry) error {
+	if !entry.Existed() {
+		if err := os.Remove(entry.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+		}
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(r.path(), entry.Backup))
+	if err != nil {
+		return fmt.Errorf("failed to read backup of %s: %w", entry.Path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", entry.Path, err)
+	}
+	if err := fileutil.WriteFile(entry.Path, data, entry.Mode); err != nil {
+		return err
+	}
+	if entry.Mode != 0 {
+		if err := os.Chmod(entry.Path, entry.Mode); err != nil {
+			return fmt.Errorf("failed to restore mode of %s: %w", entry.Path, err)
+		}
+	}
+	return nil
+}
+
+// Prune removes all but the newest keep runs. A keep of zero or less uses
+// DefaultRetention. Runs interrupted before their manifest was written count
+// towards keep and are ordered by their ID.
+func (s Store) Prune(keep int) error {
+	if keep <= 0 {
+		keep = DefaultRetention
+	}
+	ids, err := s.runIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids[min(keep, len(ids)):] {
+		if err := os.RemoveAll(filepath.Join(s.Dir, id)); err != nil {
+			return fmt.Errorf("failed to remove backup run %s: %w", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSaveAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	store := Store{Dir: filepath.Join(dir, "backups")}
+	existing := filepath.Join(dir, "claude.json")
+	created := filepath.Join(dir, "new.json")
+	if err := os.WriteFile(existing, []byte("before"), 0o640); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	run := store.Begin("sync")
+	for _, path := range []string{existing, created, existing} {
+		if err := run.Save(path); err != nil {
+			t.Fatalf("Save returned error: %v", err)
+		}
+	}
+	if err := run.Finish(); err != nil {
+		t.Fatalf("Finish returned error: %v", err)
+	}
+	if err := os.WriteFile(existing, []byte("after"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(created, []byte("after"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	runs, err := store.Runs()
+	if err != nil {
+		t.Fatalf("Runs returned error: %v", err)
+	}
+	if len(runs) != 1 || len(runs[0].Entries) != 2 || runs[0].Command != "sync" {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+	for _, entry := range runs[0].Entries {
+		if err := runs[0].Restore(entry); err != nil {
+			t.Fatalf("Restore returned error: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "before" {
+		t.Fatalf("expected original content, got %q", data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Fatalf("expected %s created by the run to be removed", created)
+	}
+}
+
+func TestRunWithoutSavesLeavesNoTrace(t *testing.T) {
+	store := Store{Dir: filepath.Join(t.TempDir(), "backups")}
+	if err := store.Begin("sync").Finish(); err != nil {
+		t.Fatalf("Finish returned error: %v", err)
+	}
+	if _, err := os.Stat(store.Dir); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup directory, got %v", err)
+	}
+}
+
+func TestPruneKeepsNewestRuns(t *testing.T) {
+	dir := t.TempDir()
+	store := Store{Dir: filepath.Join(dir, "backups")}
+	path := filepath.Join(dir, "file.json")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		run := store.Begin("sync")
+		if err := run.Save(path); err != nil {
+			t.Fatalf("Save returned error: %v", err)
+		}
+		if err := run.Finish(); err != nil {
+			t.Fatalf("Finish returned error: %v", err)
+		}
+		ids = append(ids, run.ID)
+	}
+
+	if err := store.Prune(2); err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+	runs, err := store.Runs()
+	if err != nil {
+		t.Fatalf("Runs returned error: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != ids[2] || runs[1].ID != ids[1] {
+		t.Fatalf("expected the two newest runs %v, got %+v", ids[1:], runs)
+	}
+}
+
+func TestPruneCountsRunsWithoutManifest(t *testing.T) {
+	store := Store{Dir: filepath.Join(t.TempDir(), "backups")}
+	// Two finished runs and two interrupted ones, one of them the newest.
+	ids := []string{"20260101-120000", "20260101-120000-2", "20260101-120000-10", "20260102-090000"}
+	for i, id := range ids {
+		if err := os.MkdirAll(filepath.Join(store.Dir, id), 0o700); err != nil {
+			t.Fatalf("failed to create run dir: %v", err)
+		}
+		if i%2 == 1 {
+			continue
+		}
+		manifest := `{"id":"` + id + `","time":"2026-01-01T12:00:00Z","entries":[]}`
+		if err := os.WriteFile(filepath.Join(store.Dir, id, manifestName), []byte(manifest), 0o600); err != nil {
+			t.Fatalf("failed to write manifest: %v", err)
+		}
+	}
+
+	if err := store.Prune(2); err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+	entries, err := os.ReadDir(store.Dir)
+	if err != nil {
+		t.Fatalf("failed to read backup dir: %v", err)
+	}
+	var kept []string
+	for _, entry := range entries {
+		kept = append(kept, entry.Name())
+	}
+	if len(kept) != 2 || kept[0] != "20260101-120000-10" || kept[1] != "20260102-090000" {
+		t.Fatalf("expected the two newest run dirs to be kept, got %v", kept)
+	}
+}
+
+func TestLoadRejectsIDsOutsideTheStore(t *testing.T) {
+	dir := t.TempDir()
+	store := Store{Dir: filepath.Join(dir, "backups")}
+	if err := os.MkdirAll(filepath.Join(dir, "x"), 0o700); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "x", manifestName), []byte(`{"id":"x"}`), 0o600); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	for _, id := range []string{"../x", "../../x", "20260101-120000/..", "/tmp", ""} {
+		if _, err := store.Load(id); err == nil || !strings.Contains(err.Error(), "invalid backup run ID") {
+			t.Errorf("Load(%q): expected an invalid ID error, got %v", id, err)
+		}
+	}
+	for _, id := range []string{"20260101-120000", "20260101-120000-2"} {
+		if !ValidID(id) {
+			t.Errorf("expected %q to be a valid run ID", id)
+		}
+	}
+}
@@ -8,14 +8,45 @@ import (
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"agent-align/internal/fileutil"
+	"agent-align/internal/syncer"
 )
 
 // Config describes the MCP sync behavior and extra file/directory copies.
 type Config struct {
-	MCP            MCPConfig          `yaml:"mcpServers"`
-	ExtraTargets   ExtraTargetsConfig `yaml:"extraTargets"`
-	AllowedTools   AllowedToolsConfig `yaml:"allowedTools"`
-	ArchiveTargets []ArchiveTarget    `yaml:"archiveTargets"`
+	MCP              MCPConfig          `yaml:"mcpServers"`
+	ExtraTargets     ExtraTargetsConfig `yaml:"extraTargets"`
+	AllowedTools     AllowedToolsConfig `yaml:"allowedTools"`
+	ArchiveTargets   []ArchiveTarget    `yaml:"archiveTargets"`
+	AgentDefinitions []AgentDefinition  `yaml:"agentDefinitions,omitempty"`
+	Backups          BackupsConfig      `yaml:"backups,omitempty"`
+}
+
+// BackupsConfig controls the copies kept of files agent-align overwrites.
+type BackupsConfig struct {
+	// Retain is the number of runs whose backups are kept. Zero uses the
+	// default of 10.
+	Retain int `yaml:"retain,omitempty"`
+}
+
+// AgentDefinition declares a custom agent that can be targeted like the
+// built-in agents without a new agent-align release.
+type AgentDefinition struct {
+	Name     string          `yaml:"name"`
+	Path     string          `yaml:"path"`
+	Format   string          `yaml:"format"`
+	RootNode string          `yaml:"rootNode,omitempty"`
+	Rules    AgentFieldRules `yaml:"rules,omitempty"`
+}
+
+// AgentFieldRules lists the declarative conversions applied to each server
+// before it is written for a custom agent.
+type AgentFieldRules struct {
+	Rename   map[string]string      `yaml:"rename,omitempty"`
+	Drop     []string               `yaml:"drop,omitempty"`
+	Defaults map[string]interface{} `yaml:"defaults,omitempty"`
+	TypeMap  map[string]string      `yaml:"typeMap,omitempty"`
 }
 
 // ArchiveTarget describes a source directory whose immediate subdirectories
@@ -29,6 +60,9 @@ type ArchiveTarget struct {
 type MCPConfig struct {
 	ConfigPath string        `yaml:"configPath"`
 	Targets    TargetsConfig `yaml:"targets"`
+	// StrictEnv fails the run when an MCP definition references an unset
+	// environment variable.
+	StrictEnv bool `yaml:"strictEnv,omitempty"`
 }
 
 // TargetsConfig groups agent targets and additional destinations.
@@ -43,6 +77,17 @@ type AgentTarget struct {
 	Path string `yaml:"path,omitempty"`
 	// DisabledMcpServers lists MCP IDs that should be omitted for this agent.
 	DisabledMcpServers []string `yaml:"disabledMcpServers,omitempty"`
+	// MergeStrategy is one of "replace" (default), "merge", or "managed-only".
+	MergeStrategy string `yaml:"mergeStrategy,omitempty"`
+	// IncludeTags limits the agent to MCP servers with at least one of these tags.
+	IncludeTags []string `yaml:"includeTags,omitempty"`
+	// ExcludeTags omits MCP servers that have any of these tags.
+	ExcludeTags []string `yaml:"excludeTags,omitempty"`
+	// Profile selects a profile from the MCP definitions file for this agent.
+	Profile string `yaml:"profile,omitempty"`
+	// Secrets is "expand" (default) or "passthrough" to keep ${VAR}
+	// references in the agent's native syntax.
+	Secrets string `yaml:"secrets,omitempty"`
 }
 
 // AdditionalTargets lists paths for JSON-style destinations.
@@ -226,6 +271,11 @@ func (a *AgentTarget) UnmarshalYAML(node *yaml.Node) error {
 			"name":               true,
 			"path":               true,
 			"disabledMcpServers": true,
+			"mergeStrategy":      true,
+			"includeTags":        true,
+			"excludeTags":        true,
+			"profile":            true,
+			"secrets":            true,
 		}
 		for i := 0; i < len(node.Content); i += 2 {
 			key := node.Content[i].Value
@@ -242,6 +292,11 @@ func (a *AgentTarget) UnmarshalYAML(node *yaml.Node) error {
 		a.Name = r.Name
 		a.Path = r.Path
 		a.DisabledMcpServers = r.DisabledMcpServers
+		a.MergeStrategy = r.MergeStrategy
+		a.IncludeTags = r.IncludeTags
+		a.ExcludeTags = r.ExcludeTags
+		a.Profile = r.Profile
+		a.Secrets = r.Secrets
 		return nil
 	default:
 		return fmt.Errorf("agent entry must be a string or mapping")
@@ -321,6 +376,20 @@ func Load(path string) (Config, error) {
 	}
 
 	cfg.MCP.Targets = normalizeTargets(cfg.MCP.Targets)
+	for _, target := range cfg.MCP.Targets.Agents {
+		if !syncer.IsMergeStrategy(target.MergeStrategy) {
+			return Config{}, fmt.Errorf("config at %q has agent %q with unsupported mergeStrategy %q (expected replace, merge, or managed-only)", path, target.Name, target.MergeStrategy)
+		}
+		switch target.Secrets {
+		case "", "expand", "passthrough":
+		default:
+			return Config{}, fmt.Errorf("config at %q has agent %q with unsupported secrets mode %q (expected expand or passthrough)", path, target.Name, target.Secrets)
+		}
+	}
+
+	if cfg.Backups.Retain < 0 {
+		return Config{}, fmt.Errorf("config at %q has a negative backups.retain %d", path, cfg.Backups.Retain)
+	}
 
 	for i := range cfg.MCP.Targets.Additional.JSON {
 		cfg.MCP.Targets.Additional.JSON[i].FilePath = strings.TrimSpace(cfg.MCP.Targets.Additional.JSON[i].FilePath)
@@ -531,6 +600,42 @@ func Load(path string) (Config, error) {
 		cfg.ArchiveTargets[i].Destination = expandedDest
 	}
 
+	seenDefinitions := make(map[string]struct{}, len(cfg.AgentDefinitions))
+	for i := range cfg.AgentDefinitions {
+		def := &cfg.AgentDefinitions[i]
+		def.Name = normalizeAgent(def.Name)
+		if def.Name == "" {
+			return Config{}, fmt.Errorf("config at %q has an agent definition without a name", path)
+		}
+		if _, exists := seenDefinitions[def.Name]; exists {
+			return Config{}, fmt.Errorf("config at %q defines agent %q more than once", path, def.Name)
+		}
+		seenDefinitions[def.Name] = struct{}{}
+
+		def.Format = strings.ToLower(strings.TrimSpace(def.Format))
+		switch def.Format {
+		case "json", "jsonc", "toml", "yaml":
+		case "":
+			return Config{}, fmt.Errorf("config at %q has agent definition %q without a format", path, def.Name)
+		default:
+			return Config{}, fmt.Errorf("config at %q has agent definition %q with unsupported format %q", path, def.Name, def.Format)
+		}
+
+		defPath := strings.TrimSpace(def.Path)
+		if defPath == "" {
+			return Config{}, fmt.Errorf("config at %q has agent definition %q without a path", path, def.Name)
+		}
+		expanded, err := expandUserPath(defPath)
+		if err != nil {
+			return Config{}, fmt.Errorf("config at %q has agent definition %q with invalid path %q: %w", path, def.Name, defPath, err)
+		}
+		def.Path = expanded
+		def.RootNode = strings.TrimSpace(def.RootNode)
+		if def.Format == "toml" && def.RootNode == "" {
+			return Config{}, fmt.Errorf("config at %q has TOML agent definition %q without a rootNode", path, def.Name)
+		}
+	}
+
 	if len(cfg.MCP.Targets.Agents) == 0 &&
 		len(cfg.MCP.Targets.Additional.JSON) == 0 &&
 		len(cfg.MCP.Targets.Additional.JSONC) == 0 &&
@@ -571,7 +676,12 @@ func normalizeTargets(targets TargetsConfig) TargetsConfig {
 			}
 			disabled = append(disabled, t)
 		}
-		key := name + "|" + path + "|" + strings.Join(disabled, ",")
+		strategy := strings.ToLower(strings.TrimSpace(target.MergeStrategy))
+		includeTags := normalizeTags(target.IncludeTags)
+		excludeTags := normalizeTags(target.ExcludeTags)
+		key := name + "|" + path + "|" + strings.Join(disabled, ",") + "|" + strategy +
+			"|" + strings.Join(includeTags, ",") + "|" + strings.Join(excludeTags, ",") + "|" + strings.TrimSpace(target.Profile) +
+			"|" + strings.ToLower(strings.TrimSpace(target.Secrets))
 		if _, exists := seen[key]; exists {
 			continue
 		}
@@ -580,12 +690,28 @@ func normalizeTargets(targets TargetsConfig) TargetsConfig {
 			Name:               name,
 			Path:               path,
 			DisabledMcpServers: disabled,
+			MergeStrategy:      strategy,
+			IncludeTags:        includeTags,
+			ExcludeTags:        excludeTags,
+			Profile:            strings.TrimSpace(target.Profile),
+			Secrets:            strings.ToLower(strings.TrimSpace(target.Secrets)),
 		})
 	}
 	targets.Agents = agents
 	return targets
 }
 
+// normalizeTags lowercases and trims tags, skipping empty entries.
+func normalizeTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		if trimmed := strings.ToLower(strings.TrimSpace(tag)); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
 func expandUserPath(value string) (string, error) {
 	value = strings.TrimSpace(value)
 	if value == "" || value[0] != '~' {
@@ -668,7 +794,7 @@ func UpdateAllowedTools(path string, tools []string) error {
 		return fmt.Errorf("failed to marshal updated config: %w", err)
 	}
 
-	if err := os.WriteFile(path, out, 0o644); err != nil {
+	if err := fileutil.WriteFile(path, out, 0o644); err != nil {
 		return fmt.Errorf("failed to write config %q: %w", path, err)
 	}
 	return nil
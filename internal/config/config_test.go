@@ -778,3 +778,174 @@ allowedTools:
 		t.Errorf("expected [shell(npm test)], got %v", got.AllowedTools.AlwaysAllowedTools)
 	}
 }
+
+func TestLoadAgentDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+
+	path := writeConfigFile(t, `mcpServers:
+  targets:
+    agents:
+      - cursor
+agentDefinitions:
+  - name: Cursor
+    path: ~/.cursor/mcp.json
+    format: JSON
+    rootNode: mcpServers
+    rules:
+      rename:
+        env: environment
+      drop: [alwaysAllow]
+      defaults:
+        enabled: true
+      typeMap:
+        streamable-http: http
+`)
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(got.AgentDefinitions) != 1 {
+		t.Fatalf("expected 1 agent definition, got %d", len(got.AgentDefinitions))
+	}
+	def := got.AgentDefinitions[0]
+	if def.Name != "cursor" || def.Format != "json" || def.RootNode != "mcpServers" {
+		t.Fatalf("unexpected definition: %#v", def)
+	}
+	if def.Path != filepath.Join(dir, ".cursor", "mcp.json") {
+		t.Fatalf("definition path not expanded, got %s", def.Path)
+	}
+	if def.Rules.Rename["env"] != "environment" || def.Rules.TypeMap["streamable-http"] != "http" {
+		t.Fatalf("unexpected rules: %#v", def.Rules)
+	}
+	if def.Rules.Defaults["enabled"] != true || len(def.Rules.Drop) != 1 {
+		t.Fatalf("unexpected rules: %#v", def.Rules)
+	}
+}
+
+func TestLoadRejectsInvalidAgentDefinitions(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"missing name", "  - path: /tmp/x\n    format: json\n", "without a name"},
+		{"missing format", "  - name: x\n    path: /tmp/x\n", "without a format"},
+		{"bad format", "  - name: x\n    path: /tmp/x\n    format: ini\n", "unsupported format"},
+		{"missing path", "  - name: x\n    format: json\n", "without a path"},
+		{"duplicate", "  - name: x\n    path: /tmp/x\n    format: json\n  - name: X\n    path: /tmp/y\n    format: json\n", "more than once"},
+		{"toml without root", "  - name: x\n    path: /tmp/x\n    format: toml\n", "without a rootNode"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeConfigFile(t, "mcpServers:\n  targets:\n    agents: [copilot]\nagentDefinitions:\n"+tc.body)
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadAgentMergeStrategy(t *testing.T) {
+	path := writeConfigFile(t, `mcpServers:
+  targets:
+    agents:
+      - name: claudecode
+        mergeStrategy: Managed-Only
+      - codex
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if got := cfg.MCP.Targets.Agents[0].MergeStrategy; got != "managed-only" {
+		t.Fatalf("expected normalized merge strategy, got %q", got)
+	}
+	if got := cfg.MCP.Targets.Agents[1].MergeStrategy; got != "" {
+		t.Fatalf("expected default merge strategy, got %q", got)
+	}
+
+	path = writeConfigFile(t, `mcpServers:
+  targets:
+    agents:
+      - name: claudecode
+        mergeStrategy: append
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "unsupported mergeStrategy") {
+		t.Fatalf("expected unsupported mergeStrategy error, got %v", err)
+	}
+}
+
+func TestLoadAgentTagFilters(t *testing.T) {
+	path := writeConfigFile(t, `mcpServers:
+  targets:
+    agents:
+      - name: codex
+        includeTags: [" Work ", ""]
+        excludeTags: [experimental]
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	agent := cfg.MCP.Targets.Agents[0]
+	if strings.Join(agent.IncludeTags, ",") != "work" || strings.Join(agent.ExcludeTags, ",") != "experimental" {
+		t.Fatalf("unexpected tag filters: %+v", agent)
+	}
+}
+
+func TestLoadAgentSecretsMode(t *testing.T) {
+	path := writeConfigFile(t, `mcpServers:
+  targets:
+    agents:
+      - name: claudecode
+        secrets: Passthrough
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if got := cfg.MCP.Targets.Agents[0].Secrets; got != "passthrough" {
+		t.Fatalf("expected normalized secrets mode, got %q", got)
+	}
+
+	path = writeConfigFile(t, `mcpServers:
+  targets:
+    agents:
+      - name: claudecode
+        secrets: hide
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "unsupported secrets mode") {
+		t.Fatalf("expected secrets mode error, got %v", err)
+	}
+}
+
+func TestLoadBackupsRetain(t *testing.T) {
+	path := writeConfigFile(t, `mcpServers:
+  targets:
+    agents: [claudecode]
+backups:
+  retain: 3
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Backups.Retain != 3 {
+		t.Fatalf("expected retain 3, got %d", cfg.Backups.Retain)
+	}
+
+	path = writeConfigFile(t, `mcpServers:
+  targets:
+    agents: [claudecode]
+backups:
+  retain: -1
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "negative backups.retain") {
+		t.Fatalf("expected retain error, got %v", err)
+	}
+}
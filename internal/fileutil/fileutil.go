@@ -0,0 +1,122 @@
+// Package fileutil writes files so that readers never observe a partially
+// written file: content goes to a temporary file in the same directory, is
+// synced to disk, and is renamed over the destination.
+package fileutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile atomically replaces path with data. An existing file keeps its
+// mode and, where the platform allows it, its owner; perm applies to new
+// files only. When path is a symlink the file it points to is replaced, so
+// links into dotfile repositories stay intact.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	staged, err := Stage(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := staged.Commit(); err != nil {
+		staged.Discard()
+		return err
+	}
+	return nil
+}
+
+// Staged is content written to a temporary file next to its destination,
+// ready to be renamed into place.
+type Staged struct {
+	Path   string // destination, with symlinks resolved
+	tmp    string
+	closed bool
+}
+
+// Stage writes data to a temporary file in the directory of path and syncs
+// it, applying the same mode and owner rules as WriteFile. The destination is
+// untouched until Commit; call Discard to drop the temporary file.
+func Stage(path string, data []byte, perm os.FileMode) (*Staged, error) {
+	target, err := resolveTarget(path)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := os.Stat(target)
+	switch {
+	case err == nil:
+		perm = existing.Mode().Perm()
+	case errors.Is(err, os.ErrNotExist):
+		existing = nil
+	default:
+		return nil, fmt.Errorf("failed to inspect %s: %w", target, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for %s: %w", target, err)
+	}
+	staged := &Staged{Path: target, tmp: tmp.Name()}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		staged.Discard()
+		return nil, fmt.Errorf("failed to write %s: %w", staged.tmp, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		staged.Discard()
+		return nil, fmt.Errorf("failed to sync %s: %w", staged.tmp, err)
+	}
+	if err := tmp.Close(); err != nil {
+		staged.Discard()
+		return nil, fmt.Errorf("failed to close %s: %w", staged.tmp, err)
+	}
+	if err := os.Chmod(staged.tmp, perm); err != nil {
+		staged.Discard()
+		return nil, fmt.Errorf("failed to set mode on %s: %w", staged.tmp, err)
+	}
+	if existing != nil {
+		if err := copyOwner(staged.tmp, existing); err != nil {
+			staged.Discard()
+			return nil, fmt.Errorf("failed to keep owner of %s: %w", target, err)
+		}
+	}
+	return staged, nil
+}
+
+// Commit renames the staged file over its destination.
+func (s *Staged) Commit() error {
+	if s.closed {
+		return fmt.Errorf("%s was already committed or discarded", s.Path)
+	}
+	if err := os.Rename(s.tmp, s.Path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", s.Path, err)
+	}
+	s.closed = true
+	syncDir(filepath.Dir(s.Path))
+	return nil
+}
+
+// Discard removes the temporary file if it has not been committed.
+func (s *Staged) Discard() {
+	if s.closed {
+		return
+	}
+	os.Remove(s.tmp)
+	s.closed = true
+}
+
+// resolveTarget follows path if it is a symlink.
+func resolveTarget(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return path, nil
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve symlink %s: %w", path, err)
+	}
+	return target, nil
+}
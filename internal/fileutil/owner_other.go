@@ -0,0 +1,13 @@
+//go:build !unix
+
+package fileutil
+
+import "os"
+
+// copyOwner is a no-op on platforms without Unix ownership.
+func copyOwner(path string, info os.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op on platforms that cannot sync directories.
+func syncDir(dir string) {}
@@ -0,0 +1,335 @@
+// Package jsoncdoc edits JSONC (JSON with comments) documents in place. Only
+// the bytes of the value being replaced are rewritten; comments, trailing
+// commas, key order, and indentation elsewhere in the file are kept as-is.
+package jsoncdoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type nodeKind int
+
+const (
+	nodeScalar nodeKind = iota
+	nodeObject
+	nodeArray
+)
+
+// node is a parsed value and the byte span it occupies in the source.
+type node struct {
+	kind    nodeKind
+	start   int
+	end     int // offset just past the value
+	members []member
+}
+
+// member is a key/value pair of an object.
+type member struct {
+	key      string
+	keyStart int
+	value    *node
+	comma    bool // followed by a comma
+	end      int  // offset just past the value or its comma
+}
+
+// Document is a parsed JSONC file.
+type Document struct {
+	src  []byte
+	root *node
+}
+
+// Parse reads a JSONC document. Line and block comments and trailing commas
+// are accepted. A document that only contains whitespace and comments has no
+// root value.
+func Parse(data []byte) (*Document, error) {
+	p := &parser{src: data, line: 1}
+	doc := &Document{src: data}
+	p.skipBlank()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.eof() {
+		return doc, nil
+	}
+	root, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q after document", p.peek())
+	}
+	doc.root = root
+	return doc, nil
+}
+
+// Bytes returns the original document source.
+func (d *Document) Bytes() []byte {
+	return d.src
+}
+
+// Set returns the document source with the value at path replaced by value.
+// Missing objects along the path are created inside the innermost existing
+// object, and a non-object value along the path is replaced by a new object.
+// An empty path replaces the whole document. New values are rendered with
+// the indentation already used by the document.
+func (d *Document) Set(path []string, value interface{}) ([]byte, error) {
+	unit := d.indentUnit()
+	if d.root == nil {
+		rendered, err := render(nest(path, value), "", unit)
+		if err != nil {
+			return nil, err
+		}
+		out := []byte(strings.TrimRight(string(d.src), " \t\r\n"))
+		if len(out) > 0 {
+			out = append(out, '\n')
+		}
+		return append(append(out, rendered...), '\n'), nil
+	}
+	if len(path) == 0 {
+		return d.replace(d.root, value, unit)
+	}
+	if d.root.kind != nodeObject {
+		return nil, fmt.Errorf("jsonc: document root is not an object")
+	}
+
+	obj := d.root
+	for i, segment := range path {
+		m := obj.lookup(segment)
+		if m == nil {
+			return d.insert(obj, path[i], nest(path[i+1:], value), unit)
+		}
+		if i == len(path)-1 || m.value.kind != nodeObject {
+			return d.replace(m.value, nest(path[i+1:], value), unit)
+		}
+		obj = m.value
+	}
+	return nil, fmt.Errorf("jsonc: unreachable")
+}
+
+// Delete returns the document source without the member at path. A member
+// on its own line is removed with its line; the rest of the document is kept
+// as-is. The source is returned unchanged when path does not exist.
+func (d *Document) Delete(path []string) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("jsonc: cannot delete the document root")
+	}
+	if d.root == nil {
+		return d.src, nil
+	}
+	if d.root.kind != nodeObject {
+		return nil, fmt.Errorf("jsonc: document root is not an object")
+	}
+
+	obj := d.root
+	for _, segment := range path[:len(path)-1] {
+		m := obj.lookup(segment)
+		if m == nil || m.value.kind != nodeObject {
+			return d.src, nil
+		}
+		obj = m.value
+	}
+	i := obj.index(path[len(path)-1])
+	if i < 0 {
+		return d.src, nil
+	}
+	m := obj.members[i]
+	if !m.comma && i > 0 {
+		prev := obj.members[i-1]
+		if d.sameLine(prev.value.end, m.keyStart) {
+			// Inline last member: drop it from the end of the previous value.
+			return splice(d.src, prev.value.end, m.value.end, ""), nil
+		}
+		// The previous member becomes the last one, so it loses its comma.
+		start, end := d.memberSpan(m)
+		out := splice(d.src, start, end, "")
+		return splice(out, prev.end-1, prev.end, ""), nil
+	}
+	start, end := d.memberSpan(m)
+	return splice(d.src, start, end, ""), nil
+}
+
+// memberSpan returns the bytes to remove with m: its whole line, including a
+// trailing line comment, when it is alone on its lines, or else the member
+// and the blanks after it.
+func (d *Document) memberSpan(m member) (int, int) {
+	end := m.end
+	lineEnd := end
+	for lineEnd < len(d.src) && d.src[lineEnd] != '\n' {
+		lineEnd++
+	}
+	start := d.lineStart(m.keyStart)
+	rest := strings.TrimSpace(string(d.src[end:lineEnd]))
+	if strings.TrimSpace(string(d.src[start:m.keyStart])) == "" && (rest == "" || strings.HasPrefix(rest, "//")) {
+		if lineEnd < len(d.src) {
+			lineEnd++
+		}
+		return start, lineEnd
+	}
+	for end < len(d.src) && (d.src[end] == ' ' || d.src[end] == '\t') {
+		end++
+	}
+	return m.keyStart, end
+}
+
+// lookup returns the member with the given key. When a key is repeated the
+// last occurrence wins, matching how encoding/json decodes objects.
+func (n *node) lookup(key string) *member {
+	if i := n.index(key); i >= 0 {
+		return &n.members[i]
+	}
+	return nil
+}
+
+// index returns the position of the member that lookup would return, or -1.
+func (n *node) index(key string) int {
+	for i := len(n.members) - 1; i >= 0; i-- {
+		if n.members[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Document) replace(n *node, value interface{}, unit string) ([]byte, error) {
+	rendered, err := render(value, d.lineIndent(n.start), unit)
+	if err != nil {
+		return nil, err
+	}
+	return splice(d.src, n.start, n.end, rendered), nil
+}
+
+// insert adds key as the last member of obj.
+func (d *Document) insert(obj *node, key string, value interface{}, unit string) ([]byte, error) {
+	closing := obj.end - 1
+	outer := d.lineIndent(obj.start)
+
+	if len(obj.members) == 0 {
+		inner := outer + unit
+		text, err := renderMember(key, value, inner, unit)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(d.src[obj.start+1:closing])) == "" {
+			return splice(d.src, obj.start+1, closing, "\n"+inner+text+"\n"+outer), nil
+		}
+		// The object only holds comments; keep them above the new member.
+		return d.insertBefore(closing, inner, text), nil
+	}
+
+	first := obj.members[0]
+	last := obj.members[len(obj.members)-1]
+	if d.sameLine(obj.start, first.keyStart) {
+		// Single-line object: append inline after the last member.
+		text, err := renderMember(key, value, outer, unit)
+		if err != nil {
+			return nil, err
+		}
+		if last.comma {
+			return splice(d.src, closing, closing, " "+text+", "), nil
+		}
+		return splice(d.src, last.value.end, last.value.end, ", "+text), nil
+	}
+
+	indent := d.lineIndent(first.keyStart)
+	text, err := renderMember(key, value, indent, unit)
+	if err != nil {
+		return nil, err
+	}
+	if last.comma {
+		// Keep the trailing comma style of the existing members.
+		text += ","
+	}
+	out := d.insertBefore(closing, indent, text)
+	if !last.comma {
+		out = splice(out, last.value.end, last.value.end, ",")
+	}
+	return out, nil
+}
+
+// insertBefore places text on its own line ahead of the closing bracket at
+// offset closing.
+func (d *Document) insertBefore(closing int, indent, text string) []byte {
+	lineStart := d.lineStart(closing)
+	if strings.TrimSpace(string(d.src[lineStart:closing])) == "" {
+		return splice(d.src, lineStart, lineStart, indent+text+"\n")
+	}
+	return splice(d.src, closing, closing, "\n"+indent+text+"\n"+d.lineIndent(closing))
+}
+
+func (d *Document) lineStart(offset int) int {
+	for offset > 0 && d.src[offset-1] != '\n' {
+		offset--
+	}
+	return offset
+}
+
+// lineIndent returns the leading whitespace of the line holding offset.
+func (d *Document) lineIndent(offset int) string {
+	start := d.lineStart(offset)
+	end := start
+	for end < len(d.src) && (d.src[end] == ' ' || d.src[end] == '\t') {
+		end++
+	}
+	return string(d.src[start:end])
+}
+
+func (d *Document) sameLine(a, b int) bool {
+	return !strings.Contains(string(d.src[a:b]), "\n")
+}
+
+// indentUnit guesses one level of indentation from the first indented line,
+// defaulting to two spaces.
+func (d *Document) indentUnit() string {
+	for _, line := range strings.Split(string(d.src), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || len(trimmed) == len(line) {
+			continue
+		}
+		if line[0] == '\t' {
+			return "\t"
+		}
+		return line[:len(line)-len(strings.TrimLeft(line, " "))]
+	}
+	return "  "
+}
+
+// nest wraps value in one object per path segment.
+func nest(path []string, value interface{}) interface{} {
+	for i := len(path) - 1; i >= 0; i-- {
+		value = map[string]interface{}{path[i]: value}
+	}
+	return value
+}
+
+func render(value interface{}, indent, unit string) (string, error) {
+	data, err := json.MarshalIndent(value, indent, unit)
+	if err != nil {
+		return "", fmt.Errorf("jsonc: failed to marshal value: %w", err)
+	}
+	return string(data), nil
+}
+
+func renderMember(key string, value interface{}, indent, unit string) (string, error) {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("jsonc: failed to marshal key: %w", err)
+	}
+	v, err := render(value, indent, unit)
+	if err != nil {
+		return "", err
+	}
+	return string(k) + ": " + v, nil
+}
+
+func splice(src []byte, start, end int, text string) []byte {
+	out := make([]byte, 0, len(src)-(end-start)+len(text))
+	out = append(out, src[:start]...)
+	out = append(out, text...)
+	return append(out, src[end:]...)
+}
@@ -0,0 +1,180 @@
+package jsoncdoc
+
+import (
+	"testing"
+)
+
+func set(t *testing.T, src string, path []string, value interface{}) string {
+	t.Helper()
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	out, err := doc.Set(path, value)
+	if err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	return string(out)
+}
+
+func TestSetReplacesOnlyTargetValue(t *testing.T) {
+	src := `{
+  // Theme configuration
+  "theme": "dark",
+  /* block
+     comment */
+  "mcp": {
+    "old": { "command": ["node"] }, // old server
+  },
+  "editor": {
+    "tabSize": 2, // trailing comma kept
+  },
+}
+`
+	out := set(t, src, []string{"mcp"}, map[string]interface{}{
+		"new": map[string]interface{}{"command": []interface{}{"npx"}},
+	})
+	want := `{
+  // Theme configuration
+  "theme": "dark",
+  /* block
+     comment */
+  "mcp": {
+    "new": {
+      "command": [
+        "npx"
+      ]
+    }
+  },
+  "editor": {
+    "tabSize": 2, // trailing comma kept
+  },
+}
+`
+	if out != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestSetInsertsMissingPath(t *testing.T) {
+	src := "{\n\t\"keep\": true // note\n}\n"
+	out := set(t, src, []string{"a", "b"}, map[string]interface{}{"x": 1})
+	want := "{\n\t\"keep\": true, // note\n\t\"a\": {\n\t\t\"b\": {\n\t\t\t\"x\": 1\n\t\t}\n\t}\n}\n"
+	if out != want {
+		t.Fatalf("unexpected output:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestSetKeepsTrailingCommaStyle(t *testing.T) {
+	src := "{\n  \"keep\": true,\n}"
+	out := set(t, src, []string{"mcp"}, map[string]interface{}{})
+	want := "{\n  \"keep\": true,\n  \"mcp\": {},\n}"
+	if out != want {
+		t.Fatalf("unexpected output:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestSetEmptyObjectAndDocument(t *testing.T) {
+	if out := set(t, "{}", []string{"mcp"}, 1); out != "{\n  \"mcp\": 1\n}" {
+		t.Fatalf("unexpected output for empty object: %q", out)
+	}
+	if out := set(t, "{ // only a comment\n}", []string{"mcp"}, 1); out != "{ // only a comment\n  \"mcp\": 1\n}" {
+		t.Fatalf("unexpected output for comment-only object: %q", out)
+	}
+	if out := set(t, "", []string{"mcp"}, 1); out != "{\n  \"mcp\": 1\n}\n" {
+		t.Fatalf("unexpected output for empty document: %q", out)
+	}
+}
+
+func TestSetReplacesNonObjectAlongPath(t *testing.T) {
+	out := set(t, `{"a": "text", "b": 2}`, []string{"a", "b"}, true)
+	want := `{"a": {
+  "b": true
+}, "b": 2}`
+	if out != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestSetRejectsNonObjectRoot(t *testing.T) {
+	doc, err := Parse([]byte(`[1, 2]`))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if _, err := doc.Set([]string{"mcp"}, 1); err == nil {
+		t.Fatal("expected error for array root")
+	}
+}
+
+func TestDeleteRemovesOnlyTargetMember(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		path []string
+		want string
+	}{
+		{
+			name: "own line keeps comments",
+			src:  "{\n  // model\n  \"model\": \"opus\",\n  \"allow\": [\n    \"Read\"\n  ], // managed\n  \"deny\": []\n}\n",
+			path: []string{"allow"},
+			want: "{\n  // model\n  \"model\": \"opus\",\n  \"deny\": []\n}\n",
+		},
+		{
+			name: "last member drops previous comma",
+			src:  "{\n  \"model\": \"opus\", // keep\n  \"allow\": []\n}\n",
+			path: []string{"allow"},
+			want: "{\n  \"model\": \"opus\" // keep\n}\n",
+		},
+		{
+			name: "inline members",
+			src:  `{"a": 1, "b": {"c": 2, "d": 3}}`,
+			path: []string{"b", "d"},
+			want: `{"a": 1, "b": {"c": 2}}`,
+		},
+		{
+			name: "inline first member",
+			src:  `{"a": 1, "b": 2}`,
+			path: []string{"a"},
+			want: `{"b": 2}`,
+		},
+		{
+			name: "missing path",
+			src:  `{"a": 1}`,
+			path: []string{"b", "c"},
+			want: `{"a": 1}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			out, err := doc.Delete(tt.path)
+			if err != nil {
+				t.Fatalf("Delete returned error: %v", err)
+			}
+			if string(out) != tt.want {
+				t.Fatalf("unexpected output:\n%s\nwant:\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"unterminated string":  `{"a": "oops}`,
+		"unterminated comment": `{"a": 1 /* oops`,
+		"missing colon":        `{"a" 1}`,
+		"bad literal":          `{"a": nope}`,
+		"trailing content":     `{} {}`,
+		"unclosed object":      `{"a": 1`,
+	}
+	for name, src := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(src)); err == nil {
+				t.Fatalf("expected error for %q", src)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package jsoncdoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// parser is a cursor over the raw document bytes.
+type parser struct {
+	src  []byte
+	pos  int
+	line int
+	err  error
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("jsonc: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.src[p.pos:]), s)
+}
+
+// skipBlank skips whitespace and comments. An unterminated block comment is
+// recorded in p.err.
+func (p *parser) skipBlank() {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case p.hasPrefix("//"):
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case p.hasPrefix("/*"):
+			end := strings.Index(string(p.src[p.pos+2:]), "*/")
+			if end < 0 {
+				p.err = p.errorf("unterminated block comment")
+				p.pos = len(p.src)
+				return
+			}
+			comment := p.src[p.pos : p.pos+2+end+2]
+			p.line += strings.Count(string(comment), "\n")
+			p.pos += len(comment)
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) parseValue() (*node, error) {
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"':
+		start := p.pos
+		if _, err := p.parseString(); err != nil {
+			return nil, err
+		}
+		return &node{kind: nodeScalar, start: start, end: p.pos}, nil
+	case c == 0:
+		return nil, p.errorf("missing value")
+	default:
+		return p.parseLiteral()
+	}
+}
+
+func (p *parser) parseObject() (*node, error) {
+	n := &node{kind: nodeObject, start: p.pos}
+	p.pos++
+	for {
+		if err := p.blank(); err != nil {
+			return nil, err
+		}
+		if p.peek() == '}' {
+			p.pos++
+			n.end = p.pos
+			return n, nil
+		}
+		if p.peek() != '"' {
+			return nil, p.errorf("expected string key in object")
+		}
+		keyStart := p.pos
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.blank(); err != nil {
+			return nil, err
+		}
+		if p.peek() != ':' {
+			return nil, p.errorf("expected ':' after object key")
+		}
+		p.pos++
+		if err := p.blank(); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		m := member{key: key, keyStart: keyStart, value: value}
+		if err := p.blank(); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+			m.comma = true
+			m.end = p.pos
+			n.members = append(n.members, m)
+		case '}':
+			m.end = value.end
+			n.members = append(n.members, m)
+		default:
+			return nil, p.errorf("expected ',' or '}' in object")
+		}
+	}
+}
+
+func (p *parser) parseArray() (*node, error) {
+	n := &node{kind: nodeArray, start: p.pos}
+	p.pos++
+	for {
+		if err := p.blank(); err != nil {
+			return nil, err
+		}
+		if p.peek() == ']' {
+			p.pos++
+			n.end = p.pos
+			return n, nil
+		}
+		if _, err := p.parseValue(); err != nil {
+			return nil, err
+		}
+		if err := p.blank(); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *parser) blank() error {
+	p.skipBlank()
+	if p.err != nil {
+		return p.err
+	}
+	if p.eof() {
+		return p.errorf("unexpected end of document")
+	}
+	return nil
+}
+
+// parseString reads a double-quoted string and returns its decoded value.
+func (p *parser) parseString() (string, error) {
+	start := p.pos
+	p.pos++
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		switch p.peek() {
+		case '\\':
+			p.pos += 2
+		case '"':
+			p.pos++
+			var s string
+			if err := json.Unmarshal(p.src[start:p.pos], &s); err != nil {
+				return "", p.errorf("invalid string: %v", err)
+			}
+			return s, nil
+		default:
+			p.pos++
+		}
+	}
+}
+
+// parseLiteral reads numbers, true, false, and null.
+func (p *parser) parseLiteral() (*node, error) {
+	start := p.pos
+	for !p.eof() && isLiteralChar(p.peek()) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	if len(token) == 0 {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	var v interface{}
+	if err := json.Unmarshal(token, &v); err != nil {
+		return nil, p.errorf("invalid value %q", token)
+	}
+	return &node{kind: nodeScalar, start: start, end: p.pos}, nil
+}
+
+func isLiteralChar(c byte) bool {
+	return c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
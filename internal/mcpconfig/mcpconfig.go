@@ -9,22 +9,58 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Targeting restricts which agents receive a server. It is read from the
+// agents, excludeAgents, and tags fields of a server entry.
+type Targeting struct {
+	Agents        []string // Only these agents receive the server when set
+	ExcludeAgents []string // These agents never receive the server
+	Tags          []string // Matched against a target's includeTags/excludeTags
+}
+
+// IsZero reports whether the server is sent to every agent.
+func (t Targeting) IsZero() bool {
+	return len(t.Agents) == 0 && len(t.ExcludeAgents) == 0 && len(t.Tags) == 0
+}
+
+// Definitions are the servers from an MCP definitions file plus the
+// agent-align metadata that was stripped from them.
+type Definitions struct {
+	Servers   map[string]interface{}
+	Targeting map[string]Targeting // Keyed by server ID; only set when non-zero
+	Profiles  map[string]Profile   // Named layers applied with Apply
+}
+
+// targetingFields are server fields read by agent-align itself. They are
+// removed from the server before it is rendered into any agent file.
+var targetingFields = []string{"agents", "excludeAgents", "tags"}
+
 // Load reads the MCP server definitions from a YAML file.
 // It accepts either a top-level "servers" or "mcpServers" mapping.
+// Targeting metadata is removed and environment and provider references are
+// resolved in the returned servers.
 func Load(path string) (map[string]interface{}, error) {
+	return NewResolver().Load(path)
+}
+
+// LoadDefinitions reads the MCP server definitions from a YAML file and
+// separates each server's targeting metadata from the fields that are
+// rendered into agent files. String values are returned as written; use a
+// Resolver to expand environment and provider references.
+func LoadDefinitions(path string) (Definitions, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return Definitions{}, err
 	}
 
 	var raw struct {
 		Servers    map[string]interface{} `yaml:"servers"`
 		MCPServers map[string]interface{} `yaml:"mcpServers"`
+		Profiles   map[string]rawProfile  `yaml:"profiles"`
 	}
 	decoder := yaml.NewDecoder(bytes.NewReader(data))
 	decoder.KnownFields(true)
 	if err := decoder.Decode(&raw); err != nil {
-		return nil, fmt.Errorf("failed to parse MCP config at %q: %w", path, err)
+		return Definitions{}, fmt.Errorf("failed to parse MCP config at %q: %w", path, err)
 	}
 
 	servers := raw.Servers
@@ -32,61 +68,66 @@ func Load(path string) (map[string]interface{}, error) {
 		servers = raw.MCPServers
 	}
 	if len(servers) == 0 {
-		return nil, fmt.Errorf("no MCP servers found in %s", path)
+		return Definitions{}, fmt.Errorf("no MCP servers found in %s", path)
 	}
 
+	targeting := make(map[string]Targeting)
 	for name, server := range servers {
-		if _, ok := server.(map[string]interface{}); !ok {
-			return nil, fmt.Errorf("server %q must be a mapping", name)
+		serverMap, ok := server.(map[string]interface{})
+		if !ok {
+			return Definitions{}, fmt.Errorf("server %q must be a mapping", name)
+		}
+		t, err := extractTargeting(name, serverMap)
+		if err != nil {
+			return Definitions{}, err
+		}
+		if !t.IsZero() {
+			targeting[name] = t
 		}
 	}
 
-	// Expand environment variables in all string values
-	expandEnvInMap(servers)
-
-	return servers, nil
-}
-
-// expandEnvInMap recursively expands environment variables in all string
-// values within a map[string]interface{}. It supports ${VAR} and $VAR syntax.
-func expandEnvInMap(m map[string]interface{}) {
-	for key, value := range m {
-		m[key] = expandEnvInValue(value)
+	profiles, err := parseProfiles(raw.Profiles, servers)
+	if err != nil {
+		return Definitions{}, err
 	}
+
+	return Definitions{Servers: servers, Targeting: targeting, Profiles: profiles}, nil
 }
 
-// expandEnvInValue recursively expands environment variables in a value.
-// It handles strings, maps, slices, and nested structures.
-func expandEnvInValue(value interface{}) interface{} {
-	switch v := value.(type) {
-	case string:
-		return expandEnv(v)
-	case map[string]interface{}:
-		expandEnvInMap(v)
-		return v
-	case []interface{}:
-		for i, item := range v {
-			v[i] = expandEnvInValue(item)
+// extractTargeting removes the targeting fields from server and returns them.
+func extractTargeting(name string, server map[string]interface{}) (Targeting, error) {
+	lists := make(map[string][]string, len(targetingFields))
+	for _, field := range targetingFields {
+		value, ok := server[field]
+		if !ok {
+			continue
+		}
+		delete(server, field)
+		items, ok := value.([]interface{})
+		if !ok {
+			return Targeting{}, fmt.Errorf("server %q field %q must be a list of strings", name, field)
+		}
+		for _, item := range items {
+			text, ok := item.(string)
+			if !ok {
+				return Targeting{}, fmt.Errorf("server %q field %q must be a list of strings", name, field)
+			}
+			if trimmed := strings.ToLower(strings.TrimSpace(text)); trimmed != "" {
+				lists[field] = append(lists[field], trimmed)
+			}
 		}
-		return v
-	default:
-		return value
 	}
+	return Targeting{
+		Agents:        lists["agents"],
+		ExcludeAgents: lists["excludeAgents"],
+		Tags:          lists["tags"],
+	}, nil
 }
 
-// expandEnv expands environment variables in a string.
-// It supports both ${VAR} and $VAR syntax.
-func expandEnv(s string) string {
-	return os.Expand(s, func(key string) string {
-		// Support ${VAR:-default} syntax
-		if strings.Contains(key, ":-") {
-			parts := strings.SplitN(key, ":-", 2)
-			val := os.Getenv(parts[0])
-			if val == "" {
-				return parts[1]
-			}
-			return val
-		}
-		return os.Getenv(key)
-	})
+// ExpandString expands the environment references in s, ignoring provider
+// references. It is used for values that were already passed through
+// Resolver.ResolveProviders.
+func ExpandString(s string) string {
+	expanded, _, _ := (&Resolver{}).expand(s, "", true)
+	return expanded
 }
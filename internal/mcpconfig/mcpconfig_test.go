@@ -285,3 +285,62 @@ unknownTopField: invalid
 		t.Fatalf("error should mention unknown field 'unknownTopField', got: %v", err)
 	}
 }
+
+func TestLoadDefinitionsStripsTargeting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.yml")
+	content := `servers:
+  github:
+    url: https://api.example.com/mcp
+    agents: [Codex, claudecode]
+    tags: [work]
+  fs:
+    command: npx
+    excludeAgents: [gemini]
+  plain:
+    command: uvx
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	defs, err := LoadDefinitions(path)
+	if err != nil {
+		t.Fatalf("LoadDefinitions returned error: %v", err)
+	}
+	for name, server := range defs.Servers {
+		for _, field := range []string{"agents", "excludeAgents", "tags"} {
+			if _, ok := server.(map[string]interface{})[field]; ok {
+				t.Fatalf("expected %s to be stripped from %s", field, name)
+			}
+		}
+	}
+	github := defs.Targeting["github"]
+	if strings.Join(github.Agents, ",") != "codex,claudecode" || strings.Join(github.Tags, ",") != "work" {
+		t.Fatalf("unexpected github targeting: %+v", github)
+	}
+	if strings.Join(defs.Targeting["fs"].ExcludeAgents, ",") != "gemini" {
+		t.Fatalf("unexpected fs targeting: %+v", defs.Targeting["fs"])
+	}
+	if _, ok := defs.Targeting["plain"]; ok {
+		t.Fatalf("expected no targeting for plain server")
+	}
+
+	servers, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if _, ok := servers["github"].(map[string]interface{})["agents"]; ok {
+		t.Fatal("expected Load to strip targeting metadata")
+	}
+}
+
+func TestLoadDefinitionsRejectsInvalidTargeting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.yml")
+	if err := os.WriteFile(path, []byte("servers:\n  fs:\n    command: npx\n    tags: work\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	_, err := LoadDefinitions(path)
+	if err == nil || !strings.Contains(err.Error(), `server "fs" field "tags" must be a list of strings`) {
+		t.Fatalf("expected tags error, got %v", err)
+	}
+}
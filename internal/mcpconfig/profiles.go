@@ -0,0 +1,147 @@
+package mcpconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"agent-align/internal/mcpserver"
+)
+
+// Profile is a named layer on top of the base servers. Servers adds new
+// servers or overrides fields of existing ones, and Remove drops servers.
+type Profile struct {
+	Servers   map[string]interface{}
+	Targeting map[string]Targeting // Replaces the base targeting when set
+	Remove    []string
+}
+
+type rawProfile struct {
+	Servers map[string]interface{} `yaml:"servers"`
+	Remove  []string               `yaml:"remove"`
+}
+
+// parseProfiles validates the profiles section against the base servers.
+func parseProfiles(raw map[string]rawProfile, base map[string]interface{}) (map[string]Profile, error) {
+	profiles := make(map[string]Profile, len(raw))
+	for name, rp := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("profiles require a name")
+		}
+		profile := Profile{
+			Servers:   rp.Servers,
+			Targeting: make(map[string]Targeting),
+		}
+		for id, server := range rp.Servers {
+			serverMap, ok := server.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("profile %q server %q must be a mapping", name, id)
+			}
+			if hasTargeting(serverMap) {
+				t, err := extractTargeting(id, serverMap)
+				if err != nil {
+					return nil, fmt.Errorf("profile %q: %w", name, err)
+				}
+				profile.Targeting[id] = t
+			}
+		}
+		for _, id := range rp.Remove {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			if _, ok := base[id]; !ok {
+				return nil, fmt.Errorf("profile %q removes unknown server %q", name, id)
+			}
+			profile.Remove = append(profile.Remove, id)
+		}
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+func hasTargeting(server map[string]interface{}) bool {
+	for _, field := range targetingFields {
+		if _, ok := server[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileNames returns the defined profile names, sorted.
+func (d Definitions) ProfileNames() []string {
+	names := make([]string, 0, len(d.Profiles))
+	for name := range d.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply returns the definitions with the named profile layered on top of the
+// base servers. An empty name returns a copy of the base definitions. Fields
+// in a profile server override the base server's fields, and a field set to
+// null removes it. The receiver is never modified.
+func (d Definitions) Apply(profile string) (Definitions, error) {
+	out := Definitions{
+		Servers:   cloneMap(d.Servers),
+		Targeting: make(map[string]Targeting, len(d.Targeting)),
+		Profiles:  d.Profiles,
+	}
+	for id, t := range d.Targeting {
+		out.Targeting[id] = t
+	}
+
+	profile = strings.TrimSpace(profile)
+	if profile == "" {
+		return out, nil
+	}
+	layer, ok := d.Profiles[profile]
+	if !ok {
+		available := "none defined"
+		if names := d.ProfileNames(); len(names) > 0 {
+			available = "available: " + strings.Join(names, ", ")
+		}
+		return Definitions{}, fmt.Errorf("unknown profile %q (%s)", profile, available)
+	}
+
+	for _, id := range layer.Remove {
+		delete(out.Servers, id)
+		delete(out.Targeting, id)
+	}
+	for id, override := range layer.Servers {
+		overrideMap := override.(map[string]interface{})
+		server, ok := out.Servers[id].(map[string]interface{})
+		if !ok {
+			server = make(map[string]interface{}, len(overrideMap))
+		}
+		for field, value := range cloneMap(overrideMap) {
+			if value == nil {
+				delete(server, field)
+				continue
+			}
+			server[field] = value
+		}
+		out.Servers[id] = server
+	}
+	for id, t := range layer.Targeting {
+		if t.IsZero() {
+			delete(out.Targeting, id)
+			continue
+		}
+		out.Targeting[id] = t
+	}
+
+	if len(out.Servers) == 0 {
+		return Definitions{}, fmt.Errorf("profile %q leaves no MCP servers", profile)
+	}
+	return out, nil
+}
+
+// cloneMap deep-copies decoded YAML values so profiles never share nested
+// maps or slices with the base servers. A nil map becomes an empty one.
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	return mcpserver.CloneValue(m).(map[string]interface{})
+}
@@ -0,0 +1,102 @@
+package mcpconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProfilesFixture(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mcp.yml")
+	content := `servers:
+  github:
+    url: https://api.github.com/mcp
+    headers:
+      Authorization: Bearer personal
+  notes:
+    command: notes-mcp
+    tags: [personal]
+profiles:
+  work:
+    servers:
+      github:
+        headers:
+          Authorization: Bearer work
+        tools: ~
+      jira:
+        command: jira-mcp
+        agents: [codex]
+    remove: [notes]
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	return path
+}
+
+func TestApplyProfileLayersServers(t *testing.T) {
+	defs, err := LoadDefinitions(writeProfilesFixture(t))
+	if err != nil {
+		t.Fatalf("LoadDefinitions returned error: %v", err)
+	}
+
+	work, err := defs.Apply("work")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if _, ok := work.Servers["notes"]; ok {
+		t.Fatal("expected notes to be removed by the work profile")
+	}
+	if _, ok := work.Targeting["notes"]; ok {
+		t.Fatal("expected targeting of removed server to be dropped")
+	}
+	github := work.Servers["github"].(map[string]interface{})
+	if github["url"] != "https://api.github.com/mcp" {
+		t.Fatalf("expected base fields to be kept, got %v", github)
+	}
+	if github["headers"].(map[string]interface{})["Authorization"] != "Bearer work" {
+		t.Fatalf("expected headers override, got %v", github)
+	}
+	if _, ok := github["tools"]; ok {
+		t.Fatalf("null fields should not be written, got %v", github)
+	}
+	if _, ok := work.Servers["jira"].(map[string]interface{})["agents"]; ok {
+		t.Fatal("expected targeting metadata to be stripped from profile servers")
+	}
+	if strings.Join(work.Targeting["jira"].Agents, ",") != "codex" {
+		t.Fatalf("expected profile targeting for jira, got %+v", work.Targeting["jira"])
+	}
+
+	// The base definitions are unchanged.
+	base, err := defs.Apply("")
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if len(base.Servers) != 2 || base.Servers["github"].(map[string]interface{})["headers"].(map[string]interface{})["Authorization"] != "Bearer personal" {
+		t.Fatalf("expected base servers to be untouched, got %v", base.Servers)
+	}
+}
+
+func TestApplyUnknownProfile(t *testing.T) {
+	defs, err := LoadDefinitions(writeProfilesFixture(t))
+	if err != nil {
+		t.Fatalf("LoadDefinitions returned error: %v", err)
+	}
+	_, err = defs.Apply("client")
+	if err == nil || !strings.Contains(err.Error(), `unknown profile "client" (available: work)`) {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+}
+
+func TestLoadDefinitionsRejectsUnknownProfileRemoval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.yml")
+	content := "servers:\n  fs:\n    command: npx\nprofiles:\n  work:\n    remove: [missing]\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := LoadDefinitions(path); err == nil || !strings.Contains(err.Error(), `removes unknown server "missing"`) {
+		t.Fatalf("expected removal error, got %v", err)
+	}
+}
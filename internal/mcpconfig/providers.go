@@ -0,0 +1,112 @@
+package mcpconfig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Provider resolves the argument of a ${scheme:argument} reference to a
+// secret value. ctx carries the per-lookup timeout.
+type Provider interface {
+	Resolve(ctx context.Context, argument string) (string, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func(ctx context.Context, argument string) (string, error)
+
+// Resolve calls f(ctx, argument).
+func (f ProviderFunc) Resolve(ctx context.Context, argument string) (string, error) {
+	return f(ctx, argument)
+}
+
+// DefaultProviders returns the built-in providers keyed by scheme:
+//
+//	${file:~/.secrets/gh}           contents of the file
+//	${cmd:pass show github/token}   standard output of the shell command
+//	${keyring:service/account}      entry from the system keyring
+//
+// Trailing newlines are removed from every value.
+func DefaultProviders() map[string]Provider {
+	return map[string]Provider{
+		"file":    ProviderFunc(resolveFile),
+		"cmd":     ProviderFunc(resolveCommand),
+		"keyring": ProviderFunc(resolveKeyring),
+	}
+}
+
+func resolveFile(_ context.Context, path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve home directory: %w", err)
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func resolveCommand(ctx context.Context, command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", errors.New("empty command")
+	}
+	if runtime.GOOS == "windows" {
+		return runProviderCommand(ctx, "cmd", "/C", command)
+	}
+	return runProviderCommand(ctx, "sh", "-c", command)
+}
+
+// resolveKeyring looks up service/account with the platform keyring tool:
+// security on macOS and secret-tool (libsecret) elsewhere.
+func resolveKeyring(ctx context.Context, argument string) (string, error) {
+	slash := strings.LastIndex(argument, "/")
+	if slash <= 0 || slash == len(argument)-1 {
+		return "", fmt.Errorf("keyring reference %q must be service/account", argument)
+	}
+	service, account := argument[:slash], argument[slash+1:]
+	switch runtime.GOOS {
+	case "darwin":
+		return runProviderCommand(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "windows":
+		return "", errors.New("keyring references are not supported on windows")
+	default:
+		return runProviderCommand(ctx, "secret-tool", "lookup", "service", service, "username", account)
+	}
+}
+
+// providerWaitDelay is how long a canceled command may keep its output pipes
+// open before they are closed and the lookup gives up.
+const providerWaitDelay = 500 * time.Millisecond
+
+// runProviderCommand runs name with args and returns its standard output.
+// When ctx is done the command and every process it started are killed.
+func runProviderCommand(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = providerWaitDelay
+	killProcessGroup(cmd)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s failed: %w: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s failed: %w", name, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package mcpconfig
+
+import "os/exec"
+
+// killProcessGroup leaves cmd alone on platforms without process groups;
+// WaitDelay still bounds how long a canceled command is waited for.
+func killProcessGroup(cmd *exec.Cmd) {}
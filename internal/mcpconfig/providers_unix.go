@@ -0,0 +1,18 @@
+//go:build unix
+
+package mcpconfig
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup makes cmd the leader of a new process group and kills the
+// whole group when the command is canceled, so children such as the other
+// side of a shell pipeline do not outlive the timeout.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,427 @@
+package mcpconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultProviderTimeout bounds a single provider lookup.
+const DefaultProviderTimeout = 10 * time.Second
+
+// FieldError reports a server value that could not be resolved.
+type FieldError struct {
+	Server string
+	Field  string // dotted path such as headers.Authorization or args[1]
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("server %q field %q: %v", e.Server, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// UnresolvedReference is an environment reference that has no value.
+type UnresolvedReference struct {
+	Server    string
+	Field     string
+	Reference string // as written, for example ${GITHUB_TOKEN}
+	Message   string // from ${VAR:?message}
+}
+
+// UnresolvedError lists every unresolved environment reference in a set of
+// servers.
+type UnresolvedError struct {
+	References []UnresolvedReference
+}
+
+func (e *UnresolvedError) Error() string {
+	lines := []string{fmt.Sprintf("%d unresolved environment reference(s):", len(e.References))}
+	for _, ref := range e.References {
+		line := fmt.Sprintf("  - server %q field %q: %s", ref.Server, ref.Field, ref.Reference)
+		if ref.Message != "" {
+			line += ": " + ref.Message
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Resolver expands environment references and ${scheme:argument} provider
+// references in server values. Provider results are cached for the life of
+// the Resolver, so a run should share one Resolver.
+type Resolver struct {
+	Providers map[string]Provider
+	Timeout   time.Duration // per lookup; DefaultProviderTimeout when zero
+	// Strict reports references to unset variables as errors instead of
+	// expanding them to an empty string.
+	Strict bool
+
+	cache   map[string]string
+	secrets map[string]struct{}
+}
+
+// NewResolver returns a Resolver using DefaultProviders.
+func NewResolver() *Resolver {
+	return &Resolver{Providers: DefaultProviders(), Timeout: DefaultProviderTimeout}
+}
+
+// Load reads the MCP server definitions from path like LoadDefinitions and
+// returns the servers with every reference expanded.
+func (r *Resolver) Load(path string) (map[string]interface{}, error) {
+	defs, err := LoadDefinitions(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.ExpandServers(defs.Servers)
+}
+
+// ExpandServers returns a copy of servers with environment and provider
+// references resolved in every string value. servers itself is not modified.
+// References that cannot be resolved, ${VAR:?message} on an unset variable or
+// any unset variable when Strict is set, are collected from all servers and
+// returned together as an *UnresolvedError.
+func (r *Resolver) ExpandServers(servers map[string]interface{}) (map[string]interface{}, error) {
+	return r.resolveServers(servers, true)
+}
+
+// ResolveProviders returns a copy of servers with only provider references
+// resolved. Environment references are kept as written for agents that
+// expand them on their own. Dollar signs in provider values are escaped as
+// $$, so expanding the result later never reads them as references.
+func (r *Resolver) ResolveProviders(servers map[string]interface{}) (map[string]interface{}, error) {
+	return r.resolveServers(servers, false)
+}
+
+func (r *Resolver) resolveServers(servers map[string]interface{}, env bool) (map[string]interface{}, error) {
+	resolved := cloneMap(servers)
+	names := make([]string, 0, len(resolved))
+	for name := range resolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var unresolved []UnresolvedReference
+	for _, name := range names {
+		var missing []UnresolvedReference
+		value, err := r.resolveValue(resolved[name], "", env, &missing)
+		if err != nil {
+			var fieldErr *FieldError
+			if errors.As(err, &fieldErr) {
+				fieldErr.Server = name
+			}
+			return nil, err
+		}
+		for _, ref := range missing {
+			ref.Server = name
+			unresolved = append(unresolved, ref)
+		}
+		resolved[name] = value
+	}
+	if len(unresolved) > 0 {
+		return nil, &UnresolvedError{References: unresolved}
+	}
+	return resolved, nil
+}
+
+// resolveValue expands the strings in value in place. path is the field path
+// of value within its server; unresolved references are added to missing.
+func (r *Resolver) resolveValue(value interface{}, path string, env bool, missing *[]UnresolvedReference) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		expanded, refs, err := r.expand(v, path, env)
+		if err != nil {
+			return nil, &FieldError{Field: path, Err: err}
+		}
+		for _, ref := range refs {
+			ref.Field = path
+			*missing = append(*missing, ref)
+		}
+		return expanded, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			item, err := r.resolveValue(v[key], field, env, missing)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = item
+		}
+		return v, nil
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := r.resolveValue(item, path+"["+strconv.Itoa(i)+"]", env, missing)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+// expand replaces the references in s, the value of field, and returns the
+// environment references that could not be resolved. Provider references are
+// always resolved; environment references and $$ escapes only when env is
+// set. Environment values expanded into a sensitive field are recorded as
+// secrets.
+func (r *Resolver) expand(s, field string, env bool) (string, []UnresolvedReference, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil, nil
+	}
+	var sb strings.Builder
+	var missing []UnresolvedReference
+	for i := 0; i < len(s); {
+		if s[i] != '$' || i+1 >= len(s) {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		if s[i+1] == '$' {
+			if env {
+				sb.WriteByte('$')
+			} else {
+				sb.WriteString("$$")
+			}
+			i += 2
+			continue
+		}
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				sb.WriteString(s[i:])
+				break
+			}
+			body := s[i+2 : i+end]
+			text := s[i : i+end+1]
+			i += end + 1
+			if scheme, argument, ok := r.providerReference(body); ok {
+				value, err := r.lookup(scheme, argument)
+				if err != nil {
+					return "", nil, fmt.Errorf("failed to resolve %s: %w", text, err)
+				}
+				if !env {
+					value = strings.ReplaceAll(value, "$", "$$")
+				}
+				sb.WriteString(value)
+				continue
+			}
+			if !env {
+				sb.WriteString(text)
+				continue
+			}
+			value, message, ok := r.lookupEnv(body)
+			if !ok {
+				missing = append(missing, UnresolvedReference{Reference: text, Message: message})
+			}
+			if sensitiveField(field, sb.String()) {
+				r.recordSecret(value)
+			}
+			sb.WriteString(value)
+			continue
+		}
+		n := 1
+		for i+n < len(s) && isNameChar(s[i+n], n == 1) {
+			n++
+		}
+		if n == 1 {
+			sb.WriteByte('$')
+			i++
+			continue
+		}
+		if env {
+			value, _, ok := r.lookupEnv(s[i+1 : i+n])
+			if !ok {
+				missing = append(missing, UnresolvedReference{Reference: s[i : i+n]})
+			}
+			if sensitiveField(field, sb.String()) {
+				r.recordSecret(value)
+			}
+			sb.WriteString(value)
+		} else {
+			sb.WriteString(s[i : i+n])
+		}
+		i += n
+	}
+	return sb.String(), missing, nil
+}
+
+// providerReference splits body into a registered provider scheme and its
+// argument.
+func (r *Resolver) providerReference(body string) (string, string, bool) {
+	colon := strings.IndexByte(body, ':')
+	if colon <= 0 {
+		return "", "", false
+	}
+	scheme := body[:colon]
+	if _, ok := r.Providers[scheme]; !ok {
+		return "", "", false
+	}
+	return scheme, body[colon+1:], true
+}
+
+// lookup resolves a provider reference, reusing earlier results.
+func (r *Resolver) lookup(scheme, argument string) (string, error) {
+	key := scheme + ":" + argument
+	if value, ok := r.cache[key]; ok {
+		return value, nil
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProviderTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	value, err := r.Providers[scheme].Resolve(ctx, argument)
+	if errors.Is(err, context.DeadlineExceeded) || (err != nil && ctx.Err() != nil) {
+		return "", fmt.Errorf("%s provider timed out after %s", scheme, timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s provider: %w", scheme, err)
+	}
+	if r.cache == nil {
+		r.cache = make(map[string]string)
+	}
+	r.cache[key] = value
+	r.recordSecret(value)
+	return value, nil
+}
+
+// minSecretLength keeps short values such as "1" or "on" from being treated
+// as secrets, which would mask unrelated text.
+const minSecretLength = 4
+
+// recordSecret remembers value so output can be redacted.
+func (r *Resolver) recordSecret(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+	if r.secrets == nil {
+		r.secrets = make(map[string]struct{})
+	}
+	r.secrets[value] = struct{}{}
+}
+
+// SecretValues returns the values read from providers, from sensitive
+// environment variables (see IsSensitiveName), or from any variable expanded
+// into env, headers, or a url query string, longest first, so callers can
+// redact them from output.
+func (r *Resolver) SecretValues() []string {
+	values := make([]string, 0, len(r.secrets))
+	for value := range r.secrets {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	return values
+}
+
+// sensitiveField reports whether a value expanded into field after prefix is
+// a secret: anything in env or headers, the query string of a url, and
+// fields with a sensitive name.
+func sensitiveField(field, prefix string) bool {
+	top := field
+	if i := strings.IndexAny(field, ".["); i >= 0 {
+		top = field[:i]
+	}
+	switch top {
+	case "env", "headers":
+		return true
+	case "url":
+		return strings.Contains(prefix, "?")
+	}
+	if i := strings.LastIndexByte(field, '.'); i >= 0 {
+		field = field[i+1:]
+	}
+	return IsSensitiveName(field)
+}
+
+// IsSensitiveName reports whether a field or environment variable name
+// usually holds a secret: Authorization, *_TOKEN, *_KEY, *PASSWORD*, or
+// *SECRET*. The match is case-insensitive.
+func IsSensitiveName(name string) bool {
+	upper := strings.ToUpper(strings.TrimSpace(name))
+	return upper == "AUTHORIZATION" ||
+		strings.HasSuffix(upper, "_TOKEN") ||
+		strings.HasSuffix(upper, "_KEY") ||
+		strings.Contains(upper, "PASSWORD") ||
+		strings.Contains(upper, "SECRET")
+}
+
+// lookupEnv evaluates the body of an environment reference following POSIX
+// parameter expansion: NAME, NAME:-word, NAME:+word, and NAME:?message, each
+// also without the colon to test only for unset variables. ok is false when
+// the reference must be reported: ${NAME:?message} on an unset variable, or
+// any unset variable without a fallback in strict mode.
+func (r *Resolver) lookupEnv(body string) (value, message string, ok bool) {
+	n := 0
+	for n < len(body) && isNameChar(body[n], n == 0) {
+		n++
+	}
+	name, rest := body[:n], body[n:]
+	colon := strings.HasPrefix(rest, ":")
+	if colon {
+		rest = rest[1:]
+	}
+	if n == 0 || (rest == "" && colon) || (rest != "" && strings.IndexByte("-+?", rest[0]) < 0) {
+		// Not a supported form; look the whole body up as before.
+		name, rest, colon = body, "", false
+	}
+
+	value, set := os.LookupEnv(name)
+	if set && IsSensitiveName(name) {
+		r.recordSecret(value)
+	}
+	unset := !set || (colon && value == "")
+	if rest == "" {
+		return value, "", set || !r.Strict
+	}
+	word := rest[1:]
+	switch rest[0] {
+	case '-':
+		if unset {
+			return word, "", true
+		}
+	case '+':
+		if unset {
+			return "", "", true
+		}
+		return word, "", true
+	case '?':
+		if unset {
+			if word == "" {
+				word = "not set"
+			}
+			return "", word, false
+		}
+	}
+	return value, "", true
+}
+
+func isNameChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
@@ -0,0 +1,277 @@
+package mcpconfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolverExpandsFileAndCommandReferences(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cmd provider test uses sh")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("TEST_RESOLVE_USER", "octo")
+	if err := os.MkdirAll(filepath.Join(home, ".secrets"), 0o700); err != nil {
+		t.Fatalf("failed to create secrets dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".secrets", "gh"), []byte("file-token\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{
+			"headers": map[string]interface{}{"Authorization": "Bearer ${file:~/.secrets/gh}"},
+			"env":     map[string]interface{}{"USER": "${TEST_RESOLVE_USER}", "TOKEN": "${cmd:printf 'cmd-token'}"},
+		},
+	}
+	r := NewResolver()
+	expanded, err := r.ExpandServers(servers)
+	if err != nil {
+		t.Fatalf("ExpandServers returned error: %v", err)
+	}
+	github := expanded["github"].(map[string]interface{})
+	if got := github["headers"].(map[string]interface{})["Authorization"]; got != "Bearer file-token" {
+		t.Fatalf("unexpected Authorization: %v", got)
+	}
+	env := github["env"].(map[string]interface{})
+	if env["TOKEN"] != "cmd-token" || env["USER"] != "octo" {
+		t.Fatalf("unexpected env: %v", env)
+	}
+
+	raw, err := r.ResolveProviders(servers)
+	if err != nil {
+		t.Fatalf("ResolveProviders returned error: %v", err)
+	}
+	rawEnv := raw["github"].(map[string]interface{})["env"].(map[string]interface{})
+	if rawEnv["USER"] != "${TEST_RESOLVE_USER}" || rawEnv["TOKEN"] != "cmd-token" {
+		t.Fatalf("expected only provider references resolved, got %v", rawEnv)
+	}
+	if servers["github"].(map[string]interface{})["env"].(map[string]interface{})["TOKEN"] != "${cmd:printf 'cmd-token'}" {
+		t.Fatal("input servers should not be modified")
+	}
+}
+
+func TestResolverCachesProviderLookups(t *testing.T) {
+	calls := 0
+	r := &Resolver{Providers: map[string]Provider{
+		"test": ProviderFunc(func(ctx context.Context, argument string) (string, error) {
+			calls++
+			return "value-" + argument, nil
+		}),
+	}}
+	servers := map[string]interface{}{
+		"a": map[string]interface{}{"args": []interface{}{"${test:x}", "${test:x}"}},
+		"b": map[string]interface{}{"command": "${test:x}"},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.ExpandServers(servers); err != nil {
+			t.Fatalf("ExpandServers returned error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected one provider call, got %d", calls)
+	}
+}
+
+func TestResolverErrorsNameServerAndField(t *testing.T) {
+	r := &Resolver{Providers: map[string]Provider{
+		"test": ProviderFunc(func(ctx context.Context, argument string) (string, error) {
+			return "", errors.New("not found")
+		}),
+	}}
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{"args": []interface{}{"--token", "${test:gh}"}},
+	}
+	_, err := r.ExpandServers(servers)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("expected FieldError, got %v", err)
+	}
+	if fieldErr.Server != "github" || fieldErr.Field != "args[1]" {
+		t.Fatalf("unexpected server/field: %q %q", fieldErr.Server, fieldErr.Field)
+	}
+	if !strings.Contains(err.Error(), "${test:gh}") || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("unexpected error text: %v", err)
+	}
+}
+
+func TestResolverTimesOutSlowProviders(t *testing.T) {
+	r := &Resolver{
+		Timeout: 10 * time.Millisecond,
+		Providers: map[string]Provider{
+			"slow": ProviderFunc(func(ctx context.Context, argument string) (string, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			}),
+		},
+	}
+	_, err := r.ExpandServers(map[string]interface{}{"s": map[string]interface{}{"url": "${slow:x}"}})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+func TestResolverTimesOutCommandPipelines(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell pipeline")
+	}
+	r := NewResolver()
+	r.Timeout = time.Second
+	start := time.Now()
+	_, err := r.ExpandServers(map[string]interface{}{
+		"s": map[string]interface{}{"env": map[string]interface{}{"TOKEN": "${cmd:sleep 8 | cat}"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("expected the pipeline to be killed at the timeout, took %s", elapsed)
+	}
+}
+
+func TestResolveProvidersKeepsDollarSignsInProviderValues(t *testing.T) {
+	t.Setenv("TEST_DOLLAR_USER", "octo")
+	r := &Resolver{Providers: map[string]Provider{
+		"test": ProviderFunc(func(ctx context.Context, argument string) (string, error) {
+			return "pa$$word${x}$HOME", nil
+		}),
+	}}
+	raw, err := r.ResolveProviders(map[string]interface{}{
+		"s": map[string]interface{}{"env": map[string]interface{}{"TOKEN": "${test:x}:$TEST_DOLLAR_USER"}},
+	})
+	if err != nil {
+		t.Fatalf("ResolveProviders returned error: %v", err)
+	}
+	token := raw["s"].(map[string]interface{})["env"].(map[string]interface{})["TOKEN"].(string)
+	if got := ExpandString(token); got != "pa$$word${x}$HOME:octo" {
+		t.Fatalf("expected the provider value to survive expansion, got %q", got)
+	}
+}
+
+func TestResolverFileProviderMissingFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err := NewResolver().ExpandServers(map[string]interface{}{
+		"s": map[string]interface{}{"env": map[string]interface{}{"TOKEN": "${file:" + missing + "}"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), `server "s" field "env.TOKEN"`) {
+		t.Fatalf("expected error naming server and field, got %v", err)
+	}
+}
+
+func TestResolverPOSIXExpansionForms(t *testing.T) {
+	t.Setenv("TEST_POSIX_SET", "value")
+	t.Setenv("TEST_POSIX_EMPTY", "")
+	tests := map[string]string{
+		"${TEST_POSIX_SET:+alt}":      "alt",
+		"${TEST_POSIX_UNSET:+alt}":    "",
+		"${TEST_POSIX_EMPTY:+alt}":    "",
+		"${TEST_POSIX_EMPTY+alt}":     "alt",
+		"${TEST_POSIX_EMPTY:-dflt}":   "dflt",
+		"${TEST_POSIX_EMPTY-dflt}":    "",
+		"${TEST_POSIX_SET:?required}": "value",
+		"cost: $$5 and $$TEST_POSIX":  "cost: $5 and $TEST_POSIX",
+		"$TEST_POSIX_SET-suffix":      "value-suffix",
+	}
+	for input, want := range tests {
+		got, err := (&Resolver{}).ExpandServers(map[string]interface{}{"s": map[string]interface{}{"v": input}})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", input, err)
+		}
+		if value := got["s"].(map[string]interface{})["v"]; value != want {
+			t.Errorf("%s: expected %q, got %q", input, want, value)
+		}
+	}
+}
+
+func TestResolverStrictCollectsEveryUnresolvedReference(t *testing.T) {
+	t.Setenv("TEST_STRICT_SET", "value")
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{
+			"headers": map[string]interface{}{"Authorization": "Bearer ${TEST_STRICT_MISSING}"},
+			"args":    []interface{}{"--user=$TEST_STRICT_SET", "--host=${TEST_STRICT_HOST:-localhost}"},
+		},
+		"db": map[string]interface{}{
+			"env": map[string]interface{}{"PASSWORD": "$TEST_STRICT_PASSWORD"},
+		},
+	}
+
+	if _, err := (&Resolver{}).ExpandServers(servers); err != nil {
+		t.Fatalf("expected unset variables to be allowed without strict mode, got %v", err)
+	}
+
+	_, err := (&Resolver{Strict: true}).ExpandServers(servers)
+	var unresolved *UnresolvedError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("expected UnresolvedError, got %v", err)
+	}
+	want := []UnresolvedReference{
+		{Server: "db", Field: "env.PASSWORD", Reference: "$TEST_STRICT_PASSWORD"},
+		{Server: "github", Field: "headers.Authorization", Reference: "${TEST_STRICT_MISSING}"},
+	}
+	if !reflect.DeepEqual(unresolved.References, want) {
+		t.Fatalf("expected %v, got %v", want, unresolved.References)
+	}
+}
+
+func TestResolverRequiredReferenceFailsWithMessage(t *testing.T) {
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{"url": "${TEST_REQUIRED_URL:?set TEST_REQUIRED_URL to the MCP endpoint}"},
+	}
+	_, err := (&Resolver{}).ExpandServers(servers)
+	if err == nil || !strings.Contains(err.Error(), `server "github" field "url": ${TEST_REQUIRED_URL:?set TEST_REQUIRED_URL to the MCP endpoint}: set TEST_REQUIRED_URL to the MCP endpoint`) {
+		t.Fatalf("expected error with message, got %v", err)
+	}
+}
+
+func TestResolverRecordsSecretValues(t *testing.T) {
+	t.Setenv("TEST_SECRET_API_TOKEN", "token-value")
+	t.Setenv("TEST_RECORDED_HOST", "example.com")
+	r := &Resolver{Providers: map[string]Provider{
+		"test": ProviderFunc(func(ctx context.Context, argument string) (string, error) {
+			return "provider-value", nil
+		}),
+	}}
+	servers := map[string]interface{}{
+		"s": map[string]interface{}{"args": []interface{}{"${TEST_SECRET_API_TOKEN}", "$TEST_RECORDED_HOST", "${test:x}"}},
+	}
+	if _, err := r.ExpandServers(servers); err != nil {
+		t.Fatalf("ExpandServers returned error: %v", err)
+	}
+	want := []string{"provider-value", "token-value"}
+	if got := r.SecretValues(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestResolverRecordsValuesExpandedIntoSensitiveFields(t *testing.T) {
+	t.Setenv("API", "query-secret")
+	t.Setenv("GH_PAT", "pat-secret")
+	t.Setenv("SITE", "host.example")
+	t.Setenv("ACCEPT", "text/plain")
+	r := &Resolver{}
+	servers := map[string]interface{}{
+		"remote": map[string]interface{}{
+			"url":     "https://${SITE}/mcp?token=${API}",
+			"headers": map[string]interface{}{"Accept": "$ACCEPT"},
+		},
+		"gh": map[string]interface{}{
+			"command": "gh-mcp",
+			"env":     map[string]interface{}{"GH": "${GH_PAT}"},
+		},
+	}
+	if _, err := r.ExpandServers(servers); err != nil {
+		t.Fatalf("ExpandServers returned error: %v", err)
+	}
+	want := []string{"query-secret", "pat-secret", "text/plain"}
+	if got := r.SecretValues(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,34 @@
+package mcpserver
+
+// CloneValue deep-copies a decoded YAML, JSON, or TOML value. Maps and lists
+// are copied and scalars keep their type.
+func CloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = CloneValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = CloneValue(item)
+		}
+		return out
+	case map[string]string:
+		return cloneStringMap(v)
+	case []string:
+		return cloneStrings(v)
+	}
+	return value
+}
+
+// CloneServers deep-copies a map of servers so an agent's transforms cannot
+// change the servers of another agent.
+func CloneServers(servers map[string]interface{}) map[string]interface{} {
+	if servers == nil {
+		return nil
+	}
+	return CloneValue(servers).(map[string]interface{})
+}
@@ -0,0 +1,462 @@
+// Package mcpserver is the typed model of one MCP server in the neutral
+// format of agent-align-mcp.yml. The built-in agent transformers parse
+// servers into it, adjust the typed fields, and encode the result in their
+// agent's layout; everything else passes servers around as plain maps.
+package mcpserver
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transport is the protocol an agent uses to talk to a server.
+type Transport string
+
+// Transports known to the neutral format.
+const (
+	TransportStdio          Transport = "stdio"
+	TransportStreamableHTTP Transport = "streamable-http"
+	TransportSSE            Transport = "sse"
+)
+
+// ParseTransport returns the transport a neutral type value names, or an
+// empty Transport when it names none. "http" is an alias for streamable-http.
+func ParseTransport(typ string) Transport {
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "stdio":
+		return TransportStdio
+	case "streamable-http", "http":
+		return TransportStreamableHTTP
+	case "sse":
+		return TransportSSE
+	}
+	return ""
+}
+
+// Neutral field names.
+const (
+	FieldType           = "type"
+	FieldCommand        = "command"
+	FieldArgs           = "args"
+	FieldEnv            = "env"
+	FieldCwd            = "cwd"
+	FieldURL            = "url"
+	FieldHeaders        = "headers"
+	FieldStartupTimeout = "startupTimeoutSec"
+	FieldToolTimeout    = "toolTimeoutSec"
+	FieldAlwaysAllow    = "alwaysAllow"
+	FieldAutoApprove    = "autoApprove"
+	FieldTools          = "tools"
+	FieldDisabled       = "disabled"
+)
+
+// Timeouts bound how long an agent waits for a server. Zero means the
+// agent's default.
+type Timeouts struct {
+	Startup time.Duration // until the server is ready
+	Tool    time.Duration // for one tool call
+}
+
+// ToolPolicy is which of a server's tools an agent offers and which run
+// without asking.
+type ToolPolicy struct {
+	AlwaysAllow []string // run without asking
+	AutoApprove []string // run without asking (Cline-style name)
+	Enabled     []string // the tools to offer; nil means every tool
+}
+
+// Server is one MCP server. Lists and maps are nil when the field is unset
+// and empty when it is set to an empty value, so encoding a parsed server
+// gives back the same fields.
+type Server struct {
+	Name string
+	// Type is the transport as written, such as "http". Transport is the
+	// variant it names, or empty for types the neutral format does not know.
+	Type      string
+	Transport Transport
+	Command   string
+	Args      []string
+	Env       map[string]string
+	Cwd       string
+	URL       string
+	Headers   map[string]string
+	Timeouts  Timeouts
+	Tools     ToolPolicy
+	Disabled  *bool
+	// Extra holds every other field unchanged, along with typed fields whose
+	// value has the wrong shape; Validate reports those.
+	Extra map[string]interface{}
+
+	// scalars keeps numbers and booleans read into string fields, so Map
+	// writes PORT: 8080 back as 8080 rather than "8080".
+	scalars map[scalarKey]interface{}
+}
+
+// scalarKey is a field and the list index or map key of one of its values.
+type scalarKey struct {
+	field, key string
+}
+
+// Parse reads a server from its neutral map form. It never fails: a value
+// that does not fit its typed field is kept in Extra. Numbers and booleans
+// in args, env, headers, and tool lists are read as strings, and Map writes
+// them back with their original type unless they were changed.
+func Parse(name string, raw map[string]interface{}) Server {
+	s := Server{Name: name, Extra: make(map[string]interface{})}
+	for key, value := range raw {
+		if !s.set(key, value) {
+			s.Extra[key] = CloneValue(value)
+		}
+	}
+	return s
+}
+
+func (s *Server) set(key string, value interface{}) bool {
+	var ok bool
+	switch key {
+	case FieldType:
+		if s.Type, ok = nonEmptyString(value); ok {
+			s.Transport = ParseTransport(s.Type)
+		}
+	case FieldCommand:
+		s.Command, ok = nonEmptyString(value)
+	case FieldArgs:
+		s.Args, ok = s.stringList(key, value)
+	case FieldEnv:
+		s.Env, ok = s.stringMap(key, value)
+	case FieldCwd:
+		s.Cwd, ok = nonEmptyString(value)
+	case FieldURL:
+		s.URL, ok = nonEmptyString(value)
+	case FieldHeaders:
+		s.Headers, ok = s.stringMap(key, value)
+	case FieldStartupTimeout:
+		s.Timeouts.Startup, ok = seconds(value)
+	case FieldToolTimeout:
+		s.Timeouts.Tool, ok = seconds(value)
+	case FieldAlwaysAllow:
+		s.Tools.AlwaysAllow, ok = s.stringList(key, value)
+	case FieldAutoApprove:
+		s.Tools.AutoApprove, ok = s.stringList(key, value)
+	case FieldTools:
+		s.Tools.Enabled, ok = s.stringList(key, value)
+	case FieldDisabled:
+		var disabled bool
+		if disabled, ok = value.(bool); ok {
+			s.Disabled = &disabled
+		}
+	}
+	return ok
+}
+
+// typedFields lists the fields Server has a typed member for.
+var typedFields = []string{
+	FieldType, FieldCommand, FieldArgs, FieldEnv, FieldCwd, FieldURL, FieldHeaders,
+	FieldStartupTimeout, FieldToolTimeout, FieldAlwaysAllow, FieldAutoApprove, FieldTools, FieldDisabled,
+}
+
+// Map encodes the server in its neutral map form.
+func (s Server) Map() map[string]interface{} {
+	out := make(map[string]interface{}, len(s.Extra)+len(typedFields))
+	for key, value := range s.Extra {
+		out[key] = CloneValue(value)
+	}
+	for _, field := range typedFields {
+		if value, ok := s.typed(field); ok {
+			out[field] = value
+		}
+	}
+	return out
+}
+
+// typed returns the neutral form of a typed field, or false when it is unset.
+func (s Server) typed(field string) (interface{}, bool) {
+	switch field {
+	case FieldType:
+		switch {
+		case s.Type != "":
+			return s.Type, true
+		case s.Transport != "":
+			return string(s.Transport), true
+		}
+	case FieldCommand:
+		return s.Command, s.Command != ""
+	case FieldArgs:
+		return s.list(field, s.Args)
+	case FieldEnv:
+		return s.mapping(field, s.Env)
+	case FieldCwd:
+		return s.Cwd, s.Cwd != ""
+	case FieldURL:
+		return s.URL, s.URL != ""
+	case FieldHeaders:
+		return s.mapping(field, s.Headers)
+	case FieldStartupTimeout:
+		return Seconds(s.Timeouts.Startup), s.Timeouts.Startup != 0
+	case FieldToolTimeout:
+		return Seconds(s.Timeouts.Tool), s.Timeouts.Tool != 0
+	case FieldAlwaysAllow:
+		return s.list(field, s.Tools.AlwaysAllow)
+	case FieldAutoApprove:
+		return s.list(field, s.Tools.AutoApprove)
+	case FieldTools:
+		return s.list(field, s.Tools.Enabled)
+	case FieldDisabled:
+		if s.Disabled != nil {
+			return *s.Disabled, true
+		}
+	}
+	return nil, false
+}
+
+// Clone returns a copy of s that shares no lists or maps with it.
+func (s Server) Clone() Server {
+	c := s
+	c.Args = cloneStrings(s.Args)
+	c.Env = cloneStringMap(s.Env)
+	c.Headers = cloneStringMap(s.Headers)
+	c.Tools = ToolPolicy{
+		AlwaysAllow: cloneStrings(s.Tools.AlwaysAllow),
+		AutoApprove: cloneStrings(s.Tools.AutoApprove),
+		Enabled:     cloneStrings(s.Tools.Enabled),
+	}
+	if s.Disabled != nil {
+		disabled := *s.Disabled
+		c.Disabled = &disabled
+	}
+	if s.Extra != nil {
+		c.Extra = CloneValue(s.Extra).(map[string]interface{})
+	}
+	if s.scalars != nil {
+		c.scalars = make(map[scalarKey]interface{}, len(s.scalars))
+		for key, value := range s.scalars {
+			c.scalars[key] = value
+		}
+	}
+	return c
+}
+
+// Has reports whether field is set, typed or in Extra.
+func (s Server) Has(field string) bool {
+	if _, ok := s.typed(field); ok {
+		return true
+	}
+	_, ok := s.Extra[field]
+	return ok
+}
+
+// Remove unsets field and returns the value it had in the neutral form.
+func (s *Server) Remove(field string) (interface{}, bool) {
+	value, ok := s.typed(field)
+	if !ok {
+		if value, ok = s.Extra[field]; !ok {
+			return nil, false
+		}
+		delete(s.Extra, field)
+		return value, true
+	}
+	switch field {
+	case FieldType:
+		s.Type, s.Transport = "", ""
+	case FieldCommand:
+		s.Command = ""
+	case FieldArgs:
+		s.Args = nil
+	case FieldEnv:
+		s.Env = nil
+	case FieldCwd:
+		s.Cwd = ""
+	case FieldURL:
+		s.URL = ""
+	case FieldHeaders:
+		s.Headers = nil
+	case FieldStartupTimeout:
+		s.Timeouts.Startup = 0
+	case FieldToolTimeout:
+		s.Timeouts.Tool = 0
+	case FieldAlwaysAllow:
+		s.Tools.AlwaysAllow = nil
+	case FieldAutoApprove:
+		s.Tools.AutoApprove = nil
+	case FieldTools:
+		s.Tools.Enabled = nil
+	case FieldDisabled:
+		s.Disabled = nil
+	}
+	return value, true
+}
+
+// EffectiveTransport is the declared transport, or the one implied by the
+// other fields when no type is set: a url means streamable-http and a
+// command means stdio.
+func (s Server) EffectiveTransport() Transport {
+	switch {
+	case s.Transport != "" || s.Type != "":
+		return s.Transport
+	case s.URL != "":
+		return TransportStreamableHTTP
+	case s.Command != "":
+		return TransportStdio
+	}
+	return ""
+}
+
+// IsDisabled reports whether the server is switched off.
+func (s Server) IsDisabled() bool {
+	return s.Disabled != nil && *s.Disabled
+}
+
+// Seconds encodes d as a number of seconds, whole when possible.
+func Seconds(d time.Duration) interface{} {
+	if d%time.Second == 0 {
+		return int(d / time.Second)
+	}
+	return d.Seconds()
+}
+
+// SortedKeys returns the keys of m in order.
+func SortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func nonEmptyString(value interface{}) (string, bool) {
+	text, ok := value.(string)
+	return text, ok && text != ""
+}
+
+func scalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// keepScalar remembers value when it is not already a string.
+func (s *Server) keepScalar(field, key string, value interface{}) {
+	if _, ok := value.(string); ok {
+		return
+	}
+	if s.scalars == nil {
+		s.scalars = make(map[scalarKey]interface{})
+	}
+	s.scalars[scalarKey{field, key}] = value
+}
+
+// scalar returns the value kept for text, or text itself when none was kept
+// or the text has changed since.
+func (s Server) scalar(field, key, text string) interface{} {
+	if value, ok := s.scalars[scalarKey{field, key}]; ok && fmt.Sprint(value) == text {
+		return value
+	}
+	return text
+}
+
+func (s *Server) stringList(field string, value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return cloneStrings(v), true
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for i, item := range v {
+			text, ok := scalarString(item)
+			if !ok {
+				return nil, false
+			}
+			s.keepScalar(field, strconv.Itoa(i), item)
+			out = append(out, text)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func (s *Server) stringMap(field string, value interface{}) (map[string]string, bool) {
+	switch v := value.(type) {
+	case map[string]string:
+		return cloneStringMap(v), true
+	case map[string]interface{}:
+		out := make(map[string]string, len(v))
+		for key, item := range v {
+			text, ok := scalarString(item)
+			if !ok {
+				return nil, false
+			}
+			s.keepScalar(field, key, item)
+			out[key] = text
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func seconds(value interface{}) (time.Duration, bool) {
+	var f float64
+	switch v := value.(type) {
+	case int:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	case float64:
+		f = v
+	default:
+		return 0, false
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) || f == 0 {
+		return 0, false
+	}
+	return time.Duration(f * float64(time.Second)), true
+}
+
+func (s Server) list(field string, values []string) (interface{}, bool) {
+	if values == nil {
+		return nil, false
+	}
+	list := make([]interface{}, 0, len(values))
+	for i, value := range values {
+		list = append(list, s.scalar(field, strconv.Itoa(i), value))
+	}
+	return list, true
+}
+
+func (s Server) mapping(field string, values map[string]string) (interface{}, bool) {
+	if values == nil {
+		return nil, false
+	}
+	m := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		m[k] = s.scalar(field, k, v)
+	}
+	return m, true
+}
+
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string{}, values...)
+}
+
+func cloneStringMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package mcpserver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseReadsTypedFields(t *testing.T) {
+	s := Parse("fs", map[string]interface{}{
+		"type":              "Stdio",
+		"command":           "npx",
+		"args":              []interface{}{"-y", "server", 8080},
+		"env":               map[string]interface{}{"DEBUG": true, "ROOT": "/tmp"},
+		"cwd":               "/work",
+		"startupTimeoutSec": 30,
+		"toolTimeoutSec":    1.5,
+		"alwaysAllow":       []interface{}{"read"},
+		"disabled":          false,
+		"gallery":           true,
+	})
+
+	if s.Name != "fs" || s.Type != "Stdio" || s.Transport != TransportStdio || s.Command != "npx" || s.Cwd != "/work" {
+		t.Fatalf("unexpected scalar fields: %+v", s)
+	}
+	if !reflect.DeepEqual(s.Args, []string{"-y", "server", "8080"}) {
+		t.Fatalf("unexpected args: %v", s.Args)
+	}
+	if !reflect.DeepEqual(s.Env, map[string]string{"DEBUG": "true", "ROOT": "/tmp"}) {
+		t.Fatalf("unexpected env: %v", s.Env)
+	}
+	if s.Timeouts.Startup != 30*time.Second || s.Timeouts.Tool != 1500*time.Millisecond {
+		t.Fatalf("unexpected timeouts: %+v", s.Timeouts)
+	}
+	if !reflect.DeepEqual(s.Tools.AlwaysAllow, []string{"read"}) || s.Tools.Enabled != nil {
+		t.Fatalf("unexpected tool policy: %+v", s.Tools)
+	}
+	if s.Disabled == nil || s.IsDisabled() {
+		t.Fatalf("expected disabled to be set to false, got %v", s.Disabled)
+	}
+	if !reflect.DeepEqual(s.Extra, map[string]interface{}{"gallery": true}) {
+		t.Fatalf("unexpected extra fields: %v", s.Extra)
+	}
+}
+
+func TestParseKeepsMisshapenFieldsInExtra(t *testing.T) {
+	raw := map[string]interface{}{
+		"url":     "https://example.test/mcp",
+		"headers": map[string]interface{}{"X-Nested": map[string]interface{}{"a": "b"}},
+		"args":    "single",
+		"type":    "",
+	}
+	s := Parse("remote", raw)
+	if s.Headers != nil || s.Args != nil || s.Type != "" {
+		t.Fatalf("expected misshapen fields to stay untyped, got %+v", s)
+	}
+	if !reflect.DeepEqual(s.Map(), raw) {
+		t.Fatalf("expected the server to encode as it was parsed:\n got %v\nwant %v", s.Map(), raw)
+	}
+}
+
+func TestMapRoundTripsNeutralServers(t *testing.T) {
+	raw := map[string]interface{}{
+		"type":              "http",
+		"url":               "https://example.test/mcp",
+		"headers":           map[string]interface{}{"Authorization": "Bearer ${TOKEN}"},
+		"args":              []interface{}{},
+		"tools":             []interface{}{"search"},
+		"toolTimeoutSec":    2.5,
+		"startupTimeoutSec": 10,
+		"disabled":          true,
+		"custom":            map[string]interface{}{"nested": []interface{}{1, "x"}},
+	}
+	if got := Parse("remote", raw).Map(); !reflect.DeepEqual(got, raw) {
+		t.Fatalf("round trip changed the server:\n got %v\nwant %v", got, raw)
+	}
+}
+
+func TestMapKeepsScalarTypes(t *testing.T) {
+	s := Parse("fs", map[string]interface{}{
+		"command": "npx",
+		"args":    []interface{}{"--port", 8080, true},
+		"env":     map[string]interface{}{"PORT": 8080, "DEBUG": false, "RATIO": 0.5},
+	})
+	s.Env["DEBUG"] = "true"
+	s.Args = append([]string{"-y"}, s.Args...)
+
+	got := s.Map()
+	wantArgs := []interface{}{"-y", "--port", "8080", "true"}
+	if !reflect.DeepEqual(got["args"], wantArgs) {
+		t.Fatalf("unexpected args: got %#v, want %#v", got["args"], wantArgs)
+	}
+	wantEnv := map[string]interface{}{"PORT": 8080, "DEBUG": "true", "RATIO": 0.5}
+	if !reflect.DeepEqual(got["env"], wantEnv) {
+		t.Fatalf("unexpected env: got %#v, want %#v", got["env"], wantEnv)
+	}
+}
+
+func TestRemoveUnsetsTypedAndExtraFields(t *testing.T) {
+	s := Parse("fs", map[string]interface{}{"type": "sse", "url": "https://example.test", "gallery": true})
+	if value, ok := s.Remove(FieldType); !ok || value != "sse" || s.Transport != "" || s.Has(FieldType) {
+		t.Fatalf("expected type to be removed, got %v, %v, %+v", value, ok, s)
+	}
+	if value, ok := s.Remove("gallery"); !ok || value != true || s.Has("gallery") {
+		t.Fatalf("expected gallery to be removed, got %v, %v", value, ok)
+	}
+	if _, ok := s.Remove(FieldCommand); ok {
+		t.Fatal("expected removing an unset field to report false")
+	}
+}
+
+func TestEffectiveTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		server map[string]interface{}
+		want   Transport
+	}{
+		{"declared", map[string]interface{}{"type": "sse", "url": "https://example.test"}, TransportSSE},
+		{"http alias", map[string]interface{}{"type": "HTTP"}, TransportStreamableHTTP},
+		{"url", map[string]interface{}{"url": "https://example.test"}, TransportStreamableHTTP},
+		{"command", map[string]interface{}{"command": "npx"}, TransportStdio},
+		{"unknown type", map[string]interface{}{"type": "local", "command": "npx"}, ""},
+		{"empty", map[string]interface{}{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse("srv", tt.server).EffectiveTransport(); got != tt.want {
+				t.Fatalf("EffectiveTransport() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloneServersSharesNothing(t *testing.T) {
+	servers := map[string]interface{}{
+		"fs": map[string]interface{}{
+			"command": "npx",
+			"args":    []interface{}{"-y"},
+			"env":     map[string]interface{}{"PORT": 8080},
+		},
+		"bad": "not a server",
+	}
+	clone := CloneServers(servers)
+	if !reflect.DeepEqual(clone, servers) {
+		t.Fatalf("clone differs from the original: %v", clone)
+	}
+	fs := clone["fs"].(map[string]interface{})
+	fs["args"].([]interface{})[0] = "changed"
+	fs["env"].(map[string]interface{})["PORT"] = 1
+	original := servers["fs"].(map[string]interface{})
+	if original["args"].([]interface{})[0] != "-y" || original["env"].(map[string]interface{})["PORT"] != 8080 {
+		t.Fatalf("changing the clone changed the original: %v", original)
+	}
+
+	s := Parse("fs", original)
+	c := s.Clone()
+	c.Env["PORT"] = "1"
+	c.Args[0] = "changed"
+	if s.Env["PORT"] != "8080" || s.Args[0] != "-y" {
+		t.Fatalf("changing a cloned server changed the original: %+v", s)
+	}
+}
@@ -0,0 +1,102 @@
+package mcpserver
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FieldError is a problem with one field of a server.
+type FieldError struct {
+	Server  string
+	Field   string // empty when the problem is not about one field
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("server %q %s", e.Server, e.Message)
+	}
+	return fmt.Sprintf("server %q field %q %s", e.Server, e.Field, e.Message)
+}
+
+// shapes describes the value each typed field needs, for fields whose value
+// did not fit and was kept in Extra.
+var shapes = map[string]string{
+	FieldType:           "must be a non-empty string",
+	FieldCommand:        "must be a non-empty string",
+	FieldArgs:           "must be a list of strings",
+	FieldEnv:            "must be a map of strings",
+	FieldCwd:            "must be a non-empty string",
+	FieldURL:            "must be a non-empty string",
+	FieldHeaders:        "must be a map of strings",
+	FieldStartupTimeout: "must be a positive number of seconds",
+	FieldToolTimeout:    "must be a positive number of seconds",
+	FieldAlwaysAllow:    "must be a list of strings",
+	FieldAutoApprove:    "must be a list of strings",
+	FieldTools:          "must be a list of strings",
+	FieldDisabled:       "must be true or false",
+}
+
+// Validate checks that the server can be started: its fields have the right
+// shape, its type names a known transport, and it has the command or url
+// that transport needs. Errors are sorted by field.
+func (s Server) Validate() []FieldError {
+	var errs []FieldError
+	add := func(field, message string) {
+		errs = append(errs, FieldError{Server: s.Name, Field: field, Message: message})
+	}
+
+	for field, shape := range shapes {
+		if _, ok := s.Extra[field]; ok {
+			add(field, shape)
+		}
+	}
+	if s.Type != "" && s.Transport == "" {
+		add(FieldType, fmt.Sprintf("names unknown transport %q (expected stdio, streamable-http, http, or sse)", s.Type))
+	}
+	if s.Timeouts.Startup < 0 {
+		add(FieldStartupTimeout, shapes[FieldStartupTimeout])
+	}
+	if s.Timeouts.Tool < 0 {
+		add(FieldToolTimeout, shapes[FieldToolTimeout])
+	}
+
+	switch s.EffectiveTransport() {
+	case TransportStdio:
+		if s.Command == "" && !s.Has(FieldCommand) {
+			add(FieldCommand, "is required for stdio servers")
+		}
+	case TransportStreamableHTTP, TransportSSE:
+		if s.URL == "" && !s.Has(FieldURL) {
+			add(FieldURL, fmt.Sprintf("is required for %s servers", s.EffectiveTransport()))
+		}
+	default:
+		if s.Type == "" && !s.Has(FieldCommand) && !s.Has(FieldURL) {
+			add("", "needs a command or a url")
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// ValidateServers validates every server in a neutral server map, in name
+// order. Entries that are not mappings are reported too.
+func ValidateServers(servers map[string]interface{}) []FieldError {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []FieldError
+	for _, name := range names {
+		raw, ok := servers[name].(map[string]interface{})
+		if !ok {
+			errs = append(errs, FieldError{Server: name, Message: "must be a mapping"})
+			continue
+		}
+		errs = append(errs, Parse(name, raw).Validate()...)
+	}
+	return errs
+}
@@ -0,0 +1,85 @@
+package mcpserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateReportsFieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		server map[string]interface{}
+		want   []FieldError
+	}{
+		{
+			name:   "valid stdio",
+			server: map[string]interface{}{"command": "npx", "args": []interface{}{"-y"}},
+		},
+		{
+			name:   "valid http alias",
+			server: map[string]interface{}{"type": "http", "url": "https://example.test/mcp"},
+		},
+		{
+			name:   "stdio without command",
+			server: map[string]interface{}{"type": "stdio"},
+			want:   []FieldError{{Server: "srv", Field: "command", Message: "is required for stdio servers"}},
+		},
+		{
+			name:   "sse without url",
+			server: map[string]interface{}{"type": "sse"},
+			want:   []FieldError{{Server: "srv", Field: "url", Message: "is required for sse servers"}},
+		},
+		{
+			name:   "unknown transport",
+			server: map[string]interface{}{"type": "websocket", "url": "wss://example.test"},
+			want: []FieldError{{
+				Server:  "srv",
+				Field:   "type",
+				Message: `names unknown transport "websocket" (expected stdio, streamable-http, http, or sse)`,
+			}},
+		},
+		{
+			name: "misshapen fields",
+			server: map[string]interface{}{
+				"command":        "npx",
+				"env":            []interface{}{"A=1"},
+				"disabled":       "yes",
+				"toolTimeoutSec": -5,
+			},
+			want: []FieldError{
+				{Server: "srv", Field: "disabled", Message: "must be true or false"},
+				{Server: "srv", Field: "env", Message: "must be a map of strings"},
+				{Server: "srv", Field: "toolTimeoutSec", Message: "must be a positive number of seconds"},
+			},
+		},
+		{
+			name:   "nothing to start",
+			server: map[string]interface{}{"gallery": true},
+			want:   []FieldError{{Server: "srv", Message: "needs a command or a url"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse("srv", tt.server).Validate(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateServersChecksEveryServerInOrder(t *testing.T) {
+	errs := ValidateServers(map[string]interface{}{
+		"b": map[string]interface{}{"type": "http"},
+		"a": "not a server",
+		"c": map[string]interface{}{"command": "npx"},
+	})
+	if len(errs) != 2 {
+		t.Fatalf("expected two errors, got %+v", errs)
+	}
+	if errs[0].Error() != `server "a" must be a mapping` {
+		t.Fatalf("unexpected first error: %v", errs[0])
+	}
+	if errs[1].Error() != `server "b" field "url" is required for streamable-http servers` {
+		t.Fatalf("unexpected second error: %v", errs[1])
+	}
+}
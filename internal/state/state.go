@@ -0,0 +1,253 @@
+// Package state records what agent-align wrote: every output file with its
+// content hash, the server IDs it manages in each agent file, and the wrapper
+// scripts and archives it generated. Other commands query it to clean up,
+// detect drift, and decide which servers agent-align owns.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"agent-align/internal/fileutil"
+)
+
+// Version is the format version written to the state file.
+const Version = 1
+
+// MaxRuns is the number of runs kept in the history.
+const MaxRuns = 20
+
+// Categories of recorded files. They match the categories of the sync plan.
+const (
+	CategoryAgents       = "agents"
+	CategoryAdditional   = "additional"
+	CategoryExtra        = "extra"
+	CategoryArchives     = "archives"
+	CategoryAllowedTools = "allowed-tools"
+)
+
+// legacyManagedName is the file that recorded managed server IDs before the
+// state file existed. It is read once and removed on the next save.
+const legacyManagedName = "managed-servers.json"
+
+// File is one output written by a run.
+type File struct {
+	Path     string `json:"path"`
+	Category string `json:"category"`
+	// Agent is the agent the file belongs to, for agent files and
+	// allowed-tools outputs.
+	Agent string `json:"agent,omitempty"`
+	// Source is the directory an archive was built from or the file a copy
+	// came from.
+	Source string `json:"source,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+	// Servers is the server IDs agent-align wrote to an agent file.
+	Servers []string `json:"servers,omitempty"`
+	// ManagedHash is the hash of the content agent-align manages in a merged
+	// file as written: the servers of an agent file or the node of another
+	// JSON file. Edits to the rest of the file are not mistaken for drift.
+	ManagedHash string `json:"managedHash,omitempty"`
+	// Tools is the permissions or rules agent-align wrote to an
+	// allowed-tools output, so uninstall removes only those.
+	Tools []string `json:"tools,omitempty"`
+}
+
+// Run is the set of files one command wrote.
+type Run struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	// Backup is the ID of the backup run holding the previous versions.
+	Backup string `json:"backup,omitempty"`
+	Files  []File `json:"files"`
+	// Removed is the paths the run deleted.
+	Removed []string `json:"removed,omitempty"`
+}
+
+// State is the content of the state file.
+type State struct {
+	Version int `json:"version"`
+	// Files is the latest record of every file agent-align has written,
+	// sorted by path.
+	Files []File `json:"files"`
+	// Runs is the history of runs, oldest first.
+	Runs []Run `json:"runs"`
+
+	path   string
+	legacy bool
+}
+
+// Hash returns the content hash recorded for data.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Load reads the state file at path. A missing file yields an empty state,
+// seeded from the legacy managed servers file when one exists.
+func Load(path string) (*State, error) {
+	s := &State{Version: Version, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, s.loadLegacy()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %w", path, err)
+	}
+	if s.Version > Version {
+		return nil, fmt.Errorf("state %s has version %d; this agent-align understands up to %d", path, s.Version, Version)
+	}
+	s.Version = Version
+	return s, nil
+}
+
+func (s *State) loadLegacy() error {
+	path := filepath.Join(filepath.Dir(s.path), legacyManagedName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read managed servers %s: %w", path, err)
+	}
+	var owned map[string][]string
+	if err := json.Unmarshal(data, &owned); err != nil {
+		return fmt.Errorf("failed to parse managed servers %s: %w", path, err)
+	}
+	for file, servers := range owned {
+		s.Files = append(s.Files, File{Path: file, Category: CategoryAgents, Servers: servers})
+	}
+	s.sortFiles()
+	s.legacy = true
+	return nil
+}
+
+// Record adds run to the history, updates the record of each file it wrote,
+// and forgets the files it removed. Runs that changed nothing are ignored.
+func (s *State) Record(run Run) {
+	if len(run.Files) == 0 && len(run.Removed) == 0 {
+		return
+	}
+	for _, path := range run.Removed {
+		s.Forget(path)
+	}
+	for i := range run.Files {
+		sort.Strings(run.Files[i].Servers)
+	}
+	for _, file := range run.Files {
+		s.put(file)
+	}
+	s.sortFiles()
+	s.Runs = append(s.Runs, run)
+	if len(s.Runs) > MaxRuns {
+		s.Runs = append([]Run(nil), s.Runs[len(s.Runs)-MaxRuns:]...)
+	}
+}
+
+func (s *State) put(file File) {
+	for i := range s.Files {
+		if s.Files[i].Path == file.Path {
+			s.Files[i] = file
+			return
+		}
+	}
+	s.Files = append(s.Files, file)
+}
+
+// Forget drops the record of path, for files agent-align no longer manages.
+func (s *State) Forget(path string) {
+	for i := range s.Files {
+		if s.Files[i].Path == path {
+			s.Files = append(s.Files[:i], s.Files[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *State) sortFiles() {
+	sort.Slice(s.Files, func(i, j int) bool { return s.Files[i].Path < s.Files[j].Path })
+}
+
+// Lookup returns the latest record of path.
+func (s *State) Lookup(path string) (File, bool) {
+	for _, file := range s.Files {
+		if file.Path == path {
+			return file, true
+		}
+	}
+	return File{}, false
+}
+
+// FilesIn returns the recorded files of category.
+func (s *State) FilesIn(category string) []File {
+	var out []File
+	for _, file := range s.Files {
+		if file.Category == category {
+			out = append(out, file)
+		}
+	}
+	return out
+}
+
+// ManagedServers returns the server IDs written to each agent file, keyed by
+// file path.
+func (s *State) ManagedServers() map[string][]string {
+	owned := make(map[string][]string)
+	for _, file := range s.FilesIn(CategoryAgents) {
+		owned[file.Path] = append([]string(nil), file.Servers...)
+	}
+	return owned
+}
+
+// Wrappers returns the paths of the generated copilot wrapper scripts.
+func (s *State) Wrappers() []string {
+	var paths []string
+	for _, file := range s.FilesIn(CategoryAllowedTools) {
+		if file.Agent == "copilot" {
+			paths = append(paths, file.Path)
+		}
+	}
+	return paths
+}
+
+// Archives returns the paths of the generated archives.
+func (s *State) Archives() []string {
+	var paths []string
+	for _, file := range s.FilesIn(CategoryArchives) {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+// Save writes the state file and removes the legacy managed servers file it
+// replaces.
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", s.path, err)
+	}
+	if err := fileutil.WriteFile(s.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write state %s: %w", s.path, err)
+	}
+	if s.legacy {
+		legacy := filepath.Join(filepath.Dir(s.path), legacyManagedName)
+		if err := os.Remove(legacy); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", legacy, err)
+		}
+		s.legacy = false
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package state
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordKeepsLatestFileAndBoundsHistory(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	s.Record(Run{ID: "empty"})
+	if len(s.Runs) != 0 {
+		t.Fatalf("expected runs that wrote nothing to be ignored, got %v", s.Runs)
+	}
+	for i := 0; i < MaxRuns+5; i++ {
+		s.Record(Run{ID: string(rune('a' + i)), Files: []File{
+			{Path: "/b", Category: CategoryExtra, Hash: Hash([]byte{byte(i)})},
+			{Path: "/a", Category: CategoryAgents, Servers: []string{"z", "y"}},
+		}})
+	}
+	if len(s.Runs) != MaxRuns {
+		t.Fatalf("expected %d runs, got %d", MaxRuns, len(s.Runs))
+	}
+	if len(s.Files) != 2 || s.Files[0].Path != "/a" {
+		t.Fatalf("expected one sorted record per path, got %+v", s.Files)
+	}
+	if got, _ := s.Lookup("/b"); got.Hash != Hash([]byte{MaxRuns + 4}) {
+		t.Fatalf("expected latest hash, got %s", got.Hash)
+	}
+	if got := s.ManagedServers()["/a"]; strings.Join(got, ",") != "y,z" {
+		t.Fatalf("expected sorted servers, got %v", got)
+	}
+
+	s.Forget("/a")
+	if _, ok := s.Lookup("/a"); ok {
+		t.Fatal("expected /a to be forgotten")
+	}
+}
+
+func TestLoadRejectsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, _ := Load(path)
+	s.Version = Version + 1
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Fatalf("expected version error, got %v", err)
+	}
+}
+
+func TestHash(t *testing.T) {
+	if got := Hash([]byte("")); got != "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("unexpected hash %s", got)
+	}
+}
@@ -0,0 +1,191 @@
+package syncer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"agent-align/internal/tomldoc"
+	"agent-align/internal/transforms"
+	"github.com/tidwall/jsonc"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportSource records the servers read from one agent's config file.
+type ImportSource struct {
+	Config  AgentConfig
+	Servers []string // Server names found in the file, sorted
+}
+
+// ImportConflict describes a server field that two agents define with
+// different values. The value from the first agent is kept.
+type ImportConflict struct {
+	Server string
+	Field  string
+	Kept   string // Agent whose value was kept
+	Other  string // Agent whose value was discarded
+}
+
+// ImportResult is the neutral server map merged from several agents.
+type ImportResult struct {
+	Servers   map[string]interface{}
+	Sources   []ImportSource
+	Conflicts []ImportConflict
+}
+
+// Import reads the MCP servers from each agent's config file, undoes the
+// agent-specific transform, and merges them into neutral definitions. Agents
+// are merged in order: fields missing from earlier agents are filled in from
+// later ones, and fields with different values are reported as conflicts.
+// Agents whose config file does not exist are skipped. registry resolves the
+// agent names.
+func Import(agents []AgentTarget, registry Registry) (ImportResult, error) {
+	result := ImportResult{Servers: make(map[string]interface{})}
+	owners := make(map[string]map[string]string) // server -> field -> agent
+
+	for _, agent := range dedupeTargets(agents) {
+		cfg, err := registry.AgentConfig(agent.Name, agent.PathOverride)
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("target agent %q not supported: %w", agent.Name, err)
+		}
+
+		servers, err := ReadServers(cfg)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return ImportResult{}, err
+		}
+
+		if err := registry.reverser(cfg.Name).Reverse(servers); err != nil {
+			return ImportResult{}, fmt.Errorf("failed to convert %s servers: %w", cfg.Name, err)
+		}
+		// Reverse transforms can introduce new numbers, such as seconds
+		// computed from milliseconds, so normalize again before comparing.
+		if servers, err = normalizeServers(servers); err != nil {
+			return ImportResult{}, err
+		}
+
+		source := ImportSource{Config: cfg}
+		for _, name := range sortedNames(servers) {
+			source.Servers = append(source.Servers, name)
+			server, ok := servers[name].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			existing, ok := result.Servers[name].(map[string]interface{})
+			if !ok {
+				result.Servers[name] = server
+				owners[name] = make(map[string]string, len(server))
+				for field := range server {
+					owners[name][field] = cfg.Name
+				}
+				continue
+			}
+			for _, field := range sortedNames(server) {
+				if current, exists := existing[field]; exists {
+					if !reflect.DeepEqual(current, server[field]) {
+						result.Conflicts = append(result.Conflicts, ImportConflict{
+							Server: name,
+							Field:  field,
+							Kept:   owners[name][field],
+							Other:  cfg.Name,
+						})
+					}
+					continue
+				}
+				existing[field] = server[field]
+				owners[name][field] = cfg.Name
+			}
+		}
+		result.Sources = append(result.Sources, source)
+	}
+
+	return result, nil
+}
+
+// ReadServers returns the MCP servers stored in an agent's config file. The
+// error satisfies os.IsNotExist when the file is missing. Values are
+// normalized through JSON so every format decodes to the same Go types.
+func ReadServers(cfg AgentConfig) (map[string]interface{}, error) {
+	data, err := os.ReadFile(cfg.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseServers(cfg, data)
+}
+
+// ParseServers returns the MCP servers stored in data, the content of an
+// agent config file in cfg's format, normalized like ReadServers.
+func ParseServers(cfg AgentConfig, data []byte) (map[string]interface{}, error) {
+	var root map[string]interface{}
+	switch cfg.Format {
+	case "toml":
+		doc, err := tomldoc.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse TOML from %s: %w", cfg.FilePath, err)
+		}
+		root = doc.Table(strings.Split(tomlRoot(cfg), ".")...)
+	case "yaml":
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML from %s: %w", cfg.FilePath, err)
+		}
+		root = nodeValue(root, cfg.NodeName)
+	default:
+		if err := json.Unmarshal(jsonc.ToJSON(data), &root); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON from %s: %w", cfg.FilePath, err)
+		}
+		root = nodeValue(root, cfg.NodeName)
+	}
+
+	if root == nil {
+		return map[string]interface{}{}, nil
+	}
+	return normalizeServers(root)
+}
+
+// normalizeServers round-trips servers through JSON so numbers decode as
+// float64 and lists and maps as []interface{} and map[string]interface{},
+// whichever format they were read from.
+func normalizeServers(servers map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(servers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize server configuration: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("failed to normalize server configuration: %w", err)
+	}
+	return normalized, nil
+}
+
+// nodeValue returns the mapping stored under nodeName, or the whole document
+// when no node is configured.
+func nodeValue(root map[string]interface{}, nodeName string) map[string]interface{} {
+	if nodeName == "" {
+		return root
+	}
+	node, _ := root[nodeName].(map[string]interface{})
+	return node
+}
+
+// reverser returns the reverser for a built-in agent or the rule-based
+// transformer for a custom agent.
+func (r Registry) reverser(name string) transforms.Reverser {
+	if custom, ok := r.lookup(name); ok {
+		return &transforms.RuleTransformer{Rules: custom.Rules}
+	}
+	return transforms.GetReverser(name)
+}
+
+func sortedNames(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
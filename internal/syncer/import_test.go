@@ -0,0 +1,137 @@
+package syncer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImportMergesAgentsAndReportsConflicts(t *testing.T) {
+	dir := t.TempDir()
+	codexPath := filepath.Join(dir, "config.toml")
+	codex := `model = "gpt-5"
+
+[mcp_servers.fs]
+command = "npx"
+args = ["-y", "fs-server"]
+
+[mcp_servers.fs.tools.read]
+approval_mode = "approve"
+
+[mcp_servers.remote]
+url = "https://example.com/mcp"
+
+[mcp_servers.remote.http_headers]
+X-Key = "abc"
+`
+	if err := os.WriteFile(codexPath, []byte(codex), 0o644); err != nil {
+		t.Fatalf("failed to write codex config: %v", err)
+	}
+
+	opencodePath := filepath.Join(dir, "opencode.jsonc")
+	opencode := `{
+  // OpenCode settings
+  "mcp": {
+    "fs": {"type": "local", "command": ["npx", "-y", "fs-server"], "environment": {"ROOT": "/tmp"}},
+    "remote": {"type": "remote", "url": "https://other.example.com/mcp"},
+  },
+}`
+	if err := os.WriteFile(opencodePath, []byte(opencode), 0o644); err != nil {
+		t.Fatalf("failed to write opencode config: %v", err)
+	}
+
+	result, err := Import([]AgentTarget{
+		{Name: "codex", PathOverride: codexPath},
+		{Name: "opencode", PathOverride: opencodePath},
+		{Name: "claudecode", PathOverride: filepath.Join(dir, "missing.json")},
+	}, Registry{})
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+
+	if len(result.Sources) != 2 {
+		t.Fatalf("expected the missing claude config to be skipped, got %+v", result.Sources)
+	}
+
+	fs := result.Servers["fs"].(map[string]interface{})
+	want := map[string]interface{}{
+		"command":     "npx",
+		"args":        []interface{}{"-y", "fs-server"},
+		"alwaysAllow": []interface{}{"read"},
+		"env":         map[string]interface{}{"ROOT": "/tmp"},
+	}
+	if !reflect.DeepEqual(fs, want) {
+		t.Fatalf("unexpected merged fs server:\n got %v\nwant %v", fs, want)
+	}
+
+	remote := result.Servers["remote"].(map[string]interface{})
+	if remote["url"] != "https://example.com/mcp" || remote["type"] != "http" {
+		t.Fatalf("expected codex url to be kept and opencode type added, got %v", remote)
+	}
+	if !reflect.DeepEqual(remote["headers"], map[string]interface{}{"X-Key": "abc"}) {
+		t.Fatalf("expected http_headers renamed to headers, got %v", remote)
+	}
+
+	wantConflicts := []ImportConflict{{Server: "remote", Field: "url", Kept: "codex", Other: "opencode"}}
+	if !reflect.DeepEqual(result.Conflicts, wantConflicts) {
+		t.Fatalf("unexpected conflicts: %+v", result.Conflicts)
+	}
+}
+
+func TestImportComparesNumbersAcrossFormats(t *testing.T) {
+	dir := t.TempDir()
+	codexPath := filepath.Join(dir, "config.toml")
+	codex := `[mcp_servers.x]
+command = "x-server"
+retries = 3
+tool_timeout_sec = 30
+`
+	if err := os.WriteFile(codexPath, []byte(codex), 0o644); err != nil {
+		t.Fatalf("failed to write codex config: %v", err)
+	}
+	claudePath := filepath.Join(dir, "claude.json")
+	claude := `{"mcpServers": {"x": {"command": "x-server", "retries": 3}}}`
+	if err := os.WriteFile(claudePath, []byte(claude), 0o644); err != nil {
+		t.Fatalf("failed to write claude config: %v", err)
+	}
+	geminiPath := filepath.Join(dir, "settings.json")
+	gemini := `{"mcpServers": {"x": {"command": "x-server", "timeout": 30000}}}`
+	if err := os.WriteFile(geminiPath, []byte(gemini), 0o644); err != nil {
+		t.Fatalf("failed to write gemini config: %v", err)
+	}
+
+	result, err := Import([]AgentTarget{
+		{Name: "codex", PathOverride: codexPath},
+		{Name: "claudecode", PathOverride: claudePath},
+		{Name: "gemini", PathOverride: geminiPath},
+	}, Registry{})
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+	if len(result.Conflicts) != 0 {
+		t.Fatalf("expected equal numbers from TOML and JSON not to conflict, got %+v", result.Conflicts)
+	}
+	x := result.Servers["x"].(map[string]interface{})
+	if x["toolTimeoutSec"] != float64(30) {
+		t.Fatalf("expected codex tool_timeout_sec read back as toolTimeoutSec, got %v", x)
+	}
+}
+
+func TestReadServersYAMLNode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yml")
+	if err := os.WriteFile(path, []byte("other: 1\nmcp:\n  fs:\n    command: npx\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	servers, err := ReadServers(AgentConfig{Name: "custom", FilePath: path, NodeName: "mcp", Format: "yaml"})
+	if err != nil {
+		t.Fatalf("ReadServers returned error: %v", err)
+	}
+	if !reflect.DeepEqual(servers, map[string]interface{}{"fs": map[string]interface{}{"command": "npx"}}) {
+		t.Fatalf("unexpected servers: %v", servers)
+	}
+
+	if _, err := ReadServers(AgentConfig{FilePath: filepath.Join(t.TempDir(), "none.json"), Format: "json"}); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
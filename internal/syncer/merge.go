@@ -0,0 +1,162 @@
+package syncer
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"agent-align/internal/tomldoc"
+)
+
+// Merge strategies for servers that already exist in an agent file.
+const (
+	// MergeReplace replaces the whole servers node with the rendered servers.
+	MergeReplace = "replace"
+	// MergeMerge adds or updates the rendered servers and keeps every other
+	// server in the file.
+	MergeMerge = "merge"
+	// MergeManagedOnly updates the rendered servers, removes servers a
+	// previous run wrote that are no longer rendered, and keeps servers
+	// agent-align never wrote.
+	MergeManagedOnly = "managed-only"
+)
+
+// MergeStrategies returns the accepted merge strategy names.
+func MergeStrategies() []string {
+	return []string{MergeReplace, MergeMerge, MergeManagedOnly}
+}
+
+// IsMergeStrategy reports whether value names a merge strategy. An empty
+// value selects the default and is accepted.
+func IsMergeStrategy(value string) bool {
+	normalized := normalizeMergeStrategy(value)
+	for _, strategy := range MergeStrategies() {
+		if strategy == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeMergeStrategy(value string) string {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	if normalized == "" {
+		return MergeReplace
+	}
+	return normalized
+}
+
+// mergeExistingServers combines the rendered servers with the servers in the
+// agent's current file according to strategy. owned lists the server IDs a
+// previous run wrote to the file.
+func mergeExistingServers(cfg AgentConfig, strategy string, rendered map[string]interface{}, owned []string) (map[string]interface{}, error) {
+	strategy = normalizeMergeStrategy(strategy)
+	switch strategy {
+	case MergeReplace:
+		return rendered, nil
+	case MergeMerge, MergeManagedOnly:
+	default:
+		return nil, fmt.Errorf("agent %q has unsupported merge strategy %q (expected one of %s)", cfg.Name, strategy, strings.Join(MergeStrategies(), ", "))
+	}
+
+	existing, err := ReadServers(cfg)
+	if os.IsNotExist(err) {
+		return rendered, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge servers for %s: %w", cfg.Name, err)
+	}
+
+	if strategy == MergeManagedOnly {
+		for _, id := range owned {
+			if _, stillRendered := rendered[id]; !stillRendered {
+				delete(existing, id)
+			}
+		}
+	}
+	for name, server := range rendered {
+		existing[name] = server
+	}
+	return existing, nil
+}
+
+// renderMerged renders the agent's file with the rendered servers combined
+// with the existing ones according to strategy. TOML files are edited table
+// by table, so servers agent-align does not manage keep their bytes and
+// comments.
+func renderMerged(cfg AgentConfig, strategy string, rendered map[string]interface{}, owned []string) (string, error) {
+	merged, err := mergeExistingServers(cfg, strategy, rendered, owned)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Format != "toml" || normalizeMergeStrategy(strategy) == MergeReplace {
+		return formatConfig(cfg, merged)
+	}
+	var removed []string
+	for _, id := range owned {
+		if _, kept := merged[id]; !kept {
+			removed = append(removed, id)
+		}
+	}
+	return formatTOMLServers(cfg, rendered, removed)
+}
+
+// formatTOMLServers rewrites only the tables of the named servers in the
+// agent's TOML file: servers in rendered replace their table or are added,
+// and the tables of the servers in removed are deleted. Every other byte of
+// the file is kept.
+func formatTOMLServers(cfg AgentConfig, rendered map[string]interface{}, removed []string) (string, error) {
+	data, err := os.ReadFile(cfg.FilePath)
+	if os.IsNotExist(err) {
+		return formatTOMLConfig(cfg, rendered), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", cfg.FilePath, err)
+	}
+
+	root := strings.Split(tomlRoot(cfg), ".")
+	for _, name := range append(sortedNames(rendered), removed...) {
+		doc, err := tomldoc.Parse(data)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse TOML from %s: %w", cfg.FilePath, err)
+		}
+		var section string
+		if server, ok := rendered[name]; ok {
+			section = tomldoc.EncodeTables(root, map[string]interface{}{name: server})
+		}
+		data = doc.ReplaceTable(append(append([]string(nil), root...), name), section)
+	}
+	return string(data), nil
+}
+
+// RemoveServers renders the agent's file without the servers in ids, keeping
+// every other server and setting as they are. It returns the new content and
+// the IDs that were present and removed. The error satisfies os.IsNotExist
+// when the file is missing.
+func RemoveServers(cfg AgentConfig, ids []string) (string, []string, error) {
+	existing, err := ReadServers(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	var removed []string
+	for _, id := range ids {
+		if _, ok := existing[id]; ok {
+			delete(existing, id)
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) == 0 {
+		return "", nil, nil
+	}
+	sort.Strings(removed)
+	if cfg.Format == "toml" {
+		content, err := formatTOMLServers(cfg, nil, removed)
+		return content, removed, err
+	}
+	content, err := formatConfig(cfg, existing)
+	if err != nil {
+		return "", nil, err
+	}
+	return content, removed, nil
+}
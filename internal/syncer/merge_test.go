@@ -0,0 +1,183 @@
+package syncer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeClaudeFixture(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "claude.json")
+	content := `{"theme": "dark", "mcpServers": {
+  "fs": {"command": "old"},
+  "removed": {"command": "gone"},
+  "manual": {"command": "hand-added"}
+}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	return path
+}
+
+func syncedServerNames(t *testing.T, content string) []string {
+	t.Helper()
+	var parsed struct {
+		MCPServers map[string]interface{} `json:"mcpServers"`
+	}
+	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+		t.Fatalf("failed to parse output: %v\n%s", err, content)
+	}
+	return sortedNames(parsed.MCPServers)
+}
+
+func TestSyncMergeStrategies(t *testing.T) {
+	servers := map[string]interface{}{"fs": map[string]interface{}{"command": "npx"}}
+	tests := []struct {
+		strategy string
+		want     []string
+	}{
+		{strategy: "", want: []string{"fs"}},
+		{strategy: MergeReplace, want: []string{"fs"}},
+		{strategy: MergeMerge, want: []string{"fs", "manual", "removed"}},
+		{strategy: MergeManagedOnly, want: []string{"fs", "manual"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			path := writeClaudeFixture(t)
+			s := New([]AgentTarget{{Name: "claudecode", PathOverride: path, MergeStrategy: tt.strategy}})
+			s.Owned = map[string][]string{path: {"fs", "removed"}}
+
+			result, err := s.Sync(servers)
+			if err != nil {
+				t.Fatalf("Sync returned error: %v", err)
+			}
+			output := result.Agents["claudecode"][0]
+			if got := syncedServerNames(t, output.Content); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected servers %v, got %v", tt.want, got)
+			}
+			if !strings.Contains(output.Content, `"command": "npx"`) {
+				t.Fatalf("expected rendered server to replace the existing one:\n%s", output.Content)
+			}
+			if !reflect.DeepEqual(output.Managed, []string{"fs"}) {
+				t.Fatalf("expected managed IDs [fs], got %v", output.Managed)
+			}
+		})
+	}
+}
+
+func TestSyncManagedOnlyKeepsForeignCodexTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	existing := `model = "gpt-5"
+
+[mcp_servers.manual]
+command = "hand-added"
+startup_timeout_sec = 20
+`
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	s := New([]AgentTarget{{Name: "codex", PathOverride: path, MergeStrategy: MergeManagedOnly}})
+	result, err := s.Sync(map[string]interface{}{"fs": map[string]interface{}{"command": "npx"}})
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	content := result.Agents["codex"][0].Content
+	for _, want := range []string{`model = "gpt-5"`, "[mcp_servers.fs]", "[mcp_servers.manual]", "startup_timeout_sec = 20"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("expected %q in output:\n%s", want, content)
+		}
+	}
+}
+
+func TestSyncMergeKeepsForeignCodexTablesByteForByte(t *testing.T) {
+	foreign := `# Hand-tuned server; keep the comments.
+[mcp_servers.manual]
+command = "hand-added"   # local build
+args = [
+  "--verbose", # noisy
+]
+`
+	existing := `model = "gpt-5"
+
+[mcp_servers.fs]
+command = "old"
+
+` + foreign + `
+[mcp_servers.stale]
+command = "gone"
+`
+	for _, strategy := range []string{MergeMerge, MergeManagedOnly} {
+		t.Run(strategy, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+				t.Fatalf("failed to write fixture: %v", err)
+			}
+			s := New([]AgentTarget{{Name: "codex", PathOverride: path, MergeStrategy: strategy}})
+			s.Owned = map[string][]string{path: {"fs", "stale"}}
+			result, err := s.Sync(map[string]interface{}{"fs": map[string]interface{}{"command": "npx"}})
+			if err != nil {
+				t.Fatalf("Sync returned error: %v", err)
+			}
+			content := result.Agents["codex"][0].Content
+			if !strings.Contains(content, foreign) {
+				t.Fatalf("expected the foreign table to be kept byte for byte:\n%s", content)
+			}
+			if !strings.Contains(content, "[mcp_servers.fs]\ncommand = \"npx\"") || strings.Contains(content, `"old"`) {
+				t.Fatalf("expected the managed server to be rewritten:\n%s", content)
+			}
+			if kept := strings.Contains(content, "[mcp_servers.stale]"); kept != (strategy == MergeMerge) {
+				t.Fatalf("unexpected handling of the stale managed server for %s:\n%s", strategy, content)
+			}
+		})
+	}
+}
+
+func TestSyncRejectsUnknownMergeStrategy(t *testing.T) {
+	path := writeClaudeFixture(t)
+	s := New([]AgentTarget{{Name: "claudecode", PathOverride: path, MergeStrategy: "append"}})
+	result, err := s.Sync(map[string]interface{}{"fs": map[string]interface{}{"command": "npx"}})
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if failed := result.Failed(); len(failed) != 1 || failed[0].Err == nil || failed[0].Path != path {
+		t.Fatalf("expected the target to fail for unknown merge strategy, got %+v", result.Targets)
+	}
+	if len(result.Agents) != 0 {
+		t.Fatalf("expected no output for the failed target, got %+v", result.Agents)
+	}
+}
+
+func TestRemoveServersKeepsForeignEntries(t *testing.T) {
+	path := writeClaudeFixture(t)
+	cfg, err := GetAgentConfig("claudecode", path)
+	if err != nil {
+		t.Fatalf("GetAgentConfig returned error: %v", err)
+	}
+
+	content, removed, err := RemoveServers(cfg, []string{"removed", "fs", "absent"})
+	if err != nil {
+		t.Fatalf("RemoveServers returned error: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"fs", "removed"}) {
+		t.Fatalf("unexpected removed IDs %v", removed)
+	}
+	if got := syncedServerNames(t, content); !reflect.DeepEqual(got, []string{"manual"}) {
+		t.Fatalf("expected only the foreign server to remain, got %v", got)
+	}
+	if !strings.Contains(content, `"theme": "dark"`) {
+		t.Fatalf("expected other settings to be kept:\n%s", content)
+	}
+
+	if _, removed, err := RemoveServers(cfg, []string{"absent"}); err != nil || removed != nil {
+		t.Fatalf("expected nothing removed, got %v (err %v)", removed, err)
+	}
+	cfg.FilePath = filepath.Join(t.TempDir(), "missing.json")
+	if _, _, err := RemoveServers(cfg, []string{"fs"}); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package syncer
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -10,8 +11,12 @@ import (
 	"sort"
 	"strings"
 
+	"agent-align/internal/jsoncdoc"
+	"agent-align/internal/mcpconfig"
+	"agent-align/internal/mcpserver"
+	"agent-align/internal/tomldoc"
 	"agent-align/internal/transforms"
-	"github.com/tidwall/jsonc"
+	"gopkg.in/yaml.v3"
 )
 
 // AgentTarget allows overrides for an agent destination.
@@ -20,31 +25,126 @@ type AgentTarget struct {
 	PathOverride string
 	// DisabledMcpServers lists MCP IDs that should be omitted for this agent.
 	DisabledMcpServers []string
+	// MergeStrategy controls how rendered servers combine with servers
+	// already in the agent file: MergeReplace (default), MergeMerge, or
+	// MergeManagedOnly.
+	MergeStrategy string
+	// IncludeTags limits the agent to servers tagged with at least one of
+	// these tags. ExcludeTags drops servers carrying any of them.
+	IncludeTags []string
+	ExcludeTags []string
+	// Profile names the MCP definitions profile the caller renders this agent
+	// with. Sync itself does not read it; it only keeps targets distinct.
+	Profile string
+	// Secrets is SecretsExpand (default) to write resolved values, or
+	// SecretsPassthrough to keep environment references in the agent's
+	// native syntax.
+	Secrets string
 }
 
+// Secret handling modes for AgentTarget.Secrets.
+const (
+	SecretsExpand      = "expand"
+	SecretsPassthrough = "passthrough"
+)
+
 // AgentConfig holds information about an agent's configuration file.
 type AgentConfig struct {
 	Name     string // Normalized agent name
 	FilePath string // Path to the config file
 	NodeName string // Name of the node where servers are stored
-	Format   string // "json" or "toml"
+	Format   string // "json", "jsonc", "toml", or "yaml"
+}
+
+// CustomAgent describes an agent declared in the target config instead of
+// being built into agent-align.
+type CustomAgent struct {
+	Name     string
+	Path     string // Default config file path
+	Format   string // "json", "jsonc", "toml", or "yaml"
+	NodeName string // Name of the node where servers are stored
+	Rules    transforms.FieldRules
 }
 
 // AgentResult is the rendered output for a single agent.
 type AgentResult struct {
 	Config  AgentConfig
 	Content string
+	// Managed lists the server IDs agent-align rendered into the file, sorted.
+	Managed []string
 }
 
 var supportedAgentList = []string{"copilot", "vscode", "codex", "claudecode", "gemini", "kilocode", "opencode"}
 
-// SupportedAgents returns a list of supported agent names.
+// SupportedAgents returns the names of the built-in agents.
 func SupportedAgents() []string {
 	return append([]string(nil), supportedAgentList...)
 }
 
-// GetAgentConfig returns the configuration information for a given agent.
+// Registry is the set of agents a run can target: the built-in agents plus
+// the custom agents declared in the target config. The zero value holds only
+// the built-in agents.
+type Registry struct {
+	custom []CustomAgent
+}
+
+// NewRegistry returns a registry with the given custom agents, which
+// config.Load has already validated. It rejects names that shadow a built-in
+// agent.
+func NewRegistry(custom []CustomAgent) (Registry, error) {
+	for _, agent := range custom {
+		if isBuiltinAgent(normalizeAgent(agent.Name)) {
+			return Registry{}, fmt.Errorf("custom agent %q conflicts with a built-in agent", agent.Name)
+		}
+	}
+	return Registry{custom: append([]CustomAgent(nil), custom...)}, nil
+}
+
+// Agents returns the built-in agent names followed by the custom ones, in
+// the order they were declared.
+func (r Registry) Agents() []string {
+	out := SupportedAgents()
+	for _, agent := range r.custom {
+		out = append(out, normalizeAgent(agent.Name))
+	}
+	return out
+}
+
+func isBuiltinAgent(name string) bool {
+	for _, builtin := range supportedAgentList {
+		if builtin == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Registry) lookup(name string) (CustomAgent, bool) {
+	for _, agent := range r.custom {
+		if normalizeAgent(agent.Name) == name {
+			return agent, true
+		}
+	}
+	return CustomAgent{}, false
+}
+
+// transformer returns the transformer for a built-in agent or a rule-based
+// transformer for a custom agent.
+func (r Registry) transformer(name string) transforms.Transformer {
+	if custom, ok := r.lookup(name); ok {
+		return &transforms.RuleTransformer{Rules: custom.Rules}
+	}
+	return transforms.GetTransformer(name)
+}
+
+// GetAgentConfig returns the configuration information for a built-in agent.
 func GetAgentConfig(agent, overridePath string) (AgentConfig, error) {
+	return Registry{}.AgentConfig(agent, overridePath)
+}
+
+// AgentConfig returns the configuration information for a given agent.
+// overridePath replaces the agent's default config file when set.
+func (r Registry) AgentConfig(agent, overridePath string) (AgentConfig, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return AgentConfig{}, fmt.Errorf("failed to get home directory: %w", err)
@@ -108,6 +208,14 @@ func GetAgentConfig(agent, overridePath string) (AgentConfig, error) {
 			Format:   "jsonc",
 		}, nil
 	default:
+		if custom, ok := r.lookup(name); ok {
+			return AgentConfig{
+				Name:     name,
+				FilePath: applyOverride(overridePath, custom.Path),
+				NodeName: custom.NodeName,
+				Format:   custom.Format,
+			}, nil
+		}
 		return AgentConfig{}, fmt.Errorf("unsupported agent: %s", agent)
 	}
 }
@@ -115,6 +223,23 @@ func GetAgentConfig(agent, overridePath string) (AgentConfig, error) {
 // Syncer renders MCP server definitions into the supported agent formats.
 type Syncer struct {
 	Agents []AgentTarget
+	// Owned maps an agent config file path to the server IDs a previous run
+	// wrote there. MergeManagedOnly targets use it to remove servers that
+	// agent-align no longer renders without touching foreign entries.
+	Owned map[string][]string
+	// Targeting holds the per-server agents/excludeAgents/tags metadata from
+	// the MCP definitions file, keyed by server ID.
+	Targeting map[string]mcpconfig.Targeting
+	// Unexpanded holds the servers passed to Sync before environment
+	// expansion. SecretsPassthrough targets render from it; when it is nil
+	// they fall back to the expanded servers.
+	Unexpanded map[string]interface{}
+	// FailOnLossy turns lossy-conversion warnings into errors, so a target
+	// that would lose configuration is not written.
+	FailOnLossy bool
+	// Registry resolves agent names; the zero value knows only the built-in
+	// agents.
+	Registry Registry
 }
 
 func New(agents []AgentTarget) *Syncer {
@@ -122,91 +247,209 @@ func New(agents []AgentTarget) *Syncer {
 }
 
 // SyncResult contains the output per agent plus the parsed server data.
+// Agents only holds the targets that rendered; Targets has the outcome of
+// every target, including the ones that failed.
 type SyncResult struct {
 	Agents  map[string][]AgentResult
 	Servers map[string]interface{}
+	Targets []TargetResult
+}
+
+// TargetResult is the outcome of rendering one target.
+type TargetResult struct {
+	Agent string
+	Path  string // empty when the agent could not be resolved
+	// Diagnostics are the problems found in the target's servers. Errors
+	// among them fail the target; warnings do not.
+	Diagnostics []transforms.Diagnostic
+	// Err is set when the target failed and nothing should be written to it.
+	Err error
+}
+
+// Failed returns the targets that could not be rendered.
+func (r SyncResult) Failed() []TargetResult {
+	var failed []TargetResult
+	for _, target := range r.Targets {
+		if target.Err != nil {
+			failed = append(failed, target)
+		}
+	}
+	return failed
 }
 
+// Sync renders servers for every target. A target that fails is reported in
+// the result and the others are still rendered; an error is only returned
+// when nothing can be rendered at all.
 func (s *Syncer) Sync(servers map[string]interface{}) (SyncResult, error) {
 	if len(servers) == 0 {
 		return SyncResult{}, fmt.Errorf("server list cannot be empty")
 	}
 
-	outputs := make(map[string][]AgentResult, len(s.Agents))
+	result := SyncResult{Agents: make(map[string][]AgentResult, len(s.Agents)), Servers: servers}
 	for _, agent := range s.Agents {
-		cfg, err := GetAgentConfig(agent.Name, agent.PathOverride)
-		if err != nil {
-			return SyncResult{}, fmt.Errorf("target agent %q not supported: %w", agent.Name, err)
+		target, output := s.syncTarget(agent, servers)
+		result.Targets = append(result.Targets, target)
+		if target.Err == nil {
+			result.Agents[output.Config.Name] = append(result.Agents[output.Config.Name], output)
 		}
+	}
+	return result, nil
+}
 
-		agentServers, err := deepCopyServers(servers)
-		if err != nil {
-			return SyncResult{}, err
-		}
+// syncTarget renders one target. Problems with the target are returned in
+// the TargetResult.
+func (s *Syncer) syncTarget(agent AgentTarget, servers map[string]interface{}) (TargetResult, AgentResult) {
+	target := TargetResult{Agent: agent.Name}
+	cfg, err := s.Registry.AgentConfig(agent.Name, agent.PathOverride)
+	if err != nil {
+		target.Err = fmt.Errorf("target agent %q not supported: %w", agent.Name, err)
+		return target, AgentResult{}
+	}
+	target.Agent = cfg.Name
+	target.Path = cfg.FilePath
 
-		// Remove any servers disabled for this agent before applying transforms.
-		for _, id := range agent.DisabledMcpServers {
-			trimmed := strings.TrimSpace(id)
-			if trimmed == "" {
-				continue
-			}
-			// Try exact match first
-			if _, ok := agentServers[trimmed]; ok {
-				delete(agentServers, trimmed)
-				continue
+	passthrough := strings.EqualFold(strings.TrimSpace(agent.Secrets), SecretsPassthrough) && s.Unexpanded != nil
+	source := servers
+	if passthrough {
+		source = s.Unexpanded
+	}
+	agentServers := deepCopyServers(source)
+
+	// Remove any servers disabled for this agent before applying transforms.
+	for _, id := range agent.DisabledMcpServers {
+		trimmed := strings.TrimSpace(id)
+		if trimmed == "" {
+			continue
+		}
+		// Try exact match first
+		if _, ok := agentServers[trimmed]; ok {
+			delete(agentServers, trimmed)
+			continue
+		}
+		// Fallback to case-insensitive match
+		for k := range agentServers {
+			if strings.EqualFold(k, trimmed) {
+				delete(agentServers, k)
+				break
 			}
-			// Fallback to case-insensitive match
-			for k := range agentServers {
-				if strings.EqualFold(k, trimmed) {
-					delete(agentServers, k)
-					break
-				}
+		}
+	}
+
+	// Remove servers whose targeting metadata excludes this agent.
+	for name := range agentServers {
+		if !s.targets(name, cfg.Name, agent) {
+			delete(agentServers, name)
+		}
+	}
+
+	transformer := s.Registry.transformer(cfg.Name)
+	diags, err := transforms.TransformAndReport(transformer, agentServers)
+	if err != nil {
+		var found transforms.Diagnostics
+		if !errors.As(err, &found) {
+			target.Err = err
+			return target, AgentResult{}
+		}
+		diags = append(diags, found...)
+	}
+	if s.FailOnLossy {
+		for i := range diags {
+			if diags[i].Kind == transforms.KindLossy {
+				diags[i].Severity = transforms.SeverityError
 			}
 		}
+	}
+	target.Diagnostics = append(target.Diagnostics, diags...)
+	if errs := diags.Errors(); len(errs) > 0 {
+		target.Err = errs
+		return target, AgentResult{}
+	}
 
-		transformer := transforms.GetTransformer(cfg.Name)
-		if err := transformer.Transform(agentServers); err != nil {
-			return SyncResult{}, err
+	if passthrough {
+		if !transforms.SupportsSecretPassthrough(cfg.Name) {
+			target.Diagnostics = append(target.Diagnostics, transforms.Diagnostic{
+				Severity: transforms.SeverityWarning,
+				Agent:    cfg.Name,
+				Field:    "secrets",
+				Message:  "cannot resolve environment references itself; writing expanded secrets",
+			})
 		}
+		transforms.PassthroughSecrets(cfg.Name, agentServers, mcpconfig.ExpandString)
+	}
 
-		outputs[cfg.Name] = append(outputs[cfg.Name], AgentResult{
-			Config:  cfg,
-			Content: formatConfig(cfg, agentServers),
-		})
+	managed := sortedNames(agentServers)
+	content, err := renderMerged(cfg, agent.MergeStrategy, agentServers, s.Owned[cfg.FilePath])
+	if err != nil {
+		target.Err = err
+		return target, AgentResult{}
+	}
+	return target, AgentResult{
+		Config:  cfg,
+		Content: content,
+		Managed: managed,
 	}
+}
 
-	return SyncResult{Agents: outputs, Servers: servers}, nil
+// targets reports whether the server should be written to the agent based on
+// the server's targeting metadata and the target's tag filters.
+func (s *Syncer) targets(server, agentName string, target AgentTarget) bool {
+	meta := s.Targeting[server]
+	if len(meta.Agents) > 0 && !containsFold(meta.Agents, agentName) {
+		return false
+	}
+	if containsFold(meta.ExcludeAgents, agentName) {
+		return false
+	}
+	if len(target.IncludeTags) > 0 && !anyFold(meta.Tags, target.IncludeTags) {
+		return false
+	}
+	return !anyFold(meta.Tags, target.ExcludeTags)
 }
 
-// deepCopyServers creates a deep copy of the servers map to avoid
-// transformations from one agent affecting another.
-func deepCopyServers(servers map[string]interface{}) (map[string]interface{}, error) {
-	// Use JSON marshal/unmarshal for deep copy
-	data, err := json.Marshal(servers)
-	if err != nil {
-		return nil, fmt.Errorf("failed to copy server configuration: %w", err)
+func containsFold(values []string, want string) bool {
+	for _, value := range values {
+		if strings.EqualFold(strings.TrimSpace(value), want) {
+			return true
+		}
 	}
-	var copy map[string]interface{}
-	if err := json.Unmarshal(data, &copy); err != nil {
-		return nil, fmt.Errorf("failed to copy server configuration: %w", err)
+	return false
+}
+
+func anyFold(values, wanted []string) bool {
+	for _, want := range wanted {
+		if containsFold(values, strings.TrimSpace(want)) {
+			return true
+		}
 	}
-	return copy, nil
+	return false
+}
+
+// deepCopyServers creates a deep copy of the servers map to avoid
+// transformations from one agent affecting another.
+func deepCopyServers(servers map[string]interface{}) map[string]interface{} {
+	return mcpserver.CloneServers(servers)
 }
 
-func formatConfig(config AgentConfig, servers map[string]interface{}) string {
+// formatConfig renders the content of the agent's config file with servers
+// in it. An error means nothing should be written.
+func formatConfig(config AgentConfig, servers map[string]interface{}) (string, error) {
 	if config.Format == "toml" {
-		return formatCodexConfig(config, servers)
+		return formatTOMLConfig(config, servers), nil
 	}
 
 	if config.Format == "jsonc" {
 		return formatJSONCConfig(config, servers)
 	}
 
+	if config.Format == "yaml" {
+		return formatYAMLConfig(config, servers)
+	}
+
 	switch config.Name {
 	case "gemini":
-		return formatGeminiConfig(config, servers)
+		return formatGeminiConfig(config, servers), nil
 	default:
-		return formatJSONConfig(config, servers)
+		return formatJSONConfig(config, servers), nil
 	}
 }
 
@@ -280,135 +523,135 @@ func formatJSONConfig(cfg AgentConfig, servers map[string]interface{}) string {
 }
 
 // formatJSONCConfig formats servers as JSONC (JSON with Comments).
-// It reads existing JSONC files (which may contain comments), strips the comments,
-// merges the MCP servers, and writes back standard JSON.
-func formatJSONCConfig(cfg AgentConfig, servers map[string]interface{}) string {
+// It replaces the node in the existing file in place, keeping comments,
+// trailing commas, and key order outside the MCP servers node.
+func formatJSONCConfig(cfg AgentConfig, servers map[string]interface{}) (string, error) {
 	// If no node name is provided, just render servers as the full file.
 	if cfg.NodeName == "" {
-		return formatToJSON("", servers)
+		return formatToJSON("", servers), nil
 	}
 
-	var existing map[string]interface{}
-	if data, err := os.ReadFile(cfg.FilePath); err == nil {
-		// Use jsonc.ToJSON to strip comments from JSONC files
-		jsonData := jsonc.ToJSON(data)
-		if err := json.Unmarshal(jsonData, &existing); err != nil {
-			// If existing file can't be parsed, log a warning and fall back
-			// to an empty object so we can write a sane JSON file.
-			log.Printf("warning: failed to parse existing JSONC %q: %v; overwriting mcp node", cfg.FilePath, err)
-			existing = make(map[string]interface{})
-		}
-	}
-	if existing == nil {
-		existing = make(map[string]interface{})
+	data, _ := os.ReadFile(cfg.FilePath)
+	doc, err := jsoncdoc.Parse(data)
+	if err != nil {
+		// If existing file can't be parsed, log a warning and fall back
+		// to an empty document so we can write a sane JSON file.
+		log.Printf("warning: failed to parse existing JSONC %q: %v; overwriting mcp node", cfg.FilePath, err)
+		doc, _ = jsoncdoc.Parse(nil)
 	}
 
-	existing[cfg.NodeName] = servers
-	data, err := json.MarshalIndent(existing, "", "  ")
+	// Only the bytes of the node are rewritten so comments and formatting
+	// elsewhere in the file survive the sync.
+	out, err := doc.Set([]string{cfg.NodeName}, servers)
 	if err != nil {
-		return ""
+		return "", fmt.Errorf("failed to update JSONC %s: %w", cfg.FilePath, err)
 	}
-	return string(data)
+	return string(out), nil
 }
 
-// formatToTOML converts servers to Codex TOML format
-func formatToTOML(servers map[string]interface{}) string {
-	var sb strings.Builder
-
-	// Sort server names for consistent output
-	names := make([]string, 0, len(servers))
-	for name := range servers {
-		names = append(names, name)
+// formatYAMLConfig merges the servers into an existing YAML file under
+// cfg.NodeName. The document is edited as a node tree so comments and key
+// order outside the servers node are preserved. Without a NodeName the
+// servers are the whole document, so the file holds nothing else.
+func formatYAMLConfig(cfg AgentConfig, servers map[string]interface{}) (string, error) {
+	var valueNode yaml.Node
+	if err := valueNode.Encode(servers); err != nil {
+		return "", fmt.Errorf("failed to encode YAML for %s: %w", cfg.FilePath, err)
 	}
-	sort.Strings(names)
 
-	for _, name := range names {
-		serverData, ok := servers[name].(map[string]interface{})
-		if !ok {
-			continue
+	if cfg.NodeName == "" {
+		data, err := yaml.Marshal(&valueNode)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode YAML for %s: %w", cfg.FilePath, err)
 		}
-
-		formatServerToTOML(&sb, "mcp_servers."+name, serverData)
+		return string(data), nil
 	}
 
-	return strings.TrimRight(sb.String(), "\n")
-}
-
-// formatServerToTOML recursively formats a server and its nested sections to TOML
-func formatServerToTOML(sb *strings.Builder, sectionPath string, data map[string]interface{}) {
-	// Separate nested maps from simple values
-	simpleValues := make(map[string]interface{})
-	nestedMaps := make(map[string]map[string]interface{})
+	var root yaml.Node
+	if data, err := os.ReadFile(cfg.FilePath); err == nil {
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			log.Printf("warning: failed to parse existing YAML %q: %v; overwriting mcp node", cfg.FilePath, err)
+			root = yaml.Node{}
+		}
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		root = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
 
-	for k, v := range data {
-		if nested, ok := v.(map[string]interface{}); ok {
-			nestedMaps[k] = nested
-		} else {
-			simpleValues[k] = v
-		}
-	}
-
-	// Write the section header and simple values only when there are simple
-	// values to emit. Intermediate sections that contain only nested maps (e.g.
-	// [mcp_servers.foo.tools]) are skipped so that the output only shows leaf
-	// sections such as [mcp_servers.foo.tools.my_tool].
-	if len(simpleValues) > 0 || len(nestedMaps) == 0 {
-		sb.WriteString(fmt.Sprintf("[%s]\n", sectionPath))
-
-		// Sort keys for consistent output
-		keys := make([]string, 0, len(simpleValues))
-		for k := range simpleValues {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-
-		for _, k := range keys {
-			v := simpleValues[k]
-			switch val := v.(type) {
-			case string:
-				sb.WriteString(fmt.Sprintf("%s = \"%s\"\n", k, val))
-			case []interface{}:
-				arr := make([]string, 0, len(val))
-				for _, item := range val {
-					if s, ok := item.(string); ok {
-						arr = append(arr, fmt.Sprintf("\"%s\"", s))
-					}
-				}
-				sb.WriteString(fmt.Sprintf("%s = [%s]\n", k, strings.Join(arr, ", ")))
-			case []string:
-				arr := make([]string, 0, len(val))
-				for _, s := range val {
-					arr = append(arr, fmt.Sprintf("\"%s\"", s))
-				}
-				sb.WriteString(fmt.Sprintf("%s = [%s]\n", k, strings.Join(arr, ", ")))
-			default:
-				sb.WriteString(fmt.Sprintf("%s = %v\n", k, val))
-			}
+	doc := root.Content[0]
+	replaced := false
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == cfg.NodeName {
+			doc.Content[i+1] = &valueNode
+			replaced = true
+			break
 		}
-		sb.WriteString("\n")
+	}
+	if !replaced {
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: cfg.NodeName},
+			&valueNode,
+		)
 	}
 
-	// Sort nested map keys for consistent output
-	nestedKeys := make([]string, 0, len(nestedMaps))
-	for k := range nestedMaps {
-		nestedKeys = append(nestedKeys, k)
+	data, err := yaml.Marshal(&root)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode YAML for %s: %w", cfg.FilePath, err)
 	}
-	sort.Strings(nestedKeys)
+	return string(data), nil
+}
+
+// defaultTOMLRoot is the table that holds servers in Codex config.toml.
+const defaultTOMLRoot = "mcp_servers"
 
-	// Recursively format nested maps as separate sections
-	for _, k := range nestedKeys {
-		formatServerToTOML(sb, sectionPath+"."+k, nestedMaps[k])
+// tomlRoot returns the table name servers are written under for a TOML agent:
+// the agent's NodeName, which custom TOML agents must set, or Codex's
+// mcp_servers.
+func tomlRoot(cfg AgentConfig) string {
+	if cfg.NodeName != "" {
+		return cfg.NodeName
 	}
+	return defaultTOMLRoot
+}
+
+// formatTOMLTables renders servers as [<root>.<name>] tables.
+func formatTOMLTables(root string, servers map[string]interface{}) string {
+	return tomldoc.EncodeTables(strings.Split(root, "."), servers)
 }
 
-func formatCodexConfig(cfg AgentConfig, servers map[string]interface{}) string {
-	var existing string
+// formatTOMLConfig replaces the servers table in the existing TOML file and
+// keeps every other table, key, and comment byte-for-byte.
+func formatTOMLConfig(cfg AgentConfig, servers map[string]interface{}) string {
+	root := tomlRoot(cfg)
+	newSections := formatTOMLTables(root, servers)
+
+	var existing []byte
 	if data, err := os.ReadFile(cfg.FilePath); err == nil {
-		existing = string(data)
+		existing = data
+	}
+	if strings.TrimSpace(string(existing)) == "" {
+		if newSections == "" {
+			return ""
+		}
+		return newSections + "\n"
+	}
+
+	doc, err := tomldoc.Parse(existing)
+	if err != nil {
+		log.Printf("warning: failed to parse existing TOML %q: %v; rewriting %s sections line by line", cfg.FilePath, err, root)
+		return formatTOMLConfigByLines(string(existing), root, newSections)
 	}
+	return string(doc.ReplaceTable(strings.Split(root, "."), newSections))
+}
 
-	preserved := strings.TrimRight(stripMCPServersSections(existing), "\r\n")
-	newSections := strings.TrimRight(formatToTOML(servers), "\r\n")
+// formatTOMLConfigByLines is the fallback for files the TOML parser rejects:
+// it drops [<root>.*] sections line by line and appends the new sections.
+func formatTOMLConfigByLines(existing, root, newSections string) string {
+	preserved := strings.TrimRight(stripTOMLSectionLines(existing, root), "\r\n")
+	newSections = strings.TrimRight(newSections, "\r\n")
 
 	var parts []string
 	if preserved != "" {
@@ -425,7 +668,8 @@ func formatCodexConfig(cfg AgentConfig, servers map[string]interface{}) string {
 	return strings.Join(parts, "\n\n") + "\n"
 }
 
-func stripMCPServersSections(content string) string {
+// stripTOMLSectionLines removes [<root>.*] tables with a line-based scan.
+func stripTOMLSectionLines(content, root string) string {
 	if strings.TrimSpace(content) == "" {
 		return ""
 	}
@@ -437,7 +681,7 @@ func stripMCPServersSections(content string) string {
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
 		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
-			if strings.HasPrefix(trimmed, "[mcp_servers.") {
+			if strings.HasPrefix(trimmed, "["+root+".") {
 				insideMCP = true
 				continue
 			}
@@ -480,20 +724,41 @@ func dedupeTargets(targets []AgentTarget) []AgentTarget {
 		if len(disabled) > 1 {
 			sort.Strings(disabled)
 		}
-		key := name + "|" + strings.TrimSpace(target.PathOverride) + "|" + strings.Join(disabled, ",")
+		strategy := normalizeMergeStrategy(target.MergeStrategy)
+		includeTags := trimmedList(target.IncludeTags)
+		excludeTags := trimmedList(target.ExcludeTags)
+		key := name + "|" + strings.TrimSpace(target.PathOverride) + "|" + strings.Join(disabled, ",") + "|" + strategy +
+			"|" + strings.Join(includeTags, ",") + "|" + strings.Join(excludeTags, ",") + "|" + strings.TrimSpace(target.Profile) +
+			"|" + strings.ToLower(strings.TrimSpace(target.Secrets))
 		if _, exists := seen[key]; exists {
 			continue
 		}
 		seen[key] = struct{}{}
 		out = append(out, AgentTarget{
-			Name:         name,
-			PathOverride: strings.TrimSpace(target.PathOverride),
+			Name:               name,
+			PathOverride:       strings.TrimSpace(target.PathOverride),
 			DisabledMcpServers: disabled,
+			MergeStrategy:      strategy,
+			IncludeTags:        includeTags,
+			ExcludeTags:        excludeTags,
+			Profile:            strings.TrimSpace(target.Profile),
+			Secrets:            strings.ToLower(strings.TrimSpace(target.Secrets)),
 		})
 	}
 	return out
 }
 
+// trimmedList returns the non-empty entries of values, trimmed.
+func trimmedList(values []string) []string {
+	var out []string
+	for _, value := range values {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
+
 func applyOverride(overridePath, defaultPath string) string {
 	if trimmed := strings.TrimSpace(overridePath); trimmed != "" {
 		return trimmed
@@ -1,11 +1,17 @@
 package syncer
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"agent-align/internal/mcpconfig"
+	"agent-align/internal/transforms"
+	"github.com/tidwall/jsonc"
 )
 
 func TestSyncerSync(t *testing.T) {
@@ -116,7 +122,7 @@ font_size = 12
 		},
 	}
 	cfg := AgentConfig{Name: "codex", FilePath: path, Format: "toml"}
-	result := formatCodexConfig(cfg, servers)
+	result := formatTOMLConfig(cfg, servers)
 
 	if !strings.Contains(result, "[general]") {
 		t.Fatal("general section should remain in output")
@@ -156,7 +162,10 @@ func TestFormatGeminiConfigPreservesExistingSettings(t *testing.T) {
 		},
 	}
 	cfg := AgentConfig{Name: "gemini", FilePath: path, NodeName: "mcpServers", Format: "json"}
-	result := formatConfig(cfg, servers)
+	result, err := formatConfig(cfg, servers)
+	if err != nil {
+		t.Fatalf("formatConfig returned error: %v", err)
+	}
 
 	var parsed map[string]interface{}
 	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
@@ -203,7 +212,10 @@ func TestFormatClaudeConfigPreservesExistingSettings(t *testing.T) {
 		},
 	}
 	cfg := AgentConfig{Name: "claudecode", FilePath: path, NodeName: "mcpServers", Format: "json"}
-	result := formatConfig(cfg, servers)
+	result, err := formatConfig(cfg, servers)
+	if err != nil {
+		t.Fatalf("formatConfig returned error: %v", err)
+	}
 
 	var parsed map[string]interface{}
 	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
@@ -235,7 +247,10 @@ func TestFormatGeminiConfigWithoutExistingFile(t *testing.T) {
 		},
 	}
 	cfg := AgentConfig{Name: "gemini", FilePath: path, NodeName: "mcpServers", Format: "json"}
-	result := formatConfig(cfg, servers)
+	result, err := formatConfig(cfg, servers)
+	if err != nil {
+		t.Fatalf("formatConfig returned error: %v", err)
+	}
 
 	var parsed map[string]interface{}
 	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
@@ -432,7 +447,10 @@ func TestFormatOpenCodeConfigPreservesExistingSettings(t *testing.T) {
 		},
 	}
 	cfg := AgentConfig{Name: "opencode", FilePath: path, NodeName: "mcp", Format: "jsonc"}
-	result := formatConfig(cfg, servers)
+	result, err := formatConfig(cfg, servers)
+	if err != nil {
+		t.Fatalf("formatConfig returned error: %v", err)
+	}
 
 	var parsed map[string]interface{}
 	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
@@ -468,7 +486,7 @@ func TestFormatOpenCodeConfigPreservesExistingSettings(t *testing.T) {
 func TestFormatOpenCodeConfigWithComments(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "opencode.jsonc")
-	// JSONC file with comments that should be stripped when parsing
+	// JSONC file with comments that should survive the rewrite
 	existing := `{
   // Theme configuration
   "theme": "dark",
@@ -495,11 +513,14 @@ func TestFormatOpenCodeConfigWithComments(t *testing.T) {
 		},
 	}
 	cfg := AgentConfig{Name: "opencode", FilePath: path, NodeName: "mcp", Format: "jsonc"}
-	result := formatConfig(cfg, servers)
+	result, err := formatConfig(cfg, servers)
+	if err != nil {
+		t.Fatalf("formatConfig returned error: %v", err)
+	}
 
 	var parsed map[string]interface{}
-	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
-		t.Fatalf("result not valid JSON: %v", err)
+	if err := json.Unmarshal(jsonc.ToJSON([]byte(result)), &parsed); err != nil {
+		t.Fatalf("result not valid JSONC: %v", err)
 	}
 
 	// Theme should be preserved
@@ -532,4 +553,400 @@ func TestFormatOpenCodeConfigWithComments(t *testing.T) {
 	if _, ok := mcp["old-server"]; ok {
 		t.Fatal("old-server should have been replaced")
 	}
+
+	// Comments and formatting outside the mcp node should be untouched
+	for _, want := range []string{
+		"  // Theme configuration\n  \"theme\": \"dark\",",
+		"  /* Editor settings for\n     the OpenCode editor */",
+		"    \"tabSize\": 2 // Number of spaces per tab",
+		"  // MCP server configuration\n  \"mcp\": {\n    \"new-server\": {",
+	} {
+		if !strings.Contains(result, want) {
+			t.Fatalf("expected %q in output:\n%s", want, result)
+		}
+	}
+}
+
+func TestRegistryCustomJSONAgent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cursor.json")
+	if err := os.WriteFile(path, []byte(`{"theme": "dark"}`), 0o644); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	registry, err := NewRegistry([]CustomAgent{{
+		Name:     "cursor",
+		Path:     path,
+		Format:   "json",
+		NodeName: "mcpServers",
+		Rules: transforms.FieldRules{
+			Rename: map[string]string{"env": "environment"},
+			Drop:   []string{"alwaysAllow"},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("NewRegistry returned error: %v", err)
+	}
+
+	agents := registry.Agents()
+	if agents[len(agents)-1] != "cursor" {
+		t.Fatalf("expected custom agent in the registry, got %v", agents)
+	}
+	if len(SupportedAgents()) != len(agents)-1 {
+		t.Fatalf("expected SupportedAgents to list only built-in agents, got %v", SupportedAgents())
+	}
+	if _, err := GetAgentConfig("cursor", ""); err == nil {
+		t.Fatal("expected custom agents to be unknown outside the registry")
+	}
+
+	servers := map[string]interface{}{
+		"local": map[string]interface{}{
+			"command":     "npx",
+			"env":         map[string]interface{}{"KEY": "value"},
+			"alwaysAllow": []interface{}{"search"},
+		},
+	}
+	s := New([]AgentTarget{{Name: "cursor"}})
+	s.Registry = registry
+	result, err := s.Sync(servers)
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+
+	out := result.Agents["cursor"][0]
+	if out.Config.FilePath != path || out.Config.Format != "json" {
+		t.Fatalf("unexpected config: %#v", out.Config)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(out.Content), &parsed); err != nil {
+		t.Fatalf("output not valid JSON: %v", err)
+	}
+	if parsed["theme"] != "dark" {
+		t.Fatalf("existing settings should be preserved: %v", parsed)
+	}
+	local := parsed["mcpServers"].(map[string]interface{})["local"].(map[string]interface{})
+	if _, ok := local["environment"]; !ok {
+		t.Fatalf("expected env renamed: %v", local)
+	}
+	if _, ok := local["alwaysAllow"]; ok {
+		t.Fatalf("expected alwaysAllow dropped: %v", local)
+	}
+}
+
+func TestNewRegistryRejectsBuiltinNames(t *testing.T) {
+	_, err := NewRegistry([]CustomAgent{{Name: "codex", Path: "/tmp/x", Format: "toml", NodeName: "servers"}})
+	if err == nil || !strings.Contains(err.Error(), "built-in") {
+		t.Fatalf("expected built-in conflict, got %v", err)
+	}
+}
+
+func TestRegistryCustomTOMLAgent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.toml")
+	if err := os.WriteFile(path, []byte("# agent settings\nmodel = \"x\"\n"), 0o644); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+	registry, err := NewRegistry([]CustomAgent{{Name: "tool", Path: path, Format: "toml", NodeName: "tools.mcp"}})
+	if err != nil {
+		t.Fatalf("NewRegistry returned error: %v", err)
+	}
+	s := New([]AgentTarget{{Name: "tool"}})
+	s.Registry = registry
+	result, err := s.Sync(map[string]interface{}{
+		"web": map[string]interface{}{"url": "https://example.test/mcp", "toolTimeoutSec": 30},
+	})
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	content := result.Agents["tool"][0].Content
+	for _, want := range []string{"# agent settings", "[tools.mcp.web]", "toolTimeoutSec = 30"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("expected %q in output:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "tool_timeout_sec") || strings.Contains(content, "mcp_servers") {
+		t.Fatalf("expected no Codex conversions for a custom agent:\n%s", content)
+	}
+}
+
+func TestFormatYAMLConfigPreservesComments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.yml")
+	existing := `# editor settings
+theme: dark # keep me
+servers:
+  old:
+    command: node
+`
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	servers := map[string]interface{}{
+		"new": map[string]interface{}{"command": "npx"},
+	}
+	cfg := AgentConfig{Name: "custom", FilePath: path, NodeName: "servers", Format: "yaml"}
+	result, err := formatConfig(cfg, servers)
+	if err != nil {
+		t.Fatalf("formatConfig returned error: %v", err)
+	}
+
+	if !strings.Contains(result, "# editor settings") || !strings.Contains(result, "# keep me") {
+		t.Fatalf("comments should be preserved, got:\n%s", result)
+	}
+	if strings.Contains(result, "old:") {
+		t.Fatalf("old servers should be replaced, got:\n%s", result)
+	}
+	if !strings.Contains(result, "new:") || !strings.Contains(result, "command: npx") {
+		t.Fatalf("new servers missing, got:\n%s", result)
+	}
+}
+
+func TestFormatTOMLConfigCustomRoot(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.toml")
+	existing := "[general]\nname = \"x\"\n\n[servers.old]\ncommand = \"node\"\n"
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	servers := map[string]interface{}{
+		"new": map[string]interface{}{"command": "npx"},
+	}
+	cfg := AgentConfig{Name: "custom", FilePath: path, NodeName: "servers", Format: "toml"}
+	result, err := formatConfig(cfg, servers)
+	if err != nil {
+		t.Fatalf("formatConfig returned error: %v", err)
+	}
+
+	if !strings.Contains(result, "[general]") || strings.Contains(result, "[servers.old]") {
+		t.Fatalf("unexpected preserved content:\n%s", result)
+	}
+	if !strings.Contains(result, "[servers.new]") {
+		t.Fatalf("expected custom root table, got:\n%s", result)
+	}
+}
+
+func TestFormatCodexConfigKeepsCommentsAndEscapesValues(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	existing := `model = "o3"
+mcp_servers.legacy = { command = "node" }
+
+# notifications for the TUI
+[tui]
+notifications = true
+
+[mcp_servers.old]
+command = "node"
+
+# trailing profile comment
+[profiles.work]
+model = "gpt"
+`
+	if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+		t.Fatalf("failed to write existing config: %v", err)
+	}
+
+	servers := map[string]interface{}{
+		"new": map[string]interface{}{
+			"command": `C:\bin\tool "x"`,
+			"args":    []interface{}{"--port", float64(8080), true},
+		},
+	}
+	cfg := AgentConfig{Name: "codex", FilePath: path, Format: "toml"}
+	result := formatTOMLConfig(cfg, servers)
+
+	for _, want := range []string{
+		"# notifications for the TUI\n[tui]\nnotifications = true\n",
+		"# trailing profile comment\n[profiles.work]\nmodel = \"gpt\"\n",
+		`command = "C:\\bin\\tool \"x\""`,
+		`args = ["--port", 8080, true]`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Fatalf("expected %q in output:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "legacy") || strings.Contains(result, "[mcp_servers.old]") {
+		t.Fatalf("old MCP definitions should be removed:\n%s", result)
+	}
+}
+
+func TestSyncAppliesServerTargetingAndTags(t *testing.T) {
+	dir := t.TempDir()
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{"command": "gh-mcp"},
+		"fs":     map[string]interface{}{"command": "fs-mcp"},
+		"jira":   map[string]interface{}{"command": "jira-mcp"},
+	}
+	s := New([]AgentTarget{
+		{Name: "claudecode", PathOverride: filepath.Join(dir, "claude.json")},
+		{Name: "gemini", PathOverride: filepath.Join(dir, "gemini.json"), ExcludeTags: []string{"Work"}},
+		{Name: "vscode", PathOverride: filepath.Join(dir, "vscode.json"), IncludeTags: []string{"work"}},
+	})
+	s.Targeting = map[string]mcpconfig.Targeting{
+		"github": {Agents: []string{"claudecode", "vscode"}},
+		"fs":     {ExcludeAgents: []string{"claudecode"}},
+		"jira":   {Tags: []string{"work"}},
+	}
+
+	result, err := s.Sync(servers)
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+
+	want := map[string][]string{
+		"claudecode": {"github", "jira"},
+		"gemini":     {"fs"},
+		"vscode":     {"jira"},
+	}
+	for agent, names := range want {
+		if got := result.Agents[agent][0].Managed; strings.Join(got, ",") != strings.Join(names, ",") {
+			t.Fatalf("expected %s to receive %v, got %v", agent, names, got)
+		}
+	}
+	if _, ok := servers["fs"]; !ok {
+		t.Fatal("targeting must not modify the shared server map")
+	}
+}
+
+func TestSyncSecretsPassthroughUsesUnexpandedServers(t *testing.T) {
+	dir := t.TempDir()
+	raw := map[string]interface{}{
+		"api": map[string]interface{}{"command": "npx", "env": map[string]interface{}{"API_KEY": "${API_KEY}"}},
+	}
+	expanded := map[string]interface{}{
+		"api": map[string]interface{}{"command": "npx", "env": map[string]interface{}{"API_KEY": "secret"}},
+	}
+	s := New([]AgentTarget{
+		{Name: "claudecode", PathOverride: filepath.Join(dir, "claude.json"), Secrets: SecretsPassthrough},
+		{Name: "vscode", PathOverride: filepath.Join(dir, "vscode.json")},
+	})
+	s.Unexpanded = raw
+
+	result, err := s.Sync(expanded)
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	claude := result.Agents["claudecode"][0].Content
+	if !strings.Contains(claude, `"API_KEY": "${API_KEY}"`) || strings.Contains(claude, "secret") {
+		t.Fatalf("expected reference to be kept for claudecode:\n%s", claude)
+	}
+	if vscode := result.Agents["vscode"][0].Content; !strings.Contains(vscode, `"API_KEY": "secret"`) {
+		t.Fatalf("expected expanded value for vscode:\n%s", vscode)
+	}
+	if raw["api"].(map[string]interface{})["env"].(map[string]interface{})["API_KEY"] != "${API_KEY}" {
+		t.Fatal("passthrough must not modify the unexpanded servers")
+	}
+}
+
+func TestSyncSecretsPassthroughKeepsProviderValuesWithDollarSigns(t *testing.T) {
+	dir := t.TempDir()
+	resolver := &mcpconfig.Resolver{Providers: map[string]mcpconfig.Provider{
+		"test": mcpconfig.ProviderFunc(func(ctx context.Context, argument string) (string, error) {
+			return "pa$$word${x}", nil
+		}),
+	}}
+	defs := map[string]interface{}{
+		"api": map[string]interface{}{"command": "npx", "env": map[string]interface{}{"API_KEY": "${test:key}", "USER": "${USER}"}},
+	}
+	raw, err := resolver.ResolveProviders(defs)
+	if err != nil {
+		t.Fatalf("ResolveProviders returned error: %v", err)
+	}
+	expanded, err := resolver.ExpandServers(defs)
+	if err != nil {
+		t.Fatalf("ExpandServers returned error: %v", err)
+	}
+	s := New([]AgentTarget{
+		{Name: "claudecode", PathOverride: filepath.Join(dir, "claude.json"), Secrets: SecretsPassthrough},
+		{Name: "codex", PathOverride: filepath.Join(dir, "config.toml"), Secrets: SecretsPassthrough},
+		{Name: "copilot", PathOverride: filepath.Join(dir, "copilot.json"), Secrets: SecretsPassthrough},
+	})
+	s.Unexpanded = raw
+
+	result, err := s.Sync(expanded)
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	for _, agent := range []string{"claudecode", "codex", "copilot"} {
+		content := result.Agents[agent][0].Content
+		if !strings.Contains(content, `API_KEY = "pa$$word${x}"`) && !strings.Contains(content, `"API_KEY": "pa$$word${x}"`) {
+			t.Fatalf("expected the provider value to be written as resolved for %s:\n%s", agent, content)
+		}
+	}
+	if claude := result.Agents["claudecode"][0].Content; !strings.Contains(claude, `"USER": "${USER}"`) {
+		t.Fatalf("expected the environment reference to be kept for claudecode:\n%s", claude)
+	}
+}
+
+func TestSyncKeepsRenderingAfterATargetFails(t *testing.T) {
+	dir := t.TempDir()
+	servers := map[string]interface{}{
+		"remote": map[string]interface{}{"type": "http"},
+		"fs":     map[string]interface{}{"command": "npx"},
+	}
+	s := New([]AgentTarget{
+		{Name: "copilot", PathOverride: filepath.Join(dir, "copilot.json")},
+		{Name: "codex", PathOverride: filepath.Join(dir, "config.toml")},
+		{Name: "nosuchagent"},
+	})
+
+	result, err := s.Sync(servers)
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if len(result.Targets) != 3 || len(result.Agents) != 1 || len(result.Agents["codex"]) != 1 {
+		t.Fatalf("expected only codex to render, got targets %+v agents %v", result.Targets, result.Agents)
+	}
+	failed := result.Failed()
+	if len(failed) != 2 || failed[0].Agent != "copilot" || failed[1].Agent != "nosuchagent" {
+		t.Fatalf("unexpected failures: %+v", failed)
+	}
+	want := []transforms.Diagnostic{{
+		Severity: transforms.SeverityError,
+		Kind:     transforms.KindInvalid,
+		Agent:    "copilot",
+		Server:   "remote",
+		Field:    "url",
+		Message:  "network-based servers must have both 'type' and 'url' fields",
+	}}
+	if !reflect.DeepEqual(failed[0].Diagnostics, want) {
+		t.Fatalf("unexpected diagnostics: %+v", failed[0].Diagnostics)
+	}
+}
+
+func TestSyncFailOnLossyFailsTargetsThatLoseConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	servers := map[string]interface{}{
+		"fs": map[string]interface{}{"command": "npx", "disabled": true},
+	}
+	targets := []AgentTarget{
+		{Name: "gemini", PathOverride: filepath.Join(dir, "settings.json")},
+		{Name: "vscode", PathOverride: filepath.Join(dir, "mcp.json")},
+	}
+
+	result, err := New(targets).Sync(servers)
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	if len(result.Failed()) != 0 || len(result.Agents["gemini"]) != 1 {
+		t.Fatalf("expected gemini to render with a warning, got %+v", result.Targets)
+	}
+	if diags := result.Targets[0].Diagnostics; len(diags) != 1 || diags[0].Kind != transforms.KindLossy || diags[0].Severity != transforms.SeverityWarning {
+		t.Fatalf("expected a lossy warning, got %+v", diags)
+	}
+
+	s := New(targets)
+	s.FailOnLossy = true
+	result, err = s.Sync(servers)
+	if err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+	failed := result.Failed()
+	if len(failed) != 1 || failed[0].Agent != "gemini" || len(result.Agents["vscode"]) != 1 {
+		t.Fatalf("expected only gemini to fail, got %+v", result.Targets)
+	}
+	if !strings.Contains(failed[0].Err.Error(), `server "fs" field "disabled"`) || failed[0].Diagnostics[0].Severity != transforms.SeverityError {
+		t.Fatalf("unexpected failure: %+v", failed[0])
+	}
 }
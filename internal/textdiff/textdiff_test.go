@@ -0,0 +1,102 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedEqual(t *testing.T) {
+	if out := Unified("a", "b", "same\n", "same\n", DefaultContext); out != "" {
+		t.Fatalf("expected no diff, got:\n%s", out)
+	}
+}
+
+func TestUnifiedSingleChange(t *testing.T) {
+	old := "one\ntwo\nthree\nfour\nfive\nsix\nseven\n"
+	new := "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\n"
+	want := `--- old
++++ new
+@@ -1,7 +1,7 @@
+ one
+ two
+ three
+-four
++FOUR
+ five
+ six
+ seven
+`
+	if out := Unified("old", "new", old, new, DefaultContext); out != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 1; i <= 20; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("line %d", i))
+		newLines = append(newLines, fmt.Sprintf("line %d", i))
+	}
+	newLines[1] = "changed 2"
+	newLines = append(newLines[:15], newLines[16:]...) // drop line 16
+	out := Unified("old", "new", strings.Join(oldLines, "\n")+"\n", strings.Join(newLines, "\n")+"\n", 1)
+
+	want := `--- old
++++ new
+@@ -1,3 +1,3 @@
+ line 1
+-line 2
++changed 2
+ line 3
+@@ -15,3 +15,2 @@
+ line 15
+-line 16
+ line 17
+`
+	if out != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestUnifiedNewFileAndMissingNewline(t *testing.T) {
+	out := Unified("/dev/null", "new", "", "a\nb", DefaultContext)
+	want := "--- /dev/null\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n\\ No newline at end of file\n"
+	if out != want {
+		t.Fatalf("unexpected diff:\n%q\nwant:\n%q", out, want)
+	}
+
+	out = Unified("old", "new", "a\n", "a", DefaultContext)
+	want = "--- old\n+++ new\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n"
+	if out != want {
+		t.Fatalf("unexpected diff:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+	ops := diffLines(a, b)
+
+	var edits int
+	var gotA, gotB []string
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			gotA = append(gotA, o.line)
+			gotB = append(gotB, o.line)
+		case opDelete:
+			edits++
+			gotA = append(gotA, o.line)
+		case opInsert:
+			edits++
+			gotB = append(gotB, o.line)
+		}
+	}
+	if strings.Join(gotA, " ") != strings.Join(a, " ") || strings.Join(gotB, " ") != strings.Join(b, " ") {
+		t.Fatalf("edit script does not reproduce inputs: %v", ops)
+	}
+	if edits != 5 {
+		t.Fatalf("expected 5 edits, got %d: %v", edits, ops)
+	}
+}
@@ -0,0 +1,198 @@
+package tomldoc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EncodeTables renders each entry of tables as a [<root>.<name>] section.
+// Nested maps become sub-tables; tables that only contain other tables are
+// omitted so the output only shows leaf sections. Keys are sorted for stable
+// output and nil values are skipped because TOML has no null.
+func EncodeTables(root []string, tables map[string]interface{}) string {
+	var sb strings.Builder
+	for _, name := range sortedKeys(tables) {
+		table, ok := tables[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := append(append([]string(nil), root...), name)
+		encodeTable(&sb, path, table)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func encodeTable(sb *strings.Builder, path []string, data map[string]interface{}) {
+	simple := make(map[string]interface{})
+	nested := make(map[string]map[string]interface{})
+	for k, v := range data {
+		switch val := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			nested[k] = val
+		case map[string]string:
+			converted := make(map[string]interface{}, len(val))
+			for mk, mv := range val {
+				converted[mk] = mv
+			}
+			nested[k] = converted
+		default:
+			simple[k] = v
+		}
+	}
+
+	if len(simple) > 0 || len(nested) == 0 {
+		sb.WriteString("[" + FormatKey(path...) + "]\n")
+		for _, k := range sortedKeys(simple) {
+			sb.WriteString(FormatKey(k) + " = " + EncodeValue(simple[k]) + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	names := make([]string, 0, len(nested))
+	for k := range nested {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		encodeTable(sb, append(append([]string(nil), path...), k), nested[k])
+	}
+}
+
+// FormatKey renders a dotted key, quoting segments that are not bare keys.
+func FormatKey(path ...string) string {
+	parts := make([]string, len(path))
+	for i, segment := range path {
+		if isBareKey(segment) {
+			parts[i] = segment
+		} else {
+			parts[i] = quoteString(segment)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isBareKeyChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// EncodeValue renders a single TOML value. Maps are rendered as inline
+// tables, which is how tables are written inside arrays.
+func EncodeValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return quoteString(val)
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	case int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", val)
+	case float32:
+		return formatFloat(float64(val))
+	case float64:
+		return formatFloat(val)
+	case []string:
+		items := make([]string, len(val))
+		for i, s := range val {
+			items[i] = quoteString(s)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case []interface{}:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			if item == nil {
+				continue
+			}
+			items = append(items, EncodeValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]string:
+		converted := make(map[string]interface{}, len(val))
+		for k, s := range val {
+			converted[k] = s
+		}
+		return EncodeValue(converted)
+	case map[string]interface{}:
+		items := make([]string, 0, len(val))
+		for _, k := range sortedKeys(val) {
+			if val[k] == nil {
+				continue
+			}
+			items = append(items, FormatKey(k)+" = "+EncodeValue(val[k]))
+		}
+		if len(items) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(items, ", ") + " }"
+	default:
+		return quoteString(fmt.Sprintf("%v", val))
+	}
+}
+
+// formatFloat renders whole numbers as integers because JSON round trips turn
+// every number into a float64.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == math.Trunc(f) && math.Abs(f) < 1<<53:
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,494 @@
+package tomldoc
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parser is a cursor over the raw document bytes.
+type parser struct {
+	src  []byte
+	pos  int
+	line int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("toml: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.src[p.pos:]), s)
+}
+
+func (p *parser) atNewline() bool {
+	return p.peek() == '\n' || p.hasPrefix("\r\n")
+}
+
+func (p *parser) consumeNewline() {
+	if p.peek() == '\r' {
+		p.pos++
+	}
+	if p.peek() == '\n' {
+		p.pos++
+		p.line++
+	}
+}
+
+func (p *parser) skipWhitespace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines, and comments inside arrays and
+// inline tables.
+func (p *parser) skipBlank() {
+	for !p.eof() {
+		switch {
+		case p.peek() == ' ' || p.peek() == '\t':
+			p.pos++
+		case p.atNewline():
+			p.consumeNewline()
+		case p.peek() == '#':
+			for !p.eof() && !p.atNewline() {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// finishLine consumes optional trailing whitespace and a comment followed by
+// the end of the line.
+func (p *parser) finishLine() error {
+	p.skipWhitespace()
+	if p.peek() == '#' {
+		for !p.eof() && !p.atNewline() {
+			p.pos++
+		}
+	}
+	if !p.eof() && !p.atNewline() {
+		return p.errorf("unexpected %q after value", p.peek())
+	}
+	p.consumeNewline()
+	return nil
+}
+
+func (p *parser) parseKeyValue() ([]string, interface{}, error) {
+	key, err := p.parseKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.skipWhitespace()
+	if err := p.expect('='); err != nil {
+		return nil, nil, err
+	}
+	p.skipWhitespace()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+// parseKey reads a bare, quoted, or dotted key.
+func (p *parser) parseKey() ([]string, error) {
+	var parts []string
+	for {
+		p.skipWhitespace()
+		var part string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		case c == '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		case isBareKeyChar(c):
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			part = string(p.src[start:p.pos])
+		default:
+			return nil, p.errorf("invalid key")
+		}
+		parts = append(parts, part)
+		p.skipWhitespace()
+		if p.peek() != '.' {
+			return parts, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func (p *parser) parseValue() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		if p.hasPrefix(`"""`) {
+			return p.parseMultilineBasicString()
+		}
+		return p.parseBasicString()
+	case c == '\'':
+		if p.hasPrefix(`'''`) {
+			return p.parseMultilineLiteralString()
+		}
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	case p.hasPrefix("true") && !isBareKeyChar(p.byteAt(p.pos+4)):
+		p.pos += 4
+		return true, nil
+	case p.hasPrefix("false") && !isBareKeyChar(p.byteAt(p.pos+5)):
+		p.pos += 5
+		return false, nil
+	case c == 0:
+		return nil, p.errorf("missing value")
+	default:
+		return p.parseScalar()
+	}
+}
+
+func (p *parser) byteAt(i int) byte {
+	if i >= len(p.src) {
+		return 0
+	}
+	return p.src[i]
+}
+
+func (p *parser) parseBasicString() (string, error) {
+	p.pos++ // opening quote
+	var sb strings.Builder
+	for {
+		if p.eof() || p.atNewline() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return sb.String(), nil
+		case '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *parser) parseMultilineBasicString() (string, error) {
+	p.pos += 3
+	if p.atNewline() {
+		p.consumeNewline()
+	}
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated multi-line string")
+		}
+		if p.hasPrefix(`"""`) {
+			n := p.countRun('"')
+			if n > 5 {
+				return "", p.errorf("too many quotes closing multi-line string")
+			}
+			sb.WriteString(strings.Repeat(`"`, n-3))
+			p.pos += n
+			return sb.String(), nil
+		}
+		c := p.peek()
+		switch {
+		case c == '\\' && p.isLineEndingBackslash():
+			p.pos++
+			for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.atNewline()) {
+				if p.atNewline() {
+					p.consumeNewline()
+				} else {
+					p.pos++
+				}
+			}
+		case c == '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		case p.atNewline():
+			if c == '\r' {
+				sb.WriteByte('\r')
+				p.pos++
+			}
+			sb.WriteByte('\n')
+			p.consumeNewline()
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// isLineEndingBackslash reports whether the backslash at the cursor is only
+// followed by whitespace before the end of the line.
+func (p *parser) isLineEndingBackslash() bool {
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case ' ', '\t', '\r':
+			continue
+		case '\n':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func (p *parser) countRun(c byte) int {
+	n := 0
+	for p.byteAt(p.pos+n) == c {
+		n++
+	}
+	return n
+}
+
+func (p *parser) parseEscape(sb *strings.Builder) error {
+	p.pos++ // backslash
+	if p.eof() {
+		return p.errorf("unterminated escape sequence")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'e':
+		sb.WriteByte(0x1b)
+	case '"':
+		sb.WriteByte('"')
+	case '\\':
+		sb.WriteByte('\\')
+	case 'u', 'U':
+		width := 4
+		if c == 'U' {
+			width = 8
+		}
+		if p.pos+width > len(p.src) {
+			return p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(string(p.src[p.pos:p.pos+width]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid unicode escape")
+		}
+		sb.WriteRune(rune(code))
+		p.pos += width
+	default:
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+func (p *parser) parseLiteralString() (string, error) {
+	p.pos++
+	start := p.pos
+	for {
+		if p.eof() || p.atNewline() {
+			return "", p.errorf("unterminated string")
+		}
+		if p.peek() == '\'' {
+			s := string(p.src[start:p.pos])
+			p.pos++
+			return s, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseMultilineLiteralString() (string, error) {
+	p.pos += 3
+	if p.atNewline() {
+		p.consumeNewline()
+	}
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated multi-line string")
+		}
+		if p.hasPrefix(`'''`) {
+			n := p.countRun('\'')
+			if n > 5 {
+				return "", p.errorf("too many quotes closing multi-line string")
+			}
+			sb.WriteString(strings.Repeat(`'`, n-3))
+			p.pos += n
+			return sb.String(), nil
+		}
+		if p.peek() == '\n' {
+			p.line++
+		}
+		sb.WriteByte(p.peek())
+		p.pos++
+	}
+}
+
+func (p *parser) parseArray() ([]interface{}, error) {
+	p.pos++
+	out := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.pos++
+			return out, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return out, nil
+		default:
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *parser) parseInlineTable() (map[string]interface{}, error) {
+	p.pos++
+	out := make(map[string]interface{})
+	b := newBuilder(out)
+	for {
+		p.skipBlank()
+		if p.peek() == '}' {
+			p.pos++
+			return out, nil
+		}
+		key, value, err := p.parseKeyValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := b.set(key, value); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return out, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+// parseScalar reads numbers and date/time literals.
+func (p *parser) parseScalar() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && isScalarChar(p.peek()) {
+		p.pos++
+	}
+	// Offset date-times may use a space instead of 'T' between date and time.
+	if p.pos-start == 10 && p.peek() == ' ' && isDigit(p.byteAt(p.pos+1)) && isDate(string(p.src[start:p.pos])) {
+		p.pos++
+		for !p.eof() && isScalarChar(p.peek()) {
+			p.pos++
+		}
+	}
+	token := string(p.src[start:p.pos])
+	if token == "" {
+		return nil, p.errorf("invalid value")
+	}
+
+	switch strings.TrimLeft(token, "+-") {
+	case "inf":
+		if strings.HasPrefix(token, "-") {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+
+	if isDate(token) || strings.Contains(token, ":") {
+		return token, nil
+	}
+
+	clean := strings.ReplaceAll(token, "_", "")
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(clean, prefix) {
+			n, err := strconv.ParseInt(clean[2:], base, 64)
+			if err != nil {
+				return nil, p.errorf("invalid integer %q", token)
+			}
+			return n, nil
+		}
+	}
+	if n, err := strconv.ParseInt(clean, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(clean, 64); err == nil {
+		return f, nil
+	}
+	return nil, p.errorf("invalid value %q", token)
+}
+
+func isScalarChar(c byte) bool {
+	return isBareKeyChar(c) || c == '+' || c == '.' || c == ':'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isDate(s string) bool {
+	return len(s) >= 10 && isDigit(s[0]) && isDigit(s[3]) && s[4] == '-' && s[7] == '-'
+}
@@ -0,0 +1,341 @@
+// Package tomldoc parses TOML documents into a statement list that can be
+// edited without disturbing the bytes of unrelated tables, keys, and
+// comments. It is used to rewrite the MCP server table of an agent's TOML
+// config while leaving the rest of the user's file untouched.
+package tomldoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+type stmtKind int
+
+const (
+	stmtTrivia stmtKind = iota // blank or comment-only line
+	stmtKeyValue
+	stmtTable
+	stmtArrayTable
+)
+
+// statement is a single logical line of the document. Key-values that span
+// several physical lines (multi-line strings and arrays) are one statement.
+type statement struct {
+	kind    stmtKind
+	start   int      // offset of the first byte of the statement's line
+	end     int      // offset just past the statement's trailing newline
+	key     []string // header path, or key path relative to table
+	table   []string // table in effect for key-values
+	comment bool     // trivia line that holds a comment
+}
+
+// Document is a parsed TOML file.
+type Document struct {
+	src   []byte
+	stmts []statement
+	data  map[string]interface{}
+}
+
+// Parse reads a TOML document. Values are decoded as string, int64, float64,
+// bool, []interface{}, and map[string]interface{}; dates and times are kept as
+// their literal string form.
+func Parse(data []byte) (*Document, error) {
+	p := &parser{src: data, line: 1}
+	doc := &Document{src: data, data: make(map[string]interface{})}
+	b := newBuilder(doc.data)
+
+	var table []string
+	for p.pos < len(p.src) {
+		start := p.pos
+		p.skipWhitespace()
+
+		switch {
+		case p.eof() || p.atNewline():
+			p.consumeNewline()
+			doc.stmts = append(doc.stmts, statement{kind: stmtTrivia, start: start, end: p.pos})
+		case p.peek() == '#':
+			if err := p.finishLine(); err != nil {
+				return nil, err
+			}
+			doc.stmts = append(doc.stmts, statement{kind: stmtTrivia, start: start, end: p.pos, comment: true})
+		case p.peek() == '[':
+			kind := stmtTable
+			p.pos++
+			if p.peek() == '[' {
+				kind = stmtArrayTable
+				p.pos++
+			}
+			p.skipWhitespace()
+			key, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			p.skipWhitespace()
+			if err := p.expect(']'); err != nil {
+				return nil, err
+			}
+			if kind == stmtArrayTable {
+				if err := p.expect(']'); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.finishLine(); err != nil {
+				return nil, err
+			}
+			if kind == stmtArrayTable {
+				err = b.arrayTable(key)
+			} else {
+				err = b.table(key)
+			}
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			table = key
+			doc.stmts = append(doc.stmts, statement{kind: kind, start: start, end: p.pos, key: key})
+		default:
+			key, value, err := p.parseKeyValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.finishLine(); err != nil {
+				return nil, err
+			}
+			if err := b.set(key, value); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			doc.stmts = append(doc.stmts, statement{kind: stmtKeyValue, start: start, end: p.pos, key: key, table: table})
+		}
+	}
+	return doc, nil
+}
+
+// Map returns the decoded document.
+func (d *Document) Map() map[string]interface{} {
+	return d.data
+}
+
+// Bytes returns the original document source.
+func (d *Document) Bytes() []byte {
+	return d.src
+}
+
+// Table returns the decoded value at the dotted table path, or nil when the
+// path is not defined or is not a table.
+func (d *Document) Table(path ...string) map[string]interface{} {
+	current := d.data
+	for _, segment := range path {
+		next, ok := current[segment].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+// ReplaceTable returns the document source with every statement that defines
+// the table at path removed and rendered inserted in its place. The table may
+// have been defined with [path.*] headers, [[path.*]] array headers, dotted
+// keys, or an inline table. rendered is inserted where the first header for
+// the table appeared, or appended to the end of the document when the table
+// was only defined through keys in another table (or not at all). All other
+// statements, including comments, are copied byte-for-byte.
+func (d *Document) ReplaceTable(path []string, rendered string) []byte {
+	owned := d.ownedStatements(path)
+
+	insertAt := -1
+	for i, stmt := range d.stmts {
+		if owned[i] && (stmt.kind == stmtTable || stmt.kind == stmtArrayTable) {
+			insertAt = i
+			break
+		}
+	}
+	// Keep the comment block directly above the first header; it usually
+	// describes the whole section rather than a single server.
+	if insertAt >= 0 {
+		for i := insertAt - 1; i >= 0 && d.stmts[i].kind == stmtTrivia && d.stmts[i].comment; i-- {
+			owned[i] = false
+		}
+	}
+
+	var out []byte
+	inserted := false
+	separate := false
+	for i, stmt := range d.stmts {
+		if i == insertAt {
+			// A kept comment block directly above stays attached to the
+			// inserted tables instead of being separated by a blank line.
+			attached := i > 0 && d.stmts[i-1].comment && !owned[i-1]
+			out = appendBlock(out, rendered, !attached)
+			inserted = true
+			separate = rendered != ""
+		}
+		if owned[i] {
+			continue
+		}
+		if separate && !endsWithBlankLine(out) && (stmt.kind != stmtTrivia || stmt.comment) {
+			out = append(out, '\n')
+		}
+		separate = false
+		out = append(out, d.src[stmt.start:stmt.end]...)
+	}
+	if !inserted {
+		out = appendBlock(out, rendered, true)
+	}
+	return out
+}
+
+// ownedStatements marks the statements that belong to the table at path.
+// Comment lines directly above a statement belong with that statement; other
+// trivia belongs to the table section it appears in.
+func (d *Document) ownedStatements(path []string) []bool {
+	owned := make([]bool, len(d.stmts))
+	sectionOwned := false
+	for i, stmt := range d.stmts {
+		switch stmt.kind {
+		case stmtTable, stmtArrayTable:
+			sectionOwned = hasPrefix(stmt.key, path)
+			owned[i] = sectionOwned
+		case stmtKeyValue:
+			full := append(append([]string(nil), stmt.table...), stmt.key...)
+			owned[i] = sectionOwned || hasPrefix(full, path)
+		default:
+			owned[i] = sectionOwned
+		}
+	}
+
+	// Re-attach comment runs to the statement that follows them.
+	for i := len(d.stmts) - 1; i >= 0; i-- {
+		stmt := d.stmts[i]
+		if stmt.kind == stmtTrivia {
+			continue
+		}
+		for j := i - 1; j >= 0 && d.stmts[j].kind == stmtTrivia && d.stmts[j].comment; j-- {
+			owned[j] = owned[i]
+		}
+	}
+	return owned
+}
+
+// appendBlock appends rendered to out, optionally separated by a blank line.
+func appendBlock(out []byte, rendered string, separate bool) []byte {
+	if rendered == "" {
+		return out
+	}
+	if len(out) > 0 {
+		if out[len(out)-1] != '\n' {
+			out = append(out, '\n')
+		}
+		if separate && !endsWithBlankLine(out) {
+			out = append(out, '\n')
+		}
+	}
+	out = append(out, rendered...)
+	if !strings.HasSuffix(rendered, "\n") {
+		out = append(out, '\n')
+	}
+	return out
+}
+
+func endsWithBlankLine(out []byte) bool {
+	s := strings.TrimRight(string(out), " \t\r")
+	return strings.HasSuffix(s, "\n\n") || s == "\n"
+}
+
+func hasPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// builder assembles the decoded data while statements are parsed.
+type builder struct {
+	root    map[string]interface{}
+	current map[string]interface{}
+	defined map[string]bool
+}
+
+func newBuilder(root map[string]interface{}) *builder {
+	return &builder{root: root, current: root, defined: make(map[string]bool)}
+}
+
+func (b *builder) table(key []string) error {
+	id := strings.Join(key, "\x00")
+	if b.defined[id] {
+		return fmt.Errorf("table %s defined more than once", strings.Join(key, "."))
+	}
+	b.defined[id] = true
+	m, err := descend(b.root, key)
+	if err != nil {
+		return err
+	}
+	b.current = m
+	return nil
+}
+
+func (b *builder) arrayTable(key []string) error {
+	parent, err := descend(b.root, key[:len(key)-1])
+	if err != nil {
+		return err
+	}
+	last := key[len(key)-1]
+	var arr []interface{}
+	switch existing := parent[last].(type) {
+	case nil:
+	case []interface{}:
+		arr = existing
+	default:
+		return fmt.Errorf("key %s is not an array of tables", strings.Join(key, "."))
+	}
+	m := make(map[string]interface{})
+	parent[last] = append(arr, m)
+	b.current = m
+	return nil
+}
+
+func (b *builder) set(key []string, value interface{}) error {
+	parent, err := descend(b.current, key[:len(key)-1])
+	if err != nil {
+		return err
+	}
+	last := key[len(key)-1]
+	if _, exists := parent[last]; exists {
+		return fmt.Errorf("key %s defined more than once", strings.Join(key, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// descend walks (and creates) nested tables. For arrays of tables the most
+// recently added element is used, matching TOML semantics.
+func descend(m map[string]interface{}, path []string) (map[string]interface{}, error) {
+	current := m
+	for i, segment := range path {
+		switch next := current[segment].(type) {
+		case nil:
+			created := make(map[string]interface{})
+			current[segment] = created
+			current = created
+		case map[string]interface{}:
+			current = next
+		case []interface{}:
+			if len(next) == 0 {
+				return nil, fmt.Errorf("key %s is an empty array", strings.Join(path[:i+1], "."))
+			}
+			last, ok := next[len(next)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("key %s is not a table", strings.Join(path[:i+1], "."))
+			}
+			current = last
+		default:
+			return nil, fmt.Errorf("key %s is not a table", strings.Join(path[:i+1], "."))
+		}
+	}
+	return current, nil
+}
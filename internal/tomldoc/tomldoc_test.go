@@ -0,0 +1,299 @@
+package tomldoc
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseValues(t *testing.T) {
+	src := `# top comment
+title = "a \"quoted\" \\ value\u00e9"
+literal = 'C:\path'
+count = 1_000
+hex = 0xff
+neg = -42
+ratio = 0.5
+big = 6.02e23
+off = false
+when = 1979-05-27T07:32:00Z
+spaced = 1979-05-27 07:32:00
+pos = +inf
+multi = """
+line one
+line two \
+  continued"""
+raw = '''
+keep \n as is'''
+nested = [[1, 2], ["a", "b"],]
+inline = { name = "x", "quoted key" = 1, sub.key = true }
+
+[server."my server"]
+args = [
+  "--flag", # comment inside array
+  "value",
+]
+
+[[items]]
+id = 1
+
+[[items]]
+id = 2
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	got := doc.Map()
+
+	checks := map[string]interface{}{
+		"title":   "a \"quoted\" \\ value\u00e9",
+		"literal": `C:\path`,
+		"count":   int64(1000),
+		"hex":     int64(255),
+		"neg":     int64(-42),
+		"ratio":   0.5,
+		"big":     6.02e23,
+		"off":     false,
+		"when":    "1979-05-27T07:32:00Z",
+		"spaced":  "1979-05-27 07:32:00",
+		"multi":   "line one\nline two continued",
+		"raw":     `keep \n as is`,
+	}
+	for key, want := range checks {
+		if !reflect.DeepEqual(got[key], want) {
+			t.Errorf("%s = %#v, want %#v", key, got[key], want)
+		}
+	}
+	if f, ok := got["pos"].(float64); !ok || !math.IsInf(f, 1) {
+		t.Errorf("pos = %#v, want +inf", got["pos"])
+	}
+
+	nested := []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{"a", "b"}}
+	if !reflect.DeepEqual(got["nested"], nested) {
+		t.Errorf("nested = %#v", got["nested"])
+	}
+	inline := map[string]interface{}{
+		"name":       "x",
+		"quoted key": int64(1),
+		"sub":        map[string]interface{}{"key": true},
+	}
+	if !reflect.DeepEqual(got["inline"], inline) {
+		t.Errorf("inline = %#v", got["inline"])
+	}
+
+	server := doc.Table("server", "my server")
+	if !reflect.DeepEqual(server["args"], []interface{}{"--flag", "value"}) {
+		t.Errorf("server args = %#v", server["args"])
+	}
+	items, ok := got["items"].([]interface{})
+	if !ok || len(items) != 2 {
+		t.Fatalf("items = %#v", got["items"])
+	}
+	if items[1].(map[string]interface{})["id"] != int64(2) {
+		t.Errorf("items[1] = %#v", items[1])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"unterminated": "a = \"oops\n",
+		"duplicate":    "a = 1\na = 2\n",
+		"table twice":  "[a]\n[a]\n",
+		"trailing":     "a = 1 b\n",
+		"missing":      "a =\n",
+		"bad escape":   `a = "\q"` + "\n",
+	}
+	for name, src := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(src)); err == nil {
+				t.Fatalf("expected error for %q", src)
+			}
+		})
+	}
+}
+
+func TestReplaceTablePreservesOtherContent(t *testing.T) {
+	src := `# Codex configuration
+model = "o3" # trailing comment
+
+# MCP servers
+[mcp_servers.old]
+command = "node"
+args = ["--flag"]
+
+[mcp_servers.old.env]
+KEY = "value"
+
+# Editor settings
+[editor]
+font_size = 12   # spacing kept
+
+[mcp_servers.other]
+command = "npx"
+
+[profiles.default]
+model = "gpt"
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	out := string(doc.ReplaceTable([]string{"mcp_servers"}, "[mcp_servers.new]\ncommand = \"uvx\"\n"))
+
+	want := `# Codex configuration
+model = "o3" # trailing comment
+
+# MCP servers
+[mcp_servers.new]
+command = "uvx"
+
+# Editor settings
+[editor]
+font_size = 12   # spacing kept
+
+[profiles.default]
+model = "gpt"
+`
+	if out != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestReplaceTableDottedAndInlineForms(t *testing.T) {
+	src := `model = "o3"
+mcp_servers.dotted.command = "node"
+mcp_servers.inline = { command = "npx", args = ["a"] }
+
+[tui]
+notifications = true
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	servers := doc.Table("mcp_servers")
+	if len(servers) != 2 {
+		t.Fatalf("expected both dotted and inline servers, got %#v", servers)
+	}
+
+	out := string(doc.ReplaceTable([]string{"mcp_servers"}, "[mcp_servers.new]\ncommand = \"uvx\""))
+	want := `model = "o3"
+
+[tui]
+notifications = true
+
+[mcp_servers.new]
+command = "uvx"
+`
+	if out != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestReplaceTableAppendsWhenMissing(t *testing.T) {
+	src := "[tui]\nnotifications = true"
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	out := string(doc.ReplaceTable([]string{"mcp_servers"}, "[mcp_servers.a]\ncommand = \"x\""))
+	want := "[tui]\nnotifications = true\n\n[mcp_servers.a]\ncommand = \"x\"\n"
+	if out != want {
+		t.Fatalf("unexpected output:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestReplaceTableRemovesEveryServerTable(t *testing.T) {
+	src := `# Pre
+[general]
+val = true
+
+[mcp_servers.old]
+command = "node"
+
+[editor]
+font = 12
+
+[mcp_servers.new]
+command = "npx"
+`
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	out := string(doc.ReplaceTable([]string{"mcp_servers"}, ""))
+	if strings.Contains(out, "mcp_servers") {
+		t.Fatalf("server tables should be removed, got:\n%s", out)
+	}
+	if !strings.Contains(out, "# Pre\n[general]\nval = true") || !strings.Contains(out, "[editor]\nfont = 12") {
+		t.Fatalf("other tables should be preserved, got:\n%s", out)
+	}
+}
+
+func TestEncodeTablesSkipsIntermediateEmptyTables(t *testing.T) {
+	servers := map[string]interface{}{
+		"myserver": map[string]interface{}{
+			"command": "uvx",
+			"tools": map[string]interface{}{
+				"search": map[string]interface{}{"approval_mode": "approve"},
+				"read":   map[string]interface{}{"approval_mode": "approve"},
+			},
+		},
+	}
+
+	out := EncodeTables([]string{"mcp_servers"}, servers)
+	for _, want := range []string{"[mcp_servers.myserver.tools.search]", "[mcp_servers.myserver.tools.read]", `approval_mode = "approve"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "[mcp_servers.myserver.tools]\n") {
+		t.Errorf("intermediate empty tools table should be suppressed:\n%s", out)
+	}
+}
+
+func TestEncodeTablesEscapesAndTypes(t *testing.T) {
+	servers := map[string]interface{}{
+		"my server": map[string]interface{}{
+			"command": `C:\tools\run "quoted"`,
+			"args":    []interface{}{"a", float64(123), true, []interface{}{"x"}},
+			"timeout": float64(30),
+			"ratio":   1.5,
+			"skip":    nil,
+			"headers": []interface{}{map[string]interface{}{"name": "X-Key", "value": "line\nbreak"}},
+			"env":     map[string]interface{}{"KEY": "v"},
+		},
+	}
+
+	out := EncodeTables([]string{"mcp_servers"}, servers)
+	for _, want := range []string{
+		`[mcp_servers."my server"]`,
+		`command = "C:\\tools\\run \"quoted\""`,
+		`args = ["a", 123, true, ["x"]]`,
+		`timeout = 30`,
+		`ratio = 1.5`,
+		`headers = [{ name = "X-Key", value = "line\nbreak" }]`,
+		`[mcp_servers."my server".env]`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "skip") {
+		t.Errorf("nil values should be skipped:\n%s", out)
+	}
+
+	doc, err := Parse([]byte(out))
+	if err != nil {
+		t.Fatalf("encoded output does not parse: %v\n%s", err, out)
+	}
+	server := doc.Table("mcp_servers", "my server")
+	if server["command"] != `C:\tools\run "quoted"` {
+		t.Fatalf("command did not round trip: %#v", server["command"])
+	}
+	if server["timeout"] != int64(30) {
+		t.Fatalf("timeout did not round trip as integer: %#v", server["timeout"])
+	}
+}
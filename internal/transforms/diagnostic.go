@@ -0,0 +1,76 @@
+package transforms
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diagnostic severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic kinds.
+const (
+	KindInvalid = "invalid"          // the server cannot be written for the agent
+	KindLossy   = "lossy-conversion" // configuration the agent cannot represent was dropped
+)
+
+// Diagnostic is a problem with one server found while rendering it for an
+// agent. Errors keep the agent's file from being written; warnings do not.
+type Diagnostic struct {
+	Severity string
+	Kind     string // empty for problems that have no kind
+	Agent    string
+	Server   string // empty when the problem is not about one server
+	Field    string // empty when the problem is not about one field
+	Message  string
+}
+
+func (d Diagnostic) Error() string {
+	var sb strings.Builder
+	sb.WriteString(d.Agent)
+	if d.Server != "" {
+		fmt.Fprintf(&sb, ": server %q", d.Server)
+	}
+	if d.Field != "" {
+		fmt.Fprintf(&sb, " field %q", d.Field)
+	}
+	sb.WriteString(": ")
+	sb.WriteString(d.Message)
+	return sb.String()
+}
+
+// Diagnostics is the list of problems a transformer found, returned as its
+// error. When it only holds warnings the servers were still transformed.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	msgs := make([]string, 0, len(ds))
+	for _, d := range ds {
+		msgs = append(msgs, d.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// HasErrors reports whether any diagnostic is an error.
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns the diagnostics that are errors.
+func (ds Diagnostics) Errors() Diagnostics {
+	var errs Diagnostics
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,239 @@
+package transforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"agent-align/internal/mcpserver"
+)
+
+// Reverser is implemented by transformers whose output can be converted back
+// into the neutral server format used by agent-align-mcp.yml. Fields that a
+// transformer drops cannot be recovered and are simply absent after Reverse.
+type Reverser interface {
+	// Reverse modifies agent-specific servers in place so they use the
+	// neutral field names and values.
+	Reverse(servers map[string]interface{}) error
+}
+
+// GetReverser returns the reverser for a given agent. Agents without a
+// specific transformer share the field layout of the neutral format, so the
+// no-op transformer is returned for them.
+func GetReverser(agent string) Reverser {
+	if reverser, ok := GetTransformer(agent).(Reverser); ok {
+		return reverser
+	}
+	return &NoOpTransformer{}
+}
+
+// Reverse returns nil without modifying servers.
+func (t *NoOpTransformer) Reverse(servers map[string]interface{}) error {
+	return nil
+}
+
+// Reverse undoes the Copilot defaults: the wildcard tools list, empty args
+// arrays, and the "local" transport name.
+func (t *CopilotTransformer) Reverse(servers map[string]interface{}) error {
+	for _, server := range serverMaps(servers) {
+		if tools, ok := server["tools"].([]interface{}); ok && len(tools) == 1 && tools[0] == "*" {
+			delete(server, "tools")
+		}
+		if args, ok := server["args"].([]interface{}); ok && len(args) == 0 {
+			delete(server, "args")
+		}
+		if typ, ok := server["type"].(string); ok && strings.EqualFold(strings.TrimSpace(typ), "local") {
+			server["type"] = "stdio"
+		}
+	}
+	return nil
+}
+
+// Reverse keeps Claude servers as they are; "http" is already a neutral
+// transport name.
+func (t *ClaudeTransformer) Reverse(servers map[string]interface{}) error {
+	return nil
+}
+
+// Reverse converts Gemini's timeout in milliseconds back to toolTimeoutSec.
+// The fields Gemini rejects were removed when the config was written and
+// cannot be restored.
+func (t *GeminiTransformer) Reverse(servers map[string]interface{}) error {
+	for _, server := range serverMaps(servers) {
+		if ms, ok := number(server["timeout"]); ok {
+			server[mcpserver.FieldToolTimeout] = mcpserver.Seconds(time.Duration(ms * float64(time.Millisecond)))
+			delete(server, "timeout")
+		}
+	}
+	return nil
+}
+
+// Reverse converts Codex servers back to the neutral format:
+//   - [mcp_servers.<name>.tools.<tool>] tables with approval_mode = "approve"
+//     become an "alwaysAllow" list.
+//   - "http_headers" is renamed to "headers".
+//   - "bearer_token_env_var" becomes an Authorization header that references
+//     the same environment variable.
+//   - "startup_timeout_sec" and "tool_timeout_sec" become startupTimeoutSec
+//     and toolTimeoutSec.
+func (t *CodexTransformer) Reverse(servers map[string]interface{}) error {
+	for _, server := range serverMaps(servers) {
+		for from, to := range map[string]string{
+			"startup_timeout_sec": mcpserver.FieldStartupTimeout,
+			"tool_timeout_sec":    mcpserver.FieldToolTimeout,
+		} {
+			if value, ok := server[from]; ok {
+				server[to] = value
+				delete(server, from)
+			}
+		}
+
+		if tools, ok := server["tools"].(map[string]interface{}); ok {
+			var allowed []string
+			for tool, settings := range tools {
+				if settingsMap, ok := settings.(map[string]interface{}); ok && settingsMap["approval_mode"] == "approve" {
+					allowed = append(allowed, tool)
+					delete(tools, tool)
+				}
+			}
+			if len(allowed) > 0 {
+				sort.Strings(allowed)
+				list := make([]interface{}, 0, len(allowed))
+				for _, tool := range allowed {
+					list = append(list, tool)
+				}
+				server["alwaysAllow"] = list
+			}
+			if len(tools) == 0 {
+				delete(server, "tools")
+			}
+		}
+
+		if headers, ok := server["http_headers"]; ok {
+			server["headers"] = headers
+			delete(server, "http_headers")
+		}
+
+		if envVar, ok := server["bearer_token_env_var"].(string); ok && envVar != "" {
+			headers, _ := server["headers"].(map[string]interface{})
+			if headers == nil {
+				headers = make(map[string]interface{})
+			}
+			if _, hasAuth := headers["Authorization"]; !hasAuth {
+				headers["Authorization"] = "Bearer ${" + envVar + "}"
+			}
+			server["headers"] = headers
+			delete(server, "bearer_token_env_var")
+		}
+	}
+	return nil
+}
+
+// Reverse converts OpenCode servers back to the neutral format: the command
+// array is split into "command" and "args", "environment" is renamed to
+// "env", and the "local"/"remote" types are mapped to neutral transports.
+func (t *OpenCodeTransformer) Reverse(servers map[string]interface{}) error {
+	for _, server := range serverMaps(servers) {
+		if cmdArray, ok := server["command"].([]interface{}); ok && len(cmdArray) > 0 {
+			server["command"] = cmdArray[0]
+			if len(cmdArray) > 1 {
+				server["args"] = append([]interface{}(nil), cmdArray[1:]...)
+			}
+		}
+
+		if env, hasEnv := server["environment"]; hasEnv {
+			server["env"] = env
+			delete(server, "environment")
+		}
+
+		// Neutral command servers usually omit the type, so "local" is
+		// dropped rather than mapped to "stdio".
+		if typ, ok := server["type"].(string); ok {
+			switch strings.ToLower(strings.TrimSpace(typ)) {
+			case "local":
+				delete(server, "type")
+			case "remote":
+				server["type"] = "http"
+			}
+		}
+	}
+	return nil
+}
+
+// Reverse undoes the declarative rules: renamed fields get their neutral
+// names back, type values are mapped back when the mapping is unambiguous,
+// and fields that still hold their default value are removed.
+func (t *RuleTransformer) Reverse(servers map[string]interface{}) error {
+	typeSources := make(map[string][]string)
+	for from, to := range t.Rules.TypeMap {
+		key := strings.ToLower(strings.TrimSpace(to))
+		typeSources[key] = append(typeSources[key], from)
+	}
+
+	for _, server := range serverMaps(servers) {
+		for key, value := range t.Rules.Defaults {
+			if current, ok := server[key]; ok && equalValues(current, value) {
+				delete(server, key)
+			}
+		}
+
+		renamed := make(map[string]interface{}, len(t.Rules.Rename))
+		for from, to := range t.Rules.Rename {
+			if value, ok := server[to]; ok && from != to {
+				renamed[from] = value
+				delete(server, to)
+			}
+		}
+		for key, value := range renamed {
+			server[key] = value
+		}
+
+		if typ, ok := server["type"].(string); ok {
+			if sources := typeSources[strings.ToLower(strings.TrimSpace(typ))]; len(sources) == 1 {
+				server["type"] = sources[0]
+			}
+		}
+	}
+	return nil
+}
+
+// serverMaps returns the servers that are mappings, skipping malformed
+// entries the same way Transform does.
+func serverMaps(servers map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(servers))
+	for _, serverRaw := range servers {
+		if server, ok := serverRaw.(map[string]interface{}); ok {
+			out = append(out, server)
+		}
+	}
+	return out
+}
+
+// number returns value as a float64 when it is a decoded number.
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// equalValues reports whether two decoded values are the same once encoded,
+// so an int from YAML matches a float64 from JSON.
+func equalValues(a, b interface{}) bool {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	right, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(left, right)
+}
@@ -0,0 +1,193 @@
+package transforms
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCodexTransformer_ReverseRoundTrip(t *testing.T) {
+	neutral := func() map[string]interface{} {
+		return map[string]interface{}{
+			"search": map[string]interface{}{
+				"command":     "npx",
+				"args":        []interface{}{"search-mcp"},
+				"alwaysAllow": []interface{}{"query", "fetch"},
+			},
+			"remote": map[string]interface{}{
+				"url":     "https://example.com/mcp",
+				"headers": map[string]interface{}{"X-Key": "abc"},
+			},
+		}
+	}
+
+	servers := neutral()
+	tr := &CodexTransformer{}
+	if err := tr.Transform(servers); err != nil {
+		t.Fatalf("Transform returned error: %v", err)
+	}
+	if err := tr.Reverse(servers); err != nil {
+		t.Fatalf("Reverse returned error: %v", err)
+	}
+
+	want := neutral()
+	want["search"].(map[string]interface{})["alwaysAllow"] = []interface{}{"fetch", "query"}
+	if !reflect.DeepEqual(servers, want) {
+		t.Fatalf("unexpected round trip result:\n got %v\nwant %v", servers, want)
+	}
+}
+
+func TestReverseRestoresTimeouts(t *testing.T) {
+	for _, tr := range []interface {
+		Transformer
+		Reverser
+	}{&CodexTransformer{}, &GeminiTransformer{}} {
+		servers := map[string]interface{}{
+			"fs": map[string]interface{}{"command": "npx", "toolTimeoutSec": 1.5},
+		}
+		if err := tr.Transform(servers); err != nil {
+			t.Fatalf("%T Transform returned error: %v", tr, err)
+		}
+		if err := tr.Reverse(servers); err != nil {
+			t.Fatalf("%T Reverse returned error: %v", tr, err)
+		}
+		want := map[string]interface{}{"command": "npx", "toolTimeoutSec": 1.5}
+		if got := servers["fs"]; !reflect.DeepEqual(got, want) {
+			t.Fatalf("%T round trip changed the timeout:\n got %v\nwant %v", tr, got, want)
+		}
+	}
+
+	servers := map[string]interface{}{
+		"fs": map[string]interface{}{"command": "npx", "startup_timeout_sec": 20, "tool_timeout_sec": 60},
+	}
+	if err := (&CodexTransformer{}).Reverse(servers); err != nil {
+		t.Fatalf("Reverse returned error: %v", err)
+	}
+	want := map[string]interface{}{"command": "npx", "startupTimeoutSec": 20, "toolTimeoutSec": 60}
+	if !reflect.DeepEqual(servers["fs"], want) {
+		t.Fatalf("unexpected codex timeouts: %v", servers["fs"])
+	}
+}
+
+func TestCodexTransformer_ReverseBearerTokenAndOtherTools(t *testing.T) {
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{
+			"url":                  "https://api.example.com/mcp/",
+			"bearer_token_env_var": "GITHUB_TOKEN",
+			"tools": map[string]interface{}{
+				"search": map[string]interface{}{"approval_mode": "approve"},
+				"delete": map[string]interface{}{"approval_mode": "prompt"},
+			},
+		},
+	}
+	if err := (&CodexTransformer{}).Reverse(servers); err != nil {
+		t.Fatalf("Reverse returned error: %v", err)
+	}
+
+	github := servers["github"].(map[string]interface{})
+	headers := github["headers"].(map[string]interface{})
+	if headers["Authorization"] != "Bearer ${GITHUB_TOKEN}" {
+		t.Fatalf("expected Authorization header referencing the env var, got %v", headers)
+	}
+	if _, ok := github["bearer_token_env_var"]; ok {
+		t.Fatalf("bearer_token_env_var should be removed: %v", github)
+	}
+	if !reflect.DeepEqual(github["alwaysAllow"], []interface{}{"search"}) {
+		t.Fatalf("expected approved tool in alwaysAllow, got %v", github["alwaysAllow"])
+	}
+	tools := github["tools"].(map[string]interface{})
+	if _, ok := tools["delete"]; !ok || len(tools) != 1 {
+		t.Fatalf("expected non-approved tool settings to be kept, got %v", tools)
+	}
+}
+
+func TestOpenCodeTransformer_Reverse(t *testing.T) {
+	servers := map[string]interface{}{
+		"local": map[string]interface{}{
+			"type":        "local",
+			"command":     []interface{}{"npx", "-y", "server"},
+			"environment": map[string]interface{}{"KEY": "value"},
+		},
+		"bare": map[string]interface{}{
+			"type":    "local",
+			"command": []interface{}{"server"},
+		},
+		"remote": map[string]interface{}{
+			"type": "remote",
+			"url":  "https://example.com/mcp",
+		},
+	}
+	if err := (&OpenCodeTransformer{}).Reverse(servers); err != nil {
+		t.Fatalf("Reverse returned error: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"local": map[string]interface{}{
+			"command": "npx",
+			"args":    []interface{}{"-y", "server"},
+			"env":     map[string]interface{}{"KEY": "value"},
+		},
+		"bare": map[string]interface{}{
+			"command": "server",
+		},
+		"remote": map[string]interface{}{
+			"type": "http",
+			"url":  "https://example.com/mcp",
+		},
+	}
+	if !reflect.DeepEqual(servers, want) {
+		t.Fatalf("unexpected result:\n got %v\nwant %v", servers, want)
+	}
+}
+
+func TestCopilotTransformer_ReverseDropsDefaults(t *testing.T) {
+	servers := map[string]interface{}{
+		"fs": map[string]interface{}{
+			"command": "npx",
+			"args":    []interface{}{},
+			"tools":   []interface{}{"*"},
+			"type":    "local",
+		},
+	}
+	if err := (&CopilotTransformer{}).Reverse(servers); err != nil {
+		t.Fatalf("Reverse returned error: %v", err)
+	}
+	want := map[string]interface{}{"fs": map[string]interface{}{"command": "npx", "type": "stdio"}}
+	if !reflect.DeepEqual(servers, want) {
+		t.Fatalf("unexpected result: %v", servers)
+	}
+}
+
+func TestRuleTransformer_Reverse(t *testing.T) {
+	tr := &RuleTransformer{Rules: FieldRules{
+		Rename:   map[string]string{"env": "environment", "type": "transport"},
+		Defaults: map[string]interface{}{"enabled": true},
+		TypeMap:  map[string]string{"streamable-http": "http"},
+	}}
+	servers := map[string]interface{}{
+		"remote": map[string]interface{}{"type": "streamable-http", "url": "https://example.com"},
+		"local":  map[string]interface{}{"command": "npx", "env": map[string]interface{}{"A": "1"}, "enabled": false},
+	}
+	if err := tr.Transform(servers); err != nil {
+		t.Fatalf("Transform returned error: %v", err)
+	}
+	if err := tr.Reverse(servers); err != nil {
+		t.Fatalf("Reverse returned error: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"remote": map[string]interface{}{"type": "streamable-http", "url": "https://example.com"},
+		"local":  map[string]interface{}{"command": "npx", "env": map[string]interface{}{"A": "1"}, "enabled": false},
+	}
+	if !reflect.DeepEqual(servers, want) {
+		t.Fatalf("unexpected result:\n got %v\nwant %v", servers, want)
+	}
+}
+
+func TestGetReverser(t *testing.T) {
+	if _, ok := GetReverser("codex").(*CodexTransformer); !ok {
+		t.Fatal("expected codex reverser")
+	}
+	if _, ok := GetReverser("vscode").(*NoOpTransformer); !ok {
+		t.Fatal("expected no-op reverser for agents without a transformer")
+	}
+}
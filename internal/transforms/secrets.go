@@ -0,0 +1,242 @@
+package transforms
+
+import (
+	"sort"
+	"strings"
+)
+
+// envSyntax describes how an agent writes a reference to an environment
+// variable it resolves itself.
+type envSyntax struct {
+	format   func(name string) string
+	defaults bool // the agent understands ${VAR:-default}
+}
+
+// nativeEnvSyntax lists agents that expand environment references in their
+// MCP server configs. Codex is handled separately because it only accepts
+// variable names in dedicated fields.
+var nativeEnvSyntax = map[string]envSyntax{
+	"claudecode": {format: func(name string) string { return "${" + name + "}" }, defaults: true},
+	"gemini":     {format: func(name string) string { return "${" + name + "}" }},
+	"vscode":     {format: func(name string) string { return "${env:" + name + "}" }},
+	"kilocode":   {format: func(name string) string { return "${env:" + name + "}" }},
+	"opencode":   {format: func(name string) string { return "{env:" + name + "}" }},
+}
+
+// SupportsSecretPassthrough reports whether agent can resolve environment
+// references on its own.
+func SupportsSecretPassthrough(agent string) bool {
+	agent = strings.ToLower(strings.TrimSpace(agent))
+	_, ok := nativeEnvSyntax[agent]
+	return ok || agent == "codex"
+}
+
+// PassthroughSecrets rewrites the ${VAR} and $VAR references in servers that
+// were already transformed for agent into the syntax the agent expands
+// itself. References the agent cannot express, such as defaults it does not
+// support, are resolved with expand, which receives the reference text. For
+// agents without native support every string is passed to expand.
+func PassthroughSecrets(agent string, servers map[string]interface{}, expand func(string) string) {
+	agent = strings.ToLower(strings.TrimSpace(agent))
+	if agent == "codex" {
+		for _, server := range serverMaps(servers) {
+			passthroughCodexServer(server, expand)
+		}
+		return
+	}
+
+	syntax, ok := nativeEnvSyntax[agent]
+	rewrite := func(s string) string {
+		if !ok {
+			return expand(s)
+		}
+		return rewriteReferences(s, func(ref envReference) string {
+			switch {
+			case ref.name != "" && ref.op == "":
+				return syntax.format(ref.name)
+			case ref.name != "" && ref.op == ":-" && syntax.defaults:
+				return ref.text
+			default:
+				return expand(ref.text)
+			}
+		})
+	}
+	for name, server := range servers {
+		servers[name] = mapStrings(server, rewrite)
+	}
+}
+
+// passthroughCodexServer moves plain variable references into the Codex
+// fields that take environment variable names: env_vars for stdio env,
+// env_http_headers for headers, and bearer_token_env_var for a bearer
+// Authorization header. Everything else is expanded.
+func passthroughCodexServer(server map[string]interface{}, expand func(string) string) {
+	if env, ok := server["env"].(map[string]interface{}); ok {
+		var forwarded []interface{}
+		for key, value := range env {
+			if text, ok := value.(string); ok {
+				if name, ok := wholeReference(text); ok && name == key {
+					forwarded = append(forwarded, key)
+					delete(env, key)
+				}
+			}
+		}
+		if len(forwarded) > 0 {
+			existing, _ := server["env_vars"].([]interface{})
+			server["env_vars"] = append(existing, sortedStrings(forwarded)...)
+		}
+		if len(env) == 0 {
+			delete(server, "env")
+		}
+	}
+
+	if headers, ok := server["http_headers"].(map[string]interface{}); ok {
+		envHeaders, _ := server["env_http_headers"].(map[string]interface{})
+		if envHeaders == nil {
+			envHeaders = make(map[string]interface{})
+		}
+		for header, value := range headers {
+			text, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if strings.EqualFold(header, "Authorization") && strings.HasPrefix(text, "Bearer ") {
+				if name, ok := wholeReference(strings.TrimPrefix(text, "Bearer ")); ok {
+					if _, exists := server["bearer_token_env_var"]; !exists {
+						server["bearer_token_env_var"] = name
+						delete(headers, header)
+						continue
+					}
+				}
+			}
+			if name, ok := wholeReference(text); ok {
+				envHeaders[header] = name
+				delete(headers, header)
+			}
+		}
+		if len(envHeaders) > 0 {
+			server["env_http_headers"] = envHeaders
+		}
+		if len(headers) == 0 {
+			delete(server, "http_headers")
+		}
+	}
+
+	for key, value := range server {
+		server[key] = mapStrings(value, expand)
+	}
+}
+
+// envReference is a single $VAR or ${...} reference found in a string.
+type envReference struct {
+	text string // the reference as written, including $ and braces
+	name string // variable name; empty for $$ and provider references like ${file:...}
+	op   string // ":-", ":?", ":+", or ":=" after the name; empty for plain references
+}
+
+// rewriteReferences replaces every reference in s with replace(ref).
+func rewriteReferences(s string, replace func(envReference) string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '$' || i+1 >= len(s) {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		ref, width := parseReference(s[i:])
+		if width == 0 {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		sb.WriteString(replace(ref))
+		i += width
+	}
+	return sb.String()
+}
+
+// parseReference parses the reference at the start of s, which begins with
+// '$'. It returns a zero width when s does not start with a reference.
+func parseReference(s string) (envReference, int) {
+	if s[1] == '$' {
+		// An escaped dollar sign, left for expand.
+		return envReference{text: "$$"}, 2
+	}
+	if s[1] == '{' {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return envReference{}, 0
+		}
+		body := s[2:end]
+		ref := envReference{text: s[:end+1]}
+		n := 0
+		for n < len(body) && isNameChar(body[n], n == 0) {
+			n++
+		}
+		switch {
+		case n == 0:
+			// Not a variable, for example a provider reference.
+		case n == len(body):
+			ref.name = body
+		case body[n] == ':' && n+1 < len(body) && strings.IndexByte("-?+=", body[n+1]) >= 0:
+			ref.name = body[:n]
+			ref.op = body[n : n+2]
+		}
+		return ref, end + 1
+	}
+
+	n := 1
+	for n < len(s) && isNameChar(s[n], n == 1) {
+		n++
+	}
+	if n == 1 {
+		return envReference{}, 0
+	}
+	return envReference{text: s[:n], name: s[1:n]}, n
+}
+
+// wholeReference reports whether s is exactly one plain variable reference
+// and returns the variable name.
+func wholeReference(s string) (string, bool) {
+	if !strings.HasPrefix(s, "$") || len(s) < 2 {
+		return "", false
+	}
+	ref, width := parseReference(s)
+	if width != len(s) || ref.name == "" || ref.op != "" {
+		return "", false
+	}
+	return ref.name, true
+}
+
+func isNameChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
+
+// mapStrings applies fn to every string in a decoded value.
+func mapStrings(value interface{}, fn func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = mapStrings(item, fn)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = mapStrings(item, fn)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func sortedStrings(values []interface{}) []interface{} {
+	out := append([]interface{}(nil), values...)
+	sort.Slice(out, func(i, j int) bool { return out[i].(string) < out[j].(string) })
+	return out
+}
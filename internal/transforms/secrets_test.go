@@ -0,0 +1,129 @@
+package transforms
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func expandForTest(s string) string {
+	return os.Expand(s, func(key string) string {
+		if key == "HOST:-localhost" {
+			return "localhost"
+		}
+		return "<" + key + ">"
+	})
+}
+
+func TestPassthroughSecretsRewritesNativeSyntax(t *testing.T) {
+	newServers := func() map[string]interface{} {
+		return map[string]interface{}{
+			"api": map[string]interface{}{
+				"url":     "https://${HOST:-localhost}/mcp",
+				"headers": map[string]interface{}{"Authorization": "Bearer ${API_TOKEN}"},
+				"args":    []interface{}{"--key=$API_KEY", "${file:/run/secret}", "$5 off"},
+			},
+		}
+	}
+
+	tests := []struct {
+		agent string
+		auth  string
+		url   string
+		key   string
+	}{
+		{agent: "claudecode", auth: "Bearer ${API_TOKEN}", url: "https://${HOST:-localhost}/mcp", key: "--key=${API_KEY}"},
+		{agent: "vscode", auth: "Bearer ${env:API_TOKEN}", url: "https://localhost/mcp", key: "--key=${env:API_KEY}"},
+		{agent: "opencode", auth: "Bearer {env:API_TOKEN}", url: "https://localhost/mcp", key: "--key={env:API_KEY}"},
+		{agent: "copilot", auth: "Bearer <API_TOKEN>", url: "https://localhost/mcp", key: "--key=<API_KEY>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agent, func(t *testing.T) {
+			servers := newServers()
+			PassthroughSecrets(tt.agent, servers, expandForTest)
+			api := servers["api"].(map[string]interface{})
+			if got := api["headers"].(map[string]interface{})["Authorization"]; got != tt.auth {
+				t.Fatalf("expected Authorization %q, got %q", tt.auth, got)
+			}
+			if api["url"] != tt.url {
+				t.Fatalf("expected url %q, got %q", tt.url, api["url"])
+			}
+			args := api["args"].([]interface{})
+			if args[0] != tt.key {
+				t.Fatalf("expected arg %q, got %q", tt.key, args[0])
+			}
+			if args[1] != "<file:/run/secret>" {
+				t.Fatalf("expected provider reference to be expanded, got %q", args[1])
+			}
+			if args[2] != "$5 off" && tt.agent != "copilot" {
+				t.Fatalf("expected text without a reference to be kept, got %q", args[2])
+			}
+		})
+	}
+}
+
+func TestPassthroughSecretsCodexUsesEnvFields(t *testing.T) {
+	servers := map[string]interface{}{
+		"local": map[string]interface{}{
+			"command": "npx",
+			"env": map[string]interface{}{
+				"API_KEY": "${API_KEY}",
+				"OTHER":   "${DIFFERENT}",
+				"MODE":    "fast",
+			},
+		},
+		"remote": map[string]interface{}{
+			"url": "https://example.com",
+			"http_headers": map[string]interface{}{
+				"Authorization": "Bearer ${TOKEN}",
+				"X-Team":        "$TEAM_ID",
+				"X-Static":      "id-${TEAM_ID}",
+			},
+		},
+	}
+	PassthroughSecrets("codex", servers, expandForTest)
+
+	want := map[string]interface{}{
+		"local": map[string]interface{}{
+			"command":  "npx",
+			"env":      map[string]interface{}{"OTHER": "<DIFFERENT>", "MODE": "fast"},
+			"env_vars": []interface{}{"API_KEY"},
+		},
+		"remote": map[string]interface{}{
+			"url":                  "https://example.com",
+			"bearer_token_env_var": "TOKEN",
+			"env_http_headers":     map[string]interface{}{"X-Team": "TEAM_ID"},
+			"http_headers":         map[string]interface{}{"X-Static": "id-<TEAM_ID>"},
+		},
+	}
+	if !reflect.DeepEqual(servers, want) {
+		t.Fatalf("unexpected codex passthrough:\n got %v\nwant %v", servers, want)
+	}
+}
+
+func TestSupportsSecretPassthrough(t *testing.T) {
+	for _, agent := range []string{"claudecode", "codex", "vscode", "opencode"} {
+		if !SupportsSecretPassthrough(agent) {
+			t.Fatalf("expected %s to support passthrough", agent)
+		}
+	}
+	if SupportsSecretPassthrough("copilot") {
+		t.Fatal("expected copilot to require expanded secrets")
+	}
+}
+
+func TestPassthroughSecretsLeavesEscapedDollarToExpand(t *testing.T) {
+	servers := map[string]interface{}{
+		"api": map[string]interface{}{"args": []interface{}{"--price=$$API_KEY"}},
+	}
+	PassthroughSecrets("claudecode", servers, func(s string) string {
+		if s == "$$" {
+			return "$"
+		}
+		return "<" + s + ">"
+	})
+	args := servers["api"].(map[string]interface{})["args"].([]interface{})
+	if args[0] != "--price=$API_KEY" {
+		t.Fatalf("expected escaped dollar to be expanded, got %v", args[0])
+	}
+}
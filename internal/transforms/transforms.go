@@ -2,7 +2,10 @@ package transforms
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+
+	"agent-align/internal/mcpserver"
 )
 
 // Transformer defines the interface for destination-specific transformations.
@@ -13,6 +16,24 @@ type Transformer interface {
 	Transform(servers map[string]interface{}) error
 }
 
+// Reporter is implemented by transformers that can explain what a transform
+// changed, such as configuration the agent cannot represent.
+type Reporter interface {
+	Transformer
+	// TransformAndReport transforms servers like Transform and also returns
+	// warnings about what was lost in the conversion.
+	TransformAndReport(servers map[string]interface{}) (Diagnostics, error)
+}
+
+// TransformAndReport runs t on servers, returning its warnings when it is a
+// Reporter.
+func TransformAndReport(t Transformer, servers map[string]interface{}) (Diagnostics, error) {
+	if r, ok := t.(Reporter); ok {
+		return r.TransformAndReport(servers)
+	}
+	return nil, t.Transform(servers)
+}
+
 // GetTransformer returns the appropriate transformer for a given agent.
 // If no specific transformer exists, it returns a no-op transformer.
 func GetTransformer(agent string) Transformer {
@@ -40,6 +61,32 @@ func (t *NoOpTransformer) Transform(servers map[string]interface{}) error {
 	return nil
 }
 
+// encoder converts one parsed server into an agent's layout and reports
+// what it could not carry over.
+type encoder func(s mcpserver.Server) (map[string]interface{}, []Diagnostic)
+
+// encodeServers parses every server that is a mapping into the typed model,
+// encodes it with encode, and writes the result back into the same map so
+// callers holding it see the change. Other entries are left alone.
+func encodeServers(servers map[string]interface{}, encode encoder) Diagnostics {
+	var diags Diagnostics
+	for _, name := range sortedKeys(servers) {
+		raw, ok := servers[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		encoded, found := encode(mcpserver.Parse(name, raw))
+		for key := range raw {
+			delete(raw, key)
+		}
+		for key, value := range encoded {
+			raw[key] = value
+		}
+		diags = append(diags, found...)
+	}
+	return diags
+}
+
 // CopilotTransformer handles Copilot-specific transformations and validations.
 type CopilotTransformer struct{}
 
@@ -48,41 +95,49 @@ type CopilotTransformer struct{}
 // - Adds an empty "args" array to command-based servers if not present
 // - Normalizes network transport types to the values Copilot expects
 // - Validates that network-based servers have both "type" and "url" fields
+//
+// Every server is checked, and the problems found are returned together as
+// Diagnostics.
 func (t *CopilotTransformer) Transform(servers map[string]interface{}) error {
-	for name, serverRaw := range servers {
-		server, ok := serverRaw.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		if err := t.transformServer(name, server); err != nil {
-			return err
-		}
+	if diags := encodeServers(servers, encodeCopilot); len(diags) > 0 {
+		return diags
 	}
 	return nil
 }
 
-// transformServer applies transformations to a single server configuration.
-func (t *CopilotTransformer) transformServer(name string, server map[string]interface{}) error {
-	addToolsArrayIfMissing(server)
-	addArgsArrayIfMissingForCommandServers(server)
-
-	if typ, ok := server["type"].(string); ok {
-		switch strings.ToLower(strings.TrimSpace(typ)) {
-		case "stdio":
-			server["type"] = "local"
-		case "streamable-http":
-			server["type"] = "http"
-		}
+// encodeCopilot applies the Copilot modifications to a single server.
+func encodeCopilot(s mcpserver.Server) (map[string]interface{}, []Diagnostic) {
+	if !s.Has(mcpserver.FieldTools) {
+		s.Tools.Enabled = []string{"*"}
+	}
+	// HTTP servers never get args, even if they have a command field.
+	if s.Has(mcpserver.FieldCommand) && s.Transport != mcpserver.TransportStreamableHTTP && !s.Has(mcpserver.FieldArgs) {
+		s.Args = []string{}
+	}
+
+	switch s.Transport {
+	case mcpserver.TransportStdio:
+		s.Type = "local"
+	case mcpserver.TransportStreamableHTTP:
+		s.Type = "http"
 	}
 
+	server := s.Map()
 	if isNetworkServer(server) {
-		if err := validateNetworkServer(name, server); err != nil {
-			return err
-		}
+		return server, validateNetworkServer(s.Name, server)
 	}
+	return server, nil
+}
 
-	return nil
+// sortedKeys returns the keys of servers in order so diagnostics and rule
+// matching are stable.
+func sortedKeys[V any](servers map[string]V) []string {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // isNetworkServer returns true if the server appears to be a network-based server.
@@ -93,40 +148,9 @@ func isNetworkServer(server map[string]interface{}) bool {
 	return hasType || hasURL
 }
 
-// addToolsArrayIfMissing adds a "tools" array with wildcard ["*"] to the server if not present.
-func addToolsArrayIfMissing(server map[string]interface{}) {
-	if _, hasTools := server["tools"]; !hasTools {
-		server["tools"] = []interface{}{"*"}
-	}
-}
-
-// addArgsArrayIfMissingForCommandServers adds an empty "args" array to command-based
-// servers if not present. Command-based servers are those that have a "command" field
-// and are not HTTP servers (type != "http" or "streamable-http").
-func addArgsArrayIfMissingForCommandServers(server map[string]interface{}) {
-	// Only add args if this is a command-based server
-	_, hasCommand := server["command"]
-	if !hasCommand {
-		return
-	}
-
-	// Skip if this is an HTTP server (even if it has a command field)
-	// Check for both http and streamable-http since this runs before type normalization
-	if typ, ok := server["type"].(string); ok {
-		normalizedType := strings.ToLower(strings.TrimSpace(typ))
-		if normalizedType == "http" || normalizedType == "streamable-http" {
-			return
-		}
-	}
-
-	// Add empty args array if not present
-	if _, hasArgs := server["args"]; !hasArgs {
-		server["args"] = []interface{}{}
-	}
-}
-
-// validateNetworkServer ensures that network-based servers have both "type" and "url" fields.
-func validateNetworkServer(name string, server map[string]interface{}) error {
+// validateNetworkServer ensures that network-based servers have both "type"
+// and "url" fields, reporting each missing one.
+func validateNetworkServer(name string, server map[string]interface{}) []Diagnostic {
 	rawType, hasType := server["type"]
 	_, hasURL := server["url"]
 
@@ -144,20 +168,23 @@ func validateNetworkServer(name string, server map[string]interface{}) error {
 		}
 	}
 
-	var missing []string
-	if !hasType {
-		missing = append(missing, "type")
-	}
-	if !hasURL {
-		missing = append(missing, "url")
-	}
-
-	if len(missing) > 0 {
-		return fmt.Errorf("copilot validation error: network-based server %q is missing required field(s): %s. Network servers must have both 'type' and 'url' fields",
-			name, strings.Join(missing, ", "))
+	var diags []Diagnostic
+	for _, field := range []struct {
+		name    string
+		present bool
+	}{{"type", hasType}, {"url", hasURL}} {
+		if !field.present {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError,
+				Kind:     KindInvalid,
+				Agent:    "copilot",
+				Server:   name,
+				Field:    field.name,
+				Message:  "network-based servers must have both 'type' and 'url' fields",
+			})
+		}
 	}
-
-	return nil
+	return diags
 }
 
 // CodexTransformer applies Codex-specific conversions.
@@ -168,56 +195,67 @@ type CodexTransformer struct{}
 //     sections with approval_mode = "approve", as required by Codex config.toml.
 //   - Renames the "headers" field to "http_headers" for every server so that
 //     Codex can parse them correctly.
+//   - Writes timeouts as startup_timeout_sec and tool_timeout_sec.
 //   - For the special "github" server it also converts an Authorization header
 //     into the bearer_token_env_var env-var field that Codex expects.
 func (t *CodexTransformer) Transform(servers map[string]interface{}) error {
-	for name, serverRaw := range servers {
-		server, ok := serverRaw.(map[string]interface{})
-		if !ok {
-			continue
-		}
+	_, err := t.TransformAndReport(servers)
+	return err
+}
 
-		// Convert alwaysAllow list to nested tools map with approval_mode = "approve".
-		if alwaysAllow, ok := server["alwaysAllow"].([]interface{}); ok {
-			toolsMap := make(map[string]interface{}, len(alwaysAllow))
-			for _, tool := range alwaysAllow {
-				if toolName, ok := tool.(string); ok {
-					toolsMap[toolName] = map[string]interface{}{
-						"approval_mode": "approve",
-					}
-				}
-			}
-			if len(toolsMap) > 0 {
-				server["tools"] = toolsMap
-			}
-			delete(server, "alwaysAllow")
-		}
+// TransformAndReport applies the same modifications as Transform and reports
+// the GitHub Authorization header it drops.
+func (t *CodexTransformer) TransformAndReport(servers map[string]interface{}) (Diagnostics, error) {
+	return encodeServers(servers, encodeCodex), nil
+}
 
-		headers, hasHeaders := server["headers"].(map[string]interface{})
-		if !hasHeaders {
-			continue
+// encodeCodex converts a single server to the Codex layout.
+func encodeCodex(s mcpserver.Server) (map[string]interface{}, []Diagnostic) {
+	var warnings []Diagnostic
+	allowed := s.Tools.AlwaysAllow
+	s.Tools.AlwaysAllow = nil
+	timeouts := s.Timeouts
+	s.Timeouts = mcpserver.Timeouts{}
+
+	// For the github server, convert an Authorization header into the
+	// Codex bearer_token_env_var field (unless one already exists).
+	if auth, hasAuth := s.Headers["Authorization"]; s.Name == "github" && hasAuth {
+		if !s.Has("bearer_token_env_var") {
+			s.Extra["bearer_token_env_var"] = "CODEX_GITHUB_PERSONAL_ACCESS_TOKEN"
 		}
+		if !isEmpty(auth) {
+			warnings = append(warnings, lossy("codex", s.Name, "headers.Authorization",
+				fmt.Sprintf("codex reads the token from the %v environment variable instead", s.Extra["bearer_token_env_var"])))
+		}
+		delete(s.Headers, "Authorization")
+	}
 
-		// For the github server, convert an Authorization header into the
-		// Codex bearer_token_env_var field (unless one already exists).
-		if name == "github" {
-			if _, hasEnv := server["bearer_token_env_var"]; !hasEnv {
-				if _, hasAuth := headers["Authorization"]; hasAuth {
-					server["bearer_token_env_var"] = "CODEX_GITHUB_PERSONAL_ACCESS_TOKEN"
-				}
+	server := s.Map()
+	if len(allowed) > 0 {
+		tools := make(map[string]interface{}, len(allowed))
+		for _, tool := range allowed {
+			tools[tool] = map[string]interface{}{
+				"approval_mode": "approve",
 			}
-			delete(headers, "Authorization")
 		}
+		server["tools"] = tools
+	}
 
-		// Rename headers → http_headers for all servers.
-		if len(headers) == 0 {
-			delete(server, "headers")
-		} else {
+	// Rename headers → http_headers for all servers.
+	if headers, ok := server["headers"].(map[string]interface{}); ok {
+		delete(server, "headers")
+		if len(headers) > 0 {
 			server["http_headers"] = headers
-			delete(server, "headers")
 		}
 	}
-	return nil
+
+	if timeouts.Startup != 0 {
+		server["startup_timeout_sec"] = mcpserver.Seconds(timeouts.Startup)
+	}
+	if timeouts.Tool != 0 {
+		server["tool_timeout_sec"] = mcpserver.Seconds(timeouts.Tool)
+	}
+	return server, warnings
 }
 
 // ClaudeTransformer applies minimal Claude-specific conversions. Currently it
@@ -227,20 +265,15 @@ type ClaudeTransformer struct{}
 
 // Transform applies Claude-specific normalizations.
 func (t *ClaudeTransformer) Transform(servers map[string]interface{}) error {
-	for _, serverRaw := range servers {
-		server, ok := serverRaw.(map[string]interface{})
-		if !ok {
-			continue
-		}
+	encodeServers(servers, encodeClaude)
+	return nil
+}
 
-		if typ, ok := server["type"].(string); ok {
-			switch strings.ToLower(strings.TrimSpace(typ)) {
-			case "streamable-http":
-				server["type"] = "http"
-			}
-		}
+func encodeClaude(s mcpserver.Server) (map[string]interface{}, []Diagnostic) {
+	if s.Transport == mcpserver.TransportStreamableHTTP {
+		s.Type = "http"
 	}
-	return nil
+	return s.Map(), nil
 }
 
 // GeminiTransformer removes fields that are not supported by Gemini's enhanced
@@ -250,22 +283,44 @@ func (t *ClaudeTransformer) Transform(servers map[string]interface{}) error {
 // with Gemini.
 type GeminiTransformer struct{}
 
+// geminiDroppedFields are the fields Gemini rejects and what is lost when
+// they are removed.
+var geminiDroppedFields = []droppedField{
+	{"alwaysAllow", "gemini has no list of pre-approved tools, so they will ask for approval"},
+	{"autoApprove", "gemini has no list of pre-approved tools, so they will ask for approval"},
+	{"disabled", "gemini cannot disable a server, so it will be started"},
+	{"gallery", "gemini has no gallery setting"},
+	{"type", "gemini chooses the transport from the other fields"},
+	{mcpserver.FieldStartupTimeout, "gemini has no startup timeout"},
+}
+
 // Transform removes unsupported fields from all server configurations.
 func (t *GeminiTransformer) Transform(servers map[string]interface{}) error {
-	for _, serverRaw := range servers {
-		server, ok := serverRaw.(map[string]interface{})
-		if !ok {
-			continue
-		}
+	_, err := t.TransformAndReport(servers)
+	return err
+}
 
-		// Remove fields that Gemini does not support
-		delete(server, "alwaysAllow")
-		delete(server, "autoApprove")
-		delete(server, "disabled")
-		delete(server, "gallery")
-		delete(server, "type")
+// TransformAndReport removes unsupported fields like Transform and reports
+// each one that held a value. A stdio type is removed silently since Gemini
+// starts command-based servers over stdio anyway. The tool timeout is written
+// as Gemini's timeout in milliseconds.
+func (t *GeminiTransformer) TransformAndReport(servers map[string]interface{}) (Diagnostics, error) {
+	return encodeServers(servers, encodeGemini), nil
+}
+
+func encodeGemini(s mcpserver.Server) (map[string]interface{}, []Diagnostic) {
+	if s.Transport == mcpserver.TransportStdio {
+		s.Remove(mcpserver.FieldType)
 	}
-	return nil
+	warnings := dropFields("gemini", &s, geminiDroppedFields)
+	timeout := s.Timeouts.Tool
+	s.Timeouts.Tool = 0
+
+	server := s.Map()
+	if timeout != 0 {
+		server["timeout"] = timeout.Milliseconds()
+	}
+	return server, warnings
 }
 
 // OpenCodeTransformer converts MCP server configurations to OpenCode's format.
@@ -275,61 +330,188 @@ func (t *GeminiTransformer) Transform(servers map[string]interface{}) error {
 // - "type" field with values: "local" (for stdio) or "remote" (for http)
 type OpenCodeTransformer struct{}
 
+// openCodeDroppedFields are the fields OpenCode does not use and what is lost
+// when they are removed.
+var openCodeDroppedFields = []droppedField{
+	{"alwaysAllow", "opencode has no list of pre-approved tools, so they will ask for approval"},
+	{"autoApprove", "opencode has no list of pre-approved tools, so they will ask for approval"},
+	{"disabled", "opencode will start the server"},
+	{"gallery", "opencode has no gallery setting"},
+	{"tools", "opencode enables every tool the server offers"},
+}
+
 // Transform applies OpenCode-specific conversions to all server configurations.
 func (t *OpenCodeTransformer) Transform(servers map[string]interface{}) error {
-	for _, serverRaw := range servers {
-		server, ok := serverRaw.(map[string]interface{})
-		if !ok {
-			continue
+	_, err := t.TransformAndReport(servers)
+	return err
+}
+
+// TransformAndReport applies the same conversions as Transform and reports
+// each dropped field that held a value.
+func (t *OpenCodeTransformer) TransformAndReport(servers map[string]interface{}) (Diagnostics, error) {
+	return encodeServers(servers, encodeOpenCode), nil
+}
+
+func encodeOpenCode(s mcpserver.Server) (map[string]interface{}, []Diagnostic) {
+	// Remove fields that OpenCode doesn't use
+	warnings := dropFields("opencode", &s, openCodeDroppedFields)
+
+	// OpenCode requires a type field for all servers: stdio becomes local and
+	// streamable-http/http become remote. When it is missing, a server with
+	// a url is remote and anything else, including edge cases without a
+	// command, is local.
+	switch {
+	case s.Transport == mcpserver.TransportStdio:
+		s.Type = "local"
+	case s.Transport == mcpserver.TransportStreamableHTTP:
+		s.Type = "remote"
+	case !s.Has(mcpserver.FieldType) && s.Has(mcpserver.FieldURL):
+		s.Type = "remote"
+	case !s.Has(mcpserver.FieldType):
+		s.Type = "local"
+	}
+
+	server := s.Map()
+
+	// Convert command + args to command array
+	if s.Command != "" {
+		command := []interface{}{s.Command}
+		for _, arg := range s.Args {
+			command = append(command, arg)
+		}
+		// Args that are not a list of strings cannot join the command array.
+		if args, ok := s.Extra[mcpserver.FieldArgs]; ok && !isEmpty(args) {
+			warnings = append(warnings, lossy("opencode", s.Name, mcpserver.FieldArgs, "OpenCode commands only hold string arguments"))
 		}
+		server["command"] = command
+		delete(server, "args")
+	}
 
-		// Convert command + args to command array
-		if cmd, hasCmd := server["command"].(string); hasCmd {
-			var cmdArray []interface{}
-			cmdArray = append(cmdArray, cmd)
+	// Rename "env" to "environment"
+	if env, hasEnv := server["env"]; hasEnv {
+		server["environment"] = env
+		delete(server, "env")
+	}
+	return server, warnings
+}
 
-			if args, hasArgs := server["args"].([]interface{}); hasArgs {
-				cmdArray = append(cmdArray, args...)
-				delete(server, "args")
-			}
+// droppedField is a field an agent cannot represent and what the user loses
+// when it is removed.
+type droppedField struct {
+	name string
+	loss string
+}
 
-			server["command"] = cmdArray
+// dropFields removes fields from s and returns a lossy-conversion warning
+// for each one that held a value.
+func dropFields(agent string, s *mcpserver.Server, fields []droppedField) []Diagnostic {
+	var warnings []Diagnostic
+	for _, field := range fields {
+		if value, ok := s.Remove(field.name); ok && !isEmpty(value) {
+			warnings = append(warnings, lossy(agent, s.Name, field.name, field.loss))
 		}
+	}
+	return warnings
+}
+
+// lossy returns the warning for a field that was dropped from a server.
+func lossy(agent, server, field, loss string) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityWarning,
+		Kind:     KindLossy,
+		Agent:    agent,
+		Server:   server,
+		Field:    field,
+		Message:  "dropped; " + loss,
+	}
+}
 
-		// Rename "env" to "environment"
-		if env, hasEnv := server["env"]; hasEnv {
-			server["environment"] = env
-			delete(server, "env")
+// isEmpty reports whether dropping value loses nothing: it is unset, false,
+// or an empty string, list, or map.
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// FieldRules declares the conversions applied to every server for a custom
+// agent defined in the target config. Rules run in a fixed order: Drop and
+// TypeMap operate on the neutral field names, Rename then moves fields to
+// their agent-specific names, and Defaults fills in agent-specific fields that
+// are still missing. When several TypeMap or Rename entries match the same
+// value or target field, the entry whose key sorts first wins.
+type FieldRules struct {
+	// Rename maps neutral field names to the names the agent expects.
+	Rename map[string]string
+	// Drop lists neutral fields the agent does not understand.
+	Drop []string
+	// Defaults sets fields that are missing after renaming.
+	Defaults map[string]interface{}
+	// TypeMap rewrites values of the "type" field (for example
+	// streamable-http -> http). Matching is case-insensitive.
+	TypeMap map[string]string
+}
+
+// RuleTransformer applies declarative FieldRules to every server.
+type RuleTransformer struct {
+	Rules FieldRules
+}
+
+// Transform applies the configured rules to all server configurations.
+func (t *RuleTransformer) Transform(servers map[string]interface{}) error {
+	for _, serverRaw := range servers {
+		server, ok := serverRaw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, field := range t.Rules.Drop {
+			delete(server, field)
 		}
 
-		// Add or normalize type field
-		// OpenCode requires a type field for all servers
 		if typ, ok := server["type"].(string); ok {
-			// Normalize existing type field: stdio -> local, streamable-http/http -> remote
 			normalized := strings.ToLower(strings.TrimSpace(typ))
-			switch normalized {
-			case "stdio":
-				server["type"] = "local"
-			case "streamable-http", "http":
-				server["type"] = "remote"
+			for _, from := range sortedKeys(t.Rules.TypeMap) {
+				if strings.ToLower(strings.TrimSpace(from)) == normalized {
+					server["type"] = t.Rules.TypeMap[from]
+					break
+				}
 			}
-		} else {
-			// Add type field when missing based on server configuration
-			// If server has a url, it's a remote server; otherwise it's local (command-based)
-			if _, hasURL := server["url"]; hasURL {
-				server["type"] = "remote"
-			} else {
-				// Default to local for command-based servers and edge cases
-				server["type"] = "local"
+		}
+
+		// Collect renamed values first so chained renames (a->b, b->c) do not
+		// cascade within a single pass.
+		renamed := make(map[string]interface{}, len(t.Rules.Rename))
+		for _, from := range sortedKeys(t.Rules.Rename) {
+			to := t.Rules.Rename[from]
+			if value, ok := server[from]; ok && from != to {
+				if _, taken := renamed[to]; !taken {
+					renamed[to] = value
+				}
+				delete(server, from)
 			}
 		}
+		for key, value := range renamed {
+			server[key] = value
+		}
 
-		// Remove fields that OpenCode doesn't use
-		delete(server, "alwaysAllow")
-		delete(server, "autoApprove")
-		delete(server, "disabled")
-		delete(server, "gallery")
-		delete(server, "tools")
+		for key, value := range t.Rules.Defaults {
+			if _, exists := server[key]; !exists {
+				server[key] = value
+			}
+		}
 	}
 	return nil
 }
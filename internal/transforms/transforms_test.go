@@ -1,6 +1,8 @@
 package transforms
 
 import (
+	"errors"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -909,3 +911,283 @@ func TestOpenCodeTransformer_AddsTypeForEdgeCases(t *testing.T) {
 		t.Errorf("empty server should default to type 'local', got %v", emptyServer["type"])
 	}
 }
+
+func TestRuleTransformer_AppliesRulesInOrder(t *testing.T) {
+	servers := map[string]interface{}{
+		"remote": map[string]interface{}{
+			"type":        "streamable-http",
+			"url":         "https://example.test",
+			"alwaysAllow": []interface{}{"search"},
+		},
+		"local": map[string]interface{}{
+			"command": "npx",
+			"env":     map[string]interface{}{"KEY": "value"},
+		},
+	}
+
+	tr := &RuleTransformer{Rules: FieldRules{
+		Rename:   map[string]string{"env": "environment", "type": "transport"},
+		Drop:     []string{"alwaysAllow"},
+		Defaults: map[string]interface{}{"transport": "stdio", "enabled": true},
+		TypeMap:  map[string]string{"Streamable-HTTP": "http"},
+	}}
+	if err := tr.Transform(servers); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	remote := servers["remote"].(map[string]interface{})
+	if remote["transport"] != "http" {
+		t.Fatalf("expected type mapped and renamed to transport=http, got %v", remote)
+	}
+	if _, ok := remote["type"]; ok {
+		t.Fatalf("type should have been renamed, got %v", remote)
+	}
+	if _, ok := remote["alwaysAllow"]; ok {
+		t.Fatalf("alwaysAllow should have been dropped, got %v", remote)
+	}
+	if remote["enabled"] != true {
+		t.Fatalf("expected enabled default, got %v", remote)
+	}
+
+	local := servers["local"].(map[string]interface{})
+	if _, ok := local["environment"].(map[string]interface{}); !ok {
+		t.Fatalf("expected env renamed to environment, got %v", local)
+	}
+	if local["transport"] != "stdio" {
+		t.Fatalf("expected transport default for local server, got %v", local)
+	}
+}
+
+func TestRuleTransformer_RenamesDoNotCascade(t *testing.T) {
+	servers := map[string]interface{}{
+		"srv": map[string]interface{}{"a": 1, "b": 2},
+	}
+	tr := &RuleTransformer{Rules: FieldRules{
+		Rename: map[string]string{"a": "b", "b": "c"},
+	}}
+	if err := tr.Transform(servers); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv := servers["srv"].(map[string]interface{})
+	if srv["b"] != 1 || srv["c"] != 2 {
+		t.Fatalf("unexpected rename result: %v", srv)
+	}
+	if _, ok := srv["a"]; ok {
+		t.Fatalf("a should have been renamed: %v", srv)
+	}
+}
+
+func TestRuleTransformer_ConflictingRulesAreStable(t *testing.T) {
+	tr := &RuleTransformer{Rules: FieldRules{
+		Rename:  map[string]string{"env": "environment", "envVars": "environment"},
+		TypeMap: map[string]string{"SSE": "remote", "sse": "event-stream"},
+	}}
+	for i := 0; i < 20; i++ {
+		servers := map[string]interface{}{
+			"srv": map[string]interface{}{"type": "sse", "env": "first", "envVars": "second"},
+		}
+		if err := tr.Transform(servers); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		srv := servers["srv"].(map[string]interface{})
+		if srv["type"] != "remote" || srv["environment"] != "first" {
+			t.Fatalf("expected the first rule in key order to win, got %v", srv)
+		}
+		if _, ok := srv["envVars"]; ok {
+			t.Fatalf("envVars should have been renamed: %v", srv)
+		}
+	}
+}
+
+func TestCopilotTransformer_ReportsEveryInvalidServer(t *testing.T) {
+	transformer := &CopilotTransformer{}
+	servers := map[string]interface{}{
+		"b-remote": map[string]interface{}{"url": "https://example.test"},
+		"a-remote": map[string]interface{}{"type": "sse"},
+		"fs":       map[string]interface{}{"command": "npx"},
+	}
+
+	err := transformer.Transform(servers)
+	var diags Diagnostics
+	if !errors.As(err, &diags) || !diags.HasErrors() {
+		t.Fatalf("expected diagnostics, got %v", err)
+	}
+	if len(diags) != 2 {
+		t.Fatalf("expected one diagnostic per invalid server, got %+v", diags)
+	}
+	if diags[0].Server != "a-remote" || diags[0].Field != "url" || diags[1].Server != "b-remote" || diags[1].Field != "type" {
+		t.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+	if diags[0].Agent != "copilot" || diags[0].Severity != SeverityError {
+		t.Fatalf("unexpected diagnostic: %+v", diags[0])
+	}
+	if _, ok := servers["fs"].(map[string]interface{})["tools"]; !ok {
+		t.Fatal("expected valid servers to be transformed too")
+	}
+}
+
+func TestGeminiTransformer_ReportsLossyFields(t *testing.T) {
+	transformer := &GeminiTransformer{}
+	servers := map[string]interface{}{
+		"remote": map[string]interface{}{
+			"type":        "streamable-http",
+			"url":         "https://example.test/mcp",
+			"alwaysAllow": []interface{}{"search"},
+			"disabled":    false,
+		},
+		"fs": map[string]interface{}{
+			"type":     "stdio",
+			"command":  "npx",
+			"disabled": true,
+			"gallery":  "",
+		},
+	}
+
+	warnings, err := transformer.TransformAndReport(servers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, w := range warnings {
+		if w.Severity != SeverityWarning || w.Kind != KindLossy || w.Agent != "gemini" {
+			t.Fatalf("unexpected warning: %+v", w)
+		}
+		got = append(got, w.Server+"."+w.Field)
+	}
+	want := []string{"fs.disabled", "remote.alwaysAllow", "remote.type"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected warnings for %v, got %v", want, got)
+	}
+	for name, server := range servers {
+		for _, field := range []string{"type", "alwaysAllow", "disabled", "gallery"} {
+			if _, ok := server.(map[string]interface{})[field]; ok {
+				t.Fatalf("expected %s to be removed from %s", field, name)
+			}
+		}
+	}
+}
+
+func TestOpenCodeTransformer_ReportsLossyFields(t *testing.T) {
+	servers := map[string]interface{}{
+		"fs": map[string]interface{}{
+			"command":     "npx",
+			"tools":       []interface{}{"read"},
+			"autoApprove": []interface{}{},
+			"disabled":    true,
+		},
+	}
+
+	warnings, err := TransformAndReport(GetTransformer("opencode"), servers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 2 || warnings[0].Field != "disabled" || warnings[1].Field != "tools" {
+		t.Fatalf("expected warnings for disabled and tools, got %+v", warnings)
+	}
+	if servers["fs"].(map[string]interface{})["type"] != "local" {
+		t.Fatalf("expected the server to be converted, got %v", servers["fs"])
+	}
+}
+
+func TestOpenCodeTransformer_ReportsNonStringArgs(t *testing.T) {
+	servers := map[string]interface{}{
+		"fs": map[string]interface{}{
+			"command": "npx",
+			"args":    []interface{}{"serve", map[string]interface{}{"port": 8080}},
+		},
+	}
+
+	warnings, err := TransformAndReport(GetTransformer("opencode"), servers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Field != "args" || warnings[0].Kind != KindLossy {
+		t.Fatalf("expected a lossy warning for args, got %+v", warnings)
+	}
+	fs := servers["fs"].(map[string]interface{})
+	if _, ok := fs["args"]; ok {
+		t.Fatalf("args should not be written, got %v", fs)
+	}
+	if command, ok := fs["command"].([]interface{}); !ok || len(command) != 1 || command[0] != "npx" {
+		t.Fatalf("expected the command array to hold only the command, got %v", fs["command"])
+	}
+}
+
+func TestCodexTransformer_ReportsDroppedGithubAuthorization(t *testing.T) {
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{
+			"url":     "https://api.example.test/mcp",
+			"headers": map[string]interface{}{"Authorization": "Bearer token", "X-Trace": "1"},
+		},
+		"other": map[string]interface{}{
+			"url":     "https://other.example.test/mcp",
+			"headers": map[string]interface{}{"Authorization": "Bearer token"},
+		},
+	}
+
+	warnings, err := (&CodexTransformer{}).TransformAndReport(servers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Server != "github" || warnings[0].Field != "headers.Authorization" || warnings[0].Kind != KindLossy {
+		t.Fatalf("expected one warning for the github Authorization header, got %+v", warnings)
+	}
+	if !strings.Contains(warnings[0].Message, "CODEX_GITHUB_PERSONAL_ACCESS_TOKEN") {
+		t.Fatalf("expected the warning to name the token variable, got %q", warnings[0].Message)
+	}
+}
+
+func TestTransformAndReport_RunsPlainTransformers(t *testing.T) {
+	servers := map[string]interface{}{
+		"srv": map[string]interface{}{"drop": true},
+	}
+	tr := &RuleTransformer{Rules: FieldRules{Drop: []string{"drop"}}}
+	warnings, err := TransformAndReport(tr, servers)
+	if err != nil || warnings != nil {
+		t.Fatalf("expected no warnings or error, got %v, %v", warnings, err)
+	}
+	if _, ok := servers["srv"].(map[string]interface{})["drop"]; ok {
+		t.Fatal("expected the transformer to run")
+	}
+}
+
+func TestCodexTransformer_WritesTimeouts(t *testing.T) {
+	servers := map[string]interface{}{
+		"fs": map[string]interface{}{
+			"command":           "npx",
+			"startupTimeoutSec": 20,
+			"toolTimeoutSec":    2.5,
+		},
+	}
+	if err := (&CodexTransformer{}).Transform(servers); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs := servers["fs"].(map[string]interface{})
+	if fs["startup_timeout_sec"] != 20 || fs["tool_timeout_sec"] != 2.5 {
+		t.Fatalf("expected Codex timeout fields, got %v", fs)
+	}
+	if _, ok := fs["startupTimeoutSec"]; ok {
+		t.Fatalf("neutral timeout fields should be renamed, got %v", fs)
+	}
+}
+
+func TestGeminiTransformer_WritesToolTimeoutInMilliseconds(t *testing.T) {
+	servers := map[string]interface{}{
+		"fs": map[string]interface{}{
+			"command":           "npx",
+			"startupTimeoutSec": 20,
+			"toolTimeoutSec":    30,
+		},
+	}
+	warnings, err := (&GeminiTransformer{}).TransformAndReport(servers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs := servers["fs"].(map[string]interface{})
+	if fs["timeout"] != int64(30000) {
+		t.Fatalf("expected timeout in milliseconds, got %v", fs)
+	}
+	if len(warnings) != 1 || warnings[0].Field != "startupTimeoutSec" {
+		t.Fatalf("expected the startup timeout to be reported as dropped, got %+v", warnings)
+	}
+}